@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"snippets.adelh.dev/app/internal/admin"
+	"snippets.adelh.dev/app/internal/audit"
+	"snippets.adelh.dev/app/internal/blob"
+	"snippets.adelh.dev/app/internal/cache"
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db"
+	"snippets.adelh.dev/app/internal/encryption"
+	"snippets.adelh.dev/app/internal/requestlog"
+)
+
+// adminCmd is the environment of the maintenance subcommands: the store,
+// encryption keys, cache and audit log the configuration describes, as the
+// server would use them. What they do is audited as done by the local user.
+type adminCmd struct {
+	ctx   context.Context
+	svc   *admin.Service
+	audit *audit.Log
+	args  []string
+
+	stop  context.CancelFunc
+	store db.Store
+	cache *cache.RedisCache
+}
+
+// storeAccess is what a subcommand does with the store.
+type storeAccess int
+
+const (
+	// readOnly subcommands run against a schema that is behind, they are
+	// what an operator reaches for before migrating.
+	readOnly storeAccess = iota
+	// readWrite subcommands need the current schema, and migrate it with
+	// DB_AUTO_MIGRATE.
+	readWrite
+)
+
+// newAdminCmd parses the flags of the subcommand run by fs, which takes
+// between minArgs and maxArgs arguments as described by usage, and opens
+// what it works on.
+func newAdminCmd(fs *flag.FlagSet, args []string, minArgs, maxArgs int, usage string, access storeAccess) (*adminCmd, error) {
+	flags := config.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: snippets %s\n\nflags:\n", usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() < minArgs || fs.NArg() > maxArgs {
+		return nil, fmt.Errorf("usage: snippets %s\n\nsee snippets %s -h for the flags", usage, fs.Name())
+	}
+
+	c, err := config.Load(flags)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(newLogger(c.Log, c.Log.Level))
+
+	enc, err := encryption.NewService(c.Enc.SystemKey, c.Enc.PreviousKeys...)
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	store, err := openStore(ctx, c, access)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	auditLog, err := audit.New(store, c.Audit.Key)
+	if err != nil {
+		stop()
+		store.Close()
+		return nil, err
+	}
+	redisCache := cache.NewRedisCache(c.Redis)
+	purger := db.NewPurger(store, c.Retention.RestoreWindow, c.Retention.PurgeInterval)
+
+	return &adminCmd{
+		ctx:   audit.WithActor(ctx, cliActor()),
+		svc:   admin.New(store, enc, redisCache, purger, auditLog),
+		audit: auditLog,
+		args:  fs.Args(),
+		stop:  stop,
+		store: store,
+		cache: redisCache,
+	}, nil
+}
+
+// cliActor is the audit log actor of the subcommands, the user running them.
+func cliActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+func (a *adminCmd) close() {
+	a.stop()
+	if err := a.store.Close(); err != nil {
+		slog.Error("failed to close store", "error", err)
+	}
+	if err := a.cache.Close(); err != nil {
+		slog.Error("failed to close cache", "error", err)
+	}
+}
+
+// openStore opens the store described by c, with tracing and blob storage
+// when configured. For readWrite access it creates the schema if it is
+// missing and fails if it isn't current, for readOnly access an outdated
+// schema is only reported, the schema is only read.
+func openStore(ctx context.Context, c *config.Config, access storeAccess) (db.Store, error) {
+	if access == readWrite {
+		if err := db.EnsureSchema(c.DB); err != nil {
+			return nil, err
+		}
+	}
+	store, err := db.NewStore(c.DB)
+	if err != nil {
+		return nil, err
+	}
+	if access == readOnly {
+		if err := db.CheckSchema(ctx, store); err != nil {
+			slog.Warn("reading a database whose schema isn't current, results may be incomplete", "error", err)
+		}
+	}
+	store = db.WithTracing(store)
+
+	blobs, err := blob.New(c.Blob)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if blobs != nil {
+		store = db.WithBlobStorage(store, blobs, c.Blob.Threshold)
+	}
+	return store, nil
+}
+
+// newAdminServer returns the server of the admin API, on a listener of its
+// own. Requests are authenticated by h, with the bearer token or a client
+// certificate verified against c.ClientCAFile here.
+func newAdminServer(c config.AdminConfig, h *admin.Handler, conns *connTracker) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:      fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Handler:   requestlog.Middleware(h, requestlog.Options{Route: h.Route}),
+		ConnState: conns.track,
+	}
+	if c.TLSCertFile == "" {
+		return srv, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the admin TLS certificate: %w", err)
+	}
+	srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCAFile != "" {
+		data, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the admin client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", c.ClientCAFile)
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if c.Token != "" {
+			// clients may authenticate with the token instead
+			srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return srv, nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// runInspect prints the metadata of a snippet, never its content.
+func runInspect(args []string) error {
+	a, err := newAdminCmd(flag.NewFlagSet("inspect", flag.ContinueOnError), args, 1, 1, "inspect [flags] <public-id-or-slug>", readOnly)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	snippet, err := a.svc.Inspect(a.ctx, a.args[0])
+	if err != nil {
+		return err
+	}
+	return printJSON(snippet)
+}
+
+// runDelete deletes a snippet, as a tombstone unless -hard is given.
+func runDelete(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	hard := fs.Bool("hard", false, "delete the snippet for good instead of keeping a restorable tombstone")
+	a, err := newAdminCmd(fs, args, 1, 1, "delete [-hard] [flags] <public-id-or-slug>", readWrite)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	if err := a.svc.Delete(a.ctx, a.args[0], *hard); err != nil {
+		return err
+	}
+	slog.Info("snippet deleted", "snippet", a.args[0], "hard", *hard)
+	return nil
+}
+
+// runPurgeExpired runs the purge job once rather than waiting for the
+// server to.
+func runPurgeExpired(args []string) error {
+	a, err := newAdminCmd(flag.NewFlagSet("purge-expired", flag.ContinueOnError), args, 0, 0, "purge-expired [flags]", readWrite)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	n, err := a.svc.PurgeExpired(a.ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]int64{"purged": n})
+}
+
+func runStats(args []string) error {
+	a, err := newAdminCmd(flag.NewFlagSet("stats", flag.ContinueOnError), args, 0, 0, "stats [flags]", readOnly)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	stats, err := a.svc.Stats(a.ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(stats)
+}
+
+// runReencrypt seals all content again under ENCRYPTION_KEY, content
+// sealed under one of ENCRYPTION_PREVIOUS_KEYS included. Once it succeeds
+// the previous keys can be removed.
+func runReencrypt(args []string) error {
+	a, err := newAdminCmd(flag.NewFlagSet("reencrypt", flag.ContinueOnError), args, 0, 0, "reencrypt [flags]", readWrite)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	res, err := a.svc.Reencrypt(a.ctx)
+	if err != nil {
+		return fmt.Errorf("%w (%d snippets and %d shared bodies re-encrypted, run it again to finish)", err, res.Snippets, res.Bodies)
+	}
+	return printJSON(res)
+}
+
+// runExport writes every snippet to stdout, or to the file given with -o,
+// as JSON lines. See admin.Service.Export.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fs.String("o", "", "write the export to this file rather than to stdout")
+	a, err := newAdminCmd(fs, args, 0, 0, "export [-o file] [flags]", readWrite)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	if *output == "" {
+		n, err := a.svc.Export(a.ctx, os.Stdout)
+		if err != nil {
+			return err
+		}
+		slog.Info("snippets exported", "count", n)
+		return nil
+	}
+
+	// exports hold password hashes and edit tokens
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	n, err := a.svc.Export(a.ctx, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("snippets exported", "count", n)
+	return nil
+}
+
+// runImport creates the snippets of an export read from a file, or from
+// stdin without one.
+func runImport(args []string) error {
+	a, err := newAdminCmd(flag.NewFlagSet("import", flag.ContinueOnError), args, 0, 1, "import [flags] [file]", readWrite)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	var r io.Reader = os.Stdin
+	if len(a.args) > 0 {
+		f, err := os.Open(a.args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	res, err := a.svc.Import(a.ctx, r)
+	if err != nil {
+		return fmt.Errorf("%w (%d snippets imported before the error)", err, res.Imported)
+	}
+	return printJSON(res)
+}
+
+// runVerifyAudit checks the audit log chain and prints the report, with the
+// head to pass as -anchor to a later run. It fails if the chain is broken.
+func runVerifyAudit(args []string) error {
+	fs := flag.NewFlagSet("verify-audit", flag.ContinueOnError)
+	anchor := fs.String("anchor", "", "`seq:hash` of a head printed by an earlier run, the log must still hold it")
+	a, err := newAdminCmd(fs, args, 0, 0, "verify-audit [-anchor seq:hash] [flags]", readOnly)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	var head audit.Head
+	if *anchor != "" {
+		seq, hash, ok := strings.Cut(*anchor, ":")
+		n, err := strconv.ParseInt(seq, 10, 64)
+		if !ok || err != nil || n <= 0 || hash == "" {
+			return fmt.Errorf("invalid -anchor %q: must be seq:hash", *anchor)
+		}
+		head = audit.Head{Seq: n, Hash: hash}
+	}
+
+	report, err := a.audit.Verify(a.ctx, head)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if !report.OK() {
+		return fmt.Errorf("audit log verification failed, %d problems found", len(report.Problems))
+	}
+	return nil
+}
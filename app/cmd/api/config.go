@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"snippets.adelh.dev/app/internal/config"
+)
+
+const configUsage = `usage: snippets config print [flags]
+
+commands:
+  print   show the effective configuration, with secrets redacted
+
+see snippets config print -h for the flags`
+
+// runConfig implements the config subcommand.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	flags := config.RegisterFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q\n\n%s", fs.Arg(0), configUsage)
+	}
+
+	c, err := config.Load(flags)
+	if err != nil {
+		return err
+	}
+	return c.Print(os.Stdout)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"snippets.adelh.dev/app/internal/cache"
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db"
+	"snippets.adelh.dev/app/internal/encryption"
+	"snippets.adelh.dev/app/internal/health"
+)
+
+// schemaCheckInterval is how often the schema version is read.
+const schemaCheckInterval = time.Minute
+
+// newHealthChecker returns the readiness checks of the dependencies of the
+// API.
+func newHealthChecker(c *config.Config, store db.Store, redisCache *cache.RedisCache, encryptionSvc *encryption.Service) *health.Checker {
+	required := func(name string) bool {
+		return slices.Contains(c.Health.Required, name)
+	}
+
+	checks := []health.Check{
+		{Name: "primary", Required: true, Run: health.Ping(store.Ping)},
+		{
+			Name:     "schema",
+			Required: true,
+			Every:    schemaCheckInterval,
+			Run: health.Ping(func(ctx context.Context) error {
+				return db.CheckSchema(ctx, store)
+			}),
+		},
+		{Name: "encryption", Required: true, Run: checkEncryption(encryptionSvc)},
+		{Name: config.HealthRedis, Required: required(config.HealthRedis), Run: checkRedis(redisCache)},
+	}
+	// registered without replicas too, a reload can add them
+	if r, ok := store.(db.ReplicaReporter); ok {
+		checks = append(checks, health.Check{
+			Name:     config.HealthReplicas,
+			Required: required(config.HealthReplicas),
+			Run:      checkReplicas(r),
+		})
+	}
+	return health.NewChecker(c.Health.CheckTimeout, checks...)
+}
+
+// checkEncryption checks that the system key is loaded and works.
+func checkEncryption(s *encryption.Service) func(context.Context) health.Result {
+	probe := []byte("readiness")
+	return func(context.Context) health.Result {
+		if s == nil {
+			return health.Failing(errors.New("no encryption key loaded"))
+		}
+		sealed, err := s.Encrypt(probe)
+		if err != nil {
+			return health.Failing(err)
+		}
+		opened, err := s.Decrypt(sealed)
+		if err != nil {
+			return health.Failing(err)
+		}
+		if !bytes.Equal(opened, probe) {
+			return health.Failing(errors.New("encryption round trip changed the content"))
+		}
+		return health.OK(nil)
+	}
+}
+
+func checkRedis(c *cache.RedisCache) func(context.Context) health.Result {
+	return func(ctx context.Context) health.Result {
+		if !c.Enabled() {
+			return health.OK("disabled")
+		}
+		if err := c.Ping(ctx); err != nil {
+			return health.Failing(err)
+		}
+		return health.OK(nil)
+	}
+}
+
+// checkReplicas reports the replicas as the store last probed them. Reads
+// fall back to the primary, so some of them lagging only degrades it, and
+// none being configured is fine.
+func checkReplicas(r db.ReplicaReporter) func(context.Context) health.Result {
+	return func(context.Context) health.Result {
+		statuses := r.ReplicaStatus()
+		if len(statuses) == 0 {
+			return health.OK("none configured")
+		}
+		healthy := 0
+		for _, st := range statuses {
+			if st.Healthy {
+				healthy++
+			}
+		}
+		switch healthy {
+		case len(statuses):
+			return health.OK(statuses)
+		case 0:
+			res := health.Failing(errors.New("no healthy replica, reads go to the primary"))
+			res.Detail = statuses
+			return res
+		default:
+			return health.Degraded(fmt.Errorf("%d of %d replicas unhealthy", len(statuses)-healthy, len(statuses)), statuses)
+		}
+	}
+}
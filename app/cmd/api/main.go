@@ -1,48 +1,273 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+	"snippets.adelh.dev/app/internal/admin"
 	"snippets.adelh.dev/app/internal/api"
+	"snippets.adelh.dev/app/internal/audit"
 	"snippets.adelh.dev/app/internal/cache"
 	"snippets.adelh.dev/app/internal/config"
 	"snippets.adelh.dev/app/internal/db"
 	"snippets.adelh.dev/app/internal/encryption"
+	"snippets.adelh.dev/app/internal/metrics"
+	"snippets.adelh.dev/app/internal/requestlog"
+	"snippets.adelh.dev/app/internal/tracing"
 )
 
 func main() {
-	c, err := config.Load()
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "migrate":
+			run = runMigrate
+		case "config":
+			run = runConfig
+		case "inspect":
+			run = runInspect
+		case "delete":
+			run = runDelete
+		case "purge-expired":
+			run = runPurgeExpired
+		case "stats":
+			run = runStats
+		case "reencrypt":
+			run = runReencrypt
+		case "export":
+			run = runExport
+		case "import":
+			run = runImport
+		case "verify-audit":
+			run = runVerifyAudit
+		case "serve":
+			// the default command, named for symmetry with the others
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	flags := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if flag.NArg() > 0 {
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
+
+	c, err := config.Load(flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	live := config.NewLive(c)
+	slog.SetDefault(newLogger(c.Log, live))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), c.Tracing)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	encryptionSvc, err := encryption.NewService(c.Enc.SystemKey)
+	encryptionSvc, err := encryption.NewService(c.Enc.SystemKey, c.Enc.PreviousKeys...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	store, err := db.NewPostgresStore(c.DB)
+	store, err := openStore(context.Background(), c, readWrite)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	purger := db.NewPurger(store, c.Retention.RestoreWindow, c.Retention.PurgeInterval)
+	purger.Follow(live)
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		purger.Run(workersCtx)
+	}()
+
+	auditLog, err := audit.New(store, c.Audit.Key)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := []api.Option{
+		api.WithAuditLog(auditLog),
+		api.WithPublicIDFormat(c.PublicID),
+		api.WithLive(live),
+	}
+	if c.Enc.DedupKey != "" {
+		hasher, err := encryption.NewContentHasher(c.Enc.DedupKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, api.WithDeduplication(hasher))
+	}
+
 	redisCache := cache.NewRedisCache(c.Redis)
-	service := api.New(store, encryptionSvc, redisCache)
+	redisCache.Follow(live)
+	service := api.New(store, encryptionSvc, redisCache, opts...)
+
+	checker := newHealthChecker(c, store, redisCache, encryptionSvc)
+
+	var adminHandler *admin.Handler
+	var adminSrv *http.Server
+	adminConns := newConnTracker()
+	if c.Admin.Port != 0 {
+		adminHandler = admin.NewHandler(workersCtx, admin.New(store, encryptionSvc, redisCache, purger, auditLog), admin.HandlerOptions{
+			Token:     c.Admin.Token,
+			Live:      live,
+			Readiness: checker.ReadyDetail,
+			Metrics:   metrics.Handler(),
+		})
+		adminSrv, err = newAdminServer(c.Admin, adminHandler, adminConns)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	reloads := &reloader{
+		flags:   flags,
+		started: c,
+		live:    live,
+		store:   store,
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		reloads.run(workersCtx, hup, c.Reload.Interval)
+	}()
 
 	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", checker.Live)
+	mux.HandleFunc("GET /readyz", checker.Ready)
+	if c.Server.PublicMetrics {
+		mux.Handle("GET /metrics", metrics.Handler())
+	} else if c.Admin.Port == 0 {
+		slog.Warn("metrics are not served, set ADMIN_PORT or SERVER_PUBLIC_METRICS")
+	}
+
+	if r, ok := store.(db.DBStatsReporter); ok {
+		if err := metrics.RegisterDBStats(r.DBStats); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	handler := api.HandlerFromMux(service, mux)
+	apiHandler := api.HandlerFromMux(service, mux)
+	// the mux only records the route on the request it serves, the
+	// middlewares wrapping it look it up beforehand
+	route := func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+	handler := tracing.Middleware(requestlog.Middleware(audit.Middleware(metrics.InstrumentHandler(apiHandler)), requestlog.Options{
+		Route: route,
+		Quiet: []string{"GET /healthz", "GET /readyz", "GET /metrics"},
+	}), route)
 
 	addr := fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
 
-	srv := http.Server{
-		Handler: handler,
-		Addr:    addr,
+	conns := newConnTracker()
+	srv := &http.Server{
+		Handler:   handler,
+		Addr:      addr,
+		ConnState: conns.track,
 	}
 
-	fmt.Println("Server starting on ", addr)
-	log.Fatal(srv.ListenAndServe())
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("server starting", "addr", addr)
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	if adminSrv != nil {
+		slog.Info("admin API starting", "addr", adminSrv.Addr, "tls", adminSrv.TLSConfig != nil)
+		go func() {
+			if adminSrv.TLSConfig != nil {
+				serveErr <- adminSrv.ListenAndServeTLS("", "")
+			} else {
+				serveErr <- adminSrv.ListenAndServe()
+			}
+		}()
+	}
+
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server failed", "error", err)
+			exitCode = 1
+		}
+		srv.Close()
+		if adminSrv != nil {
+			adminSrv.Close()
+		}
+	case <-ctx.Done():
+		// a second signal kills the process right away
+		stop()
+		slog.Info("shutdown signal received")
+		checker.SetShuttingDown()
+		if c.Server.ShutdownDelay > 0 {
+			slog.Info("reporting not ready before draining", "delay", c.Server.ShutdownDelay)
+			time.Sleep(c.Server.ShutdownDelay)
+		}
+		slog.Info("draining servers", "timeout", c.Server.ShutdownTimeout)
+		shutdownAll(c.Server.ShutdownTimeout, map[string]drainable{
+			"api":   {srv: srv, conns: conns},
+			"admin": {srv: adminSrv, conns: adminConns},
+		})
+	}
+
+	stopWorkers()
+	workers.Wait()
+	if adminHandler != nil {
+		adminHandler.Wait()
+	}
+	slog.Info("background workers stopped")
+
+	if err := store.Close(); err != nil {
+		slog.Error("failed to close store", "error", err)
+		exitCode = 1
+	}
+	if err := redisCache.Close(); err != nil {
+		slog.Error("failed to close cache", "error", err)
+		exitCode = 1
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	cancel()
+	slog.Info("shutdown complete")
+	os.Exit(exitCode)
+}
+
+// newLogger returns the logger writing the records of the server to stderr,
+// at the level of level so that it can be changed on reload.
+func newLogger(c config.LogConfig, level slog.Leveler) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if c.Format == config.LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db"
+)
+
+const migrateUsage = `usage: snippets migrate [flags] <command>
+
+commands:
+  up          apply all pending migrations
+  down N      roll back the last N migrations
+  down -all   roll back every migration
+  status      show the applied and the latest available version
+  force V     mark version V as applied and clear the dirty flag
+
+see snippets migrate -h for the flags`
+
+// runMigrate implements the migrate subcommand. It only needs the database
+// configuration.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags := config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	cfg, err := config.LoadDBConfig(flags)
+	if err != nil {
+		return fmt.Errorf("database config: %w", err)
+	}
+	m, err := db.NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch cmd, rest := args[0], args[1:]; cmd {
+	case "up":
+		if err := m.Up(); err != nil {
+			return err
+		}
+		return printStatus(m)
+
+	case "down":
+		if len(rest) != 1 {
+			return errors.New("migrate down needs a number of steps or -all")
+		}
+		steps := 0
+		if rest[0] != "-all" {
+			steps, err = strconv.Atoi(rest[0])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps %q", rest[0])
+			}
+		}
+		if err := m.Down(steps); err != nil {
+			return err
+		}
+		return printStatus(m)
+
+	case "status":
+		return printStatus(m)
+
+	case "force":
+		if len(rest) != 1 {
+			return errors.New("migrate force needs a version")
+		}
+		version, err := strconv.Atoi(rest[0])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", rest[0])
+		}
+		if err := m.Force(version); err != nil {
+			return err
+		}
+		return printStatus(m)
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", cmd, migrateUsage)
+	}
+}
+
+func printStatus(m *db.Migrator) error {
+	st, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	dirty := ""
+	if st.Dirty {
+		dirty = " (dirty)"
+	}
+	fmt.Printf("version: %d%s\nlatest:  %d\n", st.Current, dirty, st.Latest)
+	if len(st.Pending) > 0 {
+		fmt.Printf("pending: %v\n", st.Pending)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db"
+)
+
+// reloader applies the settings that can change while the server runs,
+// see config.Config.Changes. A configuration that fails validation is
+// rejected as a whole and the running one is kept. The replicas are
+// swapped by the store, the other settings are read from live by the
+// components using them and take effect together once the configuration
+// is put in effect.
+type reloader struct {
+	flags *config.Flags
+	// started is the configuration the server started with, settings that
+	// differ from it and can't be reloaded are reported until a restart.
+	started *config.Config
+
+	live  *config.Live
+	store db.Store
+
+	mu sync.Mutex
+}
+
+// reload loads the configuration again and applies what changed.
+func (r *reloader) reload(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := config.Load(r.flags)
+	if err != nil {
+		return fmt.Errorf("invalid configuration, keeping the current one: %w", err)
+	}
+	if _, restart := r.started.Changes(next); len(restart) > 0 {
+		slog.Warn("configuration changes need a restart to take effect", "settings", restart)
+	}
+	live, _ := r.live.Load().Changes(next)
+	if len(live) == 0 {
+		slog.Info("configuration reloaded, nothing to apply")
+		return nil
+	}
+
+	// replicas go first, they are the only change that can fail
+	if slices.Contains(live, "DB_REPLICA_DSN") {
+		u, ok := r.store.(db.ReplicaUpdater)
+		if !ok {
+			return fmt.Errorf("failed to update replicas, keeping the current configuration: %w", db.ErrReplicasUnsupported)
+		}
+		if err := u.SetReplicas(ctx, next.DB.ReplicaDSNs); err != nil {
+			return fmt.Errorf("failed to update replicas, keeping the current configuration: %w", err)
+		}
+	}
+	r.live.Store(next)
+	slog.Info("configuration reloaded", "applied", live)
+	return nil
+}
+
+// run reloads on every signal received on hup, and when the content of the
+// config file changes if interval isn't zero, until ctx is done.
+func (r *reloader) run(ctx context.Context, hup <-chan os.Signal, interval time.Duration) {
+	var tick <-chan time.Time
+	if r.started.File != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	last, _ := os.ReadFile(r.started.File)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			// read before reloading so that the next tick doesn't reload
+			// the same content again, and still sees a later change
+			last, _ = os.ReadFile(r.started.File)
+			slog.Info("reloading configuration on SIGHUP")
+		case <-tick:
+			// ConfigMap updates swap symlinks, the file is compared by
+			// content rather than by modification time
+			data, err := os.ReadFile(r.started.File)
+			if err != nil || bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			slog.Info("reloading configuration, the config file changed", "file", r.started.File)
+		}
+		if err := r.reload(ctx); err != nil {
+			slog.Error("configuration reload failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// connTracker keeps the state of the server's connections, so shutdown can
+// tell which requests it cut off.
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[net.Conn]http.ConnState
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: map[net.Conn]http.ConnState{}}
+}
+
+// track is meant for http.Server.ConnState.
+func (t *connTracker) track(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		delete(t.conns, c)
+	default:
+		t.conns[c] = state
+	}
+}
+
+// active returns the remote addresses of the connections serving a request.
+func (t *connTracker) active() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var addrs []string
+	for c, state := range t.conns {
+		if state == http.StateActive {
+			addrs = append(addrs, c.RemoteAddr().String())
+		}
+	}
+	return addrs
+}
+
+// drainable is a server with the tracker of its connections.
+type drainable struct {
+	srv   *http.Server
+	conns *connTracker
+}
+
+// shutdownAll drains the servers at the same time within a single timeout,
+// see shutdown. Nil servers are skipped.
+func shutdownAll(timeout time.Duration, servers map[string]drainable) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for name, s := range servers {
+		if s.srv == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shutdown(ctx, name, s.srv, s.conns)
+		}()
+	}
+	wg.Wait()
+}
+
+// shutdown stops srv from accepting connections and waits until ctx is done
+// for the in-flight requests to complete, the connections still serving one
+// then are closed.
+func shutdown(ctx context.Context, name string, srv *http.Server, conns *connTracker) {
+	slog.Info("draining in-flight requests", "server", name, "active", len(conns.active()))
+
+	err := srv.Shutdown(ctx)
+	if err == nil {
+		slog.Info("all requests completed", "server", name)
+		return
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		slog.Error("failed to shut down server", "server", name, "error", err)
+	}
+
+	active := conns.active()
+	slog.Warn("shutdown deadline exceeded, cutting off in-flight requests",
+		"server", name, "count", len(active), "remotes", active)
+	if err := srv.Close(); err != nil {
+		slog.Error("failed to close server", "error", err)
+	}
+}
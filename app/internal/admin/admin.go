@@ -0,0 +1,364 @@
+// Package admin implements the maintenance tasks of the snippets service:
+// inspecting and deleting snippets, purging, statistics, re-encryption
+// under a new system key, export and import. They go through the same
+// db.Store and encryption.Service as the API, so operators never need to
+// touch the database directly.
+//
+// Only Content returns decrypted content, for break-glass access through
+// the admin API. Everything else leaves content sealed.
+//
+// Every change, and every read of decrypted content, is recorded in the
+// audit log under the actor of the context, see audit.WithActor.
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"snippets.adelh.dev/app/internal/audit"
+	"snippets.adelh.dev/app/internal/cache"
+	"snippets.adelh.dev/app/internal/db"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+	"snippets.adelh.dev/app/internal/encryption"
+	"snippets.adelh.dev/app/internal/sealer"
+)
+
+// ErrNotFound is returned for a public ID or slug no snippet has.
+var ErrNotFound = errors.New("snippet not found")
+
+// maxOpenSize bounds content opened in memory. Content is only held whole
+// to re-seal it, the bound guards against corrupt rows rather than users.
+const maxOpenSize = 1 << 30
+
+// pageSize is how many rows the tasks walking every snippet read at once.
+const pageSize = 100
+
+type Service struct {
+	store   db.Store
+	content *sealer.Sealer
+	// blobs holds content outside the database, nil if the store doesn't.
+	blobs  db.ContentStore
+	cache  *cache.RedisCache
+	purger *db.Purger
+	audit  *audit.Log
+	// keyID identifies the system key in the audit log of key rotations.
+	keyID  string
+	logger *slog.Logger
+}
+
+// New returns a Service working on store. Snippets it changes are dropped
+// from redisCache, the purger is the one PurgeExpired runs. What it does is
+// recorded in auditLog.
+func New(store db.Store, enc *encryption.Service, redisCache *cache.RedisCache, purger *db.Purger, auditLog *audit.Log) *Service {
+	s := &Service{
+		store:   store,
+		content: sealer.New(enc, maxOpenSize),
+		cache:   redisCache,
+		purger:  purger,
+		audit:   auditLog,
+		keyID:   enc.KeyID(),
+		logger:  slog.Default(),
+	}
+	if blobs, ok := store.(db.ContentStore); ok {
+		s.blobs = blobs
+	}
+	return s
+}
+
+// Snippet is the metadata of a snippet. It leaves out the content, the
+// password hash and the edit token.
+type Snippet struct {
+	ID           int32      `json:"id"`
+	PublicID     string     `json:"publicId"`
+	Slug         string     `json:"slug,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	ContentType  string     `json:"contentType"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	LastEditedAt *time.Time `json:"lastEditedAt,omitempty"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	ViewCount    int32      `json:"viewCount"`
+	Protected    bool       `json:"passwordProtected"`
+	// Storage is where the content is: "inline" in the row, "blob" in the
+	// blob store or "shared" with the snippets that have the same content.
+	Storage string `json:"storage"`
+	// StoredSize is the size of the sealed content kept in the database,
+	// zero for content stored elsewhere.
+	StoredSize int `json:"storedSize"`
+}
+
+func newSnippet(row sqlc.GetSnippetByPublicIDRow) Snippet {
+	s := Snippet{
+		ID:           row.ID,
+		PublicID:     row.PublicID,
+		Slug:         row.Slug.String,
+		Title:        row.Title.String,
+		ContentType:  row.ContentType,
+		CreatedAt:    row.CreatedAt,
+		ExpiresAt:    timePtr(row.ExpiresAt),
+		LastEditedAt: timePtr(row.LastEditedAt),
+		DeletedAt:    timePtr(row.DeletedAt),
+		ViewCount:    row.ViewCount,
+		Protected:    row.PasswordHash.Valid,
+		Storage:      "inline",
+		StoredSize:   len(row.EncryptedContent),
+	}
+	switch {
+	case row.ContentHash != nil:
+		s.Storage = "shared"
+	case row.BlobKey.Valid:
+		s.Storage = "blob"
+	}
+	return s
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// get reads a snippet by public ID or slug from the primary, tombstones
+// included.
+func (s *Service) get(ctx context.Context, name string) (sqlc.GetSnippetByPublicIDRow, error) {
+	row, err := s.store.Primary().GetSnippetByPublicID(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return row, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return row, fmt.Errorf("failed to retrieve snippet: %w", err)
+	}
+	return row, nil
+}
+
+// Inspect returns the metadata of the snippet with the given public ID or
+// slug, deleted and expired ones included.
+func (s *Service) Inspect(ctx context.Context, name string) (Snippet, error) {
+	row, err := s.get(ctx, name)
+	if err != nil {
+		return Snippet{}, err
+	}
+	return newSnippet(row), nil
+}
+
+// Delete deletes the snippet with the given public ID or slug. Unless hard
+// is set it is kept as a tombstone its owner can restore until it is
+// purged, like a delete through the API. Deleting a tombstone again without
+// hard fails with ErrNotFound.
+func (s *Service) Delete(ctx context.Context, name string, hard bool) error {
+	row, err := s.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = s.audited(ctx, audit.Event{Type: audit.AdminDelete, Snippet: row.PublicID, Details: map[string]bool{"hard": hard}}, func(q sqlc.Querier) error {
+		var n int64
+		var err error
+		if hard {
+			var blobKeys []sql.NullString
+			blobKeys, err = q.DeleteSnippetById(ctx, row.ID)
+			// one blob key, possibly NULL, per snippet deleted
+			n = int64(len(blobKeys))
+		} else {
+			n, err = q.SoftDeleteSnippet(ctx, row.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete snippet: %w", err)
+		}
+		// deleted since it was read, or already a tombstone
+		if n == 0 {
+			return fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate(ctx, row.PublicID, row.Slug)
+	return nil
+}
+
+// invalidate drops a snippet from the cache under every name it is read by.
+func (s *Service) invalidate(ctx context.Context, publicID string, slug sql.NullString) {
+	s.cache.Delete(ctx, cache.SnippetKey(publicID))
+	if slug.Valid {
+		s.cache.Delete(ctx, cache.SnippetKey(slug.String))
+	}
+}
+
+// audited makes change and appends e to the audit log in the same
+// transaction, the change is only committed once it is recorded.
+func (s *Service) audited(ctx context.Context, e audit.Event, change func(q sqlc.Querier) error) error {
+	return s.store.WithTx(ctx, func(q sqlc.Querier) error {
+		if err := change(q); err != nil {
+			return err
+		}
+		return s.audit.Append(ctx, q, e)
+	})
+}
+
+// PurgeExpired runs the purge job once: expired snippets and tombstones
+// past the restore window are removed for good. It returns how many
+// snippets were removed. The purge commits in batches, it is recorded once
+// it ends and fails if it can't be.
+func (s *Service) PurgeExpired(ctx context.Context) (int64, error) {
+	n, err := s.purger.PurgeOnce(ctx)
+	if n > 0 || err == nil {
+		rerr := s.audit.Record(ctx, audit.Event{Type: audit.AdminPurgeExpired, Details: map[string]int64{"purged": n}})
+		err = errors.Join(err, rerr)
+	}
+	return n, err
+}
+
+// Summary is the metadata of a snippet in a listing.
+type Summary struct {
+	ID        int32      `json:"id"`
+	PublicID  string     `json:"publicId"`
+	Slug      string     `json:"slug,omitempty"`
+	Title     string     `json:"title,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// List returns up to limit snippets, newest first. Without a query these are
+// the live snippets, with one the snippets whose public ID or slug is the
+// query or whose title contains it, deleted ones included.
+func (s *Service) List(ctx context.Context, query string, limit int32) ([]Summary, error) {
+	items := []Summary{}
+	if query == "" {
+		rows, err := s.store.Primary().ListRecentSnippets(ctx, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list snippets: %w", err)
+		}
+		for _, row := range rows {
+			items = append(items, Summary{
+				ID:        row.ID,
+				PublicID:  row.PublicID,
+				Slug:      row.Slug.String,
+				Title:     row.Title.String,
+				CreatedAt: row.CreatedAt,
+				ExpiresAt: timePtr(row.ExpiresAt),
+			})
+		}
+		return items, nil
+	}
+
+	rows, err := s.store.Primary().SearchSnippets(ctx, sqlc.SearchSnippetsParams{Query: query, MaxRows: limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search snippets: %w", err)
+	}
+	for _, row := range rows {
+		items = append(items, Summary{
+			ID:        row.ID,
+			PublicID:  row.PublicID,
+			Slug:      row.Slug.String,
+			Title:     row.Title.String,
+			CreatedAt: row.CreatedAt,
+			ExpiresAt: timePtr(row.ExpiresAt),
+			DeletedAt: timePtr(row.DeletedAt),
+		})
+	}
+	return items, nil
+}
+
+// Expire makes the snippet with the given public ID or slug expire now, it
+// is then purged like any expired snippet. Deleted snippets and snippets
+// that already expired are left alone.
+func (s *Service) Expire(ctx context.Context, name string) error {
+	row, err := s.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = s.audited(ctx, audit.Event{Type: audit.AdminExpire, Snippet: row.PublicID}, func(q sqlc.Querier) error {
+		if _, err := q.ExpireSnippet(ctx, row.ID); err != nil {
+			return fmt.Errorf("failed to expire snippet: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate(ctx, row.PublicID, row.Slug)
+	return nil
+}
+
+// FlushCache drops the snippet with the given public ID or slug from the
+// cache. A name no snippet has any more is dropped as is. The flush is
+// recorded first, and refused if it can't be.
+func (s *Service) FlushCache(ctx context.Context, name string) error {
+	row, err := s.get(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		if err := s.audit.Record(ctx, audit.Event{Type: audit.AdminCacheFlush, Details: map[string]string{"name": name}}); err != nil {
+			return err
+		}
+		s.cache.Delete(ctx, cache.SnippetKey(name))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.audit.Record(ctx, audit.Event{Type: audit.AdminCacheFlush, Snippet: row.PublicID}); err != nil {
+		return err
+	}
+	s.invalidate(ctx, row.PublicID, row.Slug)
+	return nil
+}
+
+// Content streams the decrypted content of the snippet with the given
+// public ID or slug, along with its metadata. It is the break-glass access
+// of the admin API: the read is recorded in the audit log with the reason
+// given for it first, and refused if it can't be.
+func (s *Service) Content(ctx context.Context, name, reason string) (Snippet, io.ReadCloser, error) {
+	row, err := s.get(ctx, name)
+	if err != nil {
+		return Snippet{}, nil, err
+	}
+	err = s.audit.Record(ctx, audit.Event{Type: audit.AdminContentRead, Snippet: row.PublicID, Details: map[string]string{"reason": reason}})
+	if err != nil {
+		return Snippet{}, nil, err
+	}
+	r, err := s.open(ctx, row.EncryptedContent, row.BlobKey, row.ContentHash)
+	if err != nil {
+		return Snippet{}, nil, err
+	}
+	return newSnippet(row), r, nil
+}
+
+// Stats counts the snippets by state.
+type Stats struct {
+	Total int64 `json:"total"`
+	// Active snippets are neither deleted nor expired.
+	Active    int64 `json:"active"`
+	Deleted   int64 `json:"deleted"`
+	Expired   int64 `json:"expired"`
+	Protected int64 `json:"passwordProtected"`
+	Views     int64 `json:"views"`
+	// InBlobs is the number of snippets with content in the blob store.
+	InBlobs int64 `json:"inBlobs"`
+	// SharedBodies is the number of bodies stored once for the snippets
+	// with the same content.
+	SharedBodies int64 `json:"sharedBodies"`
+}
+
+func (s *Service) Stats(ctx context.Context) (Stats, error) {
+	row, err := s.store.Primary().GetSnippetStats(ctx)
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to count snippets: %w", err)
+	}
+	return Stats{
+		Total:        row.Total,
+		Active:       row.Total - row.Deleted - row.Expired,
+		Deleted:      row.Deleted,
+		Expired:      row.Expired,
+		Protected:    row.Protected,
+		Views:        row.Views,
+		InBlobs:      row.Blobs,
+		SharedBodies: row.Bodies,
+	}, nil
+}
@@ -0,0 +1,260 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"snippets.adelh.dev/app/internal/audit"
+	"snippets.adelh.dev/app/internal/blob"
+	"snippets.adelh.dev/app/internal/cache"
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+	"snippets.adelh.dev/app/internal/encryption"
+)
+
+var (
+	oldKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	newKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	// auditKey chains the entries of the audit log.
+	auditKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 32))
+)
+
+// newStore returns a store keeping content over 64 bytes in a blob store.
+func newStore(t *testing.T) db.Store {
+	t.Helper()
+	blobs, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db.WithBlobStorage(db.NewMemoryStore(), blobs, 64)
+}
+
+// newService returns a Service sealing under the first key.
+func newService(t *testing.T, store db.Store, keys ...string) *Service {
+	t.Helper()
+	enc, err := encryption.NewService(keys[0], keys[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog, err := audit.New(store, auditKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(store, enc, cache.NewRedisCache(config.RedisConfig{Enabled: false}), nil, auditLog)
+}
+
+// auditEvents returns the audit log as "<event> <actor> <snippet>" lines.
+func auditEvents(t *testing.T, s *Service) []string {
+	t.Helper()
+	rows, err := s.store.Primary().ListAuditEntries(context.Background(), sqlc.ListAuditEntriesParams{MaxRows: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for _, row := range rows {
+		events = append(events, strings.TrimSpace(row.Event+" "+row.Actor+" "+row.Snippet.String))
+	}
+	return events
+}
+
+// create stores a snippet, sharing its content through a body if shared.
+func create(t *testing.T, s *Service, publicID, content string, shared bool) {
+	t.Helper()
+	ctx := context.Background()
+	q := s.store.Primary()
+	arg := sqlc.CreateSnippetParams{PublicID: publicID, EditToken: "token-" + publicID, ContentType: "text/plain"}
+	if shared {
+		hash := []byte("hash-" + content)
+		sealed, err := s.content.SealShared([]byte(content), hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := q.CreateSnippetBody(ctx, sqlc.CreateSnippetBodyParams{ContentHash: hash, EncryptedContent: sealed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		arg.EncryptedContent, arg.BodyID = []byte{}, sql.NullInt32{Int32: body.ID, Valid: true}
+	} else {
+		sealed, err := s.content.Seal([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		arg.EncryptedContent = sealed
+	}
+	if _, err := q.CreateSnippet(ctx, arg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read returns the content of a snippet, opened by s.
+func read(t *testing.T, s *Service, publicID string) string {
+	t.Helper()
+	ctx := context.Background()
+	row, err := s.store.Primary().GetSnippetByPublicID(ctx, publicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.open(ctx, row.EncryptedContent, row.BlobKey, row.ContentHash)
+	if err != nil {
+		t.Fatalf("%s: %v", publicID, err)
+	}
+	defer r.Close()
+	content, err := readAll(r)
+	if err != nil {
+		t.Fatalf("%s: %v", publicID, err)
+	}
+	return string(content)
+}
+
+func testSnippets() map[string]string {
+	return map[string]string{
+		"aaa-aaaa-aaa": "inline",
+		"bbb-bbbb-bbb": strings.Repeat("stored in a blob ", 20),
+		"ccc-cccc-ccc": "shared",
+	}
+}
+
+func TestService_Reencrypt(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	old := newService(t, store, oldKey)
+	snippets := testSnippets()
+	for publicID, content := range snippets {
+		create(t, old, publicID, content, publicID == "ccc-cccc-ccc")
+	}
+
+	rotated := newService(t, store, newKey, oldKey)
+	res, err := rotated.Reencrypt(audit.WithActor(ctx, "cli:ops"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Snippets != 2 || res.Bodies != 1 {
+		t.Errorf("Reencrypt = %+v, want 2 snippets and 1 body", res)
+	}
+	if events := auditEvents(t, rotated); !slices.Equal(events, []string{audit.KeyRotation + " cli:ops"}) {
+		t.Errorf("audit log = %q, want the key rotation", events)
+	}
+	if info, _ := rotated.Inspect(ctx, "bbb-bbbb-bbb"); info.Storage != "blob" {
+		t.Errorf("storage after re-encryption = %q, want blob", info.Storage)
+	}
+
+	// the old key is no longer needed
+	current := newService(t, store, newKey)
+	for publicID, content := range snippets {
+		if got := read(t, current, publicID); got != content {
+			t.Errorf("%s = %q, want %q", publicID, got, content)
+		}
+	}
+
+	// running again is harmless
+	if _, err := current.Reencrypt(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, current, "aaa-aaaa-aaa"); got != "inline" {
+		t.Errorf("content after a second run = %q", got)
+	}
+}
+
+func TestService_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := newService(t, newStore(t), oldKey)
+	snippets := testSnippets()
+	for publicID, content := range snippets {
+		create(t, src, publicID, content, publicID == "ccc-cccc-ccc")
+	}
+	if err := src.Delete(ctx, "aaa-aaaa-aaa", false); err != nil {
+		t.Fatal(err)
+	}
+
+	var export bytes.Buffer
+	n, err := src.Export(ctx, &export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(snippets) {
+		t.Errorf("exported %d snippets, want %d", n, len(snippets))
+	}
+	if strings.Contains(export.String(), "inline") {
+		t.Error("export holds plaintext content")
+	}
+
+	dst := newService(t, newStore(t), newKey, oldKey)
+	res, err := dst.Import(ctx, bytes.NewReader(export.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Imported != len(snippets) || res.Skipped != 0 {
+		t.Errorf("Import = %+v", res)
+	}
+	for publicID, content := range snippets {
+		if got := read(t, dst, publicID); got != content {
+			t.Errorf("%s = %q, want %q", publicID, got, content)
+		}
+	}
+	if info, _ := dst.Inspect(ctx, "aaa-aaaa-aaa"); info.DeletedAt == nil {
+		t.Error("the tombstone was imported as a live snippet")
+	}
+
+	res, err = dst.Import(ctx, bytes.NewReader(export.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Imported != 0 || res.Skipped != len(snippets) {
+		t.Errorf("second Import = %+v, want every snippet skipped", res)
+	}
+
+	// content sealed under an unknown key is refused
+	if _, err := newService(t, newStore(t), newKey).Import(ctx, bytes.NewReader(export.Bytes())); err == nil {
+		t.Error("content sealed under an unknown key was imported")
+	}
+}
+
+func TestService_InspectDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newService(t, newStore(t), newKey)
+	create(t, s, "aaa-aaaa-aaa", "content", false)
+
+	info, err := s.Inspect(ctx, "aaa-aaaa-aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Storage != "inline" || info.DeletedAt != nil || info.StoredSize == 0 {
+		t.Errorf("Inspect = %+v", info)
+	}
+
+	if err := s.Delete(ctx, "aaa-aaaa-aaa", false); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := s.Inspect(ctx, "aaa-aaaa-aaa"); info.DeletedAt == nil {
+		t.Error("a soft delete left no tombstone")
+	}
+	if err := s.Delete(ctx, "aaa-aaaa-aaa", false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of a tombstone = %v, want ErrNotFound", err)
+	}
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 1 || stats.Deleted != 1 || stats.Active != 0 {
+		t.Errorf("Stats = %+v", stats)
+	}
+
+	if err := s.Delete(ctx, "aaa-aaaa-aaa", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Inspect(ctx, "aaa-aaaa-aaa"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Inspect after a hard delete = %v, want ErrNotFound", err)
+	}
+
+	want := []string{audit.AdminDelete + " anonymous aaa-aaaa-aaa", audit.AdminDelete + " anonymous aaa-aaaa-aaa"}
+	if events := auditEvents(t, s); !slices.Equal(events, want) {
+		t.Errorf("audit log = %q, want %q", events, want)
+	}
+}
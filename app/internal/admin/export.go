@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"snippets.adelh.dev/app/internal/audit"
+	"snippets.adelh.dev/app/internal/db"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+// exportedSnippet is a line of an export. Unlike Snippet it holds what is
+// needed to restore the snippet: the sealed content, the password hash and
+// the edit token.
+type exportedSnippet struct {
+	PublicID     string     `json:"publicId"`
+	Slug         string     `json:"slug,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	ContentType  string     `json:"contentType"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	LastEditedAt *time.Time `json:"lastEditedAt,omitempty"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	ViewCount    int32      `json:"viewCount"`
+	PasswordHash string     `json:"passwordHash,omitempty"`
+	EditToken    string     `json:"editToken"`
+	// Content is sealed under the system key of the exporting instance.
+	Content []byte `json:"content"`
+}
+
+// Export writes every snippet, tombstones included, to w as JSON lines and
+// returns how many it wrote. The content is sealed again under the current
+// system key on its own, shared and blob content is exported like inline
+// content: an import needs that key, as the current or a previous key, but
+// neither the dedup key nor the blob store.
+//
+// Exports hold password hashes and edit tokens, they must be kept like a
+// backup of the database. The export is recorded in the audit log before
+// anything is written, and refused if it can't be.
+func (s *Service) Export(ctx context.Context, w io.Writer) (int, error) {
+	if err := s.audit.Record(ctx, audit.Event{Type: audit.AdminExport}); err != nil {
+		return 0, err
+	}
+	return s.export(ctx, w)
+}
+
+func (s *Service) export(ctx context.Context, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	n := 0
+	for after := int32(0); ; {
+		rows, err := s.store.Primary().ListSnippets(ctx, sqlc.ListSnippetsParams{AfterID: after, MaxRows: pageSize})
+		if err != nil {
+			return n, fmt.Errorf("failed to list snippets: %w", err)
+		}
+		if len(rows) == 0 {
+			return n, nil
+		}
+		for _, row := range rows {
+			after = row.ID
+			e, err := s.exportSnippet(ctx, row)
+			if err != nil {
+				return n, fmt.Errorf("failed to export snippet %s: %w", row.PublicID, err)
+			}
+			if err := enc.Encode(e); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+}
+
+func (s *Service) exportSnippet(ctx context.Context, row sqlc.ListSnippetsRow) (exportedSnippet, error) {
+	r, err := s.open(ctx, row.EncryptedContent, row.BlobKey, row.ContentHash)
+	if err != nil {
+		return exportedSnippet{}, err
+	}
+	defer r.Close()
+	content, err := s.sealStream(r)
+	if err != nil {
+		return exportedSnippet{}, err
+	}
+
+	return exportedSnippet{
+		PublicID:     row.PublicID,
+		Slug:         row.Slug.String,
+		Title:        row.Title.String,
+		ContentType:  row.ContentType,
+		CreatedAt:    row.CreatedAt,
+		ExpiresAt:    timePtr(row.ExpiresAt),
+		LastEditedAt: timePtr(row.LastEditedAt),
+		DeletedAt:    timePtr(row.DeletedAt),
+		ViewCount:    row.ViewCount,
+		PasswordHash: row.PasswordHash.String,
+		EditToken:    row.EditToken,
+		Content:      content,
+	}, nil
+}
+
+// ImportResult counts the snippets Import created, and those it skipped
+// because their public ID or slug is taken.
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+// Import creates the snippets of an export read from r. The content must be
+// sealed under the current or a previous system key, it is sealed again
+// under the current one. Snippets whose public ID or slug is taken are
+// skipped, importing the same export twice is harmless. Imported content
+// isn't deduplicated. Every snippet imported is recorded in the audit log.
+func (s *Service) Import(ctx context.Context, r io.Reader) (ImportResult, error) {
+	var res ImportResult
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var e exportedSnippet
+		if err := dec.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) {
+				return res, nil
+			}
+			return res, fmt.Errorf("invalid snippet %d: %w", line, err)
+		}
+		if e.PublicID == "" || e.ContentType == "" || e.EditToken == "" || e.CreatedAt.IsZero() {
+			return res, fmt.Errorf("invalid snippet %d: publicId, contentType, editToken and createdAt are required", line)
+		}
+
+		params, err := s.importParams(e)
+		if err != nil {
+			return res, fmt.Errorf("failed to import snippet %s: %w", e.PublicID, err)
+		}
+		err = s.audited(ctx, audit.Event{Type: audit.AdminImport, Snippet: e.PublicID}, func(q sqlc.Querier) error {
+			_, err := q.ImportSnippet(ctx, params)
+			return err
+		})
+		if db.IsUniqueViolation(err) {
+			s.logger.Warn("snippet not imported, its public ID or slug is taken", "public_id", e.PublicID, "slug", e.Slug)
+			res.Skipped++
+			continue
+		}
+		if err != nil {
+			return res, fmt.Errorf("failed to import snippet %s: %w", e.PublicID, err)
+		}
+		res.Imported++
+	}
+}
+
+// importParams returns the row of an exported snippet, its content sealed
+// under the current system key.
+func (s *Service) importParams(e exportedSnippet) (sqlc.ImportSnippetParams, error) {
+	r, err := s.content.OpenStream(bytes.NewReader(e.Content), nil)
+	if err != nil {
+		return sqlc.ImportSnippetParams{}, fmt.Errorf("failed to decrypt content: %w", err)
+	}
+	defer r.Close()
+	content, err := readAll(r)
+	if err != nil {
+		return sqlc.ImportSnippetParams{}, err
+	}
+	// sealed like content created through the API, the store moves it to
+	// the blob store past the threshold
+	sealed, err := s.content.Seal(content)
+	if err != nil {
+		return sqlc.ImportSnippetParams{}, fmt.Errorf("failed to encrypt content: %w", err)
+	}
+
+	return sqlc.ImportSnippetParams{
+		PublicID:         e.PublicID,
+		Slug:             nullString(e.Slug),
+		Title:            nullString(e.Title),
+		ContentType:      e.ContentType,
+		EncryptedContent: sealed,
+		CreatedAt:        e.CreatedAt,
+		ExpiresAt:        nullTime(e.ExpiresAt),
+		LastEditedAt:     nullTime(e.LastEditedAt),
+		DeletedAt:        nullTime(e.DeletedAt),
+		ViewCount:        e.ViewCount,
+		PasswordHash:     nullString(e.PasswordHash),
+		EditToken:        e.EditToken,
+	}, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
@@ -0,0 +1,297 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"snippets.adelh.dev/app/internal/audit"
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/requestlog"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+// BreakGlassHeader carries the reason for reading decrypted content, it is
+// recorded with the access.
+const BreakGlassHeader = "X-Break-Glass-Reason"
+
+// HandlerOptions configures Handler.
+type HandlerOptions struct {
+	// Token authenticates requests that carry it as a bearer token. Without
+	// one, requests can only authenticate with a verified client certificate.
+	Token string
+	// BreakGlass allows reading decrypted content.
+	BreakGlass bool
+	// Live overrides BreakGlass if set: reading content is allowed by the
+	// break-glass setting of the configuration in effect.
+	Live *config.Live
+	// Readiness serves the detailed readiness report, with the errors the
+	// public one leaves out. Not served if nil.
+	Readiness http.HandlerFunc
+	// Metrics serves the Prometheus metrics. Not served if nil.
+	Metrics http.Handler
+}
+
+// Handler serves the admin API:
+//
+//	GET    /admin/snippets?q=&limit=        list or search snippets
+//	GET    /admin/snippets/{name}           metadata of a snippet
+//	GET    /admin/snippets/{name}/content   decrypted content, break-glass only
+//	POST   /admin/snippets/{name}/expire    make a snippet expire now
+//	DELETE /admin/snippets/{name}[?hard=1]  delete a snippet
+//	DELETE /admin/cache/snippets/{name}     drop a snippet from the cache
+//	GET    /admin/stats                     snippet counts
+//	GET    /admin/jobs                      runs of the maintenance jobs
+//	POST   /admin/jobs/{job}                start purge-expired or reencrypt
+//	GET    /admin/readyz                    detailed readiness report
+//	GET    /admin/metrics                   Prometheus metrics
+//
+// Snippets are named by public ID or slug. Every request must present the
+// token or a client certificate verified by the server's TLS configuration.
+type Handler struct {
+	svc        *Service
+	token      []byte
+	breakGlass bool
+	live       *config.Live
+	jobs       *jobs
+	mux        *http.ServeMux
+}
+
+// NewHandler returns the admin API over svc. Maintenance jobs it starts run
+// until they finish or ctx is done.
+func NewHandler(ctx context.Context, svc *Service, opts HandlerOptions) *Handler {
+	h := &Handler{
+		svc:        svc,
+		token:      []byte(opts.Token),
+		breakGlass: opts.BreakGlass,
+		live:       opts.Live,
+		jobs:       newJobs(ctx, svc),
+		mux:        http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("GET /admin/snippets", h.list)
+	h.mux.HandleFunc("GET /admin/snippets/{name}", h.inspect)
+	h.mux.HandleFunc("GET /admin/snippets/{name}/content", h.content)
+	h.mux.HandleFunc("POST /admin/snippets/{name}/expire", h.expire)
+	h.mux.HandleFunc("DELETE /admin/snippets/{name}", h.delete)
+	h.mux.HandleFunc("DELETE /admin/cache/snippets/{name}", h.flushCache)
+	h.mux.HandleFunc("GET /admin/stats", h.stats)
+	h.mux.HandleFunc("GET /admin/jobs", h.listJobs)
+	h.mux.HandleFunc("POST /admin/jobs/{job}", h.startJob)
+	if opts.Readiness != nil {
+		h.mux.HandleFunc("GET /admin/readyz", opts.Readiness)
+	}
+	if opts.Metrics != nil {
+		h.mux.Handle("GET /admin/metrics", opts.Metrics)
+	}
+	return h
+}
+
+// breakGlassAllowed reports whether decrypted content can be read.
+func (h *Handler) breakGlassAllowed() bool {
+	if h.live != nil {
+		return h.live.Load().Admin.BreakGlass
+	}
+	return h.breakGlass
+}
+
+// Route returns the route pattern matching r, for request logging.
+func (h *Handler) Route(r *http.Request) string {
+	_, pattern := h.mux.Handler(r)
+	return pattern
+}
+
+// Wait waits for the running maintenance jobs to finish.
+func (h *Handler) Wait() {
+	h.jobs.wg.Wait()
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actor, ok := h.authenticate(r)
+	if !ok {
+		requestlog.FromContext(r.Context()).Warn("admin request rejected, not authenticated", "remote_addr", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, r, http.StatusUnauthorized, "a bearer token or a client certificate is required")
+		return
+	}
+	ctx := audit.WithRequest(audit.WithActor(r.Context(), actor), r)
+	h.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// authenticate returns who sent r: the subject of its verified client
+// certificate, or "token" for the bearer token.
+func (h *Handler) authenticate(r *http.Request) (string, bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName, true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || len(h.token) == 0 || subtle.ConstantTimeCompare([]byte(token), h.token) != 1 {
+		return "", false
+	}
+	return "token", true
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	limit := defaultListLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxListLimit {
+			writeError(w, r, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxListLimit))
+			return
+		}
+		limit = n
+	}
+	items, err := h.svc.List(r.Context(), r.URL.Query().Get("q"), int32(limit))
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, items)
+}
+
+func (h *Handler) inspect(w http.ResponseWriter, r *http.Request) {
+	snippet, err := h.svc.Inspect(r.Context(), r.PathValue("name"))
+	if err != nil {
+		serviceError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, snippet)
+}
+
+// content is the break-glass access to decrypted content. The reason given
+// in BreakGlassHeader is audited along with who read which snippet.
+func (h *Handler) content(w http.ResponseWriter, r *http.Request) {
+	if !h.breakGlassAllowed() {
+		writeError(w, r, http.StatusForbidden, "break-glass access to content is disabled")
+		return
+	}
+	reason := strings.TrimSpace(r.Header.Get(BreakGlassHeader))
+	if reason == "" {
+		writeError(w, r, http.StatusBadRequest, "the "+BreakGlassHeader+" header is required")
+		return
+	}
+
+	snippet, content, err := h.svc.Content(r.Context(), r.PathValue("name"), reason)
+	if err != nil {
+		serviceError(w, r, err)
+		return
+	}
+	defer content.Close()
+	requestlog.FromContext(r.Context()).Warn("break-glass content access",
+		"snippet", snippet.PublicID, "actor", audit.Actor(r.Context()), "reason", reason, "remote_addr", r.RemoteAddr)
+
+	// the content is never rendered by the browser on the admin origin
+	w.Header().Set("Content-Type", snippet.ContentType)
+	w.Header().Set("Content-Disposition", "attachment")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := io.Copy(w, content); err != nil {
+		requestlog.FromContext(r.Context()).Error("failed to write content", "error", err)
+	}
+}
+
+func (h *Handler) expire(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := h.svc.Expire(r.Context(), name); err != nil {
+		serviceError(w, r, err)
+		return
+	}
+	h.inspect(w, r)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	hard := false
+	if raw := r.URL.Query().Get("hard"); raw != "" {
+		var err error
+		if hard, err = strconv.ParseBool(raw); err != nil {
+			writeError(w, r, http.StatusBadRequest, "hard must be a boolean")
+			return
+		}
+	}
+	if err := h.svc.Delete(r.Context(), r.PathValue("name"), hard); err != nil {
+		serviceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) flushCache(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.FlushCache(r.Context(), r.PathValue("name")); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.svc.Stats(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, stats)
+}
+
+func (h *Handler) listJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, h.jobs.runs())
+}
+
+func (h *Handler) startJob(w http.ResponseWriter, r *http.Request) {
+	run, err := h.jobs.start(r.PathValue("job"), audit.Actor(r.Context()))
+	switch {
+	case errors.Is(err, errUnknownJob):
+		writeError(w, r, http.StatusNotFound, "unknown job, must be "+JobPurgeExpired+" or "+JobReencrypt)
+	case errors.Is(err, errJobRunning):
+		writeError(w, r, http.StatusConflict, "the job is already running")
+	default:
+		writeJSON(w, r, http.StatusAccepted, run)
+	}
+}
+
+type errorResponse struct {
+	Status    int    `json:"status"`
+	Error     string `json:"error"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		requestlog.FromContext(r.Context()).Error("failed to write JSON response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeJSON(w, r, status, errorResponse{
+		Status:    status,
+		Error:     http.StatusText(status),
+		Message:   message,
+		RequestID: requestlog.RequestID(r.Context()),
+	})
+}
+
+// serviceError writes the response for an error of the Service methods
+// looking up a snippet.
+func serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "snippet not found")
+		return
+	}
+	serverError(w, r, err)
+}
+
+func serverError(w http.ResponseWriter, r *http.Request, err error) {
+	requestlog.FromContext(r.Context()).Error("admin request failed", "error", err)
+	writeError(w, r, http.StatusInternalServerError, "the request failed, see the server logs")
+}
@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"snippets.adelh.dev/app/internal/audit"
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+const testToken = "0123456789abcdef0123456789abcdef"
+
+func newTestHandler(t *testing.T, opts HandlerOptions) *Handler {
+	t.Helper()
+	s := newService(t, newStore(t), newKey)
+	create(t, s, "aaa-aaaa-aaa", "first", false)
+	create(t, s, "bbb-bbbb-bbb", "second", false)
+	opts.Token = testToken
+	return NewHandler(context.Background(), s, opts)
+}
+
+func serve(h http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+testToken)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Authentication(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{})
+
+	for _, auth := range []string{"none", "Bearer wrong-token", testToken} {
+		header := http.Header{}
+		if auth != "none" {
+			header.Set("Authorization", auth)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want 401", auth, rec.Code)
+		}
+	}
+
+	if rec := serve(h, http.MethodGet, "/admin/stats", nil); rec.Code != http.StatusOK {
+		t.Errorf("status with the token = %d, want 200", rec.Code)
+	}
+}
+
+func TestHandler_Snippets(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{})
+
+	rec := serve(h, http.MethodGet, "/admin/snippets?limit=1", nil)
+	var items []Summary
+	if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || len(items) != 1 {
+		t.Errorf("list = %d %+v, want one snippet", rec.Code, items)
+	}
+	if rec := serve(h, http.MethodGet, "/admin/snippets?limit=0", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("list with limit=0 = %d, want 400", rec.Code)
+	}
+
+	rec = serve(h, http.MethodPost, "/admin/snippets/aaa-aaaa-aaa/expire", nil)
+	body := rec.Body.String()
+	var snippet Snippet
+	if err := json.Unmarshal([]byte(body), &snippet); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || snippet.ExpiresAt == nil {
+		t.Errorf("expire = %d %+v, want the snippet expiring", rec.Code, snippet)
+	}
+	if strings.Contains(body, "first") {
+		t.Error("metadata holds the content")
+	}
+	if !strings.Contains(body, `"publicId":"aaa-aaaa-aaa"`) {
+		t.Errorf("expire = %s, want camelCase fields like the public API", body)
+	}
+
+	if rec := serve(h, http.MethodDelete, "/admin/snippets/bbb-bbbb-bbb", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete = %d, want 204", rec.Code)
+	}
+	rec = serve(h, http.MethodGet, "/admin/snippets?q=bbb-bbbb-bbb", nil)
+	items = nil
+	if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].DeletedAt == nil {
+		t.Errorf("search = %+v, want the tombstone", items)
+	}
+
+	if rec := serve(h, http.MethodDelete, "/admin/snippets/bbb-bbbb-bbb?hard=true", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("hard delete = %d, want 204", rec.Code)
+	}
+	if rec := serve(h, http.MethodGet, "/admin/snippets/bbb-bbbb-bbb", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("inspect after a hard delete = %d, want 404", rec.Code)
+	}
+	if rec := serve(h, http.MethodDelete, "/admin/cache/snippets/bbb-bbbb-bbb", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("cache flush = %d, want 204", rec.Code)
+	}
+}
+
+func TestHandler_BreakGlass(t *testing.T) {
+	live := config.NewLive(&config.Config{})
+	h := newTestHandler(t, HandlerOptions{BreakGlass: true, Live: live})
+	reason := http.Header{BreakGlassHeader: {"incident 42"}}
+
+	if rec := serve(h, http.MethodGet, "/admin/snippets/aaa-aaaa-aaa/content", reason); rec.Code != http.StatusForbidden {
+		t.Errorf("content without break-glass = %d, want 403", rec.Code)
+	}
+
+	live.Store(&config.Config{Admin: config.AdminConfig{BreakGlass: true}})
+	if rec := serve(h, http.MethodGet, "/admin/snippets/aaa-aaaa-aaa/content", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("content without a reason = %d, want 400", rec.Code)
+	}
+	rec := serve(h, http.MethodGet, "/admin/snippets/aaa-aaaa-aaa/content", reason)
+	if rec.Code != http.StatusOK || rec.Body.String() != "first" {
+		t.Errorf("content = %d %q, want the decrypted content", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Disposition") != "attachment" {
+		t.Error("content is not served as an attachment")
+	}
+
+	rows, err := h.svc.store.Primary().ListAuditEntries(context.Background(), sqlc.ListAuditEntriesParams{MaxRows: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Event != audit.AdminContentRead || rows[0].Actor != "token" ||
+		rows[0].Details.String != `{"reason":"incident 42"}` || !rows[0].ClientIP.Valid {
+		t.Errorf("audit log = %+v, want the content read", rows)
+	}
+}
+
+func TestHandler_Jobs(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{})
+
+	if rec := serve(h, http.MethodPost, "/admin/jobs/vacuum", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job = %d, want 404", rec.Code)
+	}
+	if rec := serve(h, http.MethodPost, "/admin/jobs/"+JobReencrypt, nil); rec.Code != http.StatusAccepted {
+		t.Fatalf("start = %d, want 202", rec.Code)
+	}
+	h.Wait()
+
+	rec := serve(h, http.MethodGet, "/admin/jobs", nil)
+	var runs []JobRun
+	if err := json.NewDecoder(rec.Body).Decode(&runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Running || runs[0].Error != "" || runs[0].Actor != "token" || runs[0].Result == nil {
+		t.Errorf("runs = %+v, want a finished reencrypt run", runs)
+	}
+}
@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"snippets.adelh.dev/app/internal/audit"
+)
+
+// Maintenance jobs the admin API can start.
+const (
+	JobPurgeExpired = "purge-expired"
+	JobReencrypt    = "reencrypt"
+)
+
+var (
+	errUnknownJob = errors.New("unknown job")
+	errJobRunning = errors.New("job is already running")
+)
+
+// JobRun is a run of a maintenance job, the one in progress or the last
+// one to finish.
+type JobRun struct {
+	Job   string `json:"job"`
+	Actor string `json:"actor"`
+	// Running is set until the job finishes, Result or Error are set then.
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Result     any        `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// jobs runs maintenance jobs in the background, one run of each at a time.
+type jobs struct {
+	// ctx bounds every run, the jobs stop when it is done.
+	ctx  context.Context
+	defs map[string]func(context.Context) (any, error)
+	wg   sync.WaitGroup
+
+	mu   sync.Mutex
+	last map[string]*JobRun
+}
+
+func newJobs(ctx context.Context, svc *Service) *jobs {
+	return &jobs{
+		ctx: ctx,
+		defs: map[string]func(context.Context) (any, error){
+			JobPurgeExpired: func(ctx context.Context) (any, error) {
+				n, err := svc.PurgeExpired(ctx)
+				return map[string]int64{"purged": n}, err
+			},
+			JobReencrypt: func(ctx context.Context) (any, error) {
+				return svc.Reencrypt(ctx)
+			},
+		},
+		last: map[string]*JobRun{},
+	}
+}
+
+// start starts a run of the named job on behalf of actor.
+func (j *jobs) start(name, actor string) (JobRun, error) {
+	fn, ok := j.defs[name]
+	if !ok {
+		return JobRun{}, errUnknownJob
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if run := j.last[name]; run != nil && run.Running {
+		return *run, errJobRunning
+	}
+	run := &JobRun{Job: name, Actor: actor, Running: true, StartedAt: time.Now().UTC()}
+	j.last[name] = run
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		logger := slog.Default().With("job", name, "actor", actor)
+		logger.Info("maintenance job started")
+		result, err := fn(audit.WithActor(j.ctx, actor))
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		finished := time.Now().UTC()
+		run.Running, run.FinishedAt, run.Result = false, &finished, result
+		if err != nil {
+			run.Error = err.Error()
+			logger.Error("maintenance job failed", "error", err)
+			return
+		}
+		logger.Info("maintenance job finished", "result", result)
+	}()
+	return *run, nil
+}
+
+// runs returns the last run of every job that ran, by job name.
+func (j *jobs) runs() []JobRun {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	runs := make([]JobRun, 0, len(j.last))
+	for _, run := range j.last {
+		runs = append(runs, *run)
+	}
+	slices.SortFunc(runs, func(a, b JobRun) int { return strings.Compare(a.Job, b.Job) })
+	return runs
+}
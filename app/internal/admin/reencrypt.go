@@ -0,0 +1,246 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"snippets.adelh.dev/app/internal/audit"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+	"snippets.adelh.dev/app/internal/sealer"
+)
+
+// ReencryptResult counts the content Reencrypt sealed again.
+type ReencryptResult struct {
+	Snippets int `json:"snippets"`
+	Bodies   int `json:"sharedBodies"`
+}
+
+// Reencrypt seals all stored content again under the current system key,
+// after which the previous keys are no longer needed. Content sealed in a
+// legacy format is upgraded on the way.
+//
+// Shared bodies go first, then the content of every snippet, each in a
+// transaction that keeps concurrent edits from being overwritten. Every
+// snippet is dropped from the cache once it is done, cached copies may
+// still reference content that was replaced. Running it again is harmless,
+// an interrupted run is finished by starting over. A run that finishes is
+// recorded in the audit log as a key rotation to the current key, and
+// fails if it can't be.
+func (s *Service) Reencrypt(ctx context.Context) (ReencryptResult, error) {
+	var res ReencryptResult
+
+	for after := int32(0); ; {
+		rows, err := s.store.Primary().ListSnippetBodies(ctx, sqlc.ListSnippetBodiesParams{AfterID: after, MaxRows: pageSize})
+		if err != nil {
+			return res, fmt.Errorf("failed to list shared bodies: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		for _, row := range rows {
+			after = row.ID
+			done, err := s.reencryptBody(ctx, row)
+			if err != nil {
+				return res, fmt.Errorf("failed to re-encrypt shared body %d: %w", row.ID, err)
+			}
+			if done {
+				res.Bodies++
+			}
+		}
+	}
+
+	for after := int32(0); ; {
+		rows, err := s.store.Primary().ListSnippets(ctx, sqlc.ListSnippetsParams{AfterID: after, MaxRows: pageSize})
+		if err != nil {
+			return res, fmt.Errorf("failed to list snippets: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		for _, row := range rows {
+			after = row.ID
+			// shared content was re-encrypted with its body
+			if !row.BodyID.Valid {
+				done, err := s.reencryptSnippet(ctx, row.ID, row.PublicID)
+				if err != nil {
+					return res, fmt.Errorf("failed to re-encrypt snippet %s: %w", row.PublicID, err)
+				}
+				if done {
+					res.Snippets++
+				}
+			}
+			s.invalidate(ctx, row.PublicID, row.Slug)
+		}
+		s.logger.Info("re-encrypting snippets", "done", res.Snippets, "last_id", after)
+	}
+	err := s.audit.Record(ctx, audit.Event{Type: audit.KeyRotation, Details: map[string]any{
+		"keyId":        s.keyID,
+		"snippets":     res.Snippets,
+		"sharedBodies": res.Bodies,
+	}})
+	return res, err
+}
+
+// reencryptBody seals a shared body again, it reports false if the body
+// changed since it was listed.
+func (s *Service) reencryptBody(ctx context.Context, row sqlc.ListSnippetBodiesRow) (bool, error) {
+	r, err := s.open(ctx, row.EncryptedContent, row.BlobKey, row.ContentHash)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	content, err := readAll(r)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := s.content.SealShared(content, row.ContentHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to encrypt content: %w", err)
+	}
+
+	n, err := s.store.Primary().UpdateSnippetBody(ctx, sqlc.UpdateSnippetBodyParams{
+		ID:               row.ID,
+		EncryptedContent: sealed,
+		OldBlobKey:       row.BlobKey,
+	})
+	return n == 1, err
+}
+
+// reencryptSnippet seals the content of a snippet again, it reports false
+// if the snippet is gone or its content became shared since it was listed.
+func (s *Service) reencryptSnippet(ctx context.Context, id int32, publicID string) (bool, error) {
+	var done bool
+	err := s.store.WithTx(ctx, func(q sqlc.Querier) error {
+		// locks the content until the transaction ends
+		if _, err := q.GetSnippetBlobKey(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		row, err := q.GetSnippetByPublicID(ctx, publicID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && row.ContentHash != nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		r, err := s.open(ctx, row.EncryptedContent, row.BlobKey, nil)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		arg := sqlc.UpdateSnippetContentParams{SnippetID: id, ContentType: row.ContentType}
+		if !row.BlobKey.Valid {
+			content, err := readAll(r)
+			if err != nil {
+				return err
+			}
+			if arg.EncryptedContent, err = s.content.Seal(content); err != nil {
+				return fmt.Errorf("failed to encrypt content: %w", err)
+			}
+			done = true
+			return q.UpdateSnippetContent(ctx, arg)
+		}
+
+		key, err := s.upload(ctx, r)
+		if err != nil {
+			return err
+		}
+		arg.EncryptedContent, arg.BlobKey = []byte{}, sql.NullString{String: key, Valid: true}
+		if err := q.UpdateSnippetContent(ctx, arg); err != nil {
+			s.blobs.DiscardContent(ctx, key)
+			return err
+		}
+		done = true
+		return nil
+	})
+	return done && err == nil, err
+}
+
+// open streams the plaintext of stored content, read from the row or from
+// the blob store. hash is the content hash of a shared body, nil otherwise.
+func (s *Service) open(ctx context.Context, encrypted []byte, blobKey sql.NullString, hash []byte) (io.ReadCloser, error) {
+	if !blobKey.Valid {
+		return s.content.OpenStream(bytes.NewReader(encrypted), hash)
+	}
+	if s.blobs == nil {
+		return nil, errors.New("snippet content is in blob storage, which is not configured")
+	}
+
+	stored, err := s.blobs.OpenContent(ctx, blobKey.String)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.content.OpenStream(stored, hash)
+	if err != nil {
+		stored.Close()
+		return nil, fmt.Errorf("failed to decrypt content: %w", err)
+	}
+	return &contentReader{ReadCloser: content, stored: stored}, nil
+}
+
+// contentReader closes the stored content along with its decrypted stream.
+type contentReader struct {
+	io.ReadCloser
+	stored io.Closer
+}
+
+func (c *contentReader) Close() error {
+	c.ReadCloser.Close()
+	return c.stored.Close()
+}
+
+func readAll(r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxOpenSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt content: %w", err)
+	}
+	if len(content) > maxOpenSize {
+		return nil, sealer.ErrTooLarge
+	}
+	return content, nil
+}
+
+// sealStream seals the content read from r under the current system key in
+// the streamed format, which doesn't need the whole content in memory.
+func (s *Service) sealStream(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.sealTo(&buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Service) sealTo(w io.Writer, r io.Reader) error {
+	sw := s.content.SealStream(w)
+	if _, err := io.Copy(sw, r); err != nil {
+		return fmt.Errorf("failed to re-encrypt content: %w", err)
+	}
+	if err := sw.Close(); err != nil {
+		return fmt.Errorf("failed to re-encrypt content: %w", err)
+	}
+	return nil
+}
+
+// upload seals the content read from r to a new blob as it is read. The
+// caller owns the blob until a row references it, see db.ContentStore.
+func (s *Service) upload(ctx context.Context, r io.Reader) (string, error) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(s.sealTo(pw, r))
+	}()
+	key, err := s.blobs.PutContent(ctx, pr)
+	// unblocks the sealer if the upload stopped reading early
+	pr.Close()
+	<-done
+	return key, err
+}
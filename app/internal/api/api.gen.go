@@ -24,6 +24,9 @@ type Error struct {
 	// Path Request path that generated the error
 	Path *string `json:"path,omitempty"`
 
+	// RequestId ID of the request, as in the X-Request-ID response header
+	RequestId *string `json:"requestId,omitempty"`
+
 	// Status HTTP status code
 	Status int `json:"status"`
 
@@ -45,6 +48,9 @@ type SnippetCreateRequest struct {
 	// Password Optional password for snippet protection
 	Password *string `json:"password,omitempty"`
 
+	// Slug Optional unique vanity name the snippet can be addressed by in place of its id. On update an empty string removes it
+	Slug *string `json:"slug,omitempty"`
+
 	// Title optional title for the snippet
 	Title *string `json:"title,omitempty"`
 }
@@ -59,6 +65,9 @@ type SnippetCreateResponse struct {
 
 	// Id Unique identifier for the snippet
 	Id string `json:"id"`
+
+	// Slug Vanity name of the snippet (if set)
+	Slug *string `json:"slug,omitempty"`
 }
 
 // SnippetResponse defines model for SnippetResponse.
@@ -78,12 +87,33 @@ type SnippetResponse struct {
 	// Id Unique identifier for the snippet
 	Id string `json:"id"`
 
+	// Slug Vanity name of the snippet (if set)
+	Slug *string `json:"slug,omitempty"`
+
 	// Title Title of the snippet
 	Title *string `json:"title,omitempty"`
 }
 
+// CreateSnippetRawParams defines parameters for CreateSnippetRaw.
+type CreateSnippetRawParams struct {
+	// Title optional title for the snippet
+	Title *string `form:"title,omitempty" json:"title,omitempty"`
+
+	// ExpiresIn Optional duration after which the snippet will expire
+	ExpiresIn *string `form:"expiresIn,omitempty" json:"expiresIn,omitempty"`
+
+	// Slug Optional unique vanity name the snippet can be addressed by in place of its id
+	Slug *string `form:"slug,omitempty" json:"slug,omitempty"`
+
+	// XSnippetPassword Optional password for snippet protection
+	XSnippetPassword *string `json:"X-Snippet-Password,omitempty"`
+}
+
 // DeleteSnippetParams defines parameters for DeleteSnippet.
 type DeleteSnippetParams struct {
+	// XConsistencyToken Token returned by a previous write, reads observe that write
+	XConsistencyToken *string `json:"X-Consistency-Token,omitempty"`
+
 	// XEditToken Edit token for deleting the snippet
 	XEditToken string `json:"X-Edit-Token"`
 
@@ -93,12 +123,33 @@ type DeleteSnippetParams struct {
 
 // GetSnippetParams defines parameters for GetSnippet.
 type GetSnippetParams struct {
+	// XConsistencyToken Token returned by a previous write, reads observe that write
+	XConsistencyToken *string `json:"X-Consistency-Token,omitempty"`
+
 	// XSnippetPassword Password for protected snippets
 	XSnippetPassword *string `json:"X-Snippet-Password,omitempty"`
 }
 
+// GetSnippetRawParams defines parameters for GetSnippetRaw.
+type GetSnippetRawParams struct {
+	// XConsistencyToken Token returned by a previous write, reads observe that write
+	XConsistencyToken *string `json:"X-Consistency-Token,omitempty"`
+
+	// XSnippetPassword Password for protected snippets
+	XSnippetPassword *string `json:"X-Snippet-Password,omitempty"`
+}
+
+// RestoreSnippetParams defines parameters for RestoreSnippet.
+type RestoreSnippetParams struct {
+	// XEditToken Edit token of the deleted snippet
+	XEditToken string `json:"X-Edit-Token"`
+}
+
 // UpdateSnippetParams defines parameters for UpdateSnippet.
 type UpdateSnippetParams struct {
+	// XConsistencyToken Token returned by a previous write, reads observe that write
+	XConsistencyToken *string `json:"X-Consistency-Token,omitempty"`
+
 	// XEditToken Edit token for updating the snippet
 	XEditToken string `json:"X-Edit-Token"`
 
@@ -117,12 +168,21 @@ type ServerInterface interface {
 	// create a new snippet
 	// (POST /snippets)
 	CreateSnippet(w http.ResponseWriter, r *http.Request)
+	// create a new snippet from the raw request body
+	// (POST /snippets/raw)
+	CreateSnippetRaw(w http.ResponseWriter, r *http.Request, params CreateSnippetRawParams)
 	// Delete a snippet
 	// (DELETE /snippets/{id})
 	DeleteSnippet(w http.ResponseWriter, r *http.Request, id string, params DeleteSnippetParams)
 	// Get a snippet
 	// (GET /snippets/{id})
 	GetSnippet(w http.ResponseWriter, r *http.Request, id string, params GetSnippetParams)
+	// Get the raw content of a snippet
+	// (GET /snippets/{id}/raw)
+	GetSnippetRaw(w http.ResponseWriter, r *http.Request, id string, params GetSnippetRawParams)
+	// Restore a deleted snippet
+	// (POST /snippets/{id}/restore)
+	RestoreSnippet(w http.ResponseWriter, r *http.Request, id string, params RestoreSnippetParams)
 	// Update a snippet
 	// (PUT /snippets/{id})
 	UpdateSnippet(w http.ResponseWriter, r *http.Request, id string, params UpdateSnippetParams)
@@ -151,6 +211,70 @@ func (siw *ServerInterfaceWrapper) CreateSnippet(w http.ResponseWriter, r *http.
 	handler.ServeHTTP(w, r)
 }
 
+// CreateSnippetRaw operation middleware
+func (siw *ServerInterfaceWrapper) CreateSnippetRaw(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params CreateSnippetRawParams
+
+	// ------------- Optional query parameter "title" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "title", r.URL.Query(), &params.Title)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "title", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "expiresIn" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "expiresIn", r.URL.Query(), &params.ExpiresIn)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "expiresIn", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "slug" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "slug", r.URL.Query(), &params.Slug)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "slug", Err: err})
+		return
+	}
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "X-Snippet-Password" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("X-Snippet-Password")]; found {
+		var XSnippetPassword string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "X-Snippet-Password", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "X-Snippet-Password", valueList[0], &XSnippetPassword, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "X-Snippet-Password", Err: err})
+			return
+		}
+
+		params.XSnippetPassword = &XSnippetPassword
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.CreateSnippetRaw(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
 // DeleteSnippet operation middleware
 func (siw *ServerInterfaceWrapper) DeleteSnippet(w http.ResponseWriter, r *http.Request) {
 
@@ -170,6 +294,25 @@ func (siw *ServerInterfaceWrapper) DeleteSnippet(w http.ResponseWriter, r *http.
 
 	headers := r.Header
 
+	// ------------- Optional header parameter "X-Consistency-Token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("X-Consistency-Token")]; found {
+		var XConsistencyToken string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "X-Consistency-Token", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "X-Consistency-Token", valueList[0], &XConsistencyToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "X-Consistency-Token", Err: err})
+			return
+		}
+
+		params.XConsistencyToken = &XConsistencyToken
+
+	}
+
 	// ------------- Required header parameter "X-Edit-Token" -------------
 	if valueList, found := headers[http.CanonicalHeaderKey("X-Edit-Token")]; found {
 		var XEditToken string
@@ -242,6 +385,25 @@ func (siw *ServerInterfaceWrapper) GetSnippet(w http.ResponseWriter, r *http.Req
 
 	headers := r.Header
 
+	// ------------- Optional header parameter "X-Consistency-Token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("X-Consistency-Token")]; found {
+		var XConsistencyToken string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "X-Consistency-Token", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "X-Consistency-Token", valueList[0], &XConsistencyToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "X-Consistency-Token", Err: err})
+			return
+		}
+
+		params.XConsistencyToken = &XConsistencyToken
+
+	}
+
 	// ------------- Optional header parameter "X-Snippet-Password" -------------
 	if valueList, found := headers[http.CanonicalHeaderKey("X-Snippet-Password")]; found {
 		var XSnippetPassword string
@@ -272,6 +434,127 @@ func (siw *ServerInterfaceWrapper) GetSnippet(w http.ResponseWriter, r *http.Req
 	handler.ServeHTTP(w, r)
 }
 
+// GetSnippetRaw operation middleware
+func (siw *ServerInterfaceWrapper) GetSnippetRaw(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", r.PathValue("id"), &id, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetSnippetRawParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "X-Consistency-Token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("X-Consistency-Token")]; found {
+		var XConsistencyToken string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "X-Consistency-Token", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "X-Consistency-Token", valueList[0], &XConsistencyToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "X-Consistency-Token", Err: err})
+			return
+		}
+
+		params.XConsistencyToken = &XConsistencyToken
+
+	}
+
+	// ------------- Optional header parameter "X-Snippet-Password" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("X-Snippet-Password")]; found {
+		var XSnippetPassword string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "X-Snippet-Password", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "X-Snippet-Password", valueList[0], &XSnippetPassword, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "X-Snippet-Password", Err: err})
+			return
+		}
+
+		params.XSnippetPassword = &XSnippetPassword
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetSnippetRaw(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// RestoreSnippet operation middleware
+func (siw *ServerInterfaceWrapper) RestoreSnippet(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", r.PathValue("id"), &id, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params RestoreSnippetParams
+
+	headers := r.Header
+
+	// ------------- Required header parameter "X-Edit-Token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("X-Edit-Token")]; found {
+		var XEditToken string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "X-Edit-Token", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "X-Edit-Token", valueList[0], &XEditToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "X-Edit-Token", Err: err})
+			return
+		}
+
+		params.XEditToken = XEditToken
+
+	} else {
+		err := fmt.Errorf("Header parameter X-Edit-Token is required, but not found")
+		siw.ErrorHandlerFunc(w, r, &RequiredHeaderError{ParamName: "X-Edit-Token", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.RestoreSnippet(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
 // UpdateSnippet operation middleware
 func (siw *ServerInterfaceWrapper) UpdateSnippet(w http.ResponseWriter, r *http.Request) {
 
@@ -291,6 +574,25 @@ func (siw *ServerInterfaceWrapper) UpdateSnippet(w http.ResponseWriter, r *http.
 
 	headers := r.Header
 
+	// ------------- Optional header parameter "X-Consistency-Token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("X-Consistency-Token")]; found {
+		var XConsistencyToken string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "X-Consistency-Token", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "X-Consistency-Token", valueList[0], &XConsistencyToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "X-Consistency-Token", Err: err})
+			return
+		}
+
+		params.XConsistencyToken = &XConsistencyToken
+
+	}
+
 	// ------------- Required header parameter "X-Edit-Token" -------------
 	if valueList, found := headers[http.CanonicalHeaderKey("X-Edit-Token")]; found {
 		var XEditToken string
@@ -465,8 +767,11 @@ func HandlerWithOptions(si ServerInterface, options StdHTTPServerOptions) http.H
 	}
 
 	m.HandleFunc("POST "+options.BaseURL+"/snippets", wrapper.CreateSnippet)
+	m.HandleFunc("POST "+options.BaseURL+"/snippets/raw", wrapper.CreateSnippetRaw)
 	m.HandleFunc("DELETE "+options.BaseURL+"/snippets/{id}", wrapper.DeleteSnippet)
 	m.HandleFunc("GET "+options.BaseURL+"/snippets/{id}", wrapper.GetSnippet)
+	m.HandleFunc("GET "+options.BaseURL+"/snippets/{id}/raw", wrapper.GetSnippetRaw)
+	m.HandleFunc("POST "+options.BaseURL+"/snippets/{id}/restore", wrapper.RestoreSnippet)
 	m.HandleFunc("PUT "+options.BaseURL+"/snippets/{id}", wrapper.UpdateSnippet)
 
 	return m
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+	"snippets.adelh.dev/app/internal/sealer"
+)
+
+// storedContent is snippet content as it is written to snippet_contents:
+// sealed bytes, or empty bytes and a reference to a shared body or to
+// content uploaded to the content store.
+type storedContent struct {
+	encrypted []byte
+	bodyID    sql.NullInt32
+	blobKey   sql.NullString
+}
+
+// storeContent seals content for storage. With deduplication enabled the
+// content is stored once for all snippets with the same plaintext, found by
+// its keyed hash, and shared through snippet_bodies.
+func (s *SnippetService) storeContent(ctx context.Context, q sqlc.Querier, content []byte) (storedContent, error) {
+	if s.dedup == nil {
+		_, span := tracer.Start(ctx, "encryption.seal")
+		sealed, err := s.content.Seal(content)
+		endSpan(span, err)
+		if err != nil {
+			return storedContent{}, fmt.Errorf("failed to encrypt content: %w", err)
+		}
+		return storedContent{encrypted: sealed}, nil
+	}
+
+	hash := s.dedup.Sum(content)
+	id, err := q.TouchSnippetBody(ctx, hash)
+	if err == nil {
+		return storedContent{encrypted: []byte{}, bodyID: sql.NullInt32{Int32: id, Valid: true}}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return storedContent{}, fmt.Errorf("failed to look up snippet body: %w", err)
+	}
+
+	_, span := tracer.Start(ctx, "encryption.seal")
+	sealed, err := s.content.SealShared(content, hash)
+	endSpan(span, err)
+	if err != nil {
+		return storedContent{}, fmt.Errorf("failed to encrypt content: %w", err)
+	}
+	body, err := q.CreateSnippetBody(ctx, sqlc.CreateSnippetBodyParams{
+		ContentHash:      hash,
+		EncryptedContent: sealed,
+	})
+	if err != nil {
+		return storedContent{}, fmt.Errorf("failed to store snippet body: %w", err)
+	}
+	return storedContent{encrypted: []byte{}, bodyID: sql.NullInt32{Int32: body.ID, Valid: true}}, nil
+}
+
+// errContentTooLarge is returned by storeStream when content it would hold
+// in memory exceeds maxBodySize.
+var errContentTooLarge = errors.New("content too large to be held in memory")
+
+// storeStream seals content read from r in chunks. With a content store
+// the sealed content is uploaded as it is produced, so memory use doesn't
+// grow with its size. Otherwise it is held in memory and fails with
+// errContentTooLarge past maxBodySize, streaming larger content needs a
+// content store (BLOB_BACKEND). Streamed content is never deduplicated,
+// its hash is only known once it has been stored.
+func (s *SnippetService) storeStream(ctx context.Context, r io.Reader) (storedContent, error) {
+	if s.blobs == nil {
+		var buf bytes.Buffer
+		if err := s.sealStream(ctx, &buf, &boundedReader{r: r, n: maxBodySize}); err != nil {
+			return storedContent{}, err
+		}
+		return storedContent{encrypted: buf.Bytes()}, nil
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(s.sealStream(ctx, pw, r))
+	}()
+	key, err := s.blobs.PutContent(ctx, pr)
+	// unblocks the sealer if the upload stopped reading early
+	pr.Close()
+	<-done
+	if err != nil {
+		return storedContent{}, err
+	}
+	return storedContent{encrypted: []byte{}, blobKey: sql.NullString{String: key, Valid: true}}, nil
+}
+
+// boundedReader reads from r, failing with errContentTooLarge once more
+// than n bytes have been read.
+type boundedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (b *boundedReader) Read(p []byte) (int, error) {
+	if b.n < 0 {
+		return 0, errContentTooLarge
+	}
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.r.Read(p)
+	b.n -= int64(n)
+	if b.n < 0 {
+		return 0, errContentTooLarge
+	}
+	return n, err
+}
+
+func (s *SnippetService) sealStream(ctx context.Context, w io.Writer, r io.Reader) (err error) {
+	_, span := tracer.Start(ctx, "encryption.seal_stream")
+	defer func() { endSpan(span, err) }()
+
+	sw := s.content.SealStream(w)
+	n, err := io.Copy(sw, r)
+	span.SetAttributes(attribute.Int64("content.size", n))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt content: %w", err)
+	}
+	if err := sw.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt content: %w", err)
+	}
+	return nil
+}
+
+// discardContent removes content uploaded for a snippet that was never
+// written.
+func (s *SnippetService) discardContent(ctx context.Context, stored storedContent) {
+	if stored.blobKey.Valid {
+		s.blobs.DiscardContent(ctx, stored.blobKey.String)
+	}
+}
+
+// openContent decrypts the content of a snippet, wherever it is stored.
+// Shared bodies open under the content hash they were stored for, which
+// doesn't need the hash key, so they stay readable if deduplication is
+// turned off. Content larger than maxBodySize fails with
+// sealer.ErrTooLarge, it can only be streamed with readContent.
+func (s *SnippetService) openContent(ctx context.Context, snippet *sqlc.GetSnippetByPublicIDRow) ([]byte, error) {
+	if !snippet.BlobKey.Valid {
+		_, span := tracer.Start(ctx, "encryption.open")
+		var content []byte
+		var err error
+		if snippet.ContentHash != nil {
+			content, err = s.content.OpenShared(snippet.EncryptedContent, snippet.ContentHash)
+		} else {
+			content, err = s.content.Open(snippet.EncryptedContent)
+		}
+		endSpan(span, err)
+		return content, err
+	}
+
+	r, err := s.readContent(ctx, snippet)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	content, err := io.ReadAll(io.LimitReader(r, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxBodySize {
+		return nil, sealer.ErrTooLarge
+	}
+	return content, nil
+}
+
+// readContent streams the decrypted content of a snippet. A read error
+// means the content is incomplete, whatever was read before it must not be
+// taken as the whole content. Its span lasts until the stream is closed.
+func (s *SnippetService) readContent(ctx context.Context, snippet *sqlc.GetSnippetByPublicIDRow) (_ io.ReadCloser, err error) {
+	ctx, span := tracer.Start(ctx, "encryption.open_stream")
+	defer func() {
+		if err != nil {
+			endSpan(span, err)
+		}
+	}()
+
+	if !snippet.BlobKey.Valid {
+		content, err := s.content.OpenStream(bytes.NewReader(snippet.EncryptedContent), snippet.ContentHash)
+		if err != nil {
+			return nil, err
+		}
+		return &contentReader{ReadCloser: content, span: span}, nil
+	}
+	if s.blobs == nil {
+		return nil, errors.New("snippet content is in blob storage, which is not configured")
+	}
+
+	stored, err := s.blobs.OpenContent(ctx, snippet.BlobKey.String)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.content.OpenStream(stored, snippet.ContentHash)
+	if err != nil {
+		stored.Close()
+		return nil, fmt.Errorf("failed to decrypt snippet: %w", err)
+	}
+	return &contentReader{ReadCloser: content, stored: stored, span: span}, nil
+}
+
+// contentReader closes the stored content, if any, along with its
+// decrypted stream and ends the span reading it. The span fails with the
+// first read error.
+type contentReader struct {
+	io.ReadCloser
+	stored io.Closer
+	span   trace.Span
+	err    error
+}
+
+func (c *contentReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+func (c *contentReader) Close() error {
+	endSpan(c.span, c.err)
+	c.ReadCloser.Close()
+	if c.stored == nil {
+		return nil
+	}
+	return c.stored.Close()
+}
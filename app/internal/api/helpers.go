@@ -11,10 +11,28 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"snippets.adelh.dev/app/internal/requestlog"
 )
 
 type envelope map[string]any
 
+// tracer records the spans of the steps of a request that neither the store
+// nor the cache trace, password hashing and content encryption.
+var tracer = otel.Tracer("snippets.adelh.dev/app/internal/api")
+
+// endSpan ends span, marking it failed if err isn't nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 const maxBodySize = 20 * 1_024 * 1_024 // 20MB
 
 func readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
@@ -85,9 +103,13 @@ func writeError(w http.ResponseWriter, r *http.Request, status int, errorType st
 		}(),
 	}
 
+	if id := requestlog.RequestID(r.Context()); id != "" {
+		response.RequestId = &id
+	}
+
 	err := writeJSON(w, status, response)
 	if err != nil {
-		slog.Error("failed to write error response", "error", err)
+		requestlog.FromContext(r.Context()).Error("failed to write error response", "error", err)
 	}
 }
 
@@ -107,8 +129,28 @@ func forbiddenError(w http.ResponseWriter, r *http.Request, message string) {
 	writeError(w, r, http.StatusForbidden, "Forbidden", message)
 }
 
+func conflictError(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusConflict, "Conflict", message)
+}
+
+func goneError(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusGone, "Gone", message)
+}
+
+func contentTooLargeError(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusRequestEntityTooLarge, "Content Too Large", message)
+}
+
+func unsupportedMediaTypeError(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusUnsupportedMediaType, "Unsupported Media Type", message)
+}
+
+func unprocessableEntityError(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusUnprocessableEntity, "Unprocessable Entity", message)
+}
+
 func internalServerError(w http.ResponseWriter, r *http.Request, err error) {
-	slog.Error("internal server error", "error", err, "path", r.URL.Path)
+	requestlog.FromContext(r.Context()).Error("internal server error", "error", err, "path", r.URL.Path)
 	writeError(w, r, http.StatusInternalServerError, "Internal Server Error", "An unexpected error occurred")
 }
 
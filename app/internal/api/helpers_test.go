@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"snippets.adelh.dev/app/internal/requestlog"
 )
 
 func Test_StringValue(t *testing.T) {
@@ -133,6 +135,22 @@ func Test_writeError(t *testing.T) {
 	}
 }
 
+func Test_writeError_RequestID(t *testing.T) {
+	var result map[string]any
+	handler := requestlog.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internalServerError(w, r, errors.New("database is down"))
+	}), requestlog.Options{Route: func(*http.Request) string { return "" }})
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/testpath", nil)
+	req.Header.Set(requestlog.Header, "req-123")
+	handler.ServeHTTP(rr, req)
+	json.NewDecoder(rr.Body).Decode(&result)
+	if result["requestId"] != "req-123" {
+		t.Errorf("requestId = %v, want %v", result["requestId"], "req-123")
+	}
+}
+
 func Test_parseExpiresIn(t *testing.T) {
 	str := "2h"
 	nt, err := parseExpiresIn(&str)
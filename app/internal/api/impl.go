@@ -1,18 +1,27 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"log/slog"
 	"net/http"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+	"snippets.adelh.dev/app/internal/audit"
 	"snippets.adelh.dev/app/internal/cache"
+	"snippets.adelh.dev/app/internal/config"
 	"snippets.adelh.dev/app/internal/db"
 	"snippets.adelh.dev/app/internal/db/sqlc"
 	"snippets.adelh.dev/app/internal/encryption"
+	"snippets.adelh.dev/app/internal/metrics"
+	"snippets.adelh.dev/app/internal/publicid"
+	"snippets.adelh.dev/app/internal/requestlog"
+	"snippets.adelh.dev/app/internal/sealer"
+	"snippets.adelh.dev/app/internal/slug"
 )
 
 //go:generate go tool oapi-codegen -config cfg.yaml ../../../openapi-spec/openapi.yaml
@@ -20,36 +29,155 @@ import (
 type SnippetService struct {
 	store      db.Store
 	redisCache *cache.RedisCache
-	enc        *encryption.Service
+	// content compresses and encrypts snippet content for storage.
+	content *sealer.Sealer
+	// enc signs the consistency tokens handed to clients.
+	enc *encryption.Service
+	// dedup hashes content to share identical bodies, nil disables it.
+	dedup *encryption.ContentHasher
+	// blobs holds content outside the database, nil if the store doesn't.
+	blobs     db.ContentStore
+	publicIDs publicid.Format
+	// audit records the snippet lifecycle, nil disables it.
+	audit *audit.Log
+	// passwordFailures limits the wrong passwords recorded per snippet.
+	passwordFailures *audit.Throttle
+
+	// settings are the ones the service was created with, live overrides
+	// them if set, see WithLive.
+	settings settings
+	live     *config.Live
+}
+
+// settings are the settings of the service that can change while it runs.
+type settings struct {
+	// maxUploadSize bounds raw uploads streamed to blobs.
+	maxUploadSize int64
+	// restoreWindow is how long deleted snippets can be restored.
+	restoreWindow time.Duration
+	// content is the policy content is accepted under.
+	content config.ContentConfig
+}
+
+// current returns the settings in effect, all of them from the same
+// configuration.
+func (s *SnippetService) current() settings {
+	if s.live == nil {
+		return s.settings
+	}
+	c := s.live.Load()
+	return settings{
+		maxUploadSize: c.Server.MaxUploadSize,
+		restoreWindow: c.Retention.RestoreWindow,
+		content:       c.Content,
+	}
 }
 
 var _ ServerInterface = (*SnippetService)(nil)
 
-func New(store db.Store, encryptionService *encryption.Service, redisCache *cache.RedisCache) *SnippetService {
-	return &SnippetService{
+// Option configures optional SnippetService settings.
+type Option func(*SnippetService)
+
+// WithPublicIDFormat sets the layout of generated public IDs,
+// publicid.Default is used otherwise.
+func WithPublicIDFormat(f publicid.Format) Option {
+	return func(s *SnippetService) {
+		s.publicIDs = f
+	}
+}
+
+// WithRestoreWindow sets how long a deleted snippet can be restored with
+// its edit token, it should match the window of the db.Purger.
+func WithRestoreWindow(d time.Duration) Option {
+	return func(s *SnippetService) {
+		s.settings.restoreWindow = d
+	}
+}
+
+// WithLive takes the restore window, the bound of raw uploads and the
+// content policy from the configuration in effect in live, so that they
+// follow reloads. It overrides WithRestoreWindow and WithMaxUploadSize.
+func WithLive(live *config.Live) Option {
+	return func(s *SnippetService) {
+		s.live = live
+	}
+}
+
+// WithDeduplication stores identical content once, shared by all snippets
+// whose content has the same hash.
+func WithDeduplication(h *encryption.ContentHasher) Option {
+	return func(s *SnippetService) {
+		s.dedup = h
+	}
+}
+
+// Wrong passwords are recorded at most once per snippet every
+// passwordFailureInterval, along with how many were not. Up to
+// maxThrottledSnippets snippets are tracked.
+const (
+	passwordFailureInterval = time.Minute
+	maxThrottledSnippets    = 10000
+)
+
+// WithAuditLog records snippets created, updated, deleted and restored,
+// and wrong passwords, in l.
+func WithAuditLog(l *audit.Log) Option {
+	return func(s *SnippetService) {
+		s.audit = l
+		s.passwordFailures = audit.NewThrottle(passwordFailureInterval, maxThrottledSnippets)
+	}
+}
+
+// WithMaxUploadSize bounds raw uploads, as long as the store keeps content
+// outside the database. Otherwise they are held in memory and bounded like
+// JSON requests.
+func WithMaxUploadSize(n int64) Option {
+	return func(s *SnippetService) {
+		s.settings.maxUploadSize = n
+	}
+}
+
+// defaultRestoreWindow matches the default of config.RetentionConfig.
+const defaultRestoreWindow = 7 * 24 * time.Hour
+
+// defaultMaxUploadSize matches the default of config.ServerConfig.
+const defaultMaxUploadSize = 1 << 30
+
+func New(store db.Store, encryptionService *encryption.Service, redisCache *cache.RedisCache, opts ...Option) *SnippetService {
+	s := &SnippetService{
+		content:    sealer.New(encryptionService, maxBodySize),
 		enc:        encryptionService,
 		store:      store,
 		redisCache: redisCache,
+		publicIDs:  publicid.Default,
+		settings: settings{
+			maxUploadSize: defaultMaxUploadSize,
+			restoreWindow: defaultRestoreWindow,
+		},
+	}
+	if blobs, ok := store.(db.ContentStore); ok {
+		s.blobs = blobs
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *SnippetService) GetSnippet(w http.ResponseWriter, r *http.Request, id string, params GetSnippetParams) {
-	snippet, err := s.getAndValidateSnippet(w, r, id)
+	snippet, err := s.getAndValidateSnippet(w, r, id, params.XConsistencyToken)
 	if err != nil {
 		return
 	}
 
-	if snippet.PasswordHash.Valid {
-		if params.XSnippetPassword == nil {
-			forbiddenError(w, r, "Password required")
-			return
-		}
-		if passwordErr := bcrypt.CompareHashAndPassword([]byte(snippet.PasswordHash.String), []byte(*params.XSnippetPassword)); passwordErr != nil {
-			forbiddenError(w, r, "Invalid password")
-			return
-		}
+	if !s.checkPassword(w, r, snippet, params.XSnippetPassword) {
+		return
+	}
+	content, err := s.openContent(r.Context(), snippet)
+	if errors.Is(err, sealer.ErrTooLarge) {
+		unprocessableEntityError(w, r, "Snippet is too large for a JSON response, read it from its raw endpoint")
+		return
 	}
-	content, err := s.enc.Decrypt(snippet.EncryptedContent)
 	if err != nil {
 		internalServerError(w, r, fmt.Errorf("failed to decrypt snippet: %w", err))
 		return
@@ -62,8 +190,10 @@ func (s *SnippetService) GetSnippet(w http.ResponseWriter, r *http.Request, id s
 		CreatedAt:   snippet.CreatedAt,
 		ExpiresAt:   &snippet.ExpiresAt.Time,
 		Id:          snippet.PublicID,
+		Slug:        stringPtr(snippet.Slug),
 	}
 
+	metrics.SnippetEvents(metrics.SnippetViewed, 1)
 	ok(w, snippetDTO)
 }
 
@@ -75,55 +205,142 @@ func (s *SnippetService) CreateSnippet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	params, valid := s.newSnippetParams(w, r, req)
+	if !valid {
+		return
+	}
+
+	stored, err := s.storeContent(r.Context(), s.store.Primary(), []byte(req.Content))
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	s.create(w, r, params, stored)
+}
+
+// newSnippetParams validates the metadata of a new snippet, the content is
+// left to the caller. On invalid metadata it writes the error response and
+// returns false.
+func (s *SnippetService) newSnippetParams(w http.ResponseWriter, r *http.Request, req SnippetCreateRequest) (sqlc.CreateSnippetParams, bool) {
 	password := toNullString(req.Password)
 	if password.Valid {
+		_, span := tracer.Start(r.Context(), "bcrypt.hash")
 		hash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		endSpan(span, err)
 		if err != nil {
 			internalServerError(w, r, fmt.Errorf("failed to hash password: %w", err))
-			return
+			return sqlc.CreateSnippetParams{}, false
 		}
 		password.String = string(hash)
 	}
 
-	encryptedData, err := s.enc.Encrypt([]byte(req.Content))
-	if err != nil {
-		internalServerError(w, r, fmt.Errorf("failed to encrypt content: %w", err))
-		return
-	}
-
 	title := toNullString(req.Title)
 
 	expiresAt, err := parseExpiresIn(req.ExpiresIn)
 	if err != nil {
 		badRequestError(w, r, err.Error())
-		return
+		return sqlc.CreateSnippetParams{}, false
 	}
 
 	contentType := stringValue(req.ContentType, "text/plain")
+	if !s.current().content.Allows(contentType) {
+		unsupportedMediaTypeError(w, r, fmt.Sprintf("Content type %q is not allowed", contentType))
+		return sqlc.CreateSnippetParams{}, false
+	}
 
-	result, err := s.store.Primary().CreateSnippet(r.Context(), sqlc.CreateSnippetParams{
-		Title:            title,
-		ExpiresAt:        expiresAt,
-		PasswordHash:     password,
-		ContentType:      contentType,
-		EncryptedContent: encryptedData,
-		EditToken:        generateEditToken(),
-	})
+	vanity, err := s.parseSlug(req.Slug)
+	if err != nil {
+		badRequestError(w, r, err.Error())
+		return sqlc.CreateSnippetParams{}, false
+	}
+	if vanity.Valid {
+		if err := s.checkSlugAvailable(r.Context(), s.store.Primary(), vanity.String, 0); err != nil {
+			s.slugError(w, r, err)
+			return sqlc.CreateSnippetParams{}, false
+		}
+	}
+
+	return sqlc.CreateSnippetParams{
+		Slug:         vanity,
+		Title:        title,
+		ExpiresAt:    expiresAt,
+		PasswordHash: password,
+		ContentType:  contentType,
+	}, true
+}
+
+// create writes a snippet with stored content and responds with its ID
+// and edit token. Content uploaded ahead of the snippet is discarded if
+// the snippet can't be created.
+func (s *SnippetService) create(w http.ResponseWriter, r *http.Request, params sqlc.CreateSnippetParams, stored storedContent) {
+	params.EncryptedContent = stored.encrypted
+	params.BodyID = stored.bodyID
+	params.BlobKey = stored.blobKey
+	params.EditToken = generateEditToken()
+
+	result, err := s.createWithPublicID(r, params)
+	if err != nil {
+		s.discardContent(r.Context(), stored)
+	}
+	if errors.Is(err, errSlugTaken) {
+		s.slugError(w, r, err)
+		return
+	}
 	if err != nil {
-		slog.Error("failed to create snippet", "error", err)
+		requestlog.FromContext(r.Context()).Error("failed to create snippet", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	metrics.SnippetEvents(metrics.SnippetCreated, 1)
+	s.setConsistencyToken(w, r)
 	response := SnippetCreateResponse{
-		ExpiresAt: &expiresAt.Time,
+		ExpiresAt: &params.ExpiresAt.Time,
 		Id:        result.PublicID,
+		Slug:      stringPtr(result.Slug),
 		EditToken: &result.EditToken,
 	}
 	ok(w, response)
 }
 
+// maxPublicIDAttempts bounds the retries on public ID collisions. With the
+// default layout a collision needs billions of snippets, repeated ones point
+// to a misconfigured, too short format.
+const maxPublicIDAttempts = 5
+
+// createWithPublicID creates a snippet under a fresh random public ID,
+// retrying with a new one if it is already taken. It returns errSlugTaken
+// if the slug was claimed since it was checked. Each attempt is audited in
+// a transaction of its own, a unique violation aborts the transaction.
+func (s *SnippetService) createWithPublicID(r *http.Request, params sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+	for attempt := 1; ; attempt++ {
+		publicID, err := s.publicIDs.New()
+		if err != nil {
+			return sqlc.CreateSnippetRow{}, err
+		}
+		params.PublicID = publicID
+
+		var result sqlc.CreateSnippetRow
+		err = s.audited(r.Context(), audit.Anonymous, audit.Event{Type: audit.SnippetCreate, Snippet: publicID}, func(q sqlc.Querier) error {
+			result, err = q.CreateSnippet(r.Context(), params)
+			return err
+		})
+		if err == nil || !db.IsUniqueViolation(err) {
+			return result, err
+		}
+		if params.Slug.Valid {
+			if slugErr := s.checkSlugAvailable(r.Context(), s.store.Primary(), params.Slug.String, 0); slugErr != nil {
+				return sqlc.CreateSnippetRow{}, slugErr
+			}
+		}
+		if attempt == maxPublicIDAttempts {
+			return sqlc.CreateSnippetRow{}, fmt.Errorf("no free public ID after %d attempts: %w", attempt, err)
+		}
+		requestlog.FromContext(r.Context()).Warn("public ID collision, retrying", "attempt", attempt)
+	}
+}
+
 func (s *SnippetService) UpdateSnippet(w http.ResponseWriter, r *http.Request, id string, params UpdateSnippetParams) {
-	snippet, err := s.getAndValidateSnippet(w, r, id)
+	snippet, err := s.getAndValidateSnippet(w, r, id, params.XConsistencyToken)
 	if err != nil {
 		return
 	}
@@ -146,13 +363,18 @@ func (s *SnippetService) UpdateSnippet(w http.ResponseWriter, r *http.Request, i
 		return
 	}
 
-	encryptedData, err := s.enc.Encrypt([]byte(req.Content))
+	// a missing slug keeps the current one, an empty one removes it
+	vanity, err := s.parseSlug(req.Slug)
 	if err != nil {
-		internalServerError(w, r, fmt.Errorf("failed to encrypt content: %w", err))
+		badRequestError(w, r, err.Error())
 		return
 	}
 
 	contentType := stringValue(req.ContentType, snippet.ContentType)
+	if req.ContentType != nil && !s.current().content.Allows(contentType) {
+		unsupportedMediaTypeError(w, r, fmt.Sprintf("Content type %q is not allowed", contentType))
+		return
+	}
 
 	err = s.store.WithTx(r.Context(), func(q sqlc.Querier) error {
 		updateParams := sqlc.UpdateSnippetParams{
@@ -166,50 +388,114 @@ func (s *SnippetService) UpdateSnippet(w http.ResponseWriter, r *http.Request, i
 			return fmt.Errorf("failed to update snippet metadata: %w", err)
 		}
 
+		stored, err := s.storeContent(r.Context(), q, []byte(req.Content))
+		if err != nil {
+			return err
+		}
+
 		contentParams := sqlc.UpdateSnippetContentParams{
 			SnippetID:        snippet.ID,
 			ContentType:      contentType,
-			EncryptedContent: encryptedData,
+			EncryptedContent: stored.encrypted,
+			BodyID:           stored.bodyID,
 		}
 
 		err = q.UpdateSnippetContent(r.Context(), contentParams)
 		if err != nil {
 			return fmt.Errorf("failed to update snippet content: %w", err)
 		}
-		s.redisCache.Delete(r.Context(), fmt.Sprintf("snippet:%s", id))
-		return nil
+
+		if req.Slug != nil && vanity != snippet.Slug {
+			if vanity.Valid {
+				if err := s.checkSlugAvailable(r.Context(), q, vanity.String, snippet.ID); err != nil {
+					return err
+				}
+			}
+			err = q.UpdateSnippetSlug(r.Context(), sqlc.UpdateSnippetSlugParams{
+				ID:   snippet.ID,
+				Slug: vanity,
+			})
+			if db.IsUniqueViolation(err) {
+				return errSlugTaken
+			}
+			if err != nil {
+				return fmt.Errorf("failed to update snippet slug: %w", err)
+			}
+		}
+		s.invalidateCache(r.Context(), snippet)
+		return s.appendAudit(r.Context(), q, editTokenActor, audit.Event{Type: audit.SnippetUpdate, Snippet: snippet.PublicID})
 	})
+	if errors.Is(err, errSlugTaken) {
+		s.slugError(w, r, err)
+		return
+	}
 	if err != nil {
 		internalServerError(w, r, err)
 		return
 	}
 
-	updatedSnippet, err := s.store.Primary().GetSnippetByPublicID(r.Context(), id)
+	// the response shows the snippet as stored, the public ID never changes
+	updatedSnippet, err := s.store.Primary().GetSnippetByPublicID(r.Context(), snippet.PublicID)
 	if err != nil {
 		internalServerError(w, r, fmt.Errorf("failed to retrieve updated snippet: %w", err))
 		return
 	}
 
-	content, err := s.enc.Decrypt(updatedSnippet.EncryptedContent)
+	content, err := s.openContent(r.Context(), &updatedSnippet)
 	if err != nil {
 		internalServerError(w, r, fmt.Errorf("failed to decrypt content: %w", err))
 		return
 	}
 
 	snippetDTO := SnippetResponse{
-		Title:       stringPtr(snippet.Title),
-		ContentType: &snippet.ContentType,
+		Title:       stringPtr(updatedSnippet.Title),
+		ContentType: &updatedSnippet.ContentType,
 		Content:     string(content),
-		CreatedAt:   snippet.CreatedAt,
-		ExpiresAt:   &snippet.ExpiresAt.Time,
-		Id:          snippet.PublicID,
+		CreatedAt:   updatedSnippet.CreatedAt,
+		ExpiresAt:   &updatedSnippet.ExpiresAt.Time,
+		Id:          updatedSnippet.PublicID,
+		Slug:        stringPtr(updatedSnippet.Slug),
 	}
+	s.setConsistencyToken(w, r)
 	ok(w, snippetDTO)
 }
 
 func (s *SnippetService) DeleteSnippet(w http.ResponseWriter, r *http.Request, id string, params DeleteSnippetParams) {
-	snippet, err := s.getAndValidateSnippet(w, r, id)
+	snippet, err := s.getAndValidateSnippet(w, r, id, params.XConsistencyToken)
+	if err != nil {
+		return
+	}
+
+	if params.XEditToken != snippet.EditToken {
+		unauthorizedError(w, r, "Invalid edit token")
+		return
+	}
+	// the snippet is kept as a tombstone for the restore window, see RestoreSnippet
+	err = s.audited(r.Context(), editTokenActor, audit.Event{Type: audit.SnippetDelete, Snippet: snippet.PublicID}, func(q sqlc.Querier) error {
+		_, err := q.SoftDeleteSnippet(r.Context(), snippet.ID)
+		return err
+	})
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	s.invalidateCache(r.Context(), snippet)
+	metrics.SnippetEvents(metrics.SnippetDeleted, 1)
+
+	s.setConsistencyToken(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreSnippet undoes a delete within the restore window. The tombstone
+// is read from the primary, deleted snippets are never cached.
+func (s *SnippetService) RestoreSnippet(w http.ResponseWriter, r *http.Request, id string, params RestoreSnippetParams) {
+	snippet, err := s.store.Primary().GetSnippetByPublicID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		notFoundError(w, r, "Snippet not found")
+		return
+	}
 	if err != nil {
+		internalServerError(w, r, fmt.Errorf("failed to retrieve snippet: %w", err))
 		return
 	}
 
@@ -217,27 +503,246 @@ func (s *SnippetService) DeleteSnippet(w http.ResponseWriter, r *http.Request, i
 		unauthorizedError(w, r, "Invalid edit token")
 		return
 	}
-	_, err = s.store.Primary().DeleteSnippetById(r.Context(), snippet.ID)
+	// restoring an expired snippet would only bring back a tombstone
+	if snippet.ExpiresAt.Valid && snippet.ExpiresAt.Time.Before(time.Now()) {
+		goneError(w, r, "Snippet has expired")
+		return
+	}
+	if !snippet.DeletedAt.Valid {
+		conflictError(w, r, "Snippet is not deleted")
+		return
+	}
+
+	// the cutoff also guards against restoring a snippet the purge job is removing
+	cutoff := time.Now().Add(-s.current().restoreWindow)
+	err = s.audited(r.Context(), editTokenActor, audit.Event{Type: audit.SnippetRestore, Snippet: snippet.PublicID}, func(q sqlc.Querier) error {
+		n, err := q.RestoreSnippet(r.Context(), sqlc.RestoreSnippetParams{
+			ID:           snippet.ID,
+			DeletedAfter: sql.NullTime{Time: cutoff, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to restore snippet: %w", err)
+		}
+		if n == 0 {
+			return errRestoreWindowPassed
+		}
+		return nil
+	})
+	if errors.Is(err, errRestoreWindowPassed) {
+		goneError(w, r, "Restore window has passed")
+		return
+	}
 	if err != nil {
 		internalServerError(w, r, err)
 		return
 	}
+	s.invalidateCache(r.Context(), &snippet)
+	metrics.SnippetEvents(metrics.SnippetRestored, 1)
 
+	s.setConsistencyToken(w, r)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// checkPassword verifies the password of a protected snippet. If it is
+// missing or wrong it writes the error response and returns false, wrong
+// passwords are audited, see passwordFailureInterval. If that fails the
+// request fails too, a failure that can't be recorded isn't answered.
+func (s *SnippetService) checkPassword(w http.ResponseWriter, r *http.Request, snippet *sqlc.GetSnippetByPublicIDRow, password *string) bool {
+	if !snippet.PasswordHash.Valid {
+		return true
+	}
+	if password == nil {
+		forbiddenError(w, r, "Password required")
+		return false
+	}
+	_, span := tracer.Start(r.Context(), "bcrypt.compare")
+	err := bcrypt.CompareHashAndPassword([]byte(snippet.PasswordHash.String), []byte(*password))
+	span.End()
+	if err != nil {
+		if err := s.recordPasswordFailure(r.Context(), snippet.PublicID); err != nil {
+			internalServerError(w, r, err)
+			return false
+		}
+		forbiddenError(w, r, "Invalid password")
+		return false
+	}
+	return true
+}
+
+// recordPasswordFailure records a wrong password for the snippet publicID,
+// unless one was recorded within passwordFailureInterval. The entry counts
+// the failures left out since the previous one.
+func (s *SnippetService) recordPasswordFailure(ctx context.Context, publicID string) error {
+	if s.audit == nil {
+		return nil
+	}
+	ok, suppressed := s.passwordFailures.Allow(publicID, time.Now())
+	if !ok {
+		return nil
+	}
+	e := audit.Event{Type: audit.SnippetPasswordFailure, Snippet: publicID}
+	if suppressed > 0 {
+		e.Details = map[string]int{"suppressed": suppressed}
+	}
+	return s.audit.Record(audit.WithActor(ctx, audit.Anonymous), e)
+}
+
+// editTokenActor is the actor of changes made with a snippet's edit token.
+const editTokenActor = "edit-token"
+
+var errRestoreWindowPassed = errors.New("restore window has passed")
+
+// audited makes change and appends e to the audit log, as done by actor, in
+// the same transaction: the change is only committed once it is recorded.
+// Without an audit log, change runs on its own on the primary.
+func (s *SnippetService) audited(ctx context.Context, actor string, e audit.Event, change func(q sqlc.Querier) error) error {
+	if s.audit == nil {
+		return change(s.store.Primary())
+	}
+	return s.store.WithTx(ctx, func(q sqlc.Querier) error {
+		if err := change(q); err != nil {
+			return err
+		}
+		return s.appendAudit(ctx, q, actor, e)
+	})
+}
+
+// appendAudit appends e to the audit log, as done by actor, within the
+// transaction of q. It does nothing without an audit log.
+func (s *SnippetService) appendAudit(ctx context.Context, q sqlc.Querier, actor string, e audit.Event) error {
+	if s.audit == nil {
+		return nil
+	}
+	return s.audit.Append(audit.WithActor(ctx, actor), q, e)
+}
+
+var errSlugTaken = errors.New("slug is already taken")
+
+// parseSlug validates a requested slug. A nil or empty slug yields NULL.
+// Slugs share a namespace with public IDs, so anything that could be
+// generated as one is refused.
+func (s *SnippetService) parseSlug(v *string) (sql.NullString, error) {
+	if v == nil || *v == "" {
+		return sql.NullString{}, nil
+	}
+	if err := slug.Validate(*v); err != nil {
+		return sql.NullString{}, err
+	}
+	if s.publicIDs.Match(*v) || publicid.Default.Match(*v) {
+		return sql.NullString{}, errors.New("slug must not look like a snippet ID")
+	}
+	return sql.NullString{String: *v, Valid: true}, nil
+}
+
+// checkSlugAvailable returns errSlugTaken if name already resolves to a
+// snippet other than owner, either as its slug or as its public ID.
+func (s *SnippetService) checkSlugAvailable(ctx context.Context, q sqlc.Querier, name string, owner int32) error {
+	existing, err := q.GetSnippetByPublicID(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up slug: %w", err)
+	}
+	if existing.ID != owner {
+		return errSlugTaken
+	}
+	return nil
+}
+
+func (s *SnippetService) slugError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errSlugTaken) {
+		conflictError(w, r, "Slug is already taken")
+		return
+	}
+	internalServerError(w, r, err)
+}
+
+// invalidateCache drops the cached snippet under every name it is read by.
+func (s *SnippetService) invalidateCache(ctx context.Context, snippet *sqlc.GetSnippetByPublicIDRow) {
+	s.redisCache.Delete(ctx, cache.SnippetKey(snippet.PublicID))
+	if snippet.Slug.Valid {
+		s.redisCache.Delete(ctx, cache.SnippetKey(snippet.Slug.String))
+	}
+}
+
+const consistencyTokenHeader = "X-Consistency-Token"
+
+// setConsistencyToken hands the client a token to send with its next read,
+// so a replica that hasn't replayed this write yet is not used to serve it.
+// It must be called after the write and before the response header is written.
+func (s *SnippetService) setConsistencyToken(w http.ResponseWriter, r *http.Request) {
+	token, err := s.store.ConsistencyToken(r.Context())
+	if err != nil {
+		// the write went through, the client only loses read-your-writes on its next read
+		requestlog.FromContext(r.Context()).Warn("failed to obtain consistency token", "error", err, "path", r.URL.Path)
+		return
+	}
+	if token != "" {
+		w.Header().Set(consistencyTokenHeader, s.sealConsistencyToken(token))
+	}
+}
+
+// consistencyTokenPurpose is what consistency tokens are signed for.
+const consistencyTokenPurpose = "consistency-token"
+
+var errInvalidConsistencyToken = errors.New("invalid consistency token")
+
+// sealConsistencyToken makes a store token opaque to clients: the token
+// followed by its signature, base64 encoded. Only tokens handed out here
+// reach the store, a forged one can't make reads wait on replicas.
+func (s *SnippetService) sealConsistencyToken(token string) string {
+	signed := append([]byte(token), s.enc.Sign(consistencyTokenPurpose, []byte(token))...)
+	return base64.RawURLEncoding.EncodeToString(signed)
+}
+
+// openConsistencyToken returns the store token sealed in v, signed under
+// the system key or a previous one.
+func (s *SnippetService) openConsistencyToken(v string) (string, error) {
+	signed, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil || len(signed) <= sha256.Size {
+		return "", errInvalidConsistencyToken
+	}
+	token, mac := signed[:len(signed)-sha256.Size], signed[len(signed)-sha256.Size:]
+	if !s.enc.Verify(consistencyTokenPurpose, token, mac) {
+		return "", errInvalidConsistencyToken
+	}
+	return string(token), nil
+}
+
 // getAndValidateSnippet retrieves a snippet and checks if it's valid and not expired
-// If primary is true, it uses the primary database, otherwise it uses a replica
-func (s *SnippetService) getAndValidateSnippet(w http.ResponseWriter, r *http.Request, publicID string) (*sqlc.GetSnippetByPublicIDRow, error) {
+// Reads go to a replica. With a consistency token only a replica that has caught up
+// with that token (or the primary) is used and the cache is bypassed, since it may
+// have been filled from a lagging replica.
+func (s *SnippetService) getAndValidateSnippet(w http.ResponseWriter, r *http.Request, publicID string, consistencyToken *string) (*sqlc.GetSnippetByPublicIDRow, error) {
 	var snippet sqlc.GetSnippetByPublicIDRow
 	var err error
 	var cacheHit bool
-	cacheKey := fmt.Sprintf("snippet:%s", publicID)
+	cacheKey := cache.SnippetKey(publicID)
 
-	cacheHit = s.redisCache.Get(r.Context(), cacheKey, &snippet)
+	// an empty header is no token
+	if consistencyToken != nil && *consistencyToken == "" {
+		consistencyToken = nil
+	}
+	var token string
+	if consistencyToken != nil {
+		token, err = s.openConsistencyToken(*consistencyToken)
+		if err != nil {
+			badRequestError(w, r, "Invalid consistency token")
+			return nil, err
+		}
+	} else {
+		cacheHit = s.redisCache.Get(r.Context(), cacheKey, &snippet)
+	}
 
 	if !cacheHit {
-		snippet, err = s.store.Replica().GetSnippetByPublicID(r.Context(), publicID)
+		var q sqlc.Querier
+		if consistencyToken != nil {
+			q = s.store.ReplicaFor(r.Context(), token)
+		} else {
+			q = s.store.Replica()
+		}
+		snippet, err = q.GetSnippetByPublicID(r.Context(), publicID)
 	}
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -248,6 +753,11 @@ func (s *SnippetService) getAndValidateSnippet(w http.ResponseWriter, r *http.Re
 		return nil, err
 	}
 
+	if snippet.DeletedAt.Valid {
+		notFoundError(w, r, "Snippet not found")
+		return nil, fmt.Errorf("snippet is deleted")
+	}
+
 	if snippet.ExpiresAt.Valid && snippet.ExpiresAt.Time.Before(time.Now()) {
 		notFoundError(w, r, "Snippet has expired")
 		return nil, fmt.Errorf("snippet has expired")
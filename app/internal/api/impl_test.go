@@ -1,25 +1,37 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"golang.org/x/crypto/bcrypt"
+	"snippets.adelh.dev/app/internal/audit"
 	"snippets.adelh.dev/app/internal/cache"
 	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db"
 	"snippets.adelh.dev/app/internal/db/mocks"
 	"snippets.adelh.dev/app/internal/db/sqlc"
 	"snippets.adelh.dev/app/internal/encryption"
+	"snippets.adelh.dev/app/internal/publicid"
 )
 
 //go:generate sh -c "cd ../../.. && mockery"
 
+// testAuditKey chains the entries of the audit log, 32 bytes base64 encoded.
+const testAuditKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
 var redisCache = cache.NewRedisCache(config.RedisConfig{
 	Enabled: false,
 })
@@ -113,6 +125,18 @@ func TestSnippetService_GetSnippet(t *testing.T) {
 			expectedStatus: http.StatusForbidden,
 			expectBody:     false,
 		},
+		{
+			name: "Failure - Deleted",
+			snippet: func() sqlc.GetSnippetByPublicIDRow {
+				s := baseSnippet
+				s.EncryptedContent = encryptedContent
+				s.DeletedAt = sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+				return s
+			}(),
+			params:         GetSnippetParams{},
+			expectedStatus: http.StatusNotFound,
+			expectBody:     false,
+		},
 	}
 
 	for _, tc := range tests {
@@ -182,7 +206,22 @@ func TestSnippetService_DeleteSnippet(t *testing.T) {
 				store.EXPECT().Primary().Return(mockQuerier)
 				store.EXPECT().Replica().Return(mockQuerier)
 				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(s, nil)
-				mockQuerier.EXPECT().DeleteSnippetById(mock.Anything, s.ID).Return(1, nil)
+				mockQuerier.EXPECT().SoftDeleteSnippet(mock.Anything, s.ID).Return(1, nil)
+				store.EXPECT().ConsistencyToken(mock.Anything).Return("0/16B3748", nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:    "Delete Success - Read With Consistency Token",
+			id:      "test-id",
+			params:  DeleteSnippetParams{XEditToken: "token", XConsistencyToken: stringRef(sealToken(encryptionSvc, "0/16B3700"))},
+			snippet: baseSnippet,
+			setupMocks: func(s sqlc.GetSnippetByPublicIDRow, store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				store.EXPECT().Primary().Return(mockQuerier)
+				store.EXPECT().ReplicaFor(mock.Anything, "0/16B3700").Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(s, nil)
+				mockQuerier.EXPECT().SoftDeleteSnippet(mock.Anything, s.ID).Return(1, nil)
+				store.EXPECT().ConsistencyToken(mock.Anything).Return("0/16B3748", nil)
 			},
 			expectedStatus: http.StatusNoContent,
 		},
@@ -197,6 +236,21 @@ func TestSnippetService_DeleteSnippet(t *testing.T) {
 			},
 			expectedStatus: http.StatusNotFound,
 		},
+		{
+			name:   "Delete 404 - Already Deleted",
+			id:     "test-id",
+			params: DeleteSnippetParams{XEditToken: "token"},
+			snippet: func() sqlc.GetSnippetByPublicIDRow {
+				s := baseSnippet
+				s.DeletedAt = sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+				return s
+			}(),
+			setupMocks: func(s sqlc.GetSnippetByPublicIDRow, store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				store.EXPECT().Replica().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(s, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
 		{
 			name:    "Delete 401",
 			id:      "test-id",
@@ -220,6 +274,691 @@ func TestSnippetService_DeleteSnippet(t *testing.T) {
 			s := New(store, encryptionSvc, redisCache)
 			s.DeleteSnippet(w, r, tt.id, tt.params)
 			assert.Equal(t, tt.expectedStatus, w.Result().StatusCode)
+			if tt.expectedStatus == http.StatusNoContent {
+				assert.Equal(t, sealToken(encryptionSvc, "0/16B3748"), w.Result().Header.Get("X-Consistency-Token"))
+			}
+		})
+	}
+}
+
+func TestSnippetService_RestoreSnippet(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := sqlc.GetSnippetByPublicIDRow{
+		ID:          1,
+		PublicID:    "test-id",
+		CreatedAt:   time.Now().Add(-time.Hour),
+		EditToken:   "token",
+		DeletedAt:   sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+		ContentType: "text/plain",
+	}
+
+	tests := []struct {
+		name           string
+		params         RestoreSnippetParams
+		setupMocks     func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier)
+		expectedStatus int
+	}{
+		{
+			name:   "Restore Success",
+			params: RestoreSnippetParams{XEditToken: "token"},
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				store.EXPECT().Primary().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(deleted, nil)
+				mockQuerier.EXPECT().RestoreSnippet(mock.Anything, mock.MatchedBy(func(arg sqlc.RestoreSnippetParams) bool {
+					// the cutoff is the restore window before now
+					want := time.Now().Add(-time.Hour)
+					return arg.ID == 1 && arg.DeletedAfter.Valid && arg.DeletedAfter.Time.Sub(want).Abs() < time.Minute
+				})).Return(1, nil)
+				store.EXPECT().ConsistencyToken(mock.Anything).Return("0/16B3748", nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "Restore Window Passed",
+			params: RestoreSnippetParams{XEditToken: "token"},
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				store.EXPECT().Primary().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(deleted, nil)
+				mockQuerier.EXPECT().RestoreSnippet(mock.Anything, mock.Anything).Return(0, nil)
+			},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:   "Expired",
+			params: RestoreSnippetParams{XEditToken: "token"},
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				expired := deleted
+				expired.ExpiresAt = sql.NullTime{Time: time.Now().Add(-time.Second), Valid: true}
+				store.EXPECT().Primary().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(expired, nil)
+			},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:   "Not Deleted",
+			params: RestoreSnippetParams{XEditToken: "token"},
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				live := deleted
+				live.DeletedAt = sql.NullTime{}
+				store.EXPECT().Primary().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(live, nil)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "Invalid Edit Token",
+			params: RestoreSnippetParams{XEditToken: "wrong-token"},
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				store.EXPECT().Primary().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(deleted, nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "Purged",
+			params: RestoreSnippetParams{XEditToken: "token"},
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				store.EXPECT().Primary().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(sqlc.GetSnippetByPublicIDRow{}, sql.ErrNoRows)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQuerier := mocks.NewMockQuerier(t)
+			store := mocks.NewMockStore(t)
+			tt.setupMocks(store, mockQuerier)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/snippets/test-id/restore", nil)
+			s := New(store, encryptionSvc, redisCache, WithRestoreWindow(time.Hour))
+			s.RestoreSnippet(w, r, "test-id", tt.params)
+			assert.Equal(t, tt.expectedStatus, w.Result().StatusCode)
 		})
 	}
 }
+
+func TestSnippetService_GetSnippet_ConsistencyToken(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedContent, err := encryptionSvc.Encrypt([]byte("fresh content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippet := sqlc.GetSnippetByPublicIDRow{
+		ID:               1,
+		PublicID:         "test-id",
+		CreatedAt:        time.Now(),
+		ExpiresAt:        sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+		EditToken:        "token",
+		ContentType:      "text/plain",
+		EncryptedContent: encryptedContent,
+	}
+
+	mockStore := mocks.NewMockStore(t)
+	mockQuerier := mocks.NewMockQuerier(t)
+	mockStore.EXPECT().ReplicaFor(mock.Anything, "0/16B3748").Return(mockQuerier)
+	mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(snippet, nil)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/snippets/test-id", nil)
+	New(mockStore, encryptionSvc, redisCache).GetSnippet(w, r, "test-id", GetSnippetParams{
+		XConsistencyToken: stringRef(sealToken(encryptionSvc, "0/16B3748")),
+	})
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	// tokens not handed out by the service never reach the store
+	other, err := encryption.NewService("MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := sealToken(encryptionSvc, "0/16B3748")
+	for _, token := range []string{"0/FFFFFFFF", "not base64!", sealToken(other, "0/16B3748"), sealed[:len(sealed)-2]} {
+		w := httptest.NewRecorder()
+		New(mocks.NewMockStore(t), encryptionSvc, redisCache).GetSnippet(w, r, "test-id", GetSnippetParams{XConsistencyToken: &token})
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "token %q", token)
+	}
+}
+
+// sealToken returns the consistency token a service using enc hands out
+// for the store token.
+func sealToken(enc *encryption.Service, token string) string {
+	return New(nil, enc, redisCache).sealConsistencyToken(token)
+}
+
+func TestSnippetService_CreateSnippet_PublicIDCollision(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, err := publicid.NewFormat("0123456789abcdef", []int{4, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tried []string
+	mockStore := mocks.NewMockStore(t)
+	mockQuerier := mocks.NewMockQuerier(t)
+	mockStore.EXPECT().Primary().Return(mockQuerier)
+	mockQuerier.EXPECT().CreateSnippet(mock.Anything, mock.Anything).
+		Run(func(_ context.Context, arg sqlc.CreateSnippetParams) {
+			tried = append(tried, arg.PublicID)
+		}).
+		Return(sqlc.CreateSnippetRow{}, &pgconn.PgError{Code: "23505"}).Once()
+	mockQuerier.EXPECT().CreateSnippet(mock.Anything, mock.Anything).
+		RunAndReturn(func(_ context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+			tried = append(tried, arg.PublicID)
+			return sqlc.CreateSnippetRow{SnippetID: 1, PublicID: arg.PublicID, EditToken: arg.EditToken}, nil
+		}).Once()
+	mockStore.EXPECT().ConsistencyToken(mock.Anything).Return("", nil)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/snippets", strings.NewReader(`{"content": "hello"}`))
+	New(mockStore, encryptionSvc, redisCache, WithPublicIDFormat(format)).CreateSnippet(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	if assert.Len(t, tried, 2) {
+		assert.True(t, format.Match(tried[0]), "generated ID %q does not match the format", tried[0])
+		assert.True(t, format.Match(tried[1]), "generated ID %q does not match the format", tried[1])
+	}
+
+	var resp SnippetCreateResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, tried[len(tried)-1], resp.Id)
+}
+
+func TestSnippetService_CreateSnippet_Slug(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, err := publicid.NewFormat("0123456789abcdef", []int{4, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		opts           []Option
+		setupMocks     func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier)
+		expectedStatus int
+	}{
+		{
+			name: "Free Slug",
+			body: `{"content": "hello", "slug": "deploy-runbook"}`,
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				store.EXPECT().Primary().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "deploy-runbook").
+					Return(sqlc.GetSnippetByPublicIDRow{}, sql.ErrNoRows)
+				mockQuerier.EXPECT().CreateSnippet(mock.Anything, mock.MatchedBy(func(arg sqlc.CreateSnippetParams) bool {
+					return arg.Slug == sql.NullString{String: "deploy-runbook", Valid: true}
+				})).RunAndReturn(func(_ context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+					return sqlc.CreateSnippetRow{SnippetID: 1, PublicID: arg.PublicID, Slug: arg.Slug, EditToken: arg.EditToken}, nil
+				})
+				store.EXPECT().ConsistencyToken(mock.Anything).Return("", nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Taken Slug",
+			body: `{"content": "hello", "slug": "deploy-runbook"}`,
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				store.EXPECT().Primary().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "deploy-runbook").
+					Return(sqlc.GetSnippetByPublicIDRow{ID: 7}, nil)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "Slug Claimed Concurrently",
+			body: `{"content": "hello", "slug": "deploy-runbook"}`,
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				store.EXPECT().Primary().Return(mockQuerier)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "deploy-runbook").
+					Return(sqlc.GetSnippetByPublicIDRow{}, sql.ErrNoRows).Once()
+				mockQuerier.EXPECT().CreateSnippet(mock.Anything, mock.Anything).
+					Return(sqlc.CreateSnippetRow{}, &pgconn.PgError{Code: "23505"}).Once()
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "deploy-runbook").
+					Return(sqlc.GetSnippetByPublicIDRow{ID: 7}, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Reserved Slug",
+			body:           `{"content": "hello", "slug": "admin"}`,
+			setupMocks:     func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid Characters",
+			body:           `{"content": "hello", "slug": "Deploy_Runbook"}`,
+			setupMocks:     func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Looks Like A Public ID",
+			body:           `{"content": "hello", "slug": "abc-defg-hij"}`,
+			setupMocks:     func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Looks Like A Public ID Of The Configured Format",
+			body:           `{"content": "hello", "slug": "dead-beef"}`,
+			opts:           []Option{WithPublicIDFormat(format)},
+			setupMocks:     func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQuerier := mocks.NewMockQuerier(t)
+			store := mocks.NewMockStore(t)
+			tt.setupMocks(store, mockQuerier)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/snippets", strings.NewReader(tt.body))
+			New(store, encryptionSvc, redisCache, tt.opts...).CreateSnippet(w, r)
+			assert.Equal(t, tt.expectedStatus, w.Result().StatusCode)
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp SnippetCreateResponse
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				if assert.NotNil(t, resp.Slug) {
+					assert.Equal(t, "deploy-runbook", *resp.Slug)
+				}
+			}
+		})
+	}
+}
+
+func TestSnippetService_UpdateSnippet_Slug(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedContent, err := encryptionSvc.Encrypt([]byte("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippet := sqlc.GetSnippetByPublicIDRow{
+		ID:               1,
+		PublicID:         "abc-defg-hij",
+		Slug:             sql.NullString{String: "old-name", Valid: true},
+		CreatedAt:        time.Now(),
+		ExpiresAt:        sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+		EditToken:        "token",
+		ContentType:      "text/plain",
+		EncryptedContent: encryptedContent,
+	}
+	renamed := snippet
+	renamed.Slug = sql.NullString{String: "new-name", Valid: true}
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMocks     func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier)
+		expectedStatus int
+		expectedSlug   *string
+	}{
+		{
+			name: "Rename",
+			body: `{"content": "content", "slug": "new-name"}`,
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "new-name").
+					Return(sqlc.GetSnippetByPublicIDRow{}, sql.ErrNoRows).Once()
+				mockQuerier.EXPECT().UpdateSnippetSlug(mock.Anything, sqlc.UpdateSnippetSlugParams{ID: 1, Slug: renamed.Slug}).Return(nil)
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "abc-defg-hij").Return(renamed, nil).Once()
+				store.EXPECT().Primary().Return(mockQuerier)
+				store.EXPECT().ConsistencyToken(mock.Anything).Return("", nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedSlug:   stringRef("new-name"),
+		},
+		{
+			name: "Remove",
+			body: `{"content": "content", "slug": ""}`,
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				mockQuerier.EXPECT().UpdateSnippetSlug(mock.Anything, sqlc.UpdateSnippetSlugParams{ID: 1}).Return(nil)
+				removed := snippet
+				removed.Slug = sql.NullString{}
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "abc-defg-hij").Return(removed, nil).Once()
+				store.EXPECT().Primary().Return(mockQuerier)
+				store.EXPECT().ConsistencyToken(mock.Anything).Return("", nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Unchanged",
+			body: `{"content": "content"}`,
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "abc-defg-hij").Return(snippet, nil).Once()
+				store.EXPECT().Primary().Return(mockQuerier)
+				store.EXPECT().ConsistencyToken(mock.Anything).Return("", nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedSlug:   stringRef("old-name"),
+		},
+		{
+			name: "Taken",
+			body: `{"content": "content", "slug": "new-name"}`,
+			setupMocks: func(store *mocks.MockStore, mockQuerier *mocks.MockQuerier) {
+				mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "new-name").
+					Return(sqlc.GetSnippetByPublicIDRow{ID: 2}, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQuerier := mocks.NewMockQuerier(t)
+			store := mocks.NewMockStore(t)
+			// the snippet is addressed by its current slug
+			store.EXPECT().Replica().Return(mockQuerier)
+			mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "old-name").Return(snippet, nil).Once()
+			store.EXPECT().WithTx(mock.Anything, mock.Anything).RunAndReturn(func(ctx context.Context, fn func(sqlc.Querier) error) error {
+				return fn(mockQuerier)
+			})
+			mockQuerier.EXPECT().UpdateSnippet(mock.Anything, mock.Anything).Return(sqlc.UpdateSnippetRow{}, nil)
+			mockQuerier.EXPECT().UpdateSnippetContent(mock.Anything, mock.Anything).Return(nil)
+			tt.setupMocks(store, mockQuerier)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/api/snippets/old-name", strings.NewReader(tt.body))
+			New(store, encryptionSvc, redisCache).UpdateSnippet(w, r, "old-name", UpdateSnippetParams{XEditToken: "token"})
+			assert.Equal(t, tt.expectedStatus, w.Result().StatusCode)
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp SnippetResponse
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				assert.Equal(t, "abc-defg-hij", resp.Id)
+				assert.Equal(t, tt.expectedSlug, resp.Slug)
+			}
+		})
+	}
+}
+
+func TestSnippetService_CompressedContentRoundTrip(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := strings.Repeat("level=info msg=\"request served\" status=200\n", 2000)
+	body, err := json.Marshal(SnippetCreateRequest{Content: logs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []byte
+	mockStore := mocks.NewMockStore(t)
+	mockQuerier := mocks.NewMockQuerier(t)
+	mockStore.EXPECT().Primary().Return(mockQuerier)
+	mockQuerier.EXPECT().CreateSnippet(mock.Anything, mock.Anything).
+		RunAndReturn(func(_ context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+			stored = arg.EncryptedContent
+			return sqlc.CreateSnippetRow{SnippetID: 1, PublicID: arg.PublicID, EditToken: arg.EditToken}, nil
+		})
+	mockStore.EXPECT().ConsistencyToken(mock.Anything).Return("", nil)
+
+	service := New(mockStore, encryptionSvc, redisCache)
+	w := httptest.NewRecorder()
+	service.CreateSnippet(w, httptest.NewRequest(http.MethodPost, "/api/snippets", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Less(t, len(stored), len(logs)/10, "content is stored uncompressed")
+
+	mockStore.EXPECT().Replica().Return(mockQuerier)
+	mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(sqlc.GetSnippetByPublicIDRow{
+		ID:               1,
+		PublicID:         "test-id",
+		CreatedAt:        time.Now(),
+		EditToken:        "token",
+		ContentType:      "text/plain",
+		EncryptedContent: stored,
+	}, nil)
+
+	w = httptest.NewRecorder()
+	service.GetSnippet(w, httptest.NewRequest(http.MethodGet, "/api/snippets/test-id", nil), "test-id", GetSnippetParams{})
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var resp SnippetResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, logs, resp.Content)
+}
+
+func stringRef(s string) *string {
+	return &s
+}
+
+func TestSnippetService_CreateSnippet_Dedup(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher, err := encryption.NewContentHasher("MTIzNDU2Nzg5MDEyMzQ1Ng==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := strings.Repeat("goroutine 1 [running]:\nmain.main()\n", 100)
+	body, err := json.Marshal(SnippetCreateRequest{Content: trace})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hash, sealed []byte
+	var bodyIDs []sql.NullInt32
+	mockStore := mocks.NewMockStore(t)
+	mockQuerier := mocks.NewMockQuerier(t)
+	mockStore.EXPECT().Primary().Return(mockQuerier)
+	mockStore.EXPECT().ConsistencyToken(mock.Anything).Return("", nil)
+	// the first paste stores the body, the second one finds it
+	mockQuerier.EXPECT().TouchSnippetBody(mock.Anything, mock.Anything).Return(0, sql.ErrNoRows).Once()
+	mockQuerier.EXPECT().CreateSnippetBody(mock.Anything, mock.Anything).
+		RunAndReturn(func(_ context.Context, arg sqlc.CreateSnippetBodyParams) (sqlc.CreateSnippetBodyRow, error) {
+			hash, sealed = arg.ContentHash, arg.EncryptedContent
+			return sqlc.CreateSnippetBodyRow{ID: 7}, nil
+		}).Once()
+	mockQuerier.EXPECT().TouchSnippetBody(mock.Anything, mock.Anything).Return(7, nil).Once()
+	mockQuerier.EXPECT().CreateSnippet(mock.Anything, mock.Anything).
+		RunAndReturn(func(_ context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+			assert.Empty(t, arg.EncryptedContent)
+			bodyIDs = append(bodyIDs, arg.BodyID)
+			return sqlc.CreateSnippetRow{SnippetID: int32(len(bodyIDs)), PublicID: arg.PublicID, EditToken: arg.EditToken}, nil
+		}).Twice()
+
+	service := New(mockStore, encryptionSvc, redisCache, WithDeduplication(hasher))
+	for range 2 {
+		w := httptest.NewRecorder()
+		service.CreateSnippet(w, httptest.NewRequest(http.MethodPost, "/api/snippets", bytes.NewReader(body)))
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	}
+	assert.Equal(t, []sql.NullInt32{{Int32: 7, Valid: true}, {Int32: 7, Valid: true}}, bodyIDs)
+	assert.Equal(t, hasher.Sum([]byte(trace)), hash)
+
+	mockStore.EXPECT().Replica().Return(mockQuerier)
+	mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(sqlc.GetSnippetByPublicIDRow{
+		ID:               1,
+		PublicID:         "test-id",
+		CreatedAt:        time.Now(),
+		EditToken:        "token",
+		ContentType:      "text/plain",
+		EncryptedContent: sealed,
+		ContentHash:      hash,
+	}, nil)
+
+	w := httptest.NewRecorder()
+	service.GetSnippet(w, httptest.NewRequest(http.MethodGet, "/api/snippets/test-id", nil), "test-id", GetSnippetParams{})
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var resp SnippetResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, trace, resp.Content)
+}
+
+func TestSnippetService_UpdateSnippet_Response(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(db.NewMemoryStore(), encryptionSvc, redisCache)
+
+	w := httptest.NewRecorder()
+	s.CreateSnippet(w, httptest.NewRequest(http.MethodPost, "/api/snippets", strings.NewReader(`{"content": "old", "title": "Old", "contentType": "text/plain"}`)))
+	var created SnippetCreateResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	w = httptest.NewRecorder()
+	body := `{"content": "new", "title": "New", "contentType": "text/markdown", "expiresIn": "1h"}`
+	s.UpdateSnippet(w, httptest.NewRequest(http.MethodPut, "/api/snippets/"+created.Id, strings.NewReader(body)), created.Id, UpdateSnippetParams{XEditToken: *created.EditToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the response shows the snippet as updated
+	var updated SnippetResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Equal(t, "new", updated.Content)
+	assert.Equal(t, stringRef("New"), updated.Title)
+	assert.Equal(t, stringRef("text/markdown"), updated.ContentType)
+	if assert.NotNil(t, updated.ExpiresAt) {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *updated.ExpiresAt, time.Minute)
+	}
+}
+
+func TestSnippetService_ContentPolicy(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := config.NewLive(&config.Config{Content: config.ContentConfig{AllowedTypes: []string{"text/*"}}})
+	s := New(db.NewMemoryStore(), encryptionSvc, redisCache, WithLive(live))
+
+	create := func(contentType string) int {
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"content": "hello", "contentType": %q}`, contentType)
+		s.CreateSnippet(w, httptest.NewRequest(http.MethodPost, "/api/snippets", strings.NewReader(body)))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, create("text/markdown"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, create("image/png"))
+
+	// a reload applies to the next request
+	live.Store(&config.Config{})
+	assert.Equal(t, http.StatusOK, create("image/png"))
+}
+
+func TestSnippetService_AuditLog(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := db.NewMemoryStore()
+	auditLog, err := audit.New(store, testAuditKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(store, encryptionSvc, redisCache, WithAuditLog(auditLog))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/snippets", strings.NewReader(`{"content": "hello", "password": "secret"}`))
+	s.CreateSnippet(w, r.WithContext(audit.WithRequest(r.Context(), r)))
+	var created SnippetCreateResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	// repeated wrong passwords are recorded once
+	wrong := "wrong"
+	for range 3 {
+		w = httptest.NewRecorder()
+		s.GetSnippet(w, httptest.NewRequest(http.MethodGet, "/api/snippets/"+created.Id, nil), created.Id, GetSnippetParams{XSnippetPassword: &wrong})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	s.DeleteSnippet(w, httptest.NewRequest(http.MethodDelete, "/api/snippets/"+created.Id, nil), created.Id, DeleteSnippetParams{XEditToken: *created.EditToken})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	rows, err := store.Primary().ListAuditEntries(context.Background(), sqlc.ListAuditEntriesParams{MaxRows: 10})
+	assert.NoError(t, err)
+	var events []string
+	for _, row := range rows {
+		assert.Equal(t, created.Id, row.Snippet.String)
+		events = append(events, row.Event+" "+row.Actor)
+	}
+	assert.Equal(t, []string{
+		audit.SnippetCreate + " " + audit.Anonymous,
+		audit.SnippetPasswordFailure + " " + audit.Anonymous,
+		audit.SnippetDelete + " " + editTokenActor,
+	}, events)
+	if assert.NotEmpty(t, rows) {
+		assert.Equal(t, "192.0.2.1", rows[0].ClientIP.String, "client IP of the create request")
+	}
+}
+
+// failingAuditStore fails every audit log append made in a transaction.
+type failingAuditStore struct {
+	db.Store
+}
+
+func (s failingAuditStore) WithTx(ctx context.Context, fn func(sqlc.Querier) error) error {
+	return s.Store.WithTx(ctx, func(q sqlc.Querier) error {
+		return fn(failingAuditQuerier{q})
+	})
+}
+
+type failingAuditQuerier struct {
+	sqlc.Querier
+}
+
+func (failingAuditQuerier) CreateAuditEntry(context.Context, sqlc.CreateAuditEntryParams) error {
+	return errors.New("audit log unavailable")
+}
+
+func TestSnippetService_AuditLogFailure(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := db.NewMemoryStore()
+	s := New(memory, encryptionSvc, redisCache)
+
+	w := httptest.NewRecorder()
+	s.CreateSnippet(w, httptest.NewRequest(http.MethodPost, "/api/snippets", strings.NewReader(`{"content": "hello", "password": "secret"}`)))
+	var created SnippetCreateResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	store := failingAuditStore{memory}
+	auditLog, err := audit.New(store, testAuditKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = New(store, encryptionSvc, redisCache, WithAuditLog(auditLog))
+
+	w = httptest.NewRecorder()
+	s.CreateSnippet(w, httptest.NewRequest(http.MethodPost, "/api/snippets", strings.NewReader(`{"content": "unrecorded"}`)))
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "create")
+
+	w = httptest.NewRecorder()
+	s.DeleteSnippet(w, httptest.NewRequest(http.MethodDelete, "/api/snippets/"+created.Id, nil), created.Id, DeleteSnippetParams{XEditToken: *created.EditToken})
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "delete")
+
+	wrong := "wrong"
+	w = httptest.NewRecorder()
+	s.GetSnippet(w, httptest.NewRequest(http.MethodGet, "/api/snippets/"+created.Id, nil), created.Id, GetSnippetParams{XSnippetPassword: &wrong})
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "wrong password")
+
+	// nothing was changed without being recorded
+	stats, err := memory.Primary().GetSnippetStats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Total)
+	assert.Equal(t, int64(0), stats.Deleted)
+	rows, err := memory.Primary().ListAuditEntries(context.Background(), sqlc.ListAuditEntriesParams{MaxRows: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, rows)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"snippets.adelh.dev/app/internal/metrics"
+	"snippets.adelh.dev/app/internal/requestlog"
+)
+
+// CreateSnippetRaw creates a snippet from the request body as is, its
+// metadata comes from the query and the headers. Unlike JSON requests the
+// body is never held in memory as a whole when the store keeps content
+// outside the database, which allows far larger snippets.
+func (s *SnippetService) CreateSnippetRaw(w http.ResponseWriter, r *http.Request, params CreateSnippetRawParams) {
+	limit := int64(maxBodySize)
+	if s.blobs != nil {
+		limit = s.current().maxUploadSize
+	}
+	if r.ContentLength > limit {
+		contentTooLargeError(w, r, fmt.Sprintf("Snippet content must not exceed %d bytes", limit))
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, limit)
+
+	req := SnippetCreateRequest{
+		Title:     params.Title,
+		ExpiresIn: params.ExpiresIn,
+		Slug:      params.Slug,
+		Password:  params.XSnippetPassword,
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if _, _, err := mime.ParseMediaType(ct); err != nil {
+			badRequestError(w, r, "invalid Content-Type header")
+			return
+		}
+		req.ContentType = &ct
+	}
+
+	snippetParams, valid := s.newSnippetParams(w, r, req)
+	if !valid {
+		return
+	}
+
+	stored, err := s.storeStream(r.Context(), body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || errors.Is(err, errContentTooLarge) {
+		contentTooLargeError(w, r, fmt.Sprintf("Snippet content must not exceed %d bytes", limit))
+		return
+	}
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	s.create(w, r, snippetParams, stored)
+}
+
+// GetSnippetRaw writes the content of a snippet as the response body, with
+// the content type it was stored with. The content is decrypted as it is
+// written, chunk by chunk.
+func (s *SnippetService) GetSnippetRaw(w http.ResponseWriter, r *http.Request, id string, params GetSnippetRawParams) {
+	snippet, err := s.getAndValidateSnippet(w, r, id, params.XConsistencyToken)
+	if err != nil {
+		return
+	}
+	if !s.checkPassword(w, r, snippet, params.XSnippetPassword) {
+		return
+	}
+
+	content, err := s.readContent(r.Context(), snippet)
+	if err != nil {
+		internalServerError(w, r, fmt.Errorf("failed to decrypt snippet: %w", err))
+		return
+	}
+	defer content.Close()
+	metrics.SnippetEvents(metrics.SnippetViewed, 1)
+
+	// the content is user supplied, it must not run in the API's origin
+	w.Header().Set("Content-Type", snippet.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+
+	n, err := io.Copy(w, content)
+	if err != nil {
+		if n == 0 {
+			internalServerError(w, r, fmt.Errorf("failed to stream snippet: %w", err))
+			return
+		}
+		// the status is sent, only an aborted response tells the client
+		// the content is incomplete
+		requestlog.FromContext(r.Context()).Error("failed to stream snippet", "error", err, "path", r.URL.Path)
+		panic(http.ErrAbortHandler)
+	}
+}
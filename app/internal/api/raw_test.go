@@ -0,0 +1,284 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"snippets.adelh.dev/app/internal/db"
+	"snippets.adelh.dev/app/internal/db/mocks"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+	"snippets.adelh.dev/app/internal/encryption"
+)
+
+// contentStore is a store that keeps content outside the database, in
+// memory.
+type contentStore struct {
+	*mocks.MockStore
+
+	mu    sync.Mutex
+	blobs map[string][]byte
+	next  int
+}
+
+var _ db.ContentStore = (*contentStore)(nil)
+
+func newContentStore(t *testing.T) *contentStore {
+	return &contentStore{MockStore: mocks.NewMockStore(t), blobs: map[string][]byte{}}
+}
+
+func (c *contentStore) PutContent(ctx context.Context, r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to store snippet content: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next++
+	key := fmt.Sprintf("blob-%d", c.next)
+	c.blobs[key] = data
+	return key, nil
+}
+
+func (c *contentStore) OpenContent(ctx context.Context, key string) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.blobs[key]
+	if !ok {
+		return nil, errors.New("blob not found")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *contentStore) DiscardContent(ctx context.Context, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.blobs, key)
+}
+
+func (c *contentStore) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.blobs)
+}
+
+// storedRow returns the row GetSnippetByPublicID would return for a
+// snippet created with arg.
+func storedRow(arg sqlc.CreateSnippetParams) sqlc.GetSnippetByPublicIDRow {
+	return sqlc.GetSnippetByPublicIDRow{
+		ID:               1,
+		PublicID:         "test-id",
+		Title:            arg.Title,
+		CreatedAt:        time.Now(),
+		ExpiresAt:        arg.ExpiresAt,
+		EditToken:        arg.EditToken,
+		ContentType:      arg.ContentType,
+		EncryptedContent: arg.EncryptedContent,
+		BlobKey:          arg.BlobKey,
+	}
+}
+
+func TestSnippetService_RawRoundTrip(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Repeat("level=info msg=\"request served\" status=200\n", 5000)
+
+	tests := []struct {
+		name   string
+		store  func(t *testing.T) (db.Store, *mocks.MockStore)
+		inBlob bool
+	}{
+		{
+			name: "database",
+			store: func(t *testing.T) (db.Store, *mocks.MockStore) {
+				s := mocks.NewMockStore(t)
+				return s, s
+			},
+		},
+		{
+			name: "content store",
+			store: func(t *testing.T) (db.Store, *mocks.MockStore) {
+				s := newContentStore(t)
+				return s, s.MockStore
+			},
+			inBlob: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mockStore := tt.store(t)
+			mockQuerier := mocks.NewMockQuerier(t)
+			mockStore.EXPECT().Primary().Return(mockQuerier)
+			mockStore.EXPECT().Replica().Return(mockQuerier)
+			mockStore.EXPECT().ConsistencyToken(mock.Anything).Return("", nil)
+
+			var created sqlc.CreateSnippetParams
+			mockQuerier.EXPECT().CreateSnippet(mock.Anything, mock.Anything).
+				RunAndReturn(func(_ context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+					created = arg
+					return sqlc.CreateSnippetRow{SnippetID: 1, PublicID: "test-id", EditToken: arg.EditToken}, nil
+				})
+
+			service := New(store, encryptionSvc, redisCache)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/snippets/raw?title=logs", strings.NewReader(content))
+			r.Header.Set("Content-Type", "text/x-log")
+			service.CreateSnippetRaw(w, r, CreateSnippetRawParams{Title: stringRef("logs")})
+			if w.Result().StatusCode != http.StatusOK {
+				t.Fatalf("create status = %d: %s", w.Result().StatusCode, w.Body)
+			}
+
+			assert.Equal(t, "logs", created.Title.String)
+			assert.Equal(t, "text/x-log", created.ContentType)
+			assert.Equal(t, tt.inBlob, created.BlobKey.Valid)
+			assert.Equal(t, tt.inBlob, len(created.EncryptedContent) == 0)
+
+			row := storedRow(created)
+			mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(row, nil)
+
+			// the raw content is streamed back as is
+			w = httptest.NewRecorder()
+			service.GetSnippetRaw(w, httptest.NewRequest(http.MethodGet, "/snippets/test-id/raw", nil), "test-id", GetSnippetRawParams{})
+			assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+			assert.Equal(t, "text/x-log", w.Header().Get("Content-Type"))
+			assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+			assert.Equal(t, content, w.Body.String())
+
+			// and readable as JSON
+			w = httptest.NewRecorder()
+			service.GetSnippet(w, httptest.NewRequest(http.MethodGet, "/snippets/test-id", nil), "test-id", GetSnippetParams{})
+			assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+			var resp SnippetResponse
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, content, resp.Content)
+		})
+	}
+}
+
+func TestSnippetService_GetSnippetRaw_Password(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockStore := mocks.NewMockStore(t)
+	mockQuerier := mocks.NewMockQuerier(t)
+	mockStore.EXPECT().Replica().Return(mockQuerier)
+	mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(sqlc.GetSnippetByPublicIDRow{
+		ID:           1,
+		PublicID:     "test-id",
+		CreatedAt:    time.Now(),
+		PasswordHash: sql.NullString{String: "$2a$10$invalidinvalidinvalidinvalidinvalidinvalidinvalidinval", Valid: true},
+	}, nil)
+
+	service := New(mockStore, encryptionSvc, redisCache)
+	w := httptest.NewRecorder()
+	service.GetSnippetRaw(w, httptest.NewRequest(http.MethodGet, "/snippets/test-id/raw", nil), "test-id", GetSnippetRawParams{})
+	assert.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+}
+
+func TestSnippetService_CreateSnippetRaw_Limits(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("declared length above the JSON limit", func(t *testing.T) {
+		service := New(mocks.NewMockStore(t), encryptionSvc, redisCache)
+		r := httptest.NewRequest(http.MethodPost, "/snippets/raw", strings.NewReader("content"))
+		r.ContentLength = maxBodySize + 1
+		w := httptest.NewRecorder()
+		service.CreateSnippetRaw(w, r, CreateSnippetRawParams{})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Result().StatusCode)
+	})
+
+	t.Run("streamed body above the upload limit", func(t *testing.T) {
+		store := newContentStore(t)
+		service := New(store, encryptionSvc, redisCache, WithMaxUploadSize(1000))
+		r := httptest.NewRequest(http.MethodPost, "/snippets/raw", io.NopCloser(strings.NewReader(strings.Repeat("x", 2000))))
+		r.ContentLength = -1
+		w := httptest.NewRecorder()
+		service.CreateSnippetRaw(w, r, CreateSnippetRawParams{})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Result().StatusCode)
+		assert.Zero(t, store.count(), "partial upload was kept")
+	})
+
+	t.Run("content held in memory above the JSON limit", func(t *testing.T) {
+		service := New(mocks.NewMockStore(t), encryptionSvc, redisCache)
+		_, err := service.storeStream(context.Background(), io.LimitReader(zeros{}, maxBodySize+1))
+		assert.ErrorIs(t, err, errContentTooLarge)
+	})
+
+	t.Run("failed create discards the upload", func(t *testing.T) {
+		store := newContentStore(t)
+		mockQuerier := mocks.NewMockQuerier(t)
+		store.EXPECT().Primary().Return(mockQuerier)
+		mockQuerier.EXPECT().CreateSnippet(mock.Anything, mock.Anything).Return(sqlc.CreateSnippetRow{}, errors.New("database is down"))
+
+		service := New(store, encryptionSvc, redisCache)
+		w := httptest.NewRecorder()
+		service.CreateSnippetRaw(w, httptest.NewRequest(http.MethodPost, "/snippets/raw", strings.NewReader("content")), CreateSnippetRawParams{})
+		assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+		assert.Zero(t, store.count(), "upload of a failed snippet was kept")
+	})
+}
+
+func TestSnippetService_GetSnippet_TooLargeForJSON(t *testing.T) {
+	encryptionSvc, err := encryption.NewService("U2FsdGVkX1/K0w2X9/0jJeJk+nGGchmRtIpC/FP4YI0=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newContentStore(t)
+	mockQuerier := mocks.NewMockQuerier(t)
+	store.EXPECT().Primary().Return(mockQuerier)
+	store.EXPECT().Replica().Return(mockQuerier)
+	store.EXPECT().ConsistencyToken(mock.Anything).Return("", nil)
+	var created sqlc.CreateSnippetParams
+	mockQuerier.EXPECT().CreateSnippet(mock.Anything, mock.Anything).
+		RunAndReturn(func(_ context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+			created = arg
+			return sqlc.CreateSnippetRow{SnippetID: 1, PublicID: "test-id", EditToken: arg.EditToken}, nil
+		})
+
+	service := New(store, encryptionSvc, redisCache)
+	content := bytes.Repeat([]byte("0123456789abcdef"), (maxBodySize/16)+1)
+	w := httptest.NewRecorder()
+	service.CreateSnippetRaw(w, httptest.NewRequest(http.MethodPost, "/snippets/raw", bytes.NewReader(content)), CreateSnippetRawParams{})
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("create status = %d: %s", w.Result().StatusCode, w.Body)
+	}
+
+	mockQuerier.EXPECT().GetSnippetByPublicID(mock.Anything, "test-id").Return(storedRow(created), nil)
+
+	w = httptest.NewRecorder()
+	service.GetSnippet(w, httptest.NewRequest(http.MethodGet, "/snippets/test-id", nil), "test-id", GetSnippetParams{})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	service.GetSnippetRaw(w, httptest.NewRequest(http.MethodGet, "/snippets/test-id/raw", nil), "test-id", GetSnippetRawParams{})
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.True(t, bytes.Equal(content, w.Body.Bytes()), "raw content differs")
+}
+
+// zeros reads zeros forever.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,182 @@
+// Package audit records who did what to which snippet in an append-only
+// log: snippets created, updated, deleted and restored, wrong passwords,
+// admin actions and key rotations.
+//
+// Every entry carries the hash of the entry before it and a hash of its own
+// fields and that link, so the log is a chain. Editing, removing or
+// inserting an entry breaks the chain from that point on, which Verify
+// detects. The hashes are HMACs under a key kept out of the database, so
+// write access to the database isn't enough to forge a chain that
+// verifies, the key is needed too. The database keeps a pointer to the
+// last entry, entries cut off the end of the log are detected against it,
+// or against a head recorded earlier if the pointer was moved too, see
+// Report.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"snippets.adelh.dev/app/internal/db"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+	"snippets.adelh.dev/app/internal/requestlog"
+)
+
+// Event types.
+const (
+	SnippetCreate          = "snippet.create"
+	SnippetUpdate          = "snippet.update"
+	SnippetDelete          = "snippet.delete"
+	SnippetRestore         = "snippet.restore"
+	SnippetPasswordFailure = "snippet.password_failure"
+
+	AdminDelete       = "admin.delete"
+	AdminExpire       = "admin.expire"
+	AdminCacheFlush   = "admin.cache_flush"
+	AdminContentRead  = "admin.content_read"
+	AdminPurgeExpired = "admin.purge_expired"
+	AdminExport       = "admin.export"
+	AdminImport       = "admin.import"
+
+	// KeyRotation is recorded once all content is sealed under a new
+	// system key.
+	KeyRotation = "key.rotation"
+)
+
+// Event is something that happened, recorded along with who did it and
+// the request it came with, see WithActor and WithRequest.
+type Event struct {
+	Type string
+	// Snippet is the public ID of the snippet concerned, if any.
+	Snippet string
+	// Details is recorded as JSON, nil records nothing.
+	Details any
+}
+
+// Log appends events to the audit log of a store.
+type Log struct {
+	store db.Store
+	key   []byte
+	now   func() time.Time
+}
+
+// MinKeySize is the minimum size of the audit key once decoded.
+const MinKeySize = 32
+
+// New returns the audit log of store. key is base64 encoded, the entries
+// are hashed with HMAC-SHA256 under it. It is required: without a secret
+// key anyone able to write to the database could edit entries and hash
+// the chain again. The log must always be written and verified with the
+// same key.
+func New(store db.Store, key string) (*Log, error) {
+	if key == "" {
+		return nil, errors.New("an audit key is required")
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit key: %w", err)
+	}
+	if len(raw) < MinKeySize {
+		return nil, fmt.Errorf("audit key must be at least %d bytes when decoded", MinKeySize)
+	}
+	return &Log{store: store, key: raw, now: time.Now}, nil
+}
+
+// Record appends e to the log in a transaction of its own, for events that
+// change nothing else.
+func (l *Log) Record(ctx context.Context, e Event) error {
+	return l.store.WithTx(ctx, func(q sqlc.Querier) error {
+		return l.Append(ctx, q, e)
+	})
+}
+
+// Append appends e to the log within the transaction of q, the one making
+// the change e records, so that neither is committed without the other.
+// Appends are serialized: each one reads the entry it follows and links to
+// it, and holds the log until the transaction ends, Append should be the
+// last statement of the transaction.
+func (l *Log) Append(ctx context.Context, q sqlc.Querier, e Event) error {
+	entry := sqlc.CreateAuditEntryParams{
+		// stored with microsecond precision by every backend
+		CreatedAt: l.now().UTC().Truncate(time.Microsecond),
+		Event:     e.Type,
+		Actor:     Actor(ctx),
+		Snippet:   nullString(e.Snippet),
+		RequestID: nullString(requestlog.RequestID(ctx)),
+	}
+	if req, ok := ctx.Value(requestKey{}).(request); ok {
+		entry.ClientIP = nullString(req.clientIP)
+		entry.UserAgent = nullString(req.userAgent)
+	}
+	if e.Details != nil {
+		details, err := json.Marshal(e.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode the details of %s: %w", e.Type, err)
+		}
+		entry.Details = nullString(string(details))
+	}
+
+	if err := l.append(ctx, q, entry); err != nil {
+		return fmt.Errorf("failed to record %s: %w", e.Type, err)
+	}
+	return nil
+}
+
+// append links entry to the head of the log and moves the head to it. The
+// head row stays locked until the transaction ends, appends wait on it
+// rather than on the log.
+func (l *Log) append(ctx context.Context, q sqlc.Querier, entry sqlc.CreateAuditEntryParams) error {
+	head, err := q.LockAuditHead(ctx)
+	if err != nil {
+		return err
+	}
+	entry.Seq = head.Seq + 1
+	entry.PrevHash = head.Hash
+	if entry.PrevHash == nil {
+		entry.PrevHash = []byte{}
+	}
+	entry.Hash = l.hash(sqlc.AuditLog(entry))
+	if err := q.CreateAuditEntry(ctx, entry); err != nil {
+		return err
+	}
+	return q.UpdateAuditHead(ctx, sqlc.UpdateAuditHeadParams{Seq: entry.Seq, Hash: entry.Hash})
+}
+
+// hash returns the hash of an entry: its fields, the previous hash
+// included, each one length-prefixed so that no two entries encode alike.
+func (l *Log) hash(e sqlc.AuditLog) []byte {
+	h := hmac.New(sha256.New, l.key)
+
+	var buf []byte
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.Seq))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.CreatedAt.UnixMicro()))
+	buf = appendField(buf, true, e.Event)
+	buf = appendField(buf, true, e.Actor)
+	for _, s := range []sql.NullString{e.Snippet, e.ClientIP, e.UserAgent, e.RequestID, e.Details} {
+		buf = appendField(buf, s.Valid, s.String)
+	}
+	buf = appendField(buf, true, string(e.PrevHash))
+	h.Write(buf)
+	return h.Sum(nil)
+}
+
+func appendField(buf []byte, valid bool, s string) []byte {
+	if !valid {
+		return append(buf, 0)
+	}
+	buf = append(buf, 1)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
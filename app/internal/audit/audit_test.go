@@ -0,0 +1,293 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func newLog(t *testing.T, store db.Store, key string) *Log {
+	t.Helper()
+	l, err := New(store, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// recordAll records three events and returns the entries.
+func recordAll(t *testing.T, l *Log) []sqlc.AuditLog {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodDelete, "/snippets/abc", nil)
+	req.RemoteAddr = "192.0.2.7:51234"
+	req.Header.Set("User-Agent", "curl/8.0")
+	ctx := WithRequest(context.Background(), req)
+
+	events := []struct {
+		ctx context.Context
+		e   Event
+	}{
+		{ctx, Event{Type: SnippetCreate, Snippet: "abc"}},
+		{WithActor(ctx, "edit-token"), Event{Type: SnippetDelete, Snippet: "abc"}},
+		{WithActor(context.Background(), "cli:ops"), Event{Type: KeyRotation, Details: map[string]int{"snippets": 1}}},
+	}
+	for _, ev := range events {
+		if err := l.Record(ev.ctx, ev.e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := l.store.Primary().ListAuditEntries(context.Background(), sqlc.ListAuditEntriesParams{MaxRows: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(events) {
+		t.Fatalf("%d entries, want %d", len(rows), len(events))
+	}
+	return rows
+}
+
+func TestLog_Record(t *testing.T) {
+	l := newLog(t, db.NewMemoryStore(), testKey)
+	rows := recordAll(t, l)
+
+	first, second, third := rows[0], rows[1], rows[2]
+	if first.Seq != 1 || len(first.PrevHash) != 0 || first.Actor != Anonymous {
+		t.Errorf("first entry = %+v, want seq 1 by %s with no previous hash", first, Anonymous)
+	}
+	if second.Actor != "edit-token" || second.Snippet.String != "abc" ||
+		second.ClientIP.String != "192.0.2.7" || second.UserAgent.String != "curl/8.0" {
+		t.Errorf("second entry = %+v, want the request details", second)
+	}
+	if string(second.PrevHash) != string(first.Hash) || string(third.PrevHash) != string(second.Hash) {
+		t.Error("entries are not chained")
+	}
+	if third.ClientIP.Valid || third.Details.String != `{"snippets":1}` {
+		t.Errorf("third entry = %+v, want details and no request", third)
+	}
+
+	report, err := l.Verify(context.Background(), Head{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Entries != 3 || report.Head.Seq != 3 {
+		t.Errorf("report = %+v, want 3 intact entries", report)
+	}
+
+	// the head of an earlier verification still chains
+	if report, err := l.Verify(context.Background(), report.Head); err != nil || !report.OK() {
+		t.Errorf("Verify with the head as anchor = %+v, %v", report, err)
+	}
+}
+
+func TestLog_VerifyTampering(t *testing.T) {
+	source := newLog(t, db.NewMemoryStore(), testKey)
+	rows := recordAll(t, source)
+	head := Head{Seq: 3}
+
+	tests := []struct {
+		name string
+		// change returns the entries of a copy of the log
+		change func([]sqlc.AuditLog) []sqlc.AuditLog
+		anchor Head
+		// moveHead points the head of the copy to its last entry rather
+		// than to the last entry of the log
+		moveHead bool
+		key      string
+		want     string
+	}{
+		{
+			name:   "modified",
+			change: func(rows []sqlc.AuditLog) []sqlc.AuditLog { rows[1].Actor = "someone-else"; return rows },
+			want:   "hash mismatch",
+		},
+		{
+			name:   "removed",
+			change: func(rows []sqlc.AuditLog) []sqlc.AuditLog { return append(rows[:1], rows[2]) },
+			want:   "entries 2 to 2 are missing",
+		},
+		{
+			name: "rehashed with another key",
+			change: func(rows []sqlc.AuditLog) []sqlc.AuditLog {
+				rows[1].Actor = "someone-else"
+				forger := &Log{key: []byte("fedcba9876543210fedcba9876543210")}
+				rows[1].Hash = forger.hash(rows[1])
+				rows[2].PrevHash = rows[1].Hash
+				return rows
+			},
+			want: "hash mismatch",
+		},
+		{
+			name:   "truncated",
+			change: func(rows []sqlc.AuditLog) []sqlc.AuditLog { return rows[:2] },
+			want:   "the log ends before its head",
+		},
+		{
+			name:     "truncated with the head",
+			change:   func(rows []sqlc.AuditLog) []sqlc.AuditLog { return rows[:2] },
+			moveHead: true,
+			anchor:   head,
+			want:     "the log ends before the anchor",
+		},
+		{
+			name:   "another key",
+			change: func(rows []sqlc.AuditLog) []sqlc.AuditLog { return rows },
+			key:    base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210")),
+			want:   "hash mismatch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := db.NewMemoryStore()
+			changed := tt.change(append([]sqlc.AuditLog(nil), rows...))
+			for _, row := range changed {
+				if err := store.Primary().CreateAuditEntry(context.Background(), sqlc.CreateAuditEntryParams(row)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			last := rows[len(rows)-1]
+			if tt.moveHead {
+				last = changed[len(changed)-1]
+			}
+			if err := store.Primary().UpdateAuditHead(context.Background(), sqlc.UpdateAuditHeadParams{Seq: last.Seq, Hash: last.Hash}); err != nil {
+				t.Fatal(err)
+			}
+			key := testKey
+			if tt.key != "" {
+				key = tt.key
+			}
+
+			report, err := newLog(t, store, key).Verify(context.Background(), tt.anchor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.OK() {
+				t.Fatal("tampering not detected")
+			}
+			if !strings.Contains(report.Problems[0].Message, tt.want) {
+				t.Errorf("problems = %+v, want %q", report.Problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidKey(t *testing.T) {
+	for _, key := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))} {
+		if _, err := New(db.NewMemoryStore(), key); err == nil {
+			t.Errorf("New(%q) succeeded", key)
+		}
+	}
+}
+
+// sqlStores returns a SQLite store, and a Postgres one if DB_TEST_DSN is set
+// as for the db package tests.
+func sqlStores(t *testing.T) map[string]db.Store {
+	t.Helper()
+	configs := map[string]config.DBConfig{
+		"sqlite": {PrimaryDSN: "sqlite://" + filepath.Join(t.TempDir(), "snippets.db"), MaxOpenConns: 1, AutoMigrate: true},
+	}
+	if dsn := os.Getenv("DB_TEST_DSN"); dsn != "" {
+		configs["postgres"] = config.DBConfig{PrimaryDSN: dsn, MaxOpenConns: 2, AutoMigrate: true}
+	}
+
+	stores := map[string]db.Store{}
+	for name, cfg := range configs {
+		if err := db.EnsureSchema(cfg); err != nil {
+			t.Fatal(err)
+		}
+		store, err := db.NewStore(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		stores[name] = store
+	}
+	return stores
+}
+
+func TestLog_RecordInvalidUserAgent(t *testing.T) {
+	agents := []string{
+		"agent \xff\xfe/1.0",
+		// a two byte rune straddles the bound
+		"a" + strings.Repeat("\u00e9", maxUserAgentLength),
+	}
+
+	for name, store := range sqlStores(t) {
+		t.Run(name, func(t *testing.T) {
+			l := newLog(t, store, testKey)
+			// the store may be shared, only look at the entries recorded here
+			before, err := l.Verify(context.Background(), Head{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, agent := range agents {
+				req := httptest.NewRequest(http.MethodGet, "/snippets/abc", nil)
+				req.Header.Set("User-Agent", agent)
+				if err := l.Record(WithRequest(context.Background(), req), Event{Type: SnippetPasswordFailure, Snippet: "abc"}); err != nil {
+					t.Fatalf("Record with User-Agent %q: %v", agent[:16], err)
+				}
+			}
+
+			rows, err := store.Primary().ListAuditEntries(context.Background(), sqlc.ListAuditEntriesParams{AfterSeq: before.Head.Seq, MaxRows: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(agents) {
+				t.Fatalf("%d entries, want %d", len(rows), len(agents))
+			}
+			for _, row := range rows {
+				if ua := row.UserAgent.String; !utf8.ValidString(ua) || len(ua) > maxUserAgentLength || ua == "" {
+					t.Errorf("stored User-Agent %q, want valid UTF-8 of at most %d bytes", ua, maxUserAgentLength)
+				}
+				// the value read back is the one hashed
+				if string(row.Hash) != string(l.hash(row)) {
+					t.Errorf("entry %d doesn't verify", row.Seq)
+				}
+			}
+		})
+	}
+}
+
+func TestThrottle_Allow(t *testing.T) {
+	th := NewThrottle(time.Minute, 2)
+	now := time.Now()
+
+	steps := []struct {
+		key            string
+		after          time.Duration
+		want           bool
+		wantSuppressed int
+	}{
+		{"a", 0, true, 0},
+		{"a", time.Second, false, 0},
+		{"a", 2 * time.Second, false, 0},
+		{"b", 2 * time.Second, true, 0},
+		{"a", time.Minute, true, 2},
+		{"a", time.Minute + time.Second, false, 0},
+		// a third key makes room by forgetting b, whose interval passed
+		{"c", time.Minute + 30*time.Second, true, 0},
+		{"a", time.Minute + 30*time.Second, false, 0},
+	}
+	for i, step := range steps {
+		ok, suppressed := th.Allow(step.key, now.Add(step.after))
+		if ok != step.want || suppressed != step.wantSuppressed {
+			t.Errorf("step %d: Allow(%q) = %v, %d, want %v, %d", i, step.key, ok, suppressed, step.want, step.wantSuppressed)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Anonymous is the actor of events caused by unauthenticated requests.
+const Anonymous = "anonymous"
+
+// Bounds of the fields recorded that come from the client, in bytes.
+const (
+	maxActorLength     = 255
+	maxClientIPLength  = 64
+	maxUserAgentLength = 512
+)
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx recording events as caused by actor,
+// such as "edit-token" or "cert:<common name>".
+func WithActor(ctx context.Context, actor string) context.Context {
+	// certificate subjects are chosen by whoever issued them
+	return context.WithValue(ctx, actorKey{}, sanitize(actor, maxActorLength))
+}
+
+// Actor returns the actor set by WithActor, Anonymous if there is none.
+func Actor(ctx context.Context) string {
+	if a, ok := ctx.Value(actorKey{}).(string); ok {
+		return a
+	}
+	return Anonymous
+}
+
+type requestKey struct{}
+
+type request struct {
+	clientIP  string
+	userAgent string
+}
+
+// WithRequest returns a copy of ctx recording events with the client IP
+// and user agent of r. The client IP is the peer address of the
+// connection, forwarding headers are not trusted.
+func WithRequest(ctx context.Context, r *http.Request) context.Context {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return context.WithValue(ctx, requestKey{}, request{
+		clientIP:  sanitize(ip, maxClientIPLength),
+		userAgent: sanitize(r.UserAgent(), maxUserAgentLength),
+	})
+}
+
+// Middleware records the events of every request with its client IP and
+// user agent, see WithRequest.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithRequest(r.Context(), r)))
+	})
+}
+
+// sanitize makes a client supplied value storable: invalid UTF-8 and NUL
+// bytes, which headers may carry but TEXT columns reject, are replaced, and
+// it is cut to at most n bytes on a rune boundary.
+func sanitize(s string, n int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	s = strings.ReplaceAll(s, "\x00", "\uFFFD")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
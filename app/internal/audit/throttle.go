@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"sync"
+	"time"
+)
+
+// Throttle limits how often an event about the same key is recorded, for
+// events anyone can cause at will such as wrong passwords: every append
+// waits on the head of the log. Events in between are counted, the count
+// is meant for the details of the next one recorded.
+type Throttle struct {
+	interval time.Duration
+	maxKeys  int
+
+	mu   sync.Mutex
+	keys map[string]throttled
+}
+
+type throttled struct {
+	recorded   time.Time
+	suppressed int
+}
+
+// NewThrottle returns a Throttle recording at most one event per key every
+// interval. It tracks up to maxKeys keys, past that it forgets them and
+// records their next events.
+func NewThrottle(interval time.Duration, maxKeys int) *Throttle {
+	return &Throttle{interval: interval, maxKeys: maxKeys, keys: map[string]throttled{}}
+}
+
+// Allow reports whether an event about key happening at now is to be
+// recorded. If so it returns the number of events about key suppressed
+// since the last one recorded.
+func (t *Throttle) Allow(key string, now time.Time) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if k, ok := t.keys[key]; ok && now.Sub(k.recorded) < t.interval {
+		k.suppressed++
+		t.keys[key] = k
+		return false, 0
+	}
+	suppressed := t.keys[key].suppressed
+	if len(t.keys) >= t.maxKeys {
+		t.prune(now)
+	}
+	t.keys[key] = throttled{recorded: now}
+	return true, suppressed
+}
+
+// prune forgets the keys whose interval has passed, or every key if that
+// leaves too many.
+func (t *Throttle) prune(now time.Time) {
+	for key, k := range t.keys {
+		if now.Sub(k.recorded) >= t.interval {
+			delete(t.keys, key)
+		}
+	}
+	if len(t.keys) >= t.maxKeys {
+		clear(t.keys)
+	}
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+// verifyPageSize is how many entries Verify reads at once.
+const verifyPageSize = 1000
+
+// Problem is a break in the chain found by Verify.
+type Problem struct {
+	Seq     int64  `json:"seq"`
+	Message string `json:"message"`
+}
+
+// Head identifies the last entry of the log, by sequence number and hex
+// encoded hash.
+type Head struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Report is the outcome of Verify.
+type Report struct {
+	Entries int64 `json:"entries"`
+	// Head is the last entry, the zero Head for an empty log. Keeping it
+	// outside the database and passing it to a later Verify detects
+	// entries removed from the end of the log along with the head the
+	// database points to.
+	Head     Head      `json:"head"`
+	Problems []Problem `json:"problems,omitempty"`
+}
+
+// OK reports whether the chain is intact.
+func (r Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify walks the whole log and reports every entry that is missing, out
+// of sequence, not linked to the entry before it or whose hash doesn't
+// match its fields. The log must end at or after the head the database
+// points to, holding that entry unchanged. If anchor isn't the zero Head,
+// the same goes for that entry. The error is only set if the log can't be
+// read.
+func (l *Log) Verify(ctx context.Context, anchor Head) (Report, error) {
+	var report Report
+	problem := func(seq int64, format string, args ...any) {
+		report.Problems = append(report.Problems, Problem{Seq: seq, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// read first, entries appended while the log is walked only add to it
+	row, err := l.store.Primary().GetAuditHead(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to read the audit log head: %w", err)
+	}
+	stored := Head{Seq: row.Seq, Hash: hex.EncodeToString(row.Hash)}
+
+	prevHash := []byte{}
+	for {
+		rows, err := l.store.Primary().ListAuditEntries(ctx, sqlc.ListAuditEntriesParams{
+			AfterSeq: report.Head.Seq,
+			MaxRows:  verifyPageSize,
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to read the audit log: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		for _, row := range rows {
+			if want := report.Head.Seq + 1; row.Seq != want {
+				problem(row.Seq, "entries %d to %d are missing", want, row.Seq-1)
+			}
+			if !bytes.Equal(row.PrevHash, prevHash) {
+				problem(row.Seq, "not linked to the entry before it")
+			}
+			if !bytes.Equal(row.Hash, l.hash(row)) {
+				problem(row.Seq, "hash mismatch, the entry was modified or hashed under another key")
+			}
+			if row.Seq == stored.Seq && hex.EncodeToString(row.Hash) != stored.Hash {
+				problem(row.Seq, "hash differs from the head %s", stored.Hash)
+			}
+			if row.Seq == anchor.Seq && hex.EncodeToString(row.Hash) != anchor.Hash {
+				problem(row.Seq, "hash differs from the anchor %s", anchor.Hash)
+			}
+			report.Entries++
+			report.Head = Head{Seq: row.Seq, Hash: hex.EncodeToString(row.Hash)}
+			prevHash = row.Hash
+		}
+	}
+	if report.Head.Seq < stored.Seq {
+		problem(stored.Seq, "entries %d to %d are missing, the log ends before its head", report.Head.Seq+1, stored.Seq)
+	}
+	if report.Head.Seq < anchor.Seq {
+		problem(anchor.Seq, "entries %d to %d are missing, the log ends before the anchor", report.Head.Seq+1, anchor.Seq)
+	}
+	return report, nil
+}
@@ -0,0 +1,65 @@
+// Package blob stores large snippet bodies outside the database.
+package blob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"snippets.adelh.dev/app/internal/config"
+)
+
+// ErrNotFound is returned by Get when no blob exists under the key.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps opaque blobs under keys chosen by the caller. Blobs are never
+// overwritten, every new body gets a new key from NewKey.
+//
+// Blobs are streamed in and out, so their size is not bounded by memory.
+type Store interface {
+	// Put stores everything read from r under key. If reading r fails,
+	// nothing is stored.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the blob stored under key, the caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob, deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// New opens the Store selected by cfg.Backend. It returns nil if no backend
+// is configured.
+func New(cfg config.BlobConfig) (Store, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case config.BlobBackendFS:
+		return NewFileStore(cfg.Dir)
+	case config.BlobBackendS3:
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.Backend)
+	}
+}
+
+// NewKey returns a random key that is safe to use as a file name and an
+// object key.
+func NewKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("blob: failed to read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// validKey reports whether key was returned by NewKey, so that keys read
+// back from the database can't escape the store's root.
+func validKey(key string) bool {
+	if len(key) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
@@ -0,0 +1,203 @@
+package blob
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"snippets.adelh.dev/app/internal/config"
+)
+
+// testStore runs the behaviour every Store must share.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	key := NewKey()
+	data := bytes.Repeat([]byte("blob "), 1000)
+
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get missing = %v, want ErrNotFound", err)
+	}
+	if err := s.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, err := readBlob(ctx, s, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get = %d bytes, want %d", len(got), len(data))
+	}
+
+	// a body that can't be read completely is not stored
+	failed := NewKey()
+	if err := s.Put(ctx, failed, io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errors.New("broken")))); err == nil {
+		t.Fatal("Put with a failing reader succeeded")
+	}
+	if _, err := s.Get(ctx, failed); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after failed Put = %v, want ErrNotFound", err)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete missing: %v", err)
+	}
+
+	for _, bad := range []string{"", "../../etc/passwd", strings.Repeat("z", 32)} {
+		if err := s.Put(ctx, bad, bytes.NewReader(data)); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func readBlob(ctx context.Context, s Store, key string) ([]byte, error) {
+	rc, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+}
+
+func TestS3Store(t *testing.T) {
+	srv := httptest.NewServer(newFakeS3("snippets"))
+	defer srv.Close()
+
+	s, err := NewS3Store(config.S3Config{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		Bucket:    "snippets",
+		Region:    "us-east-1",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Prefix:    "blobs/",
+		Insecure:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+}
+
+func TestNew(t *testing.T) {
+	s, err := New(config.BlobConfig{})
+	if s != nil || err != nil {
+		t.Errorf("New without backend = %v, %v, want nil, nil", s, err)
+	}
+	if _, err := New(config.BlobConfig{Backend: "tape"}); err == nil {
+		t.Error("New with unknown backend succeeded")
+	}
+	s, err = New(config.BlobConfig{Backend: config.BlobBackendFS, Dir: t.TempDir()})
+	if _, ok := s.(*FileStore); !ok || err != nil {
+		t.Errorf("New fs = %T, %v, want *FileStore", s, err)
+	}
+}
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible service
+// serving a single bucket with path-style requests. It doesn't check
+// signatures.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: map[string][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := readS3Body(r)
+		if err != nil {
+			f.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = body
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("ETag", `"etag"`)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code><Message>"+code+"</Message></Error>")
+}
+
+// readS3Body returns the payload of a PUT, decoding the aws-chunked framing
+// clients use for streaming signatures.
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var out []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return out, nil
+		}
+		chunk := make([]byte, size+2) // data and CRLF
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		out = append(out, chunk[:size]...)
+	}
+}
@@ -0,0 +1,111 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"snippets.adelh.dev/app/internal/config"
+)
+
+// S3Store keeps blobs as objects in a bucket of an S3-compatible service.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+var _ Store = (*S3Store)(nil)
+
+// NewS3Store connects to the bucket lazily, the bucket must already exist.
+// Requests use path-style addressing so that self-hosted services work
+// without wildcard DNS.
+func NewS3Store(cfg config.S3Config) (*S3Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       !cfg.Insecure,
+		Region:       cfg.Region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+	return &S3Store{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+func (s *S3Store) object(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return s.prefix + key, nil
+}
+
+// s3PartSize is the size of the parts large blobs are uploaded in, each
+// upload holds one part in memory.
+const s3PartSize = 8 << 20
+
+// Put uploads blobs that fit in one part with a single request and larger
+// ones as a multipart upload, since their size isn't known in advance.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) error {
+	name, err := s.object(key)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, buf)
+	size := int64(n)
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		r = bytes.NewReader(buf[:n])
+	case err != nil:
+		return fmt.Errorf("failed to read blob: %w", err)
+	default:
+		r, size = io.MultiReader(bytes.NewReader(buf), r), -1
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, name, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    s3PartSize,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload blob: %w", err)
+	}
+	return nil
+}
+
+// Get checks that the object exists before returning it, minio only
+// requests it on the first read.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob: %w", err)
+	}
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download blob: %w", err)
+	}
+	return obj, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	name, err := s.object(key)
+	if err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"snippets.adelh.dev/app/internal/config"
+)
+
+// Codec serializes values stored in the cache.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// ErrStaleEntry is returned by a Codec when a cached entry was written by a
+// different codec, format version or Go type and has to be discarded.
+var ErrStaleEntry = errors.New("cache entry has an incompatible encoding")
+
+// NewCodec returns the codec registered under name.
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case config.RedisCodecBinary, "":
+		return BinaryCodec{}, nil
+	case config.RedisCodecJSON:
+		return JSONCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown cache codec %q", name)
+	}
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	if len(data) > 0 && data[0] == binaryMagic {
+		return ErrStaleEntry
+	}
+	return json.Unmarshal(data, v)
+}
+
+const (
+	binaryMagic   byte = 0xc5
+	binaryVersion byte = 1
+	// magic + version + 4 byte type fingerprint
+	binaryHeaderSize = 6
+)
+
+// BinaryCodec is a compact, reflection based encoding for plain Go values.
+//
+// Entries start with a header holding a format version and a fingerprint of
+// the encoded type, so entries written by an older release, or for a struct
+// whose fields have since changed, are rejected with ErrStaleEntry instead of
+// being decoded into garbage. Byte slices are stored raw, which keeps
+// ciphertext at its original size.
+//
+// Supported kinds are booleans, integers, floats, strings, slices, pointers,
+// structs (exported fields only) and time.Time.
+type BinaryCodec struct{}
+
+func (BinaryCodec) Marshal(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, errors.New("cannot encode nil value")
+	}
+
+	fp, err := fingerprint(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, binaryHeaderSize, binaryHeaderSize+64)
+	buf[0] = binaryMagic
+	buf[1] = binaryVersion
+	binary.BigEndian.PutUint32(buf[2:], fp)
+
+	return appendValue(buf, rv)
+}
+
+func (BinaryCodec) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("unmarshal target must be a non-nil pointer")
+	}
+	rv = rv.Elem()
+
+	if len(data) < binaryHeaderSize || data[0] != binaryMagic || data[1] != binaryVersion {
+		return ErrStaleEntry
+	}
+	fp, err := fingerprint(rv.Type())
+	if err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(data[2:]) != fp {
+		return ErrStaleEntry
+	}
+
+	d := decoder{buf: data[binaryHeaderSize:]}
+	if err := d.value(rv); err != nil {
+		return err
+	}
+	if len(d.buf) != 0 {
+		return fmt.Errorf("%d trailing bytes after cache entry", len(d.buf))
+	}
+	return nil
+}
+
+var (
+	timeType     = reflect.TypeFor[time.Time]()
+	fingerprints sync.Map // reflect.Type -> uint32
+)
+
+// fingerprint hashes the shape of t: field names, order and kinds.
+func fingerprint(t reflect.Type) (uint32, error) {
+	if fp, ok := fingerprints.Load(t); ok {
+		return fp.(uint32), nil
+	}
+
+	var sb strings.Builder
+	if err := describe(&sb, t); err != nil {
+		return 0, err
+	}
+	h := fnv.New32a()
+	h.Write([]byte(sb.String()))
+	fp := h.Sum32()
+
+	fingerprints.Store(t, fp)
+	return fp, nil
+}
+
+func describe(sb *strings.Builder, t reflect.Type) error {
+	if t == timeType {
+		sb.WriteString("time")
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		sb.WriteString(t.Kind().String())
+	case reflect.Slice:
+		sb.WriteString("[]")
+		return describe(sb, t.Elem())
+	case reflect.Pointer:
+		sb.WriteString("*")
+		return describe(sb, t.Elem())
+	case reflect.Struct:
+		sb.WriteString("struct{")
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			sb.WriteString(f.Name)
+			sb.WriteByte(' ')
+			if err := describe(sb, f.Type); err != nil {
+				return err
+			}
+			sb.WriteByte(';')
+		}
+		sb.WriteString("}")
+	default:
+		return fmt.Errorf("binary codec: unsupported type %s", t)
+	}
+	return nil
+}
+
+func appendValue(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.Type() == timeType {
+		b, err := v.Interface().(time.Time).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(b)))
+		return append(buf, b...), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.AppendUvarint(buf, v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		buf = binary.AppendUvarint(buf, uint64(v.Len()))
+		return append(buf, v.String()...), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			buf = binary.AppendUvarint(buf, uint64(v.Len()))
+			return append(buf, v.Bytes()...), nil
+		}
+		buf = binary.AppendUvarint(buf, uint64(v.Len()))
+		for i := range v.Len() {
+			var err error
+			if buf, err = appendValue(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		return appendValue(append(buf, 1), v.Elem())
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			var err error
+			if buf, err = appendValue(buf, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("binary codec: unsupported type %s", v.Type())
+	}
+}
+
+var errShortBuffer = errors.New("binary codec: unexpected end of data")
+
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) uvarint() (uint64, error) {
+	x, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		return 0, errShortBuffer
+	}
+	d.buf = d.buf[n:]
+	return x, nil
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(d.buf)) < n {
+		return nil, errShortBuffer
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *decoder) value(v reflect.Value) error {
+	if v.Type() == timeType {
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		var t time.Time
+		if err := t.UnmarshalBinary(b); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if len(d.buf) < 1 {
+			return errShortBuffer
+		}
+		v.SetBool(d.buf[0] == 1)
+		d.buf = d.buf[1:]
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, n := binary.Varint(d.buf)
+		if n <= 0 {
+			return errShortBuffer
+		}
+		d.buf = d.buf[n:]
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		if len(d.buf) < 8 {
+			return errShortBuffer
+		}
+		v.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(d.buf)))
+		d.buf = d.buf[8:]
+	case reflect.String:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		n, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		if n > uint64(len(d.buf)) {
+			// every element takes at least one byte
+			return errShortBuffer
+		}
+		s := reflect.MakeSlice(v.Type(), int(n), int(n))
+		for i := range int(n) {
+			if err := d.value(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Pointer:
+		if len(d.buf) < 1 {
+			return errShortBuffer
+		}
+		isSet := d.buf[0] == 1
+		d.buf = d.buf[1:]
+		if !isSet {
+			v.SetZero()
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := d.value(p.Elem()); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := d.value(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("binary codec: unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+func newSnippetRow(contentSize int) sqlc.GetSnippetByPublicIDRow {
+	content := make([]byte, contentSize)
+	rand.Read(content)
+
+	return sqlc.GetSnippetByPublicIDRow{
+		ID:               4242,
+		PublicID:         "abc-defg-hij",
+		Title:            sql.NullString{String: "panic in worker pool", Valid: true},
+		CreatedAt:        time.Now().UTC(),
+		ExpiresAt:        sql.NullTime{Time: time.Now().Add(24 * time.Hour).UTC(), Valid: true},
+		PasswordHash:     sql.NullString{String: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", Valid: true},
+		EditToken:        "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		ViewCount:        17,
+		LastEditedAt:     sql.NullTime{},
+		ContentType:      "text/plain",
+		EncryptedContent: content,
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	want := newSnippetRow(512)
+
+	for _, codec := range []Codec{JSONCodec{}, BinaryCodec{}} {
+		t.Run(fmt.Sprintf("%T", codec), func(t *testing.T) {
+			data, err := codec.Marshal(want)
+			if err != nil {
+				t.Fatalf("Marshal() error: %v", err)
+			}
+
+			var got sqlc.GetSnippetByPublicIDRow
+			if err := codec.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+
+			if got.ID != want.ID || got.PublicID != want.PublicID || got.Title != want.Title ||
+				got.PasswordHash != want.PasswordHash || got.EditToken != want.EditToken ||
+				got.ViewCount != want.ViewCount || got.ContentType != want.ContentType ||
+				got.LastEditedAt.Valid != want.LastEditedAt.Valid {
+				t.Errorf("round trip mismatch:\n got %+v\nwant %+v", got, want)
+			}
+			if !got.CreatedAt.Equal(want.CreatedAt) || !got.ExpiresAt.Time.Equal(want.ExpiresAt.Time) || !got.ExpiresAt.Valid {
+				t.Errorf("timestamps mismatch: got %v/%v, want %v/%v", got.CreatedAt, got.ExpiresAt, want.CreatedAt, want.ExpiresAt)
+			}
+			if !bytes.Equal(got.EncryptedContent, want.EncryptedContent) {
+				t.Error("encrypted content mismatch")
+			}
+		})
+	}
+}
+
+func TestBinaryCodec_StaleEntries(t *testing.T) {
+	row := newSnippetRow(64)
+
+	jsonData, err := JSONCodec{}.Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dst sqlc.GetSnippetByPublicIDRow
+	if err := (BinaryCodec{}).Unmarshal(jsonData, &dst); !errors.Is(err, ErrStaleEntry) {
+		t.Errorf("decoding a JSON entry: got %v, want ErrStaleEntry", err)
+	}
+
+	binData, err := BinaryCodec{}.Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (JSONCodec{}).Unmarshal(binData, &dst); !errors.Is(err, ErrStaleEntry) {
+		t.Errorf("decoding a binary entry as JSON: got %v, want ErrStaleEntry", err)
+	}
+
+	old := bytes.Clone(binData)
+	old[1] = binaryVersion - 1
+	if err := (BinaryCodec{}).Unmarshal(old, &dst); !errors.Is(err, ErrStaleEntry) {
+		t.Errorf("decoding an older version: got %v, want ErrStaleEntry", err)
+	}
+
+	// A struct whose shape changed must not decode entries of the old shape.
+	var changed struct {
+		ID       int32
+		PublicID string
+	}
+	if err := (BinaryCodec{}).Unmarshal(binData, &changed); !errors.Is(err, ErrStaleEntry) {
+		t.Errorf("decoding into a different type: got %v, want ErrStaleEntry", err)
+	}
+
+	if err := (BinaryCodec{}).Unmarshal(binData[:len(binData)-10], &dst); err == nil {
+		t.Error("decoding a truncated entry: expected error")
+	}
+}
+
+func TestBinaryCodec_Kinds(t *testing.T) {
+	type inner struct {
+		Tags []string
+	}
+	type value struct {
+		B      bool
+		I      int
+		I8     int8
+		U64    uint64
+		F      float64
+		S      string
+		Ptr    *inner
+		NilPtr *inner
+		Nested []inner
+		hidden int
+	}
+	want := value{
+		B: true, I: -42, I8: -8, U64: 1 << 63, F: 3.25, S: "héllo",
+		Ptr:    &inner{Tags: []string{"a", "b"}},
+		Nested: []inner{{Tags: []string{}}, {Tags: []string{"c"}}},
+		hidden: 7,
+	}
+
+	data, err := BinaryCodec{}.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	var got value
+	if err := (BinaryCodec{}).Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+
+	if got.B != want.B || got.I != want.I || got.I8 != want.I8 || got.U64 != want.U64 ||
+		got.F != want.F || got.S != want.S || got.NilPtr != nil || got.hidden != 0 {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got.Ptr == nil || len(got.Ptr.Tags) != 2 || got.Ptr.Tags[1] != "b" {
+		t.Errorf("pointer field: got %+v", got.Ptr)
+	}
+	if len(got.Nested) != 2 || len(got.Nested[1].Tags) != 1 || got.Nested[1].Tags[0] != "c" {
+		t.Errorf("nested slice: got %+v", got.Nested)
+	}
+
+	if _, err := (BinaryCodec{}).Marshal(map[string]int{"a": 1}); err == nil {
+		t.Error("expected error for unsupported map type")
+	}
+}
+
+var benchmarkSizes = []struct {
+	name string
+	size int
+}{
+	{"1KB", 1 << 10},
+	{"64KB", 64 << 10},
+	{"1MB", 1 << 20},
+}
+
+func BenchmarkCodec_Marshal(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		row := newSnippetRow(size.size)
+		for _, codec := range []Codec{JSONCodec{}, BinaryCodec{}} {
+			b.Run(fmt.Sprintf("%T/%s", codec, size.name), func(b *testing.B) {
+				data, err := codec.Marshal(row)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportMetric(float64(len(data)), "encoded-bytes")
+				b.SetBytes(int64(size.size))
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for range b.N {
+					if _, err := codec.Marshal(row); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkCodec_Unmarshal(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		row := newSnippetRow(size.size)
+		for _, codec := range []Codec{JSONCodec{}, BinaryCodec{}} {
+			b.Run(fmt.Sprintf("%T/%s", codec, size.name), func(b *testing.B) {
+				data, err := codec.Marshal(row)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(int64(size.size))
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for range b.N {
+					var dst sqlc.GetSnippetByPublicIDRow
+					if err := codec.Unmarshal(data, &dst); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -2,18 +2,31 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/metrics"
 )
 
 type RedisCache struct {
-	client  *redis.Client
-	ttl     time.Duration
+	client redis.UniversalClient
+	codec  Codec
+	ttl    time.Duration
+	// live overrides ttl if set, see Follow.
+	live    *config.Live
 	logger  *slog.Logger
+	tracer  trace.Tracer
 	enabled bool
 }
 
@@ -23,25 +36,128 @@ func NewRedisCache(cfg config.RedisConfig) *RedisCache {
 		logger = slog.Default()
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.Addr,
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+	codec, err := NewCodec(cfg.Codec)
+	if err != nil {
+		logger.Error("invalid cache codec, falling back to binary", "error", err)
+		codec = BinaryCodec{}
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		// Misconfiguration must not take the service down, the cache is optional.
+		logger.Error("redis client setup failed, caching disabled", "error", err)
+		cfg.Enabled = false
+		client = redis.NewClient(&redis.Options{Addr: cfg.Addr})
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
-	if err := client.Ping(ctx).Err(); err != nil {
-		logger.Error("redis connection failed", "error", err)
+	if cfg.Enabled {
+		if err := client.Ping(ctx).Err(); err != nil {
+			logger.Error("redis connection failed", "mode", cfg.Mode, "error", err)
+		}
 	}
 
-	return &RedisCache{
+	c := &RedisCache{
 		client:  client,
-		ttl:     cfg.TTL,
+		codec:   codec,
 		logger:  logger,
+		tracer:  otel.Tracer("snippets.adelh.dev/app/internal/cache"),
 		enabled: cfg.Enabled,
+		ttl:     cfg.TTL,
+	}
+	return c
+}
+
+// Follow makes the cache keep the entries it caches from now on for the
+// TTL of the configuration in effect in live, rather than the one it was
+// created with. It must be called before the cache is used.
+func (c *RedisCache) Follow(live *config.Live) {
+	c.live = live
+}
+
+func (c *RedisCache) entryTTL() time.Duration {
+	if c.live != nil {
+		return c.live.Load().Redis.TTL
+	}
+	return c.ttl
+}
+
+// newClient builds the client matching the configured topology.
+func newClient(cfg config.RedisConfig) (redis.UniversalClient, error) {
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		DB:               cfg.DB,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		MasterName:       cfg.MasterName,
+		TLSConfig:        tlsConfig,
+
+		PoolSize:        cfg.Pool.PoolSize,
+		MinIdleConns:    cfg.Pool.MinIdleConns,
+		MaxIdleConns:    cfg.Pool.MaxIdleConns,
+		PoolTimeout:     cfg.Pool.PoolTimeout,
+		ConnMaxIdleTime: cfg.Pool.ConnMaxIdleTime,
+		ConnMaxLifetime: cfg.Pool.ConnMaxLifetime,
+		DialTimeout:     cfg.Pool.DialTimeout,
+		ReadTimeout:     cfg.Pool.ReadTimeout,
+		WriteTimeout:    cfg.Pool.WriteTimeout,
+	}
+
+	switch cfg.Mode {
+	case config.RedisModeSentinel:
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case config.RedisModeCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	case config.RedisModeStandalone, "":
+		opts.Addrs = []string{cfg.Addr}
+		return redis.NewClient(opts.Simple()), nil
+	default:
+		return nil, fmt.Errorf("unsupported redis mode %q", cfg.Mode)
+	}
+}
+
+// newTLSConfig returns nil when TLS is disabled.
+func newTLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
 	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("redis CA file contains no valid certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
 // Get retrieves a value from the cache into dst.
@@ -51,19 +167,35 @@ func (c *RedisCache) Get(ctx context.Context, key string, dst any) bool {
 	if !c.enabled {
 		return false
 	}
-	val, err := c.client.Get(ctx, key).Result()
+	ctx, span := c.startSpan(ctx, "get", key)
+	defer span.End()
+
+	val, err := c.client.Get(ctx, key).Bytes()
 	if err != nil {
 		if err != redis.Nil {
 			c.logger.Warn("redis get failed", "key", key, "error", err)
+			metrics.CacheRequest("get", metrics.CacheError)
+			spanError(span, err)
+		} else {
+			metrics.CacheRequest("get", metrics.CacheMiss)
+			span.SetAttributes(attribute.Bool("cache.hit", false))
 		}
 		return false
 	}
 
-	if err := json.Unmarshal([]byte(val), dst); err != nil {
-		c.logger.Warn("failed to unmarshal cached value", "key", key, "error", err)
+	if err := c.codec.Unmarshal(val, dst); err != nil {
+		if errors.Is(err, ErrStaleEntry) {
+			c.logger.Debug("dropping stale cache entry", "key", key)
+			metrics.CacheRequest("get", metrics.CacheMiss)
+		} else {
+			c.logger.Warn("failed to unmarshal cached value", "key", key, "error", err)
+			metrics.CacheRequest("get", metrics.CacheError)
+		}
 		c.client.Del(ctx, key)
 		return false
 	}
+	metrics.CacheRequest("get", metrics.CacheHit)
+	span.SetAttributes(attribute.Bool("cache.hit", true))
 	return true
 }
 
@@ -73,15 +205,29 @@ func (c *RedisCache) Set(ctx context.Context, key string, value any) {
 	if !c.enabled {
 		return
 	}
-	data, err := json.Marshal(value)
+	ctx, span := c.startSpan(ctx, "set", key)
+	defer span.End()
+
+	data, err := c.codec.Marshal(value)
 	if err != nil {
 		c.logger.Warn("failed to marshal value for cache", "key", key, "error", err)
+		spanError(span, err)
 		return
 	}
 
-	if err := c.client.Set(ctx, key, data, c.ttl).Err(); err != nil {
+	if err := c.client.Set(ctx, key, data, c.entryTTL()).Err(); err != nil {
 		c.logger.Warn("failed to set cache key", "key", key, "error", err)
+		metrics.CacheRequest("set", metrics.CacheError)
+		spanError(span, err)
+		return
 	}
+	metrics.CacheRequest("set", metrics.CacheOK)
+}
+
+// SnippetKey returns the key a snippet is cached under when it is read by
+// name, its public ID or its slug.
+func SnippetKey(name string) string {
+	return "snippet:" + name
 }
 
 // Delete removes a key from the cache.
@@ -89,9 +235,46 @@ func (c *RedisCache) Delete(ctx context.Context, key string) {
 	if !c.enabled {
 		return
 	}
+	ctx, span := c.startSpan(ctx, "delete", key)
+	defer span.End()
+
 	if err := c.client.Del(ctx, key).Err(); err != nil {
 		c.logger.Warn("failed to delete cache key", "key", key, "error", err)
+		metrics.CacheRequest("delete", metrics.CacheError)
+		spanError(span, err)
+		return
 	}
+	metrics.CacheRequest("delete", metrics.CacheOK)
+}
+
+// Enabled reports whether values are cached, it is false if the cache is
+// disabled or misconfigured.
+func (c *RedisCache) Enabled() bool {
+	return c.enabled
+}
+
+// Ping checks that Redis is reachable.
+func (c *RedisCache) Ping(ctx context.Context) error {
+	ctx, span := c.startSpan(ctx, "ping", "")
+	defer span.End()
+	err := c.client.Ping(ctx).Err()
+	if err != nil {
+		spanError(span, err)
+	}
+	return err
+}
+
+func (c *RedisCache) startSpan(ctx context.Context, op, key string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("db.system", "redis")}
+	if key != "" {
+		attrs = append(attrs, attribute.String("cache.key", key))
+	}
+	return c.tracer.Start(ctx, "cache."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
 }
 
 // Close closes the Redis client.
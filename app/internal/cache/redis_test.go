@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"snippets.adelh.dev/app/internal/config"
+)
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.RedisConfig
+		want    any
+		wantErr bool
+	}{
+		{
+			name: "standalone",
+			cfg:  config.RedisConfig{Mode: config.RedisModeStandalone, Addr: "localhost:6379"},
+			want: &redis.Client{},
+		},
+		{
+			name: "sentinel",
+			cfg: config.RedisConfig{
+				Mode:       config.RedisModeSentinel,
+				Addrs:      []string{"sentinel-0:26379", "sentinel-1:26379"},
+				MasterName: "mymaster",
+			},
+			want: &redis.Client{},
+		},
+		{
+			name: "cluster",
+			cfg: config.RedisConfig{
+				Mode:  config.RedisModeCluster,
+				Addrs: []string{"node-0:6379", "node-1:6379"},
+			},
+			want: &redis.ClusterClient{},
+		},
+		{
+			name:    "unknown mode",
+			cfg:     config.RedisConfig{Mode: "ring"},
+			wantErr: true,
+		},
+		{
+			name: "missing CA file",
+			cfg: config.RedisConfig{
+				Mode: config.RedisModeStandalone,
+				TLS:  config.RedisTLSConfig{Enabled: true, CAFile: "/nonexistent/ca.pem"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newClient(tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer client.Close()
+
+			switch tt.want.(type) {
+			case *redis.Client:
+				if _, ok := client.(*redis.Client); !ok {
+					t.Errorf("got %T, want *redis.Client", client)
+				}
+			case *redis.ClusterClient:
+				if _, ok := client.(*redis.ClusterClient); !ok {
+					t.Errorf("got %T, want *redis.ClusterClient", client)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	tlsConfig, err := newTLSConfig(config.RedisTLSConfig{})
+	if err != nil || tlsConfig != nil {
+		t.Fatalf("disabled TLS: got %v, %v; want nil, nil", tlsConfig, err)
+	}
+
+	tlsConfig, err = newTLSConfig(config.RedisTLSConfig{Enabled: true, ServerName: "redis.internal"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tlsConfig.ServerName != "redis.internal" {
+		t.Errorf("ServerName = %q, want %q", tlsConfig.ServerName, "redis.internal")
+	}
+}
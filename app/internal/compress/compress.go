@@ -0,0 +1,205 @@
+// Package compress picks and applies the compression used for snippet
+// content before it is encrypted.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithm identifies a compression format. The values are persisted and
+// must not change.
+type Algorithm byte
+
+const (
+	None Algorithm = 0
+	Gzip Algorithm = 1
+	Zstd Algorithm = 2
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case None:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("Algorithm(%d)", byte(a))
+	}
+}
+
+// ErrTooLarge is returned by Decompress when the output exceeds its limit.
+var ErrTooLarge = errors.New("decompressed content exceeds the size limit")
+
+const (
+	// minSize is the smallest input worth compressing, below it the
+	// format overhead eats most of the gain.
+	minSize = 512
+	// zstdMinSize is where zstd takes over from gzip. Its larger window
+	// pays off on big inputs, on small ones both end up close.
+	zstdMinSize = 32 * 1024
+	// maxEntropy in bits per byte, above it the input is most likely
+	// already compressed or encrypted.
+	maxEntropy = 7.5
+	// entropySample bounds the bytes inspected by Choose.
+	entropySample = 64 * 1024
+)
+
+// Choose returns the algorithm to use for data based on its size and an
+// entropy estimate of its beginning.
+func Choose(data []byte) Algorithm {
+	if len(data) < minSize {
+		return None
+	}
+	if entropy(data[:min(len(data), entropySample)]) > maxEntropy {
+		return None
+	}
+	if len(data) < zstdMinSize {
+		return Gzip
+	}
+	return Zstd
+}
+
+// entropy returns the Shannon entropy of data in bits per byte.
+func entropy(data []byte) float64 {
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	var h float64
+	n := float64(len(data))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// zstdEncoder is safe for concurrent use with EncodeAll.
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+
+// Compress compresses data with a.
+func Compress(a Algorithm, data []byte) ([]byte, error) {
+	switch a {
+	case None:
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %s", a)
+	}
+}
+
+// Decompress reverses Compress. It stops with ErrTooLarge as soon as the
+// output grows beyond limit bytes, so a small input can't expand into an
+// arbitrarily large allocation.
+func Decompress(a Algorithm, data []byte, limit int64) ([]byte, error) {
+	var r io.Reader
+	switch a {
+	case None:
+		if int64(len(data)) > limit {
+			return nil, ErrTooLarge
+		}
+		return data, nil
+	case Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case Zstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data),
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(limit)+1),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd data: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unknown compression %s", a)
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return nil, ErrTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s data: %w", a, err)
+	}
+	if int64(len(out)) > limit {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
+
+// NewWriter returns a writer that compresses to w with a. Close flushes the
+// compressed stream, it does not close w.
+func NewWriter(a Algorithm, w io.Writer) (io.WriteCloser, error) {
+	switch a {
+	case None:
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w,
+			zstd.WithEncoderLevel(zstd.SpeedDefault),
+			zstd.WithEncoderConcurrency(1),
+		)
+	default:
+		return nil, fmt.Errorf("unknown compression %s", a)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewReader returns a reader of the data compressed with a read from r.
+// Unlike Decompress it doesn't bound the output, callers stream it rather
+// than hold it.
+func NewReader(a Algorithm, r io.Reader) (io.ReadCloser, error) {
+	switch a {
+	case None:
+		return io.NopCloser(r), nil
+	case Gzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		return zr, nil
+	case Zstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd data: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %s", a)
+	}
+}
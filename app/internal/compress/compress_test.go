@@ -0,0 +1,111 @@
+package compress
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestChoose(t *testing.T) {
+	random := make([]byte, 64*1024)
+	rand.Read(random)
+
+	tests := []struct {
+		name string
+		data []byte
+		want Algorithm
+	}{
+		{"tiny", []byte("hello world"), None},
+		{"small text", []byte(strings.Repeat("GET /health 200 3ms\n", 100)), Gzip},
+		{"large log", []byte(strings.Repeat("level=info msg=\"request served\" status=200\n", 2000)), Zstd},
+		{"random", random, None},
+	}
+	for _, tt := range tests {
+		if got := Choose(tt.data); got != tt.want {
+			t.Errorf("Choose(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("level=info msg=\"request served\" status=200\n", 2000))
+	for _, a := range []Algorithm{None, Gzip, Zstd} {
+		compressed, err := Compress(a, data)
+		if err != nil {
+			t.Fatalf("Compress(%s): %v", a, err)
+		}
+		if a != None && len(compressed) >= len(data)/10 {
+			t.Errorf("%s compressed %d bytes to %d, want at least 10x", a, len(data), len(compressed))
+		}
+		got, err := Decompress(a, compressed, int64(len(data)))
+		if err != nil {
+			t.Fatalf("Decompress(%s): %v", a, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s round trip changed the data", a)
+		}
+	}
+}
+
+// The streaming writers and readers use the same formats as Compress and
+// Decompress.
+func TestStreams(t *testing.T) {
+	data := []byte(strings.Repeat("level=info msg=\"request served\" status=200\n", 2000))
+	for _, a := range []Algorithm{None, Gzip, Zstd} {
+		var buf bytes.Buffer
+		w, err := NewWriter(a, &buf)
+		if err != nil {
+			t.Fatalf("NewWriter(%s): %v", a, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Decompress(a, buf.Bytes(), int64(len(data)))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: Decompress of the streamed output = %d bytes, %v", a, len(got), err)
+		}
+
+		compressed, err := Compress(a, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(a, bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("NewReader(%s): %v", a, err)
+		}
+		got, err = io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: streamed read of Compress output = %d bytes, %v", a, len(got), err)
+		}
+	}
+}
+
+func TestDecompress_Limit(t *testing.T) {
+	// a bomb: 16 MiB of zeros compresses to a few KiB
+	data := make([]byte, 16<<20)
+	for _, a := range []Algorithm{None, Gzip, Zstd} {
+		compressed, err := Compress(a, data)
+		if err != nil {
+			t.Fatalf("Compress(%s): %v", a, err)
+		}
+		_, err = Decompress(a, compressed, 1<<20)
+		if !errors.Is(err, ErrTooLarge) {
+			t.Errorf("Decompress(%s) error = %v, want ErrTooLarge", a, err)
+		}
+	}
+}
+
+func TestDecompress_Invalid(t *testing.T) {
+	for _, a := range []Algorithm{Gzip, Zstd, Algorithm(9)} {
+		if _, err := Decompress(a, []byte("not compressed"), 1024); err == nil {
+			t.Errorf("Decompress(%s) of garbage succeeded", a)
+		}
+	}
+}
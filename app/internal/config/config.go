@@ -1,179 +1,685 @@
 package config
 
 import (
-	"fmt"
+	"encoding/base64"
 	"log/slog"
-	"os"
+	"mime"
+	"net"
 	"strconv"
+	"strings"
 	"time"
+
+	"snippets.adelh.dev/app/internal/publicid"
 )
 
 type Config struct {
-	Server ServerConfig
-	DB     DBConfig
-	Enc    EncryptionConfig
-	Redis  RedisConfig
+	Server    ServerConfig
+	DB        DBConfig
+	Enc       EncryptionConfig
+	Redis     RedisConfig
+	PublicID  publicid.Format
+	Retention RetentionConfig
+	Content   ContentConfig
+	Blob      BlobConfig
+	Health    HealthConfig
+	Tracing   TracingConfig
+	Log       LogConfig
+	Reload    ReloadConfig
+	Admin     AdminConfig
+	Audit     AuditConfig
+
+	// File is the config file the configuration was read from, if any.
+	File string
+	// settings holds the effective value of every setting, for Print.
+	settings map[string]value
 }
 
 type ServerConfig struct {
 	Host string
 	Port int
+	// MaxUploadSize bounds raw uploads in bytes. They are streamed to blob
+	// storage if it is configured, JSON requests are bounded separately.
+	// Without BLOB_BACKEND raw uploads are held in memory and bounded like
+	// JSON requests instead.
+	MaxUploadSize int64
+	// ShutdownTimeout is how long in-flight requests are given to complete
+	// on shutdown before their connections are closed.
+	ShutdownTimeout time.Duration
+	// ShutdownDelay is how long the server keeps serving after it reports
+	// not ready on shutdown, so load balancers stop sending it requests
+	// before connections are drained.
+	ShutdownDelay time.Duration
+	// PublicMetrics serves /metrics on the public listener, not only on
+	// the admin one.
+	PublicMetrics bool
 }
 type EncryptionConfig struct {
 	SystemKey string
+	// PreviousKeys are system keys that were rotated out. They only
+	// decrypt, content still encrypted under them is moved to SystemKey
+	// with the reencrypt command.
+	PreviousKeys []string
+	// DedupKey is the HMAC key used to find snippets with identical content,
+	// deduplication is disabled without it.
+	DedupKey string
+}
+
+// RetentionConfig controls how long deleted snippets are kept.
+type RetentionConfig struct {
+	// RestoreWindow is how long a deleted snippet can be restored with its
+	// edit token before it is purged.
+	RestoreWindow time.Duration
+	// PurgeInterval is how often snippets deleted longer than RestoreWindow
+	// ago are removed for good, zero disables the purge job.
+	PurgeInterval time.Duration
+}
+
+// ContentConfig is the policy snippet content is accepted under.
+type ContentConfig struct {
+	// AllowedTypes lists the media types snippets can be created with,
+	// such as text/plain, or text/* for all of a type. Empty allows any.
+	AllowedTypes []string
+}
+
+// Allows reports whether snippets of contentType are accepted, its
+// parameters aside.
+func (c ContentConfig) Allows(contentType string) bool {
+	if len(c.AllowedTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.AllowedTypes {
+		if allowed == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Optional components HealthConfig.Required can make required.
+const (
+	HealthRedis    = "redis"
+	HealthReplicas = "replicas"
+)
+
+// HealthConfig controls the readiness checks. The primary database, the
+// schema and the encryption key are always required, a failure of any
+// other component only degrades readiness unless it is listed in Required.
+type HealthConfig struct {
+	Required []string
+	// CheckTimeout bounds each readiness check.
+	CheckTimeout time.Duration
+}
+
+// ReloadConfig controls when the configuration is reloaded while the server
+// runs. It is always reloaded on SIGHUP.
+type ReloadConfig struct {
+	// Interval is how often the config file is checked for changes, zero
+	// disables the check.
+	Interval time.Duration
+}
+
+// AdminConfig controls the admin API, served on a listener of its own so it
+// can be kept off the public network.
+type AdminConfig struct {
+	Host string
+	// Port is where the admin API listens, zero disables it.
+	Port int
+	// Token authenticates requests sent with it as a bearer token. It needs
+	// TLS unless Host is a loopback address.
+	Token string
+	// TLSCertFile and TLSKeyFile serve the admin API over TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// ClientCAFile authenticates clients presenting a certificate signed by
+	// one of its CAs, with TLS required.
+	ClientCAFile string
+	// BreakGlass allows reading the decrypted content of snippets through
+	// the admin API, every read is audited.
+	BreakGlass bool
+}
+
+// AuditConfig controls the audit log.
+type AuditConfig struct {
+	// Key is the HMAC key the entries of the audit log are chained with,
+	// base64 encoded and at least 32 bytes once decoded. It is required,
+	// the log is only tamper-evident to someone without it. Changing it
+	// breaks verification of the entries written before.
+	Key string
+}
+
+// Log formats supported by LogConfig.Format.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogConfig controls the records written to stderr.
+type LogConfig struct {
+	Format string
+	Level  slog.Level
+}
+
+// Trace exporters supported by TracingConfig.Exporter.
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+// TracingConfig selects where OpenTelemetry spans are exported. With no
+// exporter trace context is still propagated, but no span is recorded.
+type TracingConfig struct {
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector.
+	Endpoint string
+	// Insecure sends spans to the collector over plain HTTP.
+	Insecure bool
+	// SampleRatio is the share of new traces that are recorded, traces
+	// started by a caller follow the caller's decision.
+	SampleRatio float64
+	ServiceName string
+}
+
+// Blob storage backends supported by BlobConfig.Backend.
+const (
+	BlobBackendFS = "fs"
+	BlobBackendS3 = "s3"
+)
+
+// BlobConfig selects where large snippet bodies are stored. With no backend
+// every body is stored in the database.
+type BlobConfig struct {
+	Backend string
+	// Threshold is the stored size in bytes above which a body goes to the
+	// blob store, only a reference to it is kept in the database.
+	Threshold int
+	// Dir is the root directory of the fs backend.
+	Dir string
+	S3  S3Config
+}
+
+// S3Config points the s3 blob backend at any S3-compatible service.
+type S3Config struct {
+	// Endpoint is host[:port] without a scheme, for example s3.amazonaws.com.
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// Prefix is prepended to every object key.
+	Prefix string
+	// Insecure uses plain HTTP, for local stand-ins like MinIO.
+	Insecure bool
 }
 
+// Database drivers supported by DBConfig.Driver.
+const (
+	DBDriverStdlib  = "stdlib"
+	DBDriverPgxPool = "pgxpool"
+	// DBDriverMemory keeps everything in process memory, for tests and
+	// local development. It needs no DSN.
+	DBDriverMemory = "memory"
+)
+
 type DBConfig struct {
+	// Driver selects database/sql with the pgx shim or native pgxpool for
+	// Postgres DSNs, or the in-memory store. SQLite DSNs ignore it.
+	Driver          string
 	PrimaryDSN      string
 	ReplicaDSNs     []string
 	MaxOpenConns    int
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
+	// ReplicaHealthInterval is how often replicas are probed, zero disables probing.
+	ReplicaHealthInterval time.Duration
+	// ReplicaMaxLag takes replicas further behind the primary out of rotation,
+	// zero disables the lag check.
+	ReplicaMaxLag       time.Duration
+	ReplicaProbeTimeout time.Duration
+	// AutoMigrate applies pending schema migrations on startup. It defaults
+	// to true for SQLite, which has a single writer, and false for Postgres
+	// where migrations are usually a separate deploy step.
+	AutoMigrate bool
+
+	// Settings below only apply to the pgxpool driver.
+	PrimaryPool PoolConfig
+	ReplicaPool PoolConfig
+	// StatementCacheCapacity is the number of prepared statements cached per connection.
+	StatementCacheCapacity int
+	// QueryExecMode is one of cache_statement, cache_describe, describe_exec,
+	// exec or simple_protocol, see pgx.QueryExecMode.
+	QueryExecMode string
 }
 
+// Storage backends, see DBConfig.Backend.
+const (
+	DBBackendPostgres = "postgres"
+	DBBackendSQLite   = "sqlite"
+	DBBackendMemory   = "memory"
+)
+
+// Backend returns the storage backend selected by the scheme of PrimaryDSN.
+// sqlite:// and file: DSNs open a SQLite database, the memory driver needs
+// no DSN at all and anything else is treated as Postgres.
+func (c DBConfig) Backend() string {
+	dsn := strings.ToLower(c.PrimaryDSN)
+	switch {
+	case c.Driver == DBDriverMemory:
+		return DBBackendMemory
+	case strings.HasPrefix(dsn, "sqlite:"), strings.HasPrefix(dsn, "file:"):
+		return DBBackendSQLite
+	default:
+		return DBBackendPostgres
+	}
+}
+
+// PoolConfig tunes a pgxpool connection pool.
+// Zero values fall back to MaxOpenConns and the pgxpool defaults.
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+}
+
+// Redis deployment topologies supported by RedisConfig.Mode.
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
+// Encodings supported by RedisConfig.Codec.
+const (
+	RedisCodecBinary = "binary"
+	RedisCodecJSON   = "json"
+)
+
 type RedisConfig struct {
-	Enabled  bool
-	Addr     string
-	Password string
-	DB       int
-	TTL      time.Duration
-	Logger   *slog.Logger
+	Enabled bool
+	Mode    string
+	// Codec selects how cached values are serialized.
+	Codec string
+	// Addr is the server address in standalone mode.
+	Addr string
+	// Addrs is the seed list of sentinel or cluster nodes.
+	// In standalone mode it is ignored in favour of Addr.
+	Addrs []string
+	// MasterName is the name of the master monitored by Sentinel.
+	MasterName       string
+	Username         string
+	Password         string
+	SentinelUsername string
+	SentinelPassword string
+	DB               int
+	TTL              time.Duration
+	TLS              RedisTLSConfig
+	Pool             RedisPoolConfig
+	Logger           *slog.Logger
 }
 
-func Load() (*Config, error) {
-	serverCfg, err := loadServerConfig()
-	if err != nil {
-		return nil, fmt.Errorf("server config: %w", err)
-	}
+type RedisTLSConfig struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
 
-	dbCfg, err := loadDBConfig()
-	if err != nil {
-		return nil, fmt.Errorf("database config: %w", err)
+// RedisPoolConfig tunes the connection pool of each Redis node.
+// Zero values leave the go-redis defaults in place.
+type RedisPoolConfig struct {
+	PoolSize        int
+	MinIdleConns    int
+	MaxIdleConns    int
+	PoolTimeout     time.Duration
+	ConnMaxIdleTime time.Duration
+	ConnMaxLifetime time.Duration
+	DialTimeout     time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+}
+
+// Load reads the configuration from flags, the environment and the YAML or
+// TOML file named by -config or CONFIG_FILE, in that order of precedence.
+// flags may be nil. Every invalid setting is reported in the error, not
+// just the first one.
+func Load(flags *Flags) (*Config, error) {
+	s := newSource(flags)
+	c := &Config{
+		Server:    loadServerConfig(s),
+		DB:        loadDBConfig(s),
+		Enc:       loadEncryptionConfig(s),
+		Redis:     loadRedisConfig(s),
+		PublicID:  loadPublicIDConfig(s),
+		Retention: loadRetentionConfig(s),
+		Content:   loadContentConfig(s),
+		Blob:      loadBlobConfig(s),
+		Health:    loadHealthConfig(s),
+		Tracing:   loadTracingConfig(s),
+		Log:       loadLogConfig(s),
+		Reload:    loadReloadConfig(s),
+		Admin:     loadAdminConfig(s),
+		Audit:     loadAuditConfig(s),
+		File:      s.fileName,
 	}
-	encCfg, err := LoadEncryptionConfig()
-	if err != nil {
-		return nil, fmt.Errorf("encryption config: %w", err)
+	if err := s.err(); err != nil {
+		return nil, err
 	}
-	redisCfg, err := loadRedisConfig()
-	if err != nil {
-		return nil, fmt.Errorf("redis config: %w", err)
+	c.settings = s.effective
+	return c, nil
+}
+
+// LoadDBConfig loads only the database settings, for commands like migrate
+// that don't need the rest of the configuration.
+func LoadDBConfig(flags *Flags) (DBConfig, error) {
+	s := newSource(flags)
+	config := loadDBConfig(s)
+	if err := s.err(); err != nil {
+		return DBConfig{}, err
 	}
+	return config, nil
+}
 
-	return &Config{
-		Server: serverCfg,
-		DB:     dbCfg,
-		Enc:    encCfg,
-		Redis:  redisCfg,
-	}, nil
+func loadServerConfig(s *source) ServerConfig {
+	config := ServerConfig{
+		Host:            s.str("SERVER_HOST", "0.0.0.0"),
+		Port:            s.int("SERVER_PORT", 8080, nonNegative),
+		MaxUploadSize:   s.int64("SERVER_MAX_UPLOAD_SIZE", 1<<30, positive),
+		ShutdownTimeout: s.duration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second, positive),
+		ShutdownDelay:   s.duration("SERVER_SHUTDOWN_DELAY", 0, nonNegative),
+		PublicMetrics:   s.bool("SERVER_PUBLIC_METRICS", false),
+	}
+	if config.Port > 65535 {
+		s.errorf("invalid SERVER_PORT %d: must be at most 65535", config.Port)
+	}
+	return config
 }
 
-func loadServerConfig() (ServerConfig, error) {
-	host := os.Getenv("SERVER_HOST")
-	if host == "" {
-		host = "0.0.0.0"
+func loadEncryptionConfig(s *source) EncryptionConfig {
+	config := EncryptionConfig{
+		SystemKey:    s.str("ENCRYPTION_KEY", ""),
+		PreviousKeys: s.list("ENCRYPTION_PREVIOUS_KEYS", nil),
+		DedupKey:     s.str("DEDUP_KEY", ""),
 	}
+	if config.SystemKey == "" {
+		s.errorf("ENCRYPTION_KEY is required")
+	}
+	return config
+}
+
+func loadDBConfig(s *source) DBConfig {
+	config := DBConfig{
+		Driver:      s.oneOf("DB_DRIVER", DBDriverStdlib, DBDriverStdlib, DBDriverPgxPool, DBDriverMemory),
+		PrimaryDSN:  s.str("DB_PRIMARY_DSN", ""),
+		ReplicaDSNs: s.list("DB_REPLICA_DSN", []string{}),
 
-	portStr := os.Getenv("SERVER_PORT")
-	if portStr == "" {
-		portStr = "8080"
+		MaxOpenConns:    s.int("DB_MAX_OPEN_CONNS", 25, nonNegative),
+		MaxIdleConns:    s.int("DB_MAX_IDLE_CONNS", 10, nonNegative),
+		ConnMaxLifetime: s.duration("DB_CONN_MAX_LIFETIME", 5*time.Minute, nonNegative),
+
+		ReplicaHealthInterval: s.duration("DB_REPLICA_HEALTH_INTERVAL", 5*time.Second, nonNegative),
+		ReplicaMaxLag:         s.duration("DB_REPLICA_MAX_LAG", 10*time.Second, nonNegative),
+		ReplicaProbeTimeout:   s.duration("DB_REPLICA_PROBE_TIMEOUT", 2*time.Second, positive),
+
+		PrimaryPool:            loadPoolConfig(s, "DB_PRIMARY_POOL"),
+		ReplicaPool:            loadPoolConfig(s, "DB_REPLICA_POOL"),
+		StatementCacheCapacity: s.int("DB_STATEMENT_CACHE_CAPACITY", 512, nonNegative),
+		QueryExecMode: s.oneOf("DB_QUERY_EXEC_MODE", "cache_statement",
+			"cache_statement", "cache_describe", "describe_exec", "exec", "simple_protocol"),
 	}
 
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		return ServerConfig{}, fmt.Errorf("invalid port: %w", err)
+	if config.Driver != DBDriverMemory && config.PrimaryDSN == "" {
+		s.errorf("DB_PRIMARY_DSN is required")
+	}
+	if config.Backend() == DBBackendSQLite && len(config.ReplicaDSNs) > 0 {
+		s.errorf("DB_REPLICA_DSN is not supported with a SQLite DB_PRIMARY_DSN")
 	}
+	config.AutoMigrate = s.bool("DB_AUTO_MIGRATE", config.Backend() == DBBackendSQLite)
 
-	return ServerConfig{
-		Host: host,
-		Port: port,
-	}, nil
+	return config
 }
 
-func LoadEncryptionConfig() (EncryptionConfig, error) {
-	key := os.Getenv("ENCRYPTION_KEY")
-	if key == "" {
-		return EncryptionConfig{}, fmt.Errorf("ENCRYPTION_KEY is required")
+func loadPoolConfig(s *source, prefix string) PoolConfig {
+	return PoolConfig{
+		MaxConns:          s.int32(prefix+"_MAX_CONNS", 0, nonNegative),
+		MinConns:          s.int32(prefix+"_MIN_CONNS", 0, nonNegative),
+		MaxConnIdleTime:   s.duration(prefix+"_MAX_CONN_IDLE_TIME", 0, nonNegative),
+		HealthCheckPeriod: s.duration(prefix+"_HEALTH_CHECK_PERIOD", 0, nonNegative),
 	}
-	return EncryptionConfig{
-		SystemKey: key,
-	}, nil
 }
 
-func loadDBConfig() (DBConfig, error) {
-	primaryDSN := os.Getenv("DB_PRIMARY_DSN")
-	if primaryDSN == "" {
-		return DBConfig{}, fmt.Errorf("DB_PRIMARY_DSN is required")
+func loadRedisConfig(s *source) RedisConfig {
+	config := RedisConfig{
+		Enabled:          !s.bool("REDIS_DISABLED", false),
+		Mode:             s.oneOf("REDIS_MODE", RedisModeStandalone, RedisModeStandalone, RedisModeSentinel, RedisModeCluster),
+		Codec:            s.oneOf("REDIS_CODEC", RedisCodecBinary, RedisCodecBinary, RedisCodecJSON),
+		Addr:             s.str("REDIS_ADDR", "localhost:6379"),
+		Addrs:            s.list("REDIS_ADDRS", nil),
+		MasterName:       s.str("REDIS_MASTER_NAME", ""),
+		Username:         s.str("REDIS_USERNAME", ""),
+		Password:         s.str("REDIS_PASSWORD", ""),
+		SentinelUsername: s.str("REDIS_SENTINEL_USERNAME", ""),
+		SentinelPassword: s.str("REDIS_SENTINEL_PASSWORD", ""),
+		DB:               s.int("REDIS_DB", 0, nonNegative),
+		TTL:              s.duration("REDIS_TTL", 2*time.Hour, nonNegative),
 	}
 
-	config := DBConfig{
-		PrimaryDSN:      primaryDSN,
-		ReplicaDSNs:     []string{},
-		MaxOpenConns:    25,
-		MaxIdleConns:    10,
-		ConnMaxLifetime: 5 * time.Minute,
-	}
-
-	for i := 0; ; i++ {
-		key := fmt.Sprintf("DB_REPLICA_DSN_%d", i)
-		if dsn := os.Getenv(key); dsn != "" {
-			config.ReplicaDSNs = append(config.ReplicaDSNs, dsn)
-		} else if i > 0 {
-			break
-		} else if i == 0 && os.Getenv("DB_REPLICA_DSN") != "" {
-			config.ReplicaDSNs = append(config.ReplicaDSNs, os.Getenv("DB_REPLICA_DSN"))
-			break
-		} else {
-			break
+	config.TLS = RedisTLSConfig{
+		Enabled:            s.bool("REDIS_TLS_ENABLED", false),
+		CAFile:             s.str("REDIS_TLS_CA_FILE", ""),
+		CertFile:           s.str("REDIS_TLS_CERT_FILE", ""),
+		KeyFile:            s.str("REDIS_TLS_KEY_FILE", ""),
+		ServerName:         s.str("REDIS_TLS_SERVER_NAME", ""),
+		InsecureSkipVerify: s.bool("REDIS_TLS_INSECURE_SKIP_VERIFY", false),
+	}
+
+	// go-redis gives negative timeouts a meaning of their own, so they
+	// are passed on as is.
+	config.Pool = RedisPoolConfig{
+		PoolSize:        s.int("REDIS_POOL_SIZE", 0, nonNegative),
+		MinIdleConns:    s.int("REDIS_MIN_IDLE_CONNS", 0, nonNegative),
+		MaxIdleConns:    s.int("REDIS_MAX_IDLE_CONNS", 0, nonNegative),
+		PoolTimeout:     s.duration("REDIS_POOL_TIMEOUT", 0, anyValue),
+		ConnMaxIdleTime: s.duration("REDIS_CONN_MAX_IDLE_TIME", 0, anyValue),
+		ConnMaxLifetime: s.duration("REDIS_CONN_MAX_LIFETIME", 0, anyValue),
+		DialTimeout:     s.duration("REDIS_DIAL_TIMEOUT", 0, anyValue),
+		ReadTimeout:     s.duration("REDIS_READ_TIMEOUT", 0, anyValue),
+		WriteTimeout:    s.duration("REDIS_WRITE_TIMEOUT", 0, anyValue),
+	}
+
+	switch config.Mode {
+	case RedisModeSentinel:
+		if config.MasterName == "" {
+			s.errorf("REDIS_MASTER_NAME is required in sentinel mode")
+		}
+		if len(config.Addrs) == 0 {
+			s.errorf("REDIS_ADDRS is required in sentinel mode")
+		}
+	case RedisModeCluster:
+		if len(config.Addrs) == 0 {
+			s.errorf("REDIS_ADDRS is required in cluster mode")
+		}
+	}
+
+	return config
+}
+
+// loadPublicIDConfig reads the layout of generated public IDs, for example
+// PUBLIC_ID_ALPHABET=0123456789abcdef and PUBLIC_ID_SEGMENTS=4,4,4.
+// Changing it only affects new snippets.
+func loadPublicIDConfig(s *source) publicid.Format {
+	alphabet := s.str("PUBLIC_ID_ALPHABET", publicid.Default.Alphabet)
+
+	def := make([]string, len(publicid.Default.Segments))
+	for i, n := range publicid.Default.Segments {
+		def[i] = strconv.Itoa(n)
+	}
+	var segments []int
+	for _, item := range s.list("PUBLIC_ID_SEGMENTS", def) {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			s.errorf("invalid PUBLIC_ID_SEGMENTS %q: must be a list of lengths", item)
+			return publicid.Default
 		}
+		segments = append(segments, n)
 	}
 
-	if val, err := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONNS")); err == nil {
-		config.MaxOpenConns = val
+	format, err := publicid.NewFormat(alphabet, segments)
+	if err != nil {
+		s.errorf("invalid PUBLIC_ID_ALPHABET or PUBLIC_ID_SEGMENTS: %w", err)
+		return publicid.Default
 	}
-	if val, err := strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONNS")); err == nil {
-		config.MaxIdleConns = val
+	return format
+}
+
+func loadRetentionConfig(s *source) RetentionConfig {
+	return RetentionConfig{
+		RestoreWindow: s.duration("RETENTION_RESTORE_WINDOW", 7*24*time.Hour, nonNegative),
+		PurgeInterval: s.duration("RETENTION_PURGE_INTERVAL", time.Hour, nonNegative),
 	}
-	if val := os.Getenv("DB_CONN_MAX_LIFETIME"); val != "" {
-		if duration, err := time.ParseDuration(val); err == nil {
-			config.ConnMaxLifetime = duration
+}
+
+func loadContentConfig(s *source) ContentConfig {
+	var config ContentConfig
+	for _, raw := range s.list("CONTENT_ALLOWED_TYPES", nil) {
+		mediaType, params, err := mime.ParseMediaType(raw)
+		if err != nil || len(params) > 0 || strings.Count(mediaType, "/") != 1 || strings.HasPrefix(mediaType, "*") {
+			s.errorf("invalid CONTENT_ALLOWED_TYPES type %q: must be a media type such as text/plain, or text/*", raw)
+			continue
 		}
+		config.AllowedTypes = append(config.AllowedTypes, mediaType)
 	}
+	return config
+}
 
-	return config, nil
+func loadHealthConfig(s *source) HealthConfig {
+	config := HealthConfig{
+		Required:     s.list("HEALTH_REQUIRED", nil),
+		CheckTimeout: s.duration("HEALTH_CHECK_TIMEOUT", 2*time.Second, positive),
+	}
+	for _, name := range config.Required {
+		if name != HealthRedis && name != HealthReplicas {
+			s.errorf("invalid HEALTH_REQUIRED component %q: must be %q or %q", name, HealthRedis, HealthReplicas)
+		}
+	}
+	return config
 }
 
-func loadRedisConfig() (RedisConfig, error) {
-	config := RedisConfig{
-		Enabled:  true,
-		Addr:     "localhost:6379",
-		Password: "",
-		DB:       0,
-		TTL:      2 * time.Hour,
+func loadLogConfig(s *source) LogConfig {
+	config := LogConfig{
+		Format: s.oneOf("LOG_FORMAT", LogFormatText, LogFormatText, LogFormatJSON),
 	}
+	config.Level = parsed(s, "LOG_LEVEL", slog.LevelInfo, func(raw string) (slog.Level, bool) {
+		var level slog.Level
+		return level, level.UnmarshalText([]byte(raw)) == nil
+	}, "must be debug, info, warn or error")
+	return config
+}
 
-	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
-		config.Addr = addr
+func loadReloadConfig(s *source) ReloadConfig {
+	return ReloadConfig{
+		Interval: s.duration("RELOAD_INTERVAL", 10*time.Second, nonNegative),
 	}
+}
+
+// minAuditKeySize matches audit.MinKeySize.
+const minAuditKeySize = 32
 
-	if disabled := os.Getenv("REDIS_DISABLED"); disabled == "true" || disabled == "1" {
-		config.Enabled = false
+func loadAuditConfig(s *source) AuditConfig {
+	config := AuditConfig{Key: s.str("AUDIT_KEY", "")}
+	if config.Key == "" {
+		s.errorf("AUDIT_KEY is required")
+	} else if raw, err := base64.StdEncoding.DecodeString(config.Key); err != nil || len(raw) < minAuditKeySize {
+		s.errorf("invalid AUDIT_KEY: must be base64 encoded and at least %d bytes once decoded", minAuditKeySize)
 	}
+	return config
+}
 
-	if password := os.Getenv("REDIS_PASSWORD"); password != "" {
-		config.Password = password
+func loadAdminConfig(s *source) AdminConfig {
+	config := AdminConfig{
+		Host:         s.str("ADMIN_HOST", "127.0.0.1"),
+		Port:         s.int("ADMIN_PORT", 0, nonNegative),
+		Token:        s.str("ADMIN_TOKEN", ""),
+		TLSCertFile:  s.str("ADMIN_TLS_CERT_FILE", ""),
+		TLSKeyFile:   s.str("ADMIN_TLS_KEY_FILE", ""),
+		ClientCAFile: s.str("ADMIN_TLS_CLIENT_CA_FILE", ""),
+		BreakGlass:   s.bool("ADMIN_BREAK_GLASS", false),
+	}
+	if config.Port > 65535 {
+		s.errorf("invalid ADMIN_PORT %d: must be at most 65535", config.Port)
 	}
+	if config.Token != "" && len(config.Token) < 32 {
+		s.errorf("invalid ADMIN_TOKEN: must be at least 32 characters")
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		s.errorf("ADMIN_TLS_CERT_FILE and ADMIN_TLS_KEY_FILE must be set together")
+	}
+	if config.ClientCAFile != "" && config.TLSCertFile == "" {
+		s.errorf("ADMIN_TLS_CLIENT_CA_FILE needs ADMIN_TLS_CERT_FILE and ADMIN_TLS_KEY_FILE")
+	}
+	if config.Port != 0 && config.Token != "" && config.TLSCertFile == "" && !isLoopback(config.Host) {
+		s.errorf("ADMIN_TOKEN needs ADMIN_TLS_CERT_FILE and ADMIN_TLS_KEY_FILE unless ADMIN_HOST is a loopback address, it would be sent in clear")
+	}
+	if config.Port != 0 && config.Token == "" && config.ClientCAFile == "" {
+		s.errorf("ADMIN_PORT needs ADMIN_TOKEN or ADMIN_TLS_CLIENT_CA_FILE to authenticate requests")
+	}
+	return config
+}
 
-	if dbStr := os.Getenv("REDIS_DB"); dbStr != "" {
-		if db, err := strconv.Atoi(dbStr); err == nil {
-			config.DB = db
-		}
+// isLoopback reports whether host only accepts connections from the
+// machine itself.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
 	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
 
-	if ttlStr := os.Getenv("REDIS_TTL"); ttlStr != "" {
-		if ttl, err := time.ParseDuration(ttlStr); err == nil {
-			config.TTL = ttl
+func loadTracingConfig(s *source) TracingConfig {
+	return TracingConfig{
+		Exporter:    s.oneOf("TRACING_EXPORTER", "", "", TracingExporterOTLP, TracingExporterStdout),
+		Endpoint:    s.str("TRACING_OTLP_ENDPOINT", "localhost:4318"),
+		Insecure:    s.bool("TRACING_OTLP_INSECURE", false),
+		SampleRatio: s.float("TRACING_SAMPLE_RATIO", 1, 0, 1),
+		ServiceName: s.str("TRACING_SERVICE_NAME", "snippets-api"),
+	}
+}
+
+func loadBlobConfig(s *source) BlobConfig {
+	config := BlobConfig{
+		Backend:   s.oneOf("BLOB_BACKEND", "", "", BlobBackendFS, BlobBackendS3),
+		Threshold: s.int("BLOB_THRESHOLD", 1<<20, nonNegative),
+		Dir:       s.str("BLOB_DIR", ""),
+		S3: S3Config{
+			Endpoint:  s.str("BLOB_S3_ENDPOINT", ""),
+			Bucket:    s.str("BLOB_S3_BUCKET", ""),
+			Region:    s.str("BLOB_S3_REGION", "us-east-1"),
+			AccessKey: s.str("BLOB_S3_ACCESS_KEY", ""),
+			SecretKey: s.str("BLOB_S3_SECRET_KEY", ""),
+			Prefix:    s.str("BLOB_S3_PREFIX", ""),
+			Insecure:  s.bool("BLOB_S3_INSECURE", false),
+		},
+	}
+
+	switch config.Backend {
+	case BlobBackendFS:
+		if config.Dir == "" {
+			s.errorf("BLOB_DIR is required for the fs backend")
+		}
+	case BlobBackendS3:
+		if config.S3.Endpoint == "" || config.S3.Bucket == "" {
+			s.errorf("BLOB_S3_ENDPOINT and BLOB_S3_BUCKET are required for the s3 backend")
 		}
 	}
 
-	return config, nil
+	return config
 }
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// minimalEnv sets the settings Load can't do without.
+func minimalEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("DB_DRIVER", DBDriverMemory)
+	t.Setenv("ENCRYPTION_KEY", "system-key")
+	t.Setenv("AUDIT_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func parseFlags(t *testing.T, args ...string) *Flags {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flags
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	minimalEnv(t)
+
+	c, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Port != 8080 || c.DB.MaxOpenConns != 25 || c.Redis.TTL != 2*time.Hour || !c.Redis.Enabled {
+		t.Errorf("unexpected defaults: %+v %+v %+v", c.Server, c.DB, c.Redis)
+	}
+	for _, st := range settings {
+		if _, ok := c.settings[st.key()]; !ok {
+			t.Errorf("%s is not loaded", st.key())
+		}
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	minimalEnv(t)
+	path := writeFile(t, "config.yaml", `
+server:
+  host: file.example
+  port: 1000
+redis:
+  ttl: 1m
+`)
+	t.Setenv("SERVER_PORT", "2000")
+	t.Setenv("REDIS_TTL", "2m")
+
+	c, err := Load(parseFlags(t, "-config", path, "-redis-ttl", "3m"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Host != "file.example" {
+		t.Errorf("host = %q, want it from the file", c.Server.Host)
+	}
+	if c.Server.Port != 2000 {
+		t.Errorf("port = %d, want the environment to override the file", c.Server.Port)
+	}
+	if c.Redis.TTL != 3*time.Minute {
+		t.Errorf("TTL = %v, want the flag to override the environment", c.Redis.TTL)
+	}
+}
+
+func TestLoad_TOML(t *testing.T) {
+	minimalEnv(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.toml", `
+[redis]
+addrs = ["a:6379", "b:6379"]
+mode = "cluster"
+
+[tracing]
+sample_ratio = 0.25
+`))
+
+	c, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Redis.Mode != RedisModeCluster || len(c.Redis.Addrs) != 2 || c.Tracing.SampleRatio != 0.25 {
+		t.Errorf("redis = %+v, tracing = %+v", c.Redis, c.Tracing)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	minimalEnv(t)
+	t.Setenv("DB_MAX_OPEN_CONNS", "lots")
+	t.Setenv("REDIS_TTL", "-1h")
+	t.Setenv("LOG_FORMAT", "xml")
+	t.Setenv("ADMIN_PORT", "9090")
+	t.Setenv("AUDIT_KEY", "c2hvcnQ=")
+	t.Setenv("CONTENT_ALLOWED_TYPES", "text/plain,text")
+	path := writeFile(t, "config.yaml", `
+db:
+  max_open_con: 3
+server:
+  port: [1, 2]
+`)
+
+	_, err := Load(parseFlags(t, "-config", path, "-tracing-sample-ratio", "2"))
+	if err == nil {
+		t.Fatal("invalid settings were accepted")
+	}
+	for _, want := range []string{
+		`invalid DB_MAX_OPEN_CONNS "lots": must be a non-negative integer`,
+		`invalid REDIS_TTL "-1h": must be a non-negative duration`,
+		`invalid LOG_FORMAT "xml": must be text or json`,
+		`invalid TRACING_SAMPLE_RATIO "2" (from -tracing-sample-ratio): must be between 0 and 1`,
+		"unknown setting db.max_open_con in " + path,
+		"invalid server.port in " + path + ": must be a single value",
+		"ADMIN_PORT needs ADMIN_TOKEN or ADMIN_TLS_CLIENT_CA_FILE to authenticate requests",
+		"invalid AUDIT_KEY: must be base64 encoded and at least 32 bytes once decoded",
+		`invalid CONTENT_ALLOWED_TYPES type "text": must be a media type such as text/plain, or text/*`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q\ndoes not report %q", err, want)
+		}
+	}
+}
+
+func TestLoad_AdminTokenNeedsTLS(t *testing.T) {
+	token := strings.Repeat("t", 32)
+	for _, tt := range []struct {
+		host    string
+		tls     bool
+		wantErr bool
+	}{
+		{host: "127.0.0.1"},
+		{host: "::1"},
+		{host: "localhost"},
+		{host: "0.0.0.0", wantErr: true},
+		{host: "10.0.0.1", wantErr: true},
+		{host: "10.0.0.1", tls: true},
+	} {
+		minimalEnv(t)
+		t.Setenv("ADMIN_PORT", "9090")
+		t.Setenv("ADMIN_HOST", tt.host)
+		t.Setenv("ADMIN_TOKEN", token)
+		if tt.tls {
+			t.Setenv("ADMIN_TLS_CERT_FILE", "cert.pem")
+			t.Setenv("ADMIN_TLS_KEY_FILE", "key.pem")
+		}
+
+		_, err := Load(nil)
+		if gotErr := err != nil && strings.Contains(err.Error(), "ADMIN_TOKEN needs ADMIN_TLS_CERT_FILE"); gotErr != tt.wantErr {
+			t.Errorf("host %q, tls %v: error = %v, want an error: %v", tt.host, tt.tls, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_SecretFiles(t *testing.T) {
+	minimalEnv(t)
+	t.Setenv("ENCRYPTION_KEY", "")
+	t.Setenv("ENCRYPTION_KEY_FILE", writeFile(t, "key", "from-file\n"))
+	t.Setenv("DB_REPLICA_DSN_0_FILE", writeFile(t, "dsn", "postgres://replica/db"))
+
+	c, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Enc.SystemKey != "from-file" {
+		t.Errorf("key = %q, want the file content without the newline", c.Enc.SystemKey)
+	}
+	if len(c.DB.ReplicaDSNs) != 1 || c.DB.ReplicaDSNs[0] != "postgres://replica/db" {
+		t.Errorf("replicas = %v", c.DB.ReplicaDSNs)
+	}
+
+	t.Setenv("ENCRYPTION_KEY", "from-env")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "ENCRYPTION_KEY and ENCRYPTION_KEY_FILE are both set") {
+		t.Errorf("err = %v, want the ambiguity reported", err)
+	}
+}
+
+func TestConfig_Print(t *testing.T) {
+	minimalEnv(t)
+	t.Setenv("DB_DRIVER", DBDriverPgxPool)
+	t.Setenv("DB_PRIMARY_DSN", "postgres://app:hunter2@db:5432/snippets")
+	t.Setenv("REDIS_PASSWORD", "redis-password")
+
+	c, err := Load(parseFlags(t, "-server-port", "9000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, secret := range []string{"system-key", "hunter2", "redis-password"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("printed configuration contains %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{
+		"port: 9000 # -server-port",
+		"primary_dsn: postgres://app:REDACTED@db:5432/snippets # env",
+		"ttl: 2h0m0s # default",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printed configuration does not contain %q:\n%s", want, out)
+		}
+	}
+
+	// the output is a valid config file
+	t.Setenv("SERVER_PORT", "")
+	c2, err := Load(parseFlags(t, "-config", writeFile(t, "printed.yaml", out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2.Server.Port != 9000 {
+		t.Errorf("port read back as %d", c2.Server.Port)
+	}
+}
+
+func TestConfig_Changes(t *testing.T) {
+	minimalEnv(t)
+	old, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("REDIS_TTL", "5m")
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("CONTENT_ALLOWED_TYPES", "text/*")
+	t.Setenv("SERVER_PORT", "9000")
+	next, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live, restart := old.Changes(next)
+	if strings.Join(live, ",") != "REDIS_TTL,CONTENT_ALLOWED_TYPES,LOG_LEVEL" {
+		t.Errorf("live changes = %v", live)
+	}
+	if strings.Join(restart, ",") != "SERVER_PORT" {
+		t.Errorf("changes needing a restart = %v", restart)
+	}
+	if live, restart := next.Changes(next); live != nil || restart != nil {
+		t.Errorf("a configuration differs from itself: %v %v", live, restart)
+	}
+}
+
+func TestContentConfig_Allows(t *testing.T) {
+	minimalEnv(t)
+	t.Setenv("CONTENT_ALLOWED_TYPES", "Text/*, application/json")
+	c, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for contentType, want := range map[string]bool{
+		"text/plain":                   true,
+		"text/markdown; charset=utf-8": true,
+		"application/json":             true,
+		"application/javascript":       false,
+		"image/png":                    false,
+		"not a type":                   false,
+	} {
+		if got := c.Content.Allows(contentType); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+	if !(ContentConfig{}).Allows("image/png") {
+		t.Error("an empty policy refused a type")
+	}
+}
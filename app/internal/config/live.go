@@ -0,0 +1,37 @@
+package config
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// Live is the configuration in effect while the server runs. A reload
+// puts the next configuration in effect as a whole, and components read
+// the settings they use from the one in effect every time, so none of them
+// mixes the settings of two configurations. Only the reloadable settings
+// are meant to be read from it, see Changes.
+type Live struct {
+	current atomic.Pointer[Config]
+}
+
+// NewLive returns a Live with c in effect.
+func NewLive(c *Config) *Live {
+	l := &Live{}
+	l.current.Store(c)
+	return l
+}
+
+// Load returns the configuration in effect.
+func (l *Live) Load() *Config {
+	return l.current.Load()
+}
+
+// Store puts c in effect.
+func (l *Live) Store(c *Config) {
+	l.current.Store(c)
+}
+
+// Level returns the log level in effect, a Live is a slog.Leveler.
+func (l *Live) Level() slog.Level {
+	return l.Load().Log.Level
+}
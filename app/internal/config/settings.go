@@ -0,0 +1,261 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type settingKind int
+
+const (
+	kindScalar settingKind = iota
+	kindBool
+	// kindList values are comma separated in the environment and on the
+	// command line.
+	kindList
+	// kindIndexedList values are read from KEY_0, KEY_1 and so on in the
+	// environment, or from KEY if there is a single one. They are never
+	// split, so they may contain commas.
+	kindIndexedList
+)
+
+// setting is a configuration setting. It is read from the environment
+// variable SECTION_NAME, from section.name in a config file and from the
+// -section-name flag.
+type setting struct {
+	section string
+	name    string
+	kind    settingKind
+	// secret settings can be read from the file named by KEY_FILE, are
+	// redacted when the configuration is printed and have no flag, so they
+	// don't show up in process listings.
+	secret bool
+	// redact shows the parts of a secret that are safe to print, everything
+	// is hidden if it is nil.
+	redact func(string) string
+	// reloadable settings can change while the server runs, see Changes.
+	reloadable bool
+}
+
+func (st *setting) key() string {
+	return strings.ToUpper(st.section + "_" + st.name)
+}
+
+func (st *setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(st.key()), "_", "-")
+}
+
+// settings lists every setting in the order they are printed.
+var settings = []*setting{
+	{section: "server", name: "host"},
+	{section: "server", name: "port"},
+	{section: "server", name: "max_upload_size", reloadable: true},
+	{section: "server", name: "shutdown_timeout"},
+	{section: "server", name: "shutdown_delay"},
+	{section: "server", name: "public_metrics"},
+
+	{section: "db", name: "driver"},
+	{section: "db", name: "primary_dsn", secret: true, redact: redactDSN},
+	{section: "db", name: "replica_dsn", kind: kindIndexedList, secret: true, redact: redactDSN, reloadable: true},
+	{section: "db", name: "auto_migrate", kind: kindBool},
+	{section: "db", name: "max_open_conns"},
+	{section: "db", name: "max_idle_conns"},
+	{section: "db", name: "conn_max_lifetime"},
+	{section: "db", name: "replica_health_interval"},
+	{section: "db", name: "replica_max_lag"},
+	{section: "db", name: "replica_probe_timeout"},
+	{section: "db", name: "primary_pool_max_conns"},
+	{section: "db", name: "primary_pool_min_conns"},
+	{section: "db", name: "primary_pool_max_conn_idle_time"},
+	{section: "db", name: "primary_pool_health_check_period"},
+	{section: "db", name: "replica_pool_max_conns"},
+	{section: "db", name: "replica_pool_min_conns"},
+	{section: "db", name: "replica_pool_max_conn_idle_time"},
+	{section: "db", name: "replica_pool_health_check_period"},
+	{section: "db", name: "statement_cache_capacity"},
+	{section: "db", name: "query_exec_mode"},
+
+	{section: "encryption", name: "key", secret: true},
+	{section: "encryption", name: "previous_keys", kind: kindList, secret: true},
+	{section: "dedup", name: "key", secret: true},
+
+	{section: "redis", name: "disabled", kind: kindBool},
+	{section: "redis", name: "mode"},
+	{section: "redis", name: "codec"},
+	{section: "redis", name: "addr"},
+	{section: "redis", name: "addrs", kind: kindList},
+	{section: "redis", name: "master_name"},
+	{section: "redis", name: "username"},
+	{section: "redis", name: "password", secret: true},
+	{section: "redis", name: "sentinel_username"},
+	{section: "redis", name: "sentinel_password", secret: true},
+	{section: "redis", name: "db"},
+	{section: "redis", name: "ttl", reloadable: true},
+	{section: "redis", name: "tls_enabled", kind: kindBool},
+	{section: "redis", name: "tls_ca_file"},
+	{section: "redis", name: "tls_cert_file"},
+	{section: "redis", name: "tls_key_file"},
+	{section: "redis", name: "tls_server_name"},
+	{section: "redis", name: "tls_insecure_skip_verify", kind: kindBool},
+	{section: "redis", name: "pool_size"},
+	{section: "redis", name: "min_idle_conns"},
+	{section: "redis", name: "max_idle_conns"},
+	{section: "redis", name: "pool_timeout"},
+	{section: "redis", name: "conn_max_idle_time"},
+	{section: "redis", name: "conn_max_lifetime"},
+	{section: "redis", name: "dial_timeout"},
+	{section: "redis", name: "read_timeout"},
+	{section: "redis", name: "write_timeout"},
+
+	{section: "public_id", name: "alphabet"},
+	{section: "public_id", name: "segments", kind: kindList},
+
+	{section: "retention", name: "restore_window", reloadable: true},
+	{section: "retention", name: "purge_interval"},
+
+	{section: "content", name: "allowed_types", kind: kindList, reloadable: true},
+
+	{section: "blob", name: "backend"},
+	{section: "blob", name: "threshold"},
+	{section: "blob", name: "dir"},
+	{section: "blob", name: "s3_endpoint"},
+	{section: "blob", name: "s3_bucket"},
+	{section: "blob", name: "s3_region"},
+	{section: "blob", name: "s3_access_key", secret: true},
+	{section: "blob", name: "s3_secret_key", secret: true},
+	{section: "blob", name: "s3_prefix"},
+	{section: "blob", name: "s3_insecure", kind: kindBool},
+
+	{section: "health", name: "required", kind: kindList},
+	{section: "health", name: "check_timeout"},
+
+	{section: "tracing", name: "exporter"},
+	{section: "tracing", name: "otlp_endpoint"},
+	{section: "tracing", name: "otlp_insecure", kind: kindBool},
+	{section: "tracing", name: "sample_ratio"},
+	{section: "tracing", name: "service_name"},
+
+	{section: "log", name: "format"},
+	{section: "log", name: "level", reloadable: true},
+
+	{section: "reload", name: "interval"},
+
+	{section: "admin", name: "host"},
+	{section: "admin", name: "port"},
+	{section: "admin", name: "token", secret: true},
+	{section: "admin", name: "tls_cert_file"},
+	{section: "admin", name: "tls_key_file"},
+	{section: "admin", name: "tls_client_ca_file"},
+	{section: "admin", name: "break_glass", kind: kindBool, reloadable: true},
+
+	{section: "audit", name: "key", secret: true},
+}
+
+var settingsByKey = func() map[string]*setting {
+	m := make(map[string]*setting, len(settings))
+	for _, st := range settings {
+		m[st.key()] = st
+	}
+	return m
+}()
+
+// redactDSN hides the password of URL DSNs, and key=value DSNs entirely
+// since they may have one anywhere.
+func redactDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" || u.Opaque != "" {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	q := u.Query()
+	if q.Has("password") {
+		q.Set("password", redacted)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+const redacted = "REDACTED"
+
+// Changes compares c with next and returns the settings that differ, split
+// into those that can be applied while the server runs and those that only
+// take effect on restart.
+func (c *Config) Changes(next *Config) (live, restart []string) {
+	for _, st := range settings {
+		key := st.key()
+		if slices.Equal(c.settings[key].raw, next.settings[key].raw) {
+			continue
+		}
+		if st.reloadable {
+			live = append(live, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+	return live, restart
+}
+
+// Print writes the effective configuration to w in the config file format,
+// with secrets redacted and where each value comes from as a comment.
+func (c *Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	var section *yaml.Node
+	var sectionName string
+	for _, st := range settings {
+		v, ok := c.settings[st.key()]
+		if !ok {
+			continue
+		}
+		if st.section != sectionName {
+			section, sectionName = &yaml.Node{Kind: yaml.MappingNode}, st.section
+			root.Content = append(root.Content, scalarNode(st.section), section)
+		}
+
+		vals := v.raw
+		if st.secret {
+			vals = make([]string, len(v.raw))
+			for i, raw := range v.raw {
+				switch {
+				case raw == "":
+				case st.redact != nil:
+					vals[i] = st.redact(raw)
+				default:
+					vals[i] = redacted
+				}
+			}
+		}
+
+		var node *yaml.Node
+		if st.kind == kindList || st.kind == kindIndexedList {
+			node = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for _, val := range vals {
+				node.Content = append(node.Content, scalarNode(val))
+			}
+		} else {
+			node = scalarNode(vals[0])
+		}
+		node.LineComment = v.origin
+		section.Content = append(section.Content, scalarNode(st.name), node)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func scalarNode(v string) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.ScalarNode, Value: v}
+	if v == "" {
+		n.Style = yaml.DoubleQuotedStyle
+	}
+	return n
+}
@@ -0,0 +1,414 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Flags holds the settings given on a command line, see RegisterFlags.
+type Flags struct {
+	file   string
+	values map[string][]string
+}
+
+// RegisterFlags defines -config and a flag for every setting on fs, named
+// after its environment variable: -db-max-open-conns sets DB_MAX_OPEN_CONNS.
+// Secrets have no flag.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{values: make(map[string][]string)}
+	fs.StringVar(&f.file, "config", "", "read settings from the YAML or TOML `file`, overrides CONFIG_FILE")
+	for _, st := range settings {
+		if st.secret {
+			continue
+		}
+		fs.Var(flagValue{f: f, st: st}, st.flagName(), "sets "+st.key())
+	}
+	return f
+}
+
+type flagValue struct {
+	f  *Flags
+	st *setting
+}
+
+func (v flagValue) String() string { return "" }
+
+func (v flagValue) Set(s string) error {
+	if v.st.kind == kindList || v.st.kind == kindIndexedList {
+		v.f.values[v.st.key()] = append(v.f.values[v.st.key()], s)
+	} else {
+		v.f.values[v.st.key()] = []string{s}
+	}
+	return nil
+}
+
+func (v flagValue) IsBoolFlag() bool { return v.st.kind == kindBool }
+
+// value is the raw value of a setting and where it was found.
+type value struct {
+	raw []string
+	// origin is "default", "env", the flag, the KEY_FILE variable or the
+	// config file the value was read from.
+	origin string
+}
+
+// source resolves settings by the name of their environment variable. Flags
+// take precedence over the environment, which takes precedence over the
+// config file. Invalid values are collected in errs so that every mistake
+// is reported at once.
+type source struct {
+	flags     map[string][]string
+	file      map[string][]string
+	fileName  string
+	effective map[string]value
+	errs      []error
+}
+
+func newSource(flags *Flags) *source {
+	s := &source{effective: make(map[string]value)}
+	path := os.Getenv("CONFIG_FILE")
+	if flags != nil {
+		s.flags = flags.values
+		if flags.file != "" {
+			path = flags.file
+		}
+	}
+	if path != "" {
+		s.readFile(path)
+	}
+	return s
+}
+
+func (s *source) errorf(format string, args ...any) {
+	s.errs = append(s.errs, fmt.Errorf(format, args...))
+}
+
+func (s *source) err() error {
+	return errors.Join(s.errs...)
+}
+
+// invalid reports the value of key as invalid, must says what it should be.
+func (s *source) invalid(key string, v value, must string) {
+	from := ""
+	if v.origin != "env" {
+		from = " (from " + v.origin + ")"
+	}
+	s.errorf("invalid %s %q%s: %s", key, strings.Join(v.raw, ","), from, must)
+}
+
+// readFile flattens the config file at path into settings keyed by their
+// environment variable, nested tables are joined with underscores.
+func (s *source) readFile(path string) {
+	s.fileName = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.errorf("config file: %w", err)
+		return
+	}
+
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		err = fmt.Errorf("unsupported format %q: must be .yaml, .yml or .toml", ext)
+	}
+	if err != nil {
+		s.errorf("config file %s: %w", path, err)
+		return
+	}
+
+	s.file = make(map[string][]string)
+	s.flatten("", doc)
+}
+
+func (s *source) flatten(prefix string, doc map[string]any) {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if table, ok := doc[k].(map[string]any); ok {
+			s.flatten(path, table)
+			continue
+		}
+
+		key := strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+		st, ok := settingsByKey[key]
+		if !ok {
+			s.errorf("unknown setting %s in %s", path, s.fileName)
+			continue
+		}
+
+		var vals []string
+		switch v := doc[k].(type) {
+		case []any:
+			if st.kind != kindList && st.kind != kindIndexedList {
+				s.errorf("invalid %s in %s: must be a single value", path, s.fileName)
+				continue
+			}
+			for _, item := range v {
+				vals = append(vals, fmt.Sprint(item))
+			}
+		case nil:
+			continue
+		default:
+			vals = []string{fmt.Sprint(v)}
+		}
+		s.file[key] = vals
+	}
+}
+
+// env returns the environment variable name, or for secrets the content of
+// the file named by name_FILE.
+func (s *source) env(name string, secret bool) (value, bool) {
+	if secret {
+		if path := os.Getenv(name + "_FILE"); path != "" {
+			if os.Getenv(name) != "" {
+				s.errorf("%s and %s_FILE are both set", name, name)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				s.errorf("%s_FILE: %w", name, err)
+				return value{}, false
+			}
+			return value{raw: []string{strings.TrimRight(string(data), "\r\n")}, origin: name + "_FILE"}, true
+		}
+	}
+	if val := os.Getenv(name); val != "" {
+		return value{raw: []string{val}, origin: "env"}, true
+	}
+	return value{}, false
+}
+
+// lookup returns the raw value of key, with list values split.
+func (s *source) lookup(key string) (value, bool) {
+	st, ok := settingsByKey[key]
+	if !ok {
+		panic("config: unknown setting " + key)
+	}
+
+	if vals, ok := s.flags[key]; ok {
+		v := value{raw: vals, origin: "-" + st.flagName()}
+		if st.kind == kindList {
+			v.raw = splitList(strings.Join(vals, ","))
+		}
+		return v, true
+	}
+
+	switch st.kind {
+	case kindIndexedList:
+		var v value
+		for i := 0; ; i++ {
+			item, ok := s.env(fmt.Sprintf("%s_%d", key, i), st.secret)
+			if !ok {
+				break
+			}
+			v.raw, v.origin = append(v.raw, item.raw...), item.origin
+		}
+		if v.raw != nil {
+			return v, true
+		}
+		if v, ok := s.env(key, st.secret); ok {
+			return v, true
+		}
+	case kindList:
+		if v, ok := s.env(key, st.secret); ok {
+			v.raw = splitList(v.raw[0])
+			return v, true
+		}
+	default:
+		if v, ok := s.env(key, st.secret); ok {
+			return v, true
+		}
+	}
+
+	if vals, ok := s.file[key]; ok {
+		v := value{raw: vals, origin: s.fileName}
+		if st.kind == kindList && len(vals) == 1 {
+			v.raw = splitList(vals[0])
+		}
+		return v, true
+	}
+	return value{}, false
+}
+
+// use records v as the effective value of key.
+func (s *source) use(key string, v value) {
+	s.effective[key] = v
+}
+
+// str returns the value of key, or def if it isn't set.
+func (s *source) str(key, def string) string {
+	v, ok := s.lookup(key)
+	if !ok {
+		v = value{raw: []string{def}, origin: "default"}
+	}
+	s.use(key, v)
+	return v.raw[0]
+}
+
+// oneOf returns the lowercased value of key, which must be one of allowed,
+// or def if it isn't set.
+func (s *source) oneOf(key, def string, allowed ...string) string {
+	v, ok := s.lookup(key)
+	if !ok {
+		s.use(key, value{raw: []string{def}, origin: "default"})
+		return def
+	}
+	val := strings.ToLower(v.raw[0])
+	for _, a := range allowed {
+		if val == a {
+			v.raw = []string{val}
+			s.use(key, v)
+			return val
+		}
+	}
+	s.invalid(key, v, "must be "+orList(allowed))
+	return def
+}
+
+// list returns the values of key, or def if it isn't set.
+func (s *source) list(key string, def []string) []string {
+	v, ok := s.lookup(key)
+	if !ok {
+		v = value{raw: def, origin: "default"}
+	}
+	s.use(key, v)
+	return v.raw
+}
+
+// Constraints on numbers and durations.
+type bound int
+
+const (
+	anyValue bound = iota
+	nonNegative
+	positive
+)
+
+func (b bound) check(n float64) bool {
+	switch b {
+	case nonNegative:
+		return n >= 0
+	case positive:
+		return n > 0
+	default:
+		return true
+	}
+}
+
+func (b bound) describe(what string) string {
+	switch b {
+	case nonNegative:
+		return "must be a non-negative " + what
+	case positive:
+		return "must be a positive " + what
+	default:
+		return "must be " + article(what) + " " + what
+	}
+}
+
+func article(word string) string {
+	if strings.ContainsRune("aeiou", rune(word[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// parsed looks key up and parses it with parse, falling back to def if it
+// isn't set or invalid.
+func parsed[T any](s *source, key string, def T, parse func(string) (T, bool), must string) T {
+	v, ok := s.lookup(key)
+	if !ok {
+		s.use(key, value{raw: []string{fmt.Sprint(def)}, origin: "default"})
+		return def
+	}
+	if len(v.raw) == 1 {
+		if n, ok := parse(v.raw[0]); ok {
+			s.use(key, value{raw: []string{fmt.Sprint(n)}, origin: v.origin})
+			return n
+		}
+	}
+	s.invalid(key, v, must)
+	return def
+}
+
+func (s *source) int(key string, def int, b bound) int {
+	return parsed(s, key, def, func(raw string) (int, bool) {
+		n, err := strconv.Atoi(raw)
+		return n, err == nil && b.check(float64(n))
+	}, b.describe("integer"))
+}
+
+func (s *source) int32(key string, def int32, b bound) int32 {
+	return parsed(s, key, def, func(raw string) (int32, bool) {
+		n, err := strconv.ParseInt(raw, 10, 32)
+		return int32(n), err == nil && b.check(float64(n))
+	}, b.describe("32-bit integer"))
+}
+
+func (s *source) int64(key string, def int64, b bound) int64 {
+	return parsed(s, key, def, func(raw string) (int64, bool) {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		return n, err == nil && b.check(float64(n))
+	}, b.describe("integer"))
+}
+
+func (s *source) float(key string, def, min, max float64) float64 {
+	return parsed(s, key, def, func(raw string) (float64, bool) {
+		f, err := strconv.ParseFloat(raw, 64)
+		return f, err == nil && f >= min && f <= max
+	}, fmt.Sprintf("must be between %v and %v", min, max))
+}
+
+func (s *source) duration(key string, def time.Duration, b bound) time.Duration {
+	return parsed(s, key, def, func(raw string) (time.Duration, bool) {
+		d, err := time.ParseDuration(raw)
+		return d, err == nil && b.check(float64(d))
+	}, b.describe("duration"))
+}
+
+func (s *source) bool(key string, def bool) bool {
+	return parsed(s, key, def, func(raw string) (bool, bool) {
+		v, err := strconv.ParseBool(raw)
+		return v, err == nil
+	}, "must be true or false")
+}
+
+// orList formats items as "a, b or c", leaving out empty ones.
+func orList(items []string) string {
+	items = splitList(strings.Join(items, ","))
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
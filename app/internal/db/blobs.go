@@ -0,0 +1,373 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"snippets.adelh.dev/app/internal/blob"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+// ContentStore is implemented by stores that keep snippet content outside
+// the database. Rows referencing such content have a BlobKey and empty
+// EncryptedContent, the content is streamed with OpenContent.
+type ContentStore interface {
+	// PutContent stores the content read from r under a new key. Passed as
+	// BlobKey with empty EncryptedContent to CreateSnippet or
+	// UpdateSnippetContent, the key is owned by the row written. Until
+	// then the caller removes unused content with DiscardContent.
+	PutContent(ctx context.Context, r io.Reader) (string, error)
+	// OpenContent opens the content stored under key, the caller must
+	// close it.
+	OpenContent(ctx context.Context, key string) (io.ReadCloser, error)
+	DiscardContent(ctx context.Context, key string)
+}
+
+// BlobStore is a Store that keeps snippet bodies larger than a threshold in
+// a blob.Store, the database only holds their key. The queriers it returns
+// move bodies written through them to the blob store transparently, rows
+// read back only reference them, so that large bodies are neither loaded
+// nor cached until they are read with OpenContent.
+//
+// Blobs are written before the row that references them and deleted once no
+// committed row references them anymore. A crash in between can leak a blob
+// but never leaves a row pointing at a missing one.
+type BlobStore struct {
+	Store
+	blobs     blob.Store
+	threshold int
+	logger    *slog.Logger
+}
+
+var _ Store = (*BlobStore)(nil)
+var _ ReplicaReporter = (*BlobStore)(nil)
+var _ ReplicaUpdater = (*BlobStore)(nil)
+var _ DBStatsReporter = (*BlobStore)(nil)
+var _ SchemaReporter = (*BlobStore)(nil)
+var _ ContentStore = (*BlobStore)(nil)
+
+// WithBlobStorage wraps store so that bodies above threshold bytes go to blobs.
+func WithBlobStorage(store Store, blobs blob.Store, threshold int) *BlobStore {
+	return &BlobStore{
+		Store:     store,
+		blobs:     blobs,
+		threshold: threshold,
+		logger:    slog.Default(),
+	}
+}
+
+func (s *BlobStore) Primary() sqlc.Querier {
+	return &blobQuerier{Querier: s.Store.Primary(), s: s}
+}
+
+func (s *BlobStore) Replica() sqlc.Querier {
+	return &blobQuerier{Querier: s.Store.Replica(), s: s}
+}
+
+func (s *BlobStore) ReplicaFor(ctx context.Context, token string) sqlc.Querier {
+	return &blobQuerier{Querier: s.Store.ReplicaFor(ctx, token), s: s}
+}
+
+// WithTx defers blob deletions until the outcome of the transaction is known:
+// blobs written by a rolled back transaction and blobs released by a
+// committed one are removed.
+func (s *BlobStore) WithTx(ctx context.Context, fn func(sqlc.Querier) error) error {
+	tx := &blobTx{}
+	err := s.Store.WithTx(ctx, func(q sqlc.Querier) error {
+		return fn(&blobQuerier{Querier: q, s: s, tx: tx})
+	})
+	if err != nil {
+		s.deleteBlobs(ctx, tx.written...)
+		return err
+	}
+	s.deleteBlobs(ctx, tx.released...)
+	return nil
+}
+
+// ReplicaStatus reports the replicas of the wrapped store, if it has any.
+func (s *BlobStore) ReplicaStatus() []ReplicaStatus {
+	if r, ok := s.Store.(ReplicaReporter); ok {
+		return r.ReplicaStatus()
+	}
+	return nil
+}
+
+// SetReplicas replaces the replicas of the wrapped store, if it has any.
+func (s *BlobStore) SetReplicas(ctx context.Context, dsns []string) error {
+	if u, ok := s.Store.(ReplicaUpdater); ok {
+		return u.SetReplicas(ctx, dsns)
+	}
+	return ErrReplicasUnsupported
+}
+
+// SchemaStatus reports the schema of the wrapped store, if it has one.
+func (s *BlobStore) SchemaStatus(ctx context.Context) (MigrationStatus, error) {
+	if r, ok := s.Store.(SchemaReporter); ok {
+		return r.SchemaStatus(ctx)
+	}
+	return MigrationStatus{}, ErrNoSchema
+}
+
+// DBStats reports the pools of the wrapped store, if it has any.
+func (s *BlobStore) DBStats() map[string]sql.DBStats {
+	if r, ok := s.Store.(DBStatsReporter); ok {
+		return r.DBStats()
+	}
+	return nil
+}
+
+func (s *BlobStore) PutContent(ctx context.Context, r io.Reader) (string, error) {
+	key := blob.NewKey()
+	if err := s.blobs.Put(ctx, key, r); err != nil {
+		return "", fmt.Errorf("failed to store snippet content: %w", err)
+	}
+	return key, nil
+}
+
+func (s *BlobStore) OpenContent(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snippet content: %w", err)
+	}
+	return r, nil
+}
+
+func (s *BlobStore) DiscardContent(ctx context.Context, key string) {
+	s.deleteBlobs(ctx, key)
+}
+
+// deleteBlobs removes blobs no row references anymore. Failures only leak
+// storage, so they are logged rather than returned.
+func (s *BlobStore) deleteBlobs(ctx context.Context, keys ...string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			s.logger.Error("failed to delete blob", "key", key, "error", err)
+		}
+	}
+}
+
+// blobTx collects the blobs to clean up when a transaction ends.
+type blobTx struct {
+	// written are deleted on rollback
+	written []string
+	// released are deleted on commit
+	released []string
+}
+
+// blobQuerier moves large bodies between the database and the blob store.
+// Queries that don't touch content go straight to the embedded Querier.
+type blobQuerier struct {
+	sqlc.Querier
+	s *BlobStore
+	// tx is nil outside transactions, blobs are then released right away
+	tx *blobTx
+}
+
+// put stores data in the blob store if it is above the threshold and returns
+// the key and the bytes to keep in the row.
+func (q *blobQuerier) put(ctx context.Context, data []byte) (sql.NullString, []byte, error) {
+	if len(data) <= q.s.threshold {
+		return sql.NullString{}, data, nil
+	}
+	key, err := q.s.PutContent(ctx, bytes.NewReader(data))
+	if err != nil {
+		return sql.NullString{}, nil, err
+	}
+	return sql.NullString{String: key, Valid: true}, []byte{}, nil
+}
+
+// written records a blob referenced by a row that was just written.
+func (q *blobQuerier) written(key sql.NullString) {
+	if key.Valid && q.tx != nil {
+		q.tx.written = append(q.tx.written, key.String)
+	}
+}
+
+// release records blobs that are no longer referenced by any row.
+func (q *blobQuerier) release(ctx context.Context, keys ...sql.NullString) {
+	for _, key := range keys {
+		if !key.Valid {
+			continue
+		}
+		if q.tx != nil {
+			q.tx.released = append(q.tx.released, key.String)
+		} else {
+			q.s.deleteBlobs(ctx, key.String)
+		}
+	}
+}
+
+func (q *blobQuerier) CreateSnippet(ctx context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+	// content from PutContent stays the caller's until the row is written
+	if arg.BlobKey.Valid {
+		arg.EncryptedContent = []byte{}
+		row, err := q.Querier.CreateSnippet(ctx, arg)
+		if err == nil {
+			q.written(arg.BlobKey)
+		}
+		return row, err
+	}
+
+	key, data, err := q.put(ctx, arg.EncryptedContent)
+	if err != nil {
+		return sqlc.CreateSnippetRow{}, err
+	}
+	arg.BlobKey, arg.EncryptedContent = key, data
+
+	row, err := q.Querier.CreateSnippet(ctx, arg)
+	if err != nil {
+		// callers retry on unique violations, don't leave the blob behind
+		if key.Valid {
+			q.s.deleteBlobs(ctx, key.String)
+		}
+		return sqlc.CreateSnippetRow{}, err
+	}
+	q.written(key)
+	return row, nil
+}
+
+func (q *blobQuerier) UpdateSnippetContent(ctx context.Context, arg sqlc.UpdateSnippetContentParams) error {
+	old, err := q.Querier.GetSnippetBlobKey(ctx, arg.SnippetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return q.Querier.UpdateSnippetContent(ctx, arg)
+	}
+	if err != nil {
+		return err
+	}
+
+	// NULL content keeps the stored body, wherever it lives
+	if arg.EncryptedContent == nil && !arg.BlobKey.Valid {
+		arg.BlobKey = old
+		return q.Querier.UpdateSnippetContent(ctx, arg)
+	}
+
+	// content from PutContent stays the caller's until the row is written
+	uploaded := arg.BlobKey.Valid
+	if uploaded {
+		arg.EncryptedContent = []byte{}
+	} else {
+		key, data, err := q.put(ctx, arg.EncryptedContent)
+		if err != nil {
+			return err
+		}
+		arg.BlobKey, arg.EncryptedContent = key, data
+	}
+
+	if err := q.Querier.UpdateSnippetContent(ctx, arg); err != nil {
+		if arg.BlobKey.Valid && !uploaded {
+			q.s.deleteBlobs(ctx, arg.BlobKey.String)
+		}
+		return err
+	}
+	q.written(arg.BlobKey)
+	q.release(ctx, old)
+	return nil
+}
+
+func (q *blobQuerier) DeleteSnippetById(ctx context.Context, id int32) ([]sql.NullString, error) {
+	keys, err := q.Querier.DeleteSnippetById(ctx, id)
+	if err == nil {
+		q.release(ctx, keys...)
+	}
+	return keys, err
+}
+
+func (q *blobQuerier) DeleteExpiredSnippets(ctx context.Context) ([]sql.NullString, error) {
+	keys, err := q.Querier.DeleteExpiredSnippets(ctx)
+	if err == nil {
+		q.release(ctx, keys...)
+	}
+	return keys, err
+}
+
+func (q *blobQuerier) PurgeDeletedSnippets(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error) {
+	keys, err := q.Querier.PurgeDeletedSnippets(ctx, deletedBefore)
+	if err == nil {
+		q.release(ctx, keys...)
+	}
+	return keys, err
+}
+
+func (q *blobQuerier) CreateSnippetBody(ctx context.Context, arg sqlc.CreateSnippetBodyParams) (sqlc.CreateSnippetBodyRow, error) {
+	key, data, err := q.put(ctx, arg.EncryptedContent)
+	if err != nil {
+		return sqlc.CreateSnippetBodyRow{}, err
+	}
+	arg.BlobKey, arg.EncryptedContent = key, data
+
+	row, err := q.Querier.CreateSnippetBody(ctx, arg)
+	if err != nil || row.BlobKey != key {
+		// an identical body stored concurrently is kept instead of ours
+		if key.Valid {
+			q.s.deleteBlobs(ctx, key.String)
+		}
+		return row, err
+	}
+	q.written(key)
+	return row, nil
+}
+
+func (q *blobQuerier) PurgeUnusedSnippetBodies(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error) {
+	keys, err := q.Querier.PurgeUnusedSnippetBodies(ctx, usedBefore)
+	if err == nil {
+		q.release(ctx, keys...)
+	}
+	return keys, err
+}
+
+func (q *blobQuerier) ImportSnippet(ctx context.Context, arg sqlc.ImportSnippetParams) (int32, error) {
+	// content from PutContent stays the caller's until the row is written
+	if arg.BlobKey.Valid {
+		arg.EncryptedContent = []byte{}
+		id, err := q.Querier.ImportSnippet(ctx, arg)
+		if err == nil {
+			q.written(arg.BlobKey)
+		}
+		return id, err
+	}
+
+	key, data, err := q.put(ctx, arg.EncryptedContent)
+	if err != nil {
+		return 0, err
+	}
+	arg.BlobKey, arg.EncryptedContent = key, data
+
+	id, err := q.Querier.ImportSnippet(ctx, arg)
+	if err != nil {
+		if key.Valid {
+			q.s.deleteBlobs(ctx, key.String)
+		}
+		return 0, err
+	}
+	q.written(key)
+	return id, nil
+}
+
+// UpdateSnippetBody moves the new content to the blob store if it is above
+// the threshold and releases the blob the body was stored under, unless the
+// body changed in the meantime.
+func (q *blobQuerier) UpdateSnippetBody(ctx context.Context, arg sqlc.UpdateSnippetBodyParams) (int64, error) {
+	key, data, err := q.put(ctx, arg.EncryptedContent)
+	if err != nil {
+		return 0, err
+	}
+	arg.BlobKey, arg.EncryptedContent = key, data
+
+	n, err := q.Querier.UpdateSnippetBody(ctx, arg)
+	if err != nil || n == 0 {
+		if key.Valid {
+			q.s.deleteBlobs(ctx, key.String)
+		}
+		return n, err
+	}
+	q.written(key)
+	q.release(ctx, arg.OldBlobKey)
+	return n, nil
+}
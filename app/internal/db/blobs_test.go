@@ -0,0 +1,334 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"snippets.adelh.dev/app/internal/blob"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+// memBlobs is a blob.Store in memory that can be told to fail.
+type memBlobs struct {
+	mu      sync.Mutex
+	blobs   map[string][]byte
+	failPut bool
+}
+
+func newMemBlobs() *memBlobs {
+	return &memBlobs{blobs: map[string][]byte{}}
+}
+
+func (m *memBlobs) Put(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failPut || err != nil {
+		return errors.New("put failed")
+	}
+	m.blobs[key] = data
+	return nil
+}
+
+func (m *memBlobs) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.blobs[key]
+	if !ok {
+		return nil, blob.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memBlobs) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, key)
+	return nil
+}
+
+func (m *memBlobs) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Collect(maps.Keys(m.blobs))
+}
+
+// content returns the content of a row, wherever it is stored.
+func content(t *testing.T, s *BlobStore, row sqlc.GetSnippetByPublicIDRow) []byte {
+	t.Helper()
+	if !row.BlobKey.Valid {
+		return row.EncryptedContent
+	}
+	r, err := s.OpenContent(context.Background(), row.BlobKey.String)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func newTestBlobStore(t *testing.T) (*BlobStore, *MemoryStore, *memBlobs) {
+	t.Helper()
+	inner, blobs := NewMemoryStore(), newMemBlobs()
+	return WithBlobStorage(inner, blobs, 16), inner, blobs
+}
+
+func TestBlobStore_CreateAndGet(t *testing.T) {
+	ctx := context.Background()
+	s, inner, blobs := newTestBlobStore(t)
+	q := s.Primary()
+	large := bytes.Repeat([]byte("x"), 100)
+
+	big, err := q.CreateSnippet(ctx, sqlc.CreateSnippetParams{PublicID: "aaa-aaaa-aaa", EncryptedContent: large})
+	if err != nil {
+		t.Fatal(err)
+	}
+	small, err := q.CreateSnippet(ctx, sqlc.CreateSnippetParams{PublicID: "bbb-bbbb-bbb", EncryptedContent: []byte("small")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the large body moved out of the database
+	raw, err := inner.Primary().GetSnippetByPublicID(ctx, big.PublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !raw.BlobKey.Valid || len(raw.EncryptedContent) != 0 {
+		t.Fatalf("stored row BlobKey = %v, content = %d bytes, want a key and no content", raw.BlobKey, len(raw.EncryptedContent))
+	}
+	if got := blobs.keys(); len(got) != 1 || got[0] != raw.BlobKey.String {
+		t.Fatalf("blobs = %v, want [%s]", got, raw.BlobKey.String)
+	}
+
+	for _, tc := range []struct {
+		publicID string
+		want     []byte
+	}{
+		{big.PublicID, large},
+		{small.PublicID, []byte("small")},
+	} {
+		row, err := s.Replica().GetSnippetByPublicID(ctx, tc.publicID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// rows only reference their blob, it is read on demand
+		if row.BlobKey.Valid && len(row.EncryptedContent) != 0 {
+			t.Errorf("%s row holds %d bytes of blob content", tc.publicID, len(row.EncryptedContent))
+		}
+		if got := content(t, s, row); !bytes.Equal(got, tc.want) {
+			t.Errorf("%s content = %q, want %q", tc.publicID, got, tc.want)
+		}
+	}
+}
+
+func TestBlobStore_CreateFailures(t *testing.T) {
+	ctx := context.Background()
+	s, _, blobs := newTestBlobStore(t)
+	q := s.Primary()
+	large := bytes.Repeat([]byte("x"), 100)
+
+	if _, err := q.CreateSnippet(ctx, sqlc.CreateSnippetParams{PublicID: "aaa-aaaa-aaa", EncryptedContent: large}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a rejected row doesn't leave its blob behind
+	_, err := q.CreateSnippet(ctx, sqlc.CreateSnippetParams{PublicID: "aaa-aaaa-aaa", EncryptedContent: large})
+	if !IsUniqueViolation(err) {
+		t.Fatalf("duplicate CreateSnippet error = %v, want a unique violation", err)
+	}
+	if got := blobs.keys(); len(got) != 1 {
+		t.Errorf("blobs = %v, want only the first snippet's", got)
+	}
+
+	// no row without its blob
+	blobs.failPut = true
+	if _, err := q.CreateSnippet(ctx, sqlc.CreateSnippetParams{PublicID: "bbb-bbbb-bbb", EncryptedContent: large}); err == nil {
+		t.Fatal("CreateSnippet succeeded although the blob store failed")
+	}
+	if _, err := q.GetSnippetByPublicID(ctx, "bbb-bbbb-bbb"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("lookup error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestBlobStore_UpdateContent(t *testing.T) {
+	ctx := context.Background()
+	s, _, blobs := newTestBlobStore(t)
+	large := bytes.Repeat([]byte("x"), 100)
+	larger := bytes.Repeat([]byte("y"), 200)
+
+	created, err := s.Primary().CreateSnippet(ctx, sqlc.CreateSnippetParams{PublicID: "aaa-aaaa-aaa", EncryptedContent: large})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := blobs.keys()
+
+	update := func(content []byte) error {
+		return s.WithTx(ctx, func(q sqlc.Querier) error {
+			return q.UpdateSnippetContent(ctx, sqlc.UpdateSnippetContentParams{SnippetID: created.SnippetID, EncryptedContent: content})
+		})
+	}
+	current := func() []byte {
+		row, err := s.Primary().GetSnippetByPublicID(ctx, created.PublicID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content(t, s, row)
+	}
+
+	// the replaced blob is removed once the transaction commits
+	if err := update(larger); err != nil {
+		t.Fatal(err)
+	}
+	if got := blobs.keys(); len(got) != 1 || got[0] == first[0] {
+		t.Fatalf("blobs after update = %v, want a single new blob", got)
+	}
+	if !bytes.Equal(current(), larger) {
+		t.Error("content was not updated")
+	}
+
+	// a rolled back transaction keeps the old blob and drops the new one
+	second := blobs.keys()
+	err = s.WithTx(ctx, func(q sqlc.Querier) error {
+		err := q.UpdateSnippetContent(ctx, sqlc.UpdateSnippetContentParams{SnippetID: created.SnippetID, EncryptedContent: large})
+		if err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("WithTx succeeded, want the rollback error")
+	}
+	if got := blobs.keys(); !slices.Equal(got, second) {
+		t.Fatalf("blobs after rollback = %v, want %v", got, second)
+	}
+	if !bytes.Equal(current(), larger) {
+		t.Error("content changed by a rolled back transaction")
+	}
+
+	// moving the body back inline releases the blob
+	if err := update([]byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	if got := blobs.keys(); len(got) != 0 {
+		t.Errorf("blobs after inline update = %v, want none", got)
+	}
+	if string(current()) != "small" {
+		t.Errorf("content = %q, want small", current())
+	}
+}
+
+func TestBlobStore_PutContent(t *testing.T) {
+	ctx := context.Background()
+	s, _, blobs := newTestBlobStore(t)
+	q := s.Primary()
+
+	// content of any size can be uploaded ahead of its row
+	key, err := s.PutContent(ctx, strings.NewReader("streamed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	arg := sqlc.CreateSnippetParams{PublicID: "aaa-aaaa-aaa", BlobKey: sql.NullString{String: key, Valid: true}}
+	if _, err := q.CreateSnippet(ctx, arg); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed create leaves the upload to the caller
+	if _, err := q.CreateSnippet(ctx, arg); !IsUniqueViolation(err) {
+		t.Fatalf("duplicate CreateSnippet error = %v, want a unique violation", err)
+	}
+	if got := blobs.keys(); len(got) != 1 {
+		t.Fatalf("blobs = %v, want the uploaded one", got)
+	}
+
+	row, err := q.GetSnippetByPublicID(ctx, "aaa-aaaa-aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := content(t, s, row); string(got) != "streamed" {
+		t.Errorf("content = %q, want streamed", got)
+	}
+
+	// replacing it with another upload releases the first
+	next, err := s.PutContent(ctx, strings.NewReader("replaced"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.WithTx(ctx, func(q sqlc.Querier) error {
+		return q.UpdateSnippetContent(ctx, sqlc.UpdateSnippetContentParams{
+			SnippetID: row.ID,
+			BlobKey:   sql.NullString{String: next, Valid: true},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := blobs.keys(); len(got) != 1 || got[0] != next {
+		t.Errorf("blobs after update = %v, want [%s]", got, next)
+	}
+
+	s.DiscardContent(ctx, next)
+	if _, err := s.OpenContent(ctx, next); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("OpenContent after DiscardContent = %v, want blob.ErrNotFound", err)
+	}
+}
+
+func TestBlobStore_DeletesReleaseBlobs(t *testing.T) {
+	ctx := context.Background()
+	s, _, blobs := newTestBlobStore(t)
+	q := s.Primary()
+	large := bytes.Repeat([]byte("x"), 100)
+
+	create := func(publicID string, expiresAt time.Time) int32 {
+		t.Helper()
+		arg := sqlc.CreateSnippetParams{PublicID: publicID, EncryptedContent: large}
+		if !expiresAt.IsZero() {
+			arg.ExpiresAt = sql.NullTime{Time: expiresAt, Valid: true}
+		}
+		row, err := q.CreateSnippet(ctx, arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return row.SnippetID
+	}
+
+	removed := create("aaa-aaaa-aaa", time.Time{})
+	deleted := create("bbb-bbbb-bbb", time.Time{})
+	create("ccc-cccc-ccc", time.Now().Add(-time.Minute))
+	create("ddd-dddd-ddd", time.Time{})
+
+	if _, err := q.DeleteSnippetById(ctx, removed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.SoftDeleteSnippet(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+	// tombstones keep their blob until they are purged
+	if got := blobs.keys(); len(got) != 3 {
+		t.Fatalf("blobs = %v, want 3", got)
+	}
+
+	p := NewPurger(s, 0, time.Minute)
+	p.now = func() time.Time { return time.Now().Add(time.Minute) }
+	if n, err := p.PurgeOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("PurgeOnce = %d, %v, want 2, nil", n, err)
+	}
+	if got := blobs.keys(); len(got) != 1 {
+		t.Errorf("blobs after purge = %v, want only the live snippet's", got)
+	}
+	if _, err := q.GetSnippetByPublicID(ctx, "ddd-dddd-ddd"); err != nil {
+		t.Errorf("live snippet lookup: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package db
+
+import "testing"
+
+func TestParseLSN(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    LSN
+		wantErr bool
+	}{
+		{in: "0/0", want: 0},
+		{in: "0/16B3748", want: 0x16B3748},
+		{in: "16/B374D848", want: 0x16_B374D848},
+		{in: "FFFFFFFF/FFFFFFFF", want: 1<<64 - 1},
+		{in: "", wantErr: true},
+		{in: "16B374D848", wantErr: true},
+		{in: "16/XYZ", wantErr: true},
+		{in: "1FFFFFFFF/0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLSN(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLSN(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLSN(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+		if !tt.wantErr && got.String() != tt.in {
+			t.Errorf("LSN(%q).String() = %q", tt.in, got.String())
+		}
+	}
+
+	a, _ := ParseLSN("0/FFFFFFFF")
+	b, _ := ParseLSN("1/0")
+	if a >= b {
+		t.Errorf("expected %s < %s", a, b)
+	}
+}
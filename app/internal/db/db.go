@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"sync"
 
 	"snippets.adelh.dev/app/internal/config"
 	"snippets.adelh.dev/app/internal/db/sqlc"
@@ -13,19 +12,57 @@ import (
 type Store interface {
 	Primary() sqlc.Querier
 	Replica() sqlc.Querier
+	// ReplicaFor returns a querier that has observed every write made
+	// before token was issued, falling back to the primary if no replica
+	// has caught up yet. An empty token behaves like Replica.
+	ReplicaFor(ctx context.Context, token string) sqlc.Querier
+	// ConsistencyToken returns an opaque token for the current state of the
+	// primary. Take it after a write and hand it to ReplicaFor on reads.
+	ConsistencyToken(ctx context.Context) (string, error)
 	WithTx(ctx context.Context, fn func(sqlc.Querier) error) error
+	// Ping checks that the primary database is reachable.
+	Ping(ctx context.Context) error
 	Close() error
 }
 
+// NewStore opens the Store implementation selected by cfg.Backend and,
+// for Postgres, cfg.Driver.
+func NewStore(cfg config.DBConfig) (Store, error) {
+	switch cfg.Backend() {
+	case config.DBBackendMemory:
+		return NewMemoryStore(), nil
+	case config.DBBackendSQLite:
+		return NewSQLiteStore(cfg)
+	}
+
+	switch cfg.Driver {
+	case config.DBDriverPgxPool:
+		return NewPgxStore(cfg)
+	case config.DBDriverStdlib, "":
+		return NewPostgresStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+}
+
+// DBStatsReporter is implemented by stores with connection pools, it
+// reports them by database: "primary" and the names of the replicas.
+type DBStatsReporter interface {
+	DBStats() map[string]sql.DBStats
+}
+
 type PostgresStore struct {
-	primary    *sql.DB
-	replicas   []*sql.DB
-	mu         sync.RWMutex
-	q          sqlc.Queries
-	replicaIdx int
+	primary *sql.DB
+	rs      *replicaSet
+	q       sqlc.Queries
+	cfg     config.DBConfig
 }
 
 var _ Store = (*PostgresStore)(nil)
+var _ ReplicaReporter = (*PostgresStore)(nil)
+var _ ReplicaUpdater = (*PostgresStore)(nil)
+var _ DBStatsReporter = (*PostgresStore)(nil)
+var _ SchemaReporter = (*PostgresStore)(nil)
 
 func NewPostgresStore(cfg config.DBConfig) (*PostgresStore, error) {
 	primary, err := sql.Open("pgx", cfg.PrimaryDSN)
@@ -41,31 +78,49 @@ func NewPostgresStore(cfg config.DBConfig) (*PostgresStore, error) {
 		return nil, fmt.Errorf("failed to ping primary DB: %w", err)
 	}
 
-	var replicas []*sql.DB
+	store := &PostgresStore{
+		primary: primary,
+		q:       *sqlc.New(primary),
+		cfg:     cfg,
+	}
+
+	var replicas []*replica
 	for i, dsn := range cfg.ReplicaDSNs {
-		replica, err := sql.Open("pgx", dsn)
+		r, err := store.openReplica(fmt.Sprintf("replica-%d", i), dsn)
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to replica DB %d: %w", i, err)
 		}
+		replicas = append(replicas, r)
+	}
+	store.rs = newReplicaSet(replicas, cfg.ReplicaMaxLag, cfg.ReplicaProbeTimeout)
+	store.rs.primaryLSN = store.primaryLSN
 
-		replica.SetMaxOpenConns(cfg.MaxOpenConns)
-		replica.SetMaxIdleConns(cfg.MaxIdleConns)
-		replica.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	// An unreachable replica no longer prevents startup, it just stays
+	// out of rotation until a probe succeeds.
+	store.rs.checkAll(context.Background())
+	store.rs.start(cfg.ReplicaHealthInterval)
 
-		if err := replica.Ping(); err != nil {
-			return nil, fmt.Errorf("failed to ping replica DB %d: %w", i, err)
-		}
-
-		replicas = append(replicas, replica)
-	}
+	return store, nil
+}
 
-	store := &PostgresStore{
-		primary:  primary,
-		replicas: replicas,
-		q:        *sqlc.New(primary),
+func (s *PostgresStore) openReplica(name, dsn string) (*replica, error) {
+	conn, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
 	}
 
-	return store, nil
+	conn.SetMaxOpenConns(s.cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(s.cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(s.cfg.ConnMaxLifetime)
+
+	return &replica{
+		name:  name,
+		dsn:   dsn,
+		q:     sqlc.New(conn),
+		probe: sqlReplicaProbe(conn),
+		close: conn.Close,
+		stats: conn.Stats,
+	}, nil
 }
 
 func (s *PostgresStore) Primary() sqlc.Querier {
@@ -73,19 +128,59 @@ func (s *PostgresStore) Primary() sqlc.Querier {
 }
 
 // Replica returns a queries struct connected to a replica database
-// Uses round-robin selection
+// Uses round-robin selection over healthy replicas and falls back to the primary
+// when none is healthy.
 func (s *PostgresStore) Replica() sqlc.Querier {
-	if len(s.replicas) == 0 {
-		return sqlc.New(s.primary)
+	if r := s.rs.pick(); r != nil {
+		return r.q
+	}
+	return &s.q
+}
+
+// ReplicaFor returns a replica that has replayed the WAL up to token.
+// Replicas are tried in round-robin order, the primary is used when none has caught up.
+func (s *PostgresStore) ReplicaFor(ctx context.Context, token string) sqlc.Querier {
+	if token == "" {
+		return s.Replica()
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	target, err := ParseLSN(token)
+	if err != nil {
+		// a malformed token can't be honoured on a replica, the primary is always consistent
+		return &s.q
+	}
+
+	if r := s.rs.pickFor(ctx, target); r != nil {
+		return r.q
+	}
+	return &s.q
+}
 
-	idx := s.replicaIdx
-	s.replicaIdx = (s.replicaIdx + 1) % len(s.replicas)
+// ConsistencyToken returns the current WAL write position of the primary.
+func (s *PostgresStore) ConsistencyToken(ctx context.Context) (string, error) {
+	lsn, err := s.primaryLSN(ctx)
+	if err != nil {
+		return "", err
+	}
+	return lsn.String(), nil
+}
+
+func (s *PostgresStore) primaryLSN(ctx context.Context) (LSN, error) {
+	var lsn string
+	if err := s.primary.QueryRowContext(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&lsn); err != nil {
+		return 0, fmt.Errorf("failed to read primary WAL position: %w", err)
+	}
+	return ParseLSN(lsn)
+}
 
-	return sqlc.New(s.replicas[idx])
+// ReplicaStatus reports the health of every configured replica.
+func (s *PostgresStore) ReplicaStatus() []ReplicaStatus {
+	return s.rs.statuses()
+}
+
+// SetReplicas replaces the replicas, keeping those that are still listed.
+func (s *PostgresStore) SetReplicas(ctx context.Context, dsns []string) error {
+	return s.rs.replace(ctx, dsns, s.openReplica)
 }
 
 // WithTx executes a function within a database transaction
@@ -107,14 +202,26 @@ func (s *PostgresStore) WithTx(ctx context.Context, fn func(sqlc.Querier) error)
 	return tx.Commit()
 }
 
+func (s *PostgresStore) DBStats() map[string]sql.DBStats {
+	stats := map[string]sql.DBStats{"primary": s.primary.Stats()}
+	for _, r := range s.rs.members() {
+		stats[r.name] = r.stats()
+	}
+	return stats
+}
+
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.primary.PingContext(ctx)
+}
+
+func (s *PostgresStore) SchemaStatus(ctx context.Context) (MigrationStatus, error) {
+	return schemaStatus(s.primary.QueryRowContext(ctx, schemaVersionQuery), postgresMigrations, "migrations")
+}
+
 func (s *PostgresStore) Close() error {
+	replicasErr := s.rs.close()
 	if err := s.primary.Close(); err != nil {
 		return err
 	}
-	for i, replica := range s.replicas {
-		if err := replica.Close(); err != nil {
-			return fmt.Errorf("failed to close replica %d: %w", i, err)
-		}
-	}
-	return nil
+	return replicasErr
 }
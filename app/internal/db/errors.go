@@ -0,0 +1,54 @@
+package db
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// errUniqueViolation is what MemoryStore reports for a duplicate key.
+var errUniqueViolation = errors.New("duplicate key value violates unique constraint")
+
+// errMissingBody is what MemoryStore reports for a reference to a snippet
+// body that doesn't exist.
+var errMissingBody = errors.New("insert or update violates foreign key constraint on body_id")
+
+// SQLITE_CONSTRAINT_UNIQUE and SQLITE_CONSTRAINT_PRIMARYKEY extended result
+// codes, a duplicate INTEGER PRIMARY KEY reports the latter.
+const (
+	sqliteConstraintUnique     = 2067
+	sqliteConstraintPrimaryKey = 1555
+)
+
+// IsUniqueViolation reports whether err was caused by inserting a duplicate
+// value into a unique column, for any of the Store backends.
+func IsUniqueViolation(err error) bool {
+	if errors.Is(err, errUniqueViolation) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+
+	// modernc.org/sqlite errors, matched by behaviour to keep the driver optional
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code()
+		return code == sqliteConstraintUnique || code == sqliteConstraintPrimaryKey
+	}
+	return false
+}
+
+// isUndefinedTable reports whether err was caused by querying a table that
+// doesn't exist, on Postgres or SQLite.
+func isUndefinedTable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "42P01"
+	}
+	// SQLite reports it as a generic error, only the message tells
+	return err != nil && strings.Contains(err.Error(), "no such table")
+}
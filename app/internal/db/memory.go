@@ -0,0 +1,790 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+// MemoryStore is a Store that keeps all data in process memory.
+// It is meant for tests and local development; nothing survives a restart.
+//
+// Transactions are serialized: WithTx holds the store lock until fn returns
+// and works on a copy of the data that replaces the original on commit.
+// fn must therefore only use the querier it is given, calling back into the
+// store from inside a transaction deadlocks.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	state *memState
+	q     *memQuerier
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{state: newMemState()}
+	s.q = &memQuerier{
+		state:   func() *memState { return s.state },
+		lock:    s.mu.Lock,
+		unlock:  s.mu.Unlock,
+		rlock:   s.mu.RLock,
+		runlock: s.mu.RUnlock,
+	}
+	return s
+}
+
+func (s *MemoryStore) Primary() sqlc.Querier {
+	return s.q
+}
+
+func (s *MemoryStore) Replica() sqlc.Querier {
+	return s.q
+}
+
+// ReplicaFor returns the single copy of the data, which is always consistent.
+func (s *MemoryStore) ReplicaFor(ctx context.Context, token string) sqlc.Querier {
+	return s.q
+}
+
+// ConsistencyToken returns an empty token, there are no replicas to catch up.
+func (s *MemoryStore) ConsistencyToken(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+// WithTx executes a function within a transaction
+func (s *MemoryStore) WithTx(ctx context.Context, fn func(sqlc.Querier) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx := s.state.clone()
+	noop := func() {}
+	err := fn(&memQuerier{
+		state:   func() *memState { return tx },
+		lock:    noop,
+		unlock:  noop,
+		rlock:   noop,
+		runlock: noop,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.state = tx
+	return nil
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+type memState struct {
+	nextID     int32
+	snippets   map[int32]sqlc.Snippet
+	contents   map[int32]sqlc.SnippetContent
+	byPublicID map[string]int32
+	bySlug     map[string]int32
+
+	nextBodyID int32
+	bodies     map[int32]sqlc.SnippetBody
+	byHash     map[string]int32
+
+	// audit is only ever appended to, by seq
+	audit     []sqlc.AuditLog
+	auditHead sqlc.GetAuditHeadRow
+}
+
+func newMemState() *memState {
+	return &memState{
+		nextID:     1,
+		snippets:   map[int32]sqlc.Snippet{},
+		contents:   map[int32]sqlc.SnippetContent{},
+		byPublicID: map[string]int32{},
+		bySlug:     map[string]int32{},
+		nextBodyID: 1,
+		bodies:     map[int32]sqlc.SnippetBody{},
+		byHash:     map[string]int32{},
+		auditHead:  sqlc.GetAuditHeadRow{Hash: []byte{}},
+	}
+}
+
+// clone returns a copy that can be modified without affecting m.
+// Byte slices are never modified in place, so they are shared.
+func (m *memState) clone() *memState {
+	c := &memState{
+		nextID:     m.nextID,
+		snippets:   make(map[int32]sqlc.Snippet, len(m.snippets)),
+		contents:   make(map[int32]sqlc.SnippetContent, len(m.contents)),
+		byPublicID: make(map[string]int32, len(m.byPublicID)),
+		bySlug:     make(map[string]int32, len(m.bySlug)),
+		nextBodyID: m.nextBodyID,
+		bodies:     make(map[int32]sqlc.SnippetBody, len(m.bodies)),
+		byHash:     make(map[string]int32, len(m.byHash)),
+		// appending to the clipped slice copies it
+		audit:     slices.Clip(m.audit),
+		auditHead: m.auditHead,
+	}
+	for k, v := range m.snippets {
+		c.snippets[k] = v
+	}
+	for k, v := range m.contents {
+		c.contents[k] = v
+	}
+	for k, v := range m.byPublicID {
+		c.byPublicID[k] = v
+	}
+	for k, v := range m.bySlug {
+		c.bySlug[k] = v
+	}
+	for k, v := range m.bodies {
+		c.bodies[k] = v
+	}
+	for k, v := range m.byHash {
+		c.byHash[k] = v
+	}
+	return c
+}
+
+// ref adjusts the reference count of a body, like the trigger on
+// snippet_contents does.
+func (m *memState) ref(id sql.NullInt32, delta int32) {
+	if !id.Valid {
+		return
+	}
+	if body, ok := m.bodies[id.Int32]; ok {
+		body.RefCount += delta
+		m.bodies[id.Int32] = body
+	}
+}
+
+// delete removes a snippet and returns the blob key of its content.
+func (m *memState) delete(id int32) (sql.NullString, bool) {
+	snippet, ok := m.snippets[id]
+	if !ok {
+		return sql.NullString{}, false
+	}
+	key := m.contents[id].BlobKey
+	m.ref(m.contents[id].BodyID, -1)
+	delete(m.snippets, id)
+	delete(m.contents, id)
+	delete(m.byPublicID, snippet.PublicID)
+	if snippet.Slug.Valid {
+		delete(m.bySlug, snippet.Slug.String)
+	}
+	return key, true
+}
+
+// memQuerier implements sqlc.Querier on top of a memState, mirroring the
+// semantics of queries.sql.
+type memQuerier struct {
+	state                        func() *memState
+	lock, unlock, rlock, runlock func()
+}
+
+var _ sqlc.Querier = (*memQuerier)(nil)
+
+func (q *memQuerier) CreateSnippet(ctx context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	if _, taken := m.byPublicID[arg.PublicID]; taken {
+		return sqlc.CreateSnippetRow{}, errUniqueViolation
+	}
+	if _, taken := m.bySlug[arg.Slug.String]; taken && arg.Slug.Valid {
+		return sqlc.CreateSnippetRow{}, errUniqueViolation
+	}
+	if _, ok := m.bodies[arg.BodyID.Int32]; arg.BodyID.Valid && !ok {
+		return sqlc.CreateSnippetRow{}, errMissingBody
+	}
+
+	id := m.nextID
+	m.nextID++
+	snippet := sqlc.Snippet{
+		ID:           id,
+		PublicID:     arg.PublicID,
+		Slug:         arg.Slug,
+		Title:        arg.Title,
+		CreatedAt:    time.Now().UTC(),
+		ExpiresAt:    arg.ExpiresAt,
+		PasswordHash: arg.PasswordHash,
+		EditToken:    arg.EditToken,
+	}
+	m.snippets[id] = snippet
+	m.contents[id] = sqlc.SnippetContent{
+		SnippetID:        id,
+		ContentType:      arg.ContentType,
+		EncryptedContent: slices.Clone(arg.EncryptedContent),
+		BlobKey:          arg.BlobKey,
+		BodyID:           arg.BodyID,
+	}
+	m.ref(arg.BodyID, 1)
+	m.byPublicID[arg.PublicID] = id
+	if arg.Slug.Valid {
+		m.bySlug[arg.Slug.String] = id
+	}
+
+	return sqlc.CreateSnippetRow{
+		SnippetID: id,
+		PublicID:  snippet.PublicID,
+		Slug:      snippet.Slug,
+		CreatedAt: snippet.CreatedAt,
+		EditToken: snippet.EditToken,
+	}, nil
+}
+
+func (q *memQuerier) DeleteExpiredSnippets(ctx context.Context) ([]sql.NullString, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	now := time.Now()
+	keys := []sql.NullString{}
+	for id, snippet := range m.snippets {
+		if snippet.ExpiresAt.Valid && snippet.ExpiresAt.Time.Before(now) {
+			key, _ := m.delete(id)
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (q *memQuerier) DeleteSnippetById(ctx context.Context, id int32) ([]sql.NullString, error) {
+	q.lock()
+	defer q.unlock()
+
+	if key, ok := q.state().delete(id); ok {
+		return []sql.NullString{key}, nil
+	}
+	return []sql.NullString{}, nil
+}
+
+func (q *memQuerier) GetSnippetBlobKey(ctx context.Context, snippetID int32) (sql.NullString, error) {
+	q.rlock()
+	defer q.runlock()
+
+	content, ok := q.state().contents[snippetID]
+	if !ok {
+		return sql.NullString{}, sql.ErrNoRows
+	}
+	return content.BlobKey, nil
+}
+
+func (q *memQuerier) GetSnippetByPublicID(ctx context.Context, publicID string) (sqlc.GetSnippetByPublicIDRow, error) {
+	q.rlock()
+	defer q.runlock()
+	m := q.state()
+
+	id, ok := m.byPublicID[publicID]
+	if !ok {
+		id, ok = m.bySlug[publicID]
+	}
+	if !ok {
+		return sqlc.GetSnippetByPublicIDRow{}, sql.ErrNoRows
+	}
+	s, c := m.snippets[id], m.contents[id]
+	encryptedContent, blobKey, contentHash := c.EncryptedContent, c.BlobKey, []byte(nil)
+	if body, ok := m.bodies[c.BodyID.Int32]; ok && c.BodyID.Valid {
+		encryptedContent, blobKey, contentHash = body.EncryptedContent, body.BlobKey, body.ContentHash
+	}
+
+	return sqlc.GetSnippetByPublicIDRow{
+		ID:               s.ID,
+		PublicID:         s.PublicID,
+		Slug:             s.Slug,
+		Title:            s.Title,
+		CreatedAt:        s.CreatedAt,
+		ExpiresAt:        s.ExpiresAt,
+		PasswordHash:     s.PasswordHash,
+		EditToken:        s.EditToken,
+		ViewCount:        s.ViewCount,
+		LastEditedAt:     s.LastEditedAt,
+		DeletedAt:        s.DeletedAt,
+		ContentType:      c.ContentType,
+		EncryptedContent: slices.Clone(encryptedContent),
+		BlobKey:          blobKey,
+		ContentHash:      slices.Clone(contentHash),
+	}, nil
+}
+
+func (q *memQuerier) IncrementSnippetViewCount(ctx context.Context, id int32) (int32, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	snippet, ok := m.snippets[id]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	snippet.ViewCount++
+	m.snippets[id] = snippet
+	return snippet.ViewCount, nil
+}
+
+func (q *memQuerier) ListRecentSnippets(ctx context.Context, limit int32) ([]sqlc.ListRecentSnippetsRow, error) {
+	q.rlock()
+	defer q.runlock()
+	m := q.state()
+
+	items := make([]sqlc.ListRecentSnippetsRow, 0, len(m.snippets))
+	for _, s := range m.snippets {
+		if s.DeletedAt.Valid {
+			continue
+		}
+		items = append(items, sqlc.ListRecentSnippetsRow{
+			ID:        s.ID,
+			PublicID:  s.PublicID,
+			Slug:      s.Slug,
+			Title:     s.Title,
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+		})
+	}
+	slices.SortFunc(items, func(a, b sqlc.ListRecentSnippetsRow) int {
+		// newest first, ids break ties between snippets created in the same instant
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	if limit >= 0 && int(limit) < len(items) {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (q *memQuerier) PurgeDeletedSnippets(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	keys := []sql.NullString{}
+	for id, snippet := range m.snippets {
+		if snippet.DeletedAt.Valid && deletedBefore.Valid && snippet.DeletedAt.Time.Before(deletedBefore.Time) {
+			key, _ := m.delete(id)
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (q *memQuerier) RestoreSnippet(ctx context.Context, arg sqlc.RestoreSnippetParams) (int64, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	snippet, ok := m.snippets[arg.ID]
+	if !ok || !snippet.DeletedAt.Valid || !arg.DeletedAfter.Valid || snippet.DeletedAt.Time.Before(arg.DeletedAfter.Time) {
+		return 0, nil
+	}
+	snippet.DeletedAt = sql.NullTime{}
+	m.snippets[arg.ID] = snippet
+	return 1, nil
+}
+
+func (q *memQuerier) SoftDeleteSnippet(ctx context.Context, id int32) (int64, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	snippet, ok := m.snippets[id]
+	if !ok || snippet.DeletedAt.Valid {
+		return 0, nil
+	}
+	snippet.DeletedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	m.snippets[id] = snippet
+	return 1, nil
+}
+
+func (q *memQuerier) UpdateSnippet(ctx context.Context, arg sqlc.UpdateSnippetParams) (sqlc.UpdateSnippetRow, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	snippet, ok := m.snippets[arg.ID]
+	if !ok {
+		return sqlc.UpdateSnippetRow{}, sql.ErrNoRows
+	}
+	if arg.Title.Valid {
+		snippet.Title = arg.Title
+	}
+	if arg.ExpiresAt.Valid {
+		snippet.ExpiresAt = arg.ExpiresAt
+	}
+	if arg.PasswordHash.Valid {
+		snippet.PasswordHash = arg.PasswordHash
+	}
+	snippet.LastEditedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	m.snippets[arg.ID] = snippet
+
+	return sqlc.UpdateSnippetRow{
+		ID:           snippet.ID,
+		PublicID:     snippet.PublicID,
+		CreatedAt:    snippet.CreatedAt,
+		LastEditedAt: snippet.LastEditedAt,
+	}, nil
+}
+
+func (q *memQuerier) UpdateSnippetSlug(ctx context.Context, arg sqlc.UpdateSnippetSlugParams) error {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	snippet, ok := m.snippets[arg.ID]
+	if !ok {
+		return nil
+	}
+	if owner, taken := m.bySlug[arg.Slug.String]; taken && arg.Slug.Valid && owner != arg.ID {
+		return errUniqueViolation
+	}
+	if snippet.Slug.Valid {
+		delete(m.bySlug, snippet.Slug.String)
+	}
+	if arg.Slug.Valid {
+		m.bySlug[arg.Slug.String] = arg.ID
+	}
+	snippet.Slug = arg.Slug
+	m.snippets[arg.ID] = snippet
+	return nil
+}
+
+func (q *memQuerier) UpdateSnippetContent(ctx context.Context, arg sqlc.UpdateSnippetContentParams) error {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	content, ok := m.contents[arg.SnippetID]
+	if !ok {
+		return nil
+	}
+	content.ContentType = arg.ContentType
+	if arg.EncryptedContent != nil {
+		content.EncryptedContent = slices.Clone(arg.EncryptedContent)
+	}
+	content.BlobKey = arg.BlobKey
+	if content.BodyID != arg.BodyID {
+		if _, ok := m.bodies[arg.BodyID.Int32]; arg.BodyID.Valid && !ok {
+			return errMissingBody
+		}
+		m.ref(content.BodyID, -1)
+		m.ref(arg.BodyID, 1)
+		content.BodyID = arg.BodyID
+	}
+	m.contents[arg.SnippetID] = content
+	return nil
+}
+
+func (q *memQuerier) TouchSnippetBody(ctx context.Context, contentHash []byte) (int32, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	id, ok := m.byHash[string(contentHash)]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	body := m.bodies[id]
+	body.LastUsedAt = time.Now().UTC()
+	m.bodies[id] = body
+	return id, nil
+}
+
+func (q *memQuerier) CreateSnippetBody(ctx context.Context, arg sqlc.CreateSnippetBodyParams) (sqlc.CreateSnippetBodyRow, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	now := time.Now().UTC()
+	if id, ok := m.byHash[string(arg.ContentHash)]; ok {
+		body := m.bodies[id]
+		body.LastUsedAt = now
+		m.bodies[id] = body
+		return sqlc.CreateSnippetBodyRow{ID: id, BlobKey: body.BlobKey}, nil
+	}
+
+	id := m.nextBodyID
+	m.nextBodyID++
+	m.bodies[id] = sqlc.SnippetBody{
+		ID:               id,
+		ContentHash:      slices.Clone(arg.ContentHash),
+		EncryptedContent: slices.Clone(arg.EncryptedContent),
+		BlobKey:          arg.BlobKey,
+		LastUsedAt:       now,
+	}
+	m.byHash[string(arg.ContentHash)] = id
+	return sqlc.CreateSnippetBodyRow{ID: id, BlobKey: arg.BlobKey}, nil
+}
+
+func (q *memQuerier) PurgeUnusedSnippetBodies(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	keys := []sql.NullString{}
+	for id, body := range m.bodies {
+		if body.RefCount == 0 && body.LastUsedAt.Before(usedBefore) {
+			delete(m.bodies, id)
+			delete(m.byHash, string(body.ContentHash))
+			keys = append(keys, body.BlobKey)
+		}
+	}
+	return keys, nil
+}
+
+func (q *memQuerier) ImportSnippet(ctx context.Context, arg sqlc.ImportSnippetParams) (int32, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	if _, taken := m.byPublicID[arg.PublicID]; taken {
+		return 0, errUniqueViolation
+	}
+	if _, taken := m.bySlug[arg.Slug.String]; taken && arg.Slug.Valid {
+		return 0, errUniqueViolation
+	}
+
+	id := m.nextID
+	m.nextID++
+	m.snippets[id] = sqlc.Snippet{
+		ID:           id,
+		PublicID:     arg.PublicID,
+		Slug:         arg.Slug,
+		Title:        arg.Title,
+		CreatedAt:    arg.CreatedAt.UTC(),
+		ExpiresAt:    arg.ExpiresAt,
+		PasswordHash: arg.PasswordHash,
+		EditToken:    arg.EditToken,
+		ViewCount:    arg.ViewCount,
+		LastEditedAt: arg.LastEditedAt,
+		DeletedAt:    arg.DeletedAt,
+	}
+	m.contents[id] = sqlc.SnippetContent{
+		SnippetID:        id,
+		ContentType:      arg.ContentType,
+		EncryptedContent: slices.Clone(arg.EncryptedContent),
+		BlobKey:          arg.BlobKey,
+	}
+	m.byPublicID[arg.PublicID] = id
+	if arg.Slug.Valid {
+		m.bySlug[arg.Slug.String] = id
+	}
+	return id, nil
+}
+
+func (q *memQuerier) ListSnippets(ctx context.Context, arg sqlc.ListSnippetsParams) ([]sqlc.ListSnippetsRow, error) {
+	q.rlock()
+	defer q.runlock()
+	m := q.state()
+
+	ids := make([]int32, 0, len(m.snippets))
+	for id := range m.snippets {
+		if id > arg.AfterID {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	if arg.MaxRows >= 0 && int(arg.MaxRows) < len(ids) {
+		ids = ids[:arg.MaxRows]
+	}
+
+	rows := make([]sqlc.ListSnippetsRow, len(ids))
+	for i, id := range ids {
+		s, c := m.snippets[id], m.contents[id]
+		encryptedContent, blobKey, contentHash := c.EncryptedContent, c.BlobKey, []byte(nil)
+		if body, ok := m.bodies[c.BodyID.Int32]; ok && c.BodyID.Valid {
+			encryptedContent, blobKey, contentHash = body.EncryptedContent, body.BlobKey, body.ContentHash
+		}
+		rows[i] = sqlc.ListSnippetsRow{
+			ID:               s.ID,
+			PublicID:         s.PublicID,
+			Slug:             s.Slug,
+			Title:            s.Title,
+			CreatedAt:        s.CreatedAt,
+			ExpiresAt:        s.ExpiresAt,
+			PasswordHash:     s.PasswordHash,
+			EditToken:        s.EditToken,
+			ViewCount:        s.ViewCount,
+			LastEditedAt:     s.LastEditedAt,
+			DeletedAt:        s.DeletedAt,
+			ContentType:      c.ContentType,
+			EncryptedContent: slices.Clone(encryptedContent),
+			BlobKey:          blobKey,
+			ContentHash:      slices.Clone(contentHash),
+			BodyID:           c.BodyID,
+		}
+	}
+	return rows, nil
+}
+
+func (q *memQuerier) GetSnippetStats(ctx context.Context) (sqlc.GetSnippetStatsRow, error) {
+	q.rlock()
+	defer q.runlock()
+	m := q.state()
+
+	now := time.Now()
+	stats := sqlc.GetSnippetStatsRow{Total: int64(len(m.snippets)), Bodies: int64(len(m.bodies))}
+	for _, s := range m.snippets {
+		switch {
+		case s.DeletedAt.Valid:
+			stats.Deleted++
+		case s.ExpiresAt.Valid && s.ExpiresAt.Time.Before(now):
+			stats.Expired++
+		}
+		if s.PasswordHash.Valid {
+			stats.Protected++
+		}
+		stats.Views += int64(s.ViewCount)
+	}
+	for _, c := range m.contents {
+		if c.BlobKey.Valid {
+			stats.Blobs++
+		}
+	}
+	return stats, nil
+}
+
+func (q *memQuerier) ListSnippetBodies(ctx context.Context, arg sqlc.ListSnippetBodiesParams) ([]sqlc.ListSnippetBodiesRow, error) {
+	q.rlock()
+	defer q.runlock()
+	m := q.state()
+
+	ids := make([]int32, 0, len(m.bodies))
+	for id := range m.bodies {
+		if id > arg.AfterID {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	if arg.MaxRows >= 0 && int(arg.MaxRows) < len(ids) {
+		ids = ids[:arg.MaxRows]
+	}
+
+	rows := make([]sqlc.ListSnippetBodiesRow, len(ids))
+	for i, id := range ids {
+		body := m.bodies[id]
+		rows[i] = sqlc.ListSnippetBodiesRow{
+			ID:               body.ID,
+			ContentHash:      slices.Clone(body.ContentHash),
+			EncryptedContent: slices.Clone(body.EncryptedContent),
+			BlobKey:          body.BlobKey,
+		}
+	}
+	return rows, nil
+}
+
+func (q *memQuerier) UpdateSnippetBody(ctx context.Context, arg sqlc.UpdateSnippetBodyParams) (int64, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	body, ok := m.bodies[arg.ID]
+	if !ok || body.BlobKey != arg.OldBlobKey {
+		return 0, nil
+	}
+	body.EncryptedContent = slices.Clone(arg.EncryptedContent)
+	body.BlobKey = arg.BlobKey
+	m.bodies[arg.ID] = body
+	return 1, nil
+}
+
+func (q *memQuerier) SearchSnippets(ctx context.Context, arg sqlc.SearchSnippetsParams) ([]sqlc.SearchSnippetsRow, error) {
+	q.rlock()
+	defer q.runlock()
+	m := q.state()
+
+	query := strings.ToLower(arg.Query)
+	rows := []sqlc.SearchSnippetsRow{}
+	for _, s := range m.snippets {
+		if s.PublicID != arg.Query && (!s.Slug.Valid || s.Slug.String != arg.Query) &&
+			(!s.Title.Valid || !strings.Contains(strings.ToLower(s.Title.String), query)) {
+			continue
+		}
+		rows = append(rows, sqlc.SearchSnippetsRow{
+			ID:        s.ID,
+			PublicID:  s.PublicID,
+			Slug:      s.Slug,
+			Title:     s.Title,
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+			DeletedAt: s.DeletedAt,
+		})
+	}
+	slices.SortFunc(rows, func(a, b sqlc.SearchSnippetsRow) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	if arg.MaxRows >= 0 && int(arg.MaxRows) < len(rows) {
+		rows = rows[:arg.MaxRows]
+	}
+	return rows, nil
+}
+
+func (q *memQuerier) ExpireSnippet(ctx context.Context, id int32) (int64, error) {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	now := time.Now().UTC()
+	snippet, ok := m.snippets[id]
+	if !ok || snippet.DeletedAt.Valid || (snippet.ExpiresAt.Valid && !snippet.ExpiresAt.Time.After(now)) {
+		return 0, nil
+	}
+	snippet.ExpiresAt = sql.NullTime{Time: now, Valid: true}
+	m.snippets[id] = snippet
+	return 1, nil
+}
+
+// LockAuditHead only reads the head, transactions are serialized.
+func (q *memQuerier) LockAuditHead(ctx context.Context) (sqlc.LockAuditHeadRow, error) {
+	head, err := q.GetAuditHead(ctx)
+	return sqlc.LockAuditHeadRow(head), err
+}
+
+func (q *memQuerier) GetAuditHead(ctx context.Context) (sqlc.GetAuditHeadRow, error) {
+	q.rlock()
+	defer q.runlock()
+	return q.state().auditHead, nil
+}
+
+func (q *memQuerier) UpdateAuditHead(ctx context.Context, arg sqlc.UpdateAuditHeadParams) error {
+	q.lock()
+	defer q.unlock()
+	q.state().auditHead = sqlc.GetAuditHeadRow(arg)
+	return nil
+}
+
+func (q *memQuerier) CreateAuditEntry(ctx context.Context, arg sqlc.CreateAuditEntryParams) error {
+	q.lock()
+	defer q.unlock()
+	m := q.state()
+
+	if len(m.audit) > 0 && m.audit[len(m.audit)-1].Seq >= arg.Seq {
+		return errUniqueViolation
+	}
+	m.audit = append(m.audit, sqlc.AuditLog(arg))
+	return nil
+}
+
+func (q *memQuerier) ListAuditEntries(ctx context.Context, arg sqlc.ListAuditEntriesParams) ([]sqlc.AuditLog, error) {
+	q.rlock()
+	defer q.runlock()
+	m := q.state()
+
+	i, _ := slices.BinarySearchFunc(m.audit, arg.AfterSeq+1, func(e sqlc.AuditLog, seq int64) int {
+		return cmp.Compare(e.Seq, seq)
+	})
+	rows := slices.Clone(m.audit[i:])
+	if arg.MaxRows >= 0 && int(arg.MaxRows) < len(rows) {
+		rows = rows[:arg.MaxRows]
+	}
+	return rows, nil
+}
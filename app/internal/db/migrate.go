@@ -0,0 +1,267 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	migratepgx "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"snippets.adelh.dev/app/internal/config"
+)
+
+//go:embed migrations/*.sql
+var postgresMigrations embed.FS
+
+//go:embed sqlite/migrations/*.sql
+var sqliteMigrations embed.FS
+
+// ErrSchemaOutdated is returned by EnsureSchema when the database is behind
+// the migrations embedded in the binary.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// MigrationStatus describes the schema version of a database.
+type MigrationStatus struct {
+	// Current is the applied version, zero for an empty database.
+	Current uint
+	// Dirty is set when a migration failed halfway and needs to be fixed by
+	// hand and then forced to a version.
+	Dirty bool
+	// Latest is the newest embedded migration.
+	Latest uint
+	// Pending lists the embedded versions newer than Current.
+	Pending []uint
+}
+
+// SchemaReporter is implemented by stores with a migrated schema.
+type SchemaReporter interface {
+	// SchemaStatus compares the version recorded in schema_migrations with
+	// the embedded migrations. It only reads that table, with a single
+	// query: it takes no lock and creates nothing, unlike a Migrator.
+	SchemaStatus(ctx context.Context) (MigrationStatus, error)
+}
+
+// ErrNoSchema is returned by SchemaStatus on a store without a schema, such
+// as the memory store.
+var ErrNoSchema = errors.New("the store has no schema")
+
+// schemaVersionQuery reads the table golang-migrate keeps its version in,
+// it holds a single row once a migration ran.
+const schemaVersionQuery = `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+// schemaStatus scans the result of schemaVersionQuery and compares it with
+// the migrations in dir of fsys. A missing table or row is version zero.
+func schemaStatus(row interface{ Scan(...any) error }, fsys fs.FS, dir string) (MigrationStatus, error) {
+	var st MigrationStatus
+	var version int64
+	err := row.Scan(&version, &st.Dirty)
+	switch {
+	case err == nil:
+		st.Current = uint(version)
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, pgx.ErrNoRows), isUndefinedTable(err):
+	default:
+		return st, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	src, err := iofs.New(fsys, dir)
+	if err != nil {
+		return st, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	defer src.Close()
+	return st, st.addPending(src)
+}
+
+// addPending sets Latest and Pending from the migrations of src.
+func (st *MigrationStatus) addPending(src source.Driver) error {
+	version, err := src.First()
+	for err == nil {
+		st.Latest = version
+		if version > st.Current {
+			st.Pending = append(st.Pending, version)
+		}
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Migrator applies the embedded schema migrations of the configured backend.
+// It uses the same schema_migrations table as the migrate CLI, so databases
+// migrated with the CLI are picked up where they left off.
+type Migrator struct {
+	m   *migrate.Migrate
+	src source.Driver
+}
+
+// NewMigrator opens a dedicated connection to the primary database of cfg.
+// On Postgres every run holds an advisory lock, so instances starting at the
+// same time apply each migration once.
+func NewMigrator(cfg config.DBConfig) (*Migrator, error) {
+	var (
+		fsys   fs.FS
+		dir    string
+		name   string
+		driver database.Driver
+	)
+
+	switch cfg.Backend() {
+	case config.DBBackendMemory:
+		return nil, errors.New("the memory backend has no schema to migrate")
+
+	case config.DBBackendSQLite:
+		dsn, err := sqliteDSN(cfg.PrimaryDSN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SQLite DSN: %w", err)
+		}
+		conn, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open SQLite DB: %w", err)
+		}
+		driver, err = migratesqlite.WithInstance(conn, &migratesqlite.Config{})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to open SQLite DB: %w", err)
+		}
+		fsys, dir, name = sqliteMigrations, "sqlite/migrations", "sqlite"
+
+	default:
+		conn, err := sql.Open("pgx", cfg.PrimaryDSN)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to primary DB: %w", err)
+		}
+		driver, err = migratepgx.WithInstance(conn, &migratepgx.Config{})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to connect to primary DB: %w", err)
+		}
+		fsys, dir, name = postgresMigrations, "migrations", "pgx5"
+	}
+
+	src, err := iofs.New(fsys, dir)
+	if err != nil {
+		driver.Close()
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", src, name, driver)
+	if err != nil {
+		driver.Close()
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	return &Migrator{m: m, src: src}, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up() error {
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Down rolls back the given number of migrations, or all of them if steps is zero.
+func (m *Migrator) Down(steps int) error {
+	var err error
+	if steps == 0 {
+		err = m.m.Down()
+	} else {
+		err = m.m.Steps(-steps)
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Force sets the version without running any migration and clears the dirty
+// flag. Use it after repairing a failed migration by hand.
+func (m *Migrator) Force(version int) error {
+	return m.m.Force(version)
+}
+
+// Status reports the applied and available schema versions.
+func (m *Migrator) Status() (MigrationStatus, error) {
+	var st MigrationStatus
+
+	current, dirty, err := m.m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return st, err
+	}
+	st.Current, st.Dirty = current, dirty
+	return st, st.addPending(m.src)
+}
+
+// Close closes the migration source and the database connection.
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+// EnsureSchema applies pending migrations if cfg.AutoMigrate is set and then
+// checks that the schema is current. It returns ErrSchemaOutdated when
+// migrations are still pending, a server must not run against such a schema.
+func EnsureSchema(cfg config.DBConfig) error {
+	if cfg.Backend() == config.DBBackendMemory {
+		return nil
+	}
+
+	m, err := NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if cfg.AutoMigrate {
+		if err := m.Up(); err != nil {
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+	}
+	st, err := m.Status()
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return checkStatus(st)
+}
+
+// CheckSchema returns ErrSchemaOutdated if the schema of the database of s
+// isn't current, without migrating it. It reads the version through the
+// connections of s, see SchemaReporter, stores without a schema pass.
+func CheckSchema(ctx context.Context, s Store) error {
+	r, ok := s.(SchemaReporter)
+	if !ok {
+		return nil
+	}
+	st, err := r.SchemaStatus(ctx)
+	if errors.Is(err, ErrNoSchema) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return checkStatus(st)
+}
+
+func checkStatus(st MigrationStatus) error {
+	switch {
+	case st.Dirty:
+		return fmt.Errorf("%w: migration %d failed and left the schema dirty, fix it and run migrate force", ErrSchemaOutdated, st.Current)
+	case len(st.Pending) > 0:
+		return fmt.Errorf("%w: at version %d, %d migrations pending up to %d, run migrate up or set DB_AUTO_MIGRATE",
+			ErrSchemaOutdated, st.Current, len(st.Pending), st.Latest)
+	case st.Current > st.Latest:
+		slog.Warn("database schema is newer than this binary", "version", st.Current, "latest", st.Latest)
+	}
+	return nil
+}
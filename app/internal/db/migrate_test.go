@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+func TestMigratorSQLite(t *testing.T) {
+	cfg := config.DBConfig{
+		PrimaryDSN:   "sqlite://" + filepath.Join(t.TempDir(), "snippets.db"),
+		MaxOpenConns: 1,
+	}
+
+	reader, err := NewSQLiteStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if err := CheckSchema(context.Background(), reader); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("CheckSchema on empty DB = %v, want ErrSchemaOutdated", err)
+	}
+	// checking only reads, it doesn't create the version table
+	var tables int
+	if err := reader.db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name = 'schema_migrations'`).Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Fatal("CheckSchema created schema_migrations")
+	}
+
+	// a fresh database must not be served
+	if err := EnsureSchema(cfg); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("EnsureSchema on empty DB = %v, want ErrSchemaOutdated", err)
+	}
+
+	m, err := NewMigrator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	st, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Current != 0 || st.Latest == 0 || len(st.Pending) == 0 || st.Pending[len(st.Pending)-1] != st.Latest {
+		t.Fatalf("status before migrating = %+v", st)
+	}
+	latest := st.Latest
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	// applying again is a no-op
+	if err := m.Up(); err != nil {
+		t.Fatalf("second Up: %v", err)
+	}
+	st, err = m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Current != latest || st.Dirty || len(st.Pending) != 0 {
+		t.Fatalf("status after Up = %+v, want version %d", st, latest)
+	}
+	if err := EnsureSchema(cfg); err != nil {
+		t.Fatalf("EnsureSchema after Up: %v", err)
+	}
+	if err := CheckSchema(context.Background(), reader); err != nil {
+		t.Fatalf("CheckSchema after Up: %v", err)
+	}
+
+	store, err := NewSQLiteStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Primary().CreateSnippet(context.Background(), sqlc.CreateSnippetParams{
+		PublicID:         "abc-defg-hij",
+		EditToken:        "token",
+		ContentType:      "text/plain",
+		EncryptedContent: []byte("content"),
+	})
+	store.Close()
+	if err != nil {
+		t.Fatalf("CreateSnippet on migrated DB: %v", err)
+	}
+
+	if err := m.Down(0); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	st, err = m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Current != 0 || !slices.Contains(st.Pending, latest) {
+		t.Fatalf("status after Down = %+v, want version 0", st)
+	}
+
+	if err := m.Force(int(latest)); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	if st, _ := m.Status(); st.Current != latest || st.Dirty {
+		t.Fatalf("status after Force = %+v, want clean version %d", st, latest)
+	}
+}
+
+func TestEnsureSchemaAutoMigrate(t *testing.T) {
+	cfg := config.DBConfig{
+		PrimaryDSN:   "sqlite://" + filepath.Join(t.TempDir(), "snippets.db"),
+		MaxOpenConns: 1,
+		AutoMigrate:  true,
+	}
+	for range 2 {
+		if err := EnsureSchema(cfg); err != nil {
+			t.Fatalf("EnsureSchema: %v", err)
+		}
+	}
+}
+
+func TestEmbeddedPostgresMigrations(t *testing.T) {
+	ups, err := postgresMigrations.ReadDir("migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ups) == 0 || len(ups)%2 != 0 {
+		t.Fatalf("embedded %d migration files, want matching up and down pairs", len(ups))
+	}
+}
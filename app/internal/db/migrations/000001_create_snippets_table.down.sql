@@ -1,6 +1,6 @@
-DROPTRIGGERIFEXISTStrigger_set_snippet_public_id
+DROP TRIGGER IF EXISTS trigger_set_snippet_public_id
   ON snippets;
-DROPFUNCTIONIFEXISTSset_snippet_public_id();
-DROPFUNCTIONIFEXISTSgenerate_snippet_id();
-DROPTABLEIFEXISTSsnippet_contents;
-DROPTABLEIFEXISTSsnippets;
+DROP FUNCTION IF EXISTS set_snippet_public_id();
+DROP FUNCTION IF EXISTS generate_snippet_id();
+DROP TABLE IF EXISTS snippet_contents;
+DROP TABLE IF EXISTS snippets;
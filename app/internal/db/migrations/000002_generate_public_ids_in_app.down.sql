@@ -0,0 +1,65 @@
+-- Fails if IDs longer than 12 characters have been generated since.
+ALTER TABLE snippets ALTER COLUMN public_id TYPE VARCHAR(12);
+
+-- Function to generate a Google Meet-style ID (abc-defg-hij)
+CREATE OR REPLACE FUNCTION generate_snippet_id() 
+RETURNS VARCHAR AS $$
+DECLARE
+    chars TEXT := 'abcdefghijkmnopqrstuvwxyz23456789';
+    result VARCHAR := '';
+    i INTEGER := 0;
+BEGIN
+    -- First segment (3 chars)
+    FOR i IN 1..3 LOOP
+        result := result || substr(chars, floor(random() * length(chars))::integer + 1, 1);
+    END LOOP;
+    
+    result := result || '-';
+    
+    -- Second segment (4 chars)
+    FOR i IN 1..4 LOOP
+        result := result || substr(chars, floor(random() * length(chars))::integer + 1, 1);
+    END LOOP;
+    
+    result := result || '-';
+    
+    -- Third segment (3 chars)
+    FOR i IN 1..3 LOOP
+        result := result || substr(chars, floor(random() * length(chars))::integer + 1, 1);
+    END LOOP;
+    
+    RETURN result;
+END;
+$$ LANGUAGE plpgsql;
+
+
+-- Trigger to generate a unique public_id for new snippets
+CREATE OR REPLACE FUNCTION set_snippet_public_id()
+RETURNS TRIGGER AS $$
+DECLARE
+    new_id VARCHAR;
+    id_exists BOOLEAN;
+BEGIN
+    -- Generate IDs until we find one that doesn't exist
+    LOOP
+        new_id := generate_snippet_id();
+        
+        -- Check if this ID already exists
+        SELECT EXISTS(SELECT 1 FROM snippets WHERE public_id = new_id) INTO id_exists;
+        
+        -- If the ID doesn't exist, use it
+        IF NOT id_exists THEN
+            NEW.public_id := new_id;
+            EXIT;
+        END IF;
+    END LOOP;
+    
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_set_snippet_public_id
+BEFORE INSERT ON snippets
+FOR EACH ROW
+WHEN (NEW.public_id IS NULL)
+EXECUTE FUNCTION set_snippet_public_id();
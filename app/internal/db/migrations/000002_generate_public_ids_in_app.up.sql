@@ -0,0 +1,9 @@
+-- Public IDs are generated by the application with crypto/rand and a
+-- configurable layout, a collision is retried on the unique violation.
+DROP TRIGGER IF EXISTS trigger_set_snippet_public_id
+  ON snippets;
+DROP FUNCTION IF EXISTS set_snippet_public_id();
+DROP FUNCTION IF EXISTS generate_snippet_id();
+
+-- Room for longer ID layouts
+ALTER TABLE snippets ALTER COLUMN public_id TYPE VARCHAR(64);
@@ -0,0 +1,3 @@
+-- Optional vanity slug, resolved like the public ID. Both share one
+-- namespace, the application rejects slugs that look like a public ID.
+ALTER TABLE snippets ADD COLUMN slug VARCHAR(64) UNIQUE;
@@ -0,0 +1,6 @@
+-- Tombstoned snippets would become visible again, purge them first.
+DELETE FROM snippets WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_snippets_deleted_at;
+
+ALTER TABLE snippets DROP COLUMN IF EXISTS deleted_at;
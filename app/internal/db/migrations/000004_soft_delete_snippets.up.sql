@@ -0,0 +1,7 @@
+-- Deleted snippets are kept as tombstones for a restore window and purged
+-- afterwards, see db.Purger.
+ALTER TABLE snippets ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Index for the purge job
+CREATE INDEX idx_snippets_deleted_at ON snippets(deleted_at)
+WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Snippets stored in the blob store can't be read without their key.
+DELETE FROM snippets
+WHERE id IN (SELECT snippet_id FROM snippet_contents WHERE blob_key IS NOT NULL);
+
+ALTER TABLE snippet_contents DROP COLUMN blob_key;
@@ -0,0 +1,3 @@
+-- Content above the blob threshold lives in a blob store, the row only keeps
+-- its key and an empty encrypted_content. See db.WithBlobStorage.
+ALTER TABLE snippet_contents ADD COLUMN blob_key VARCHAR(128);
@@ -0,0 +1,10 @@
+-- Deduplicated snippets can't be read without their body.
+DELETE FROM snippets
+WHERE id IN (SELECT snippet_id FROM snippet_contents WHERE body_id IS NOT NULL);
+
+DROP TRIGGER IF EXISTS snippet_contents_body_refs ON snippet_contents;
+DROP FUNCTION IF EXISTS count_snippet_body_refs();
+
+ALTER TABLE snippet_contents DROP COLUMN body_id;
+
+DROP TABLE IF EXISTS snippet_bodies;
@@ -0,0 +1,46 @@
+-- SNIPPET_BODIES TABLE: content shared by snippets with identical plaintext.
+-- content_hash is an HMAC of the plaintext under a server secret, so it
+-- doesn't reveal the content. ref_count is kept up to date by the trigger
+-- below, unreferenced bodies are removed by db.Purger after a grace period.
+CREATE TABLE snippet_bodies (
+    id SERIAL PRIMARY KEY,
+
+    content_hash BYTEA NOT NULL UNIQUE,
+
+    -- Same layout as snippet_contents, a body sits inline or in the blob store
+    encrypted_content BYTEA NOT NULL,
+    blob_key VARCHAR(128),
+
+    ref_count INTEGER NOT NULL DEFAULT 0 CHECK (ref_count >= 0),
+
+    -- Refreshed whenever a snippet is about to reference the body
+    last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Index for the purge job
+CREATE INDEX idx_snippet_bodies_unused ON snippet_bodies(last_used_at)
+WHERE ref_count = 0;
+
+-- Deduplicated snippets keep an empty encrypted_content and point to a body
+ALTER TABLE snippet_contents ADD COLUMN body_id INTEGER REFERENCES snippet_bodies(id);
+
+CREATE INDEX idx_snippet_contents_body_id ON snippet_contents(body_id);
+
+CREATE FUNCTION count_snippet_body_refs() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.body_id IS NOT DISTINCT FROM NEW.body_id THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.body_id IS NOT NULL THEN
+        UPDATE snippet_bodies SET ref_count = ref_count - 1 WHERE id = OLD.body_id;
+    END IF;
+    IF TG_OP IN ('UPDATE', 'INSERT') AND NEW.body_id IS NOT NULL THEN
+        UPDATE snippet_bodies SET ref_count = ref_count + 1 WHERE id = NEW.body_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER snippet_contents_body_refs
+AFTER INSERT OR DELETE OR UPDATE OF body_id ON snippet_contents
+FOR EACH ROW EXECUTE FUNCTION count_snippet_body_refs();
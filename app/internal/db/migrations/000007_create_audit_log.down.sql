@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS audit_head;
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS reject_audit_log_change();
@@ -0,0 +1,52 @@
+-- AUDIT_LOG TABLE: append-only record of snippet lifecycle events, admin
+-- actions and key rotations. Each entry commits to the previous one: hash is
+-- computed over the entry and prev_hash, so changing, removing or inserting
+-- an entry breaks the chain from that point on, see the audit package.
+CREATE TABLE audit_log (
+    -- Assigned by the application from audit_head, one more than the
+    -- previous entry, so a missing entry shows as a gap.
+    seq BIGINT PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    event VARCHAR(64) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    -- The public ID of the snippet the event is about, if any. Not a foreign
+    -- key, entries outlive their snippets.
+    snippet VARCHAR(64),
+    client_ip VARCHAR(64),
+    user_agent TEXT,
+    request_id VARCHAR(128),
+    -- Event specific details, as JSON
+    details TEXT,
+
+    prev_hash BYTEA NOT NULL,
+    hash BYTEA NOT NULL
+);
+
+-- Index for looking up the history of a snippet
+CREATE INDEX idx_audit_log_snippet ON audit_log(snippet) WHERE snippet IS NOT NULL;
+
+-- AUDIT_HEAD TABLE: the single row pointing at the last entry. Appends
+-- lock it rather than the log, and the log is checked against it: entries
+-- removed from the end leave the head past the last entry.
+CREATE TABLE audit_head (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    seq BIGINT NOT NULL,
+    hash BYTEA NOT NULL
+);
+
+INSERT INTO audit_head (seq, hash) VALUES (0, '');
+
+CREATE FUNCTION reject_audit_log_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION reject_audit_log_change();
+
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT EXECUTE FUNCTION reject_audit_log_change();
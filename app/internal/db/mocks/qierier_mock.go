@@ -6,6 +6,8 @@ package mocks
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	mock "github.com/stretchr/testify/mock"
 	"snippets.adelh.dev/app/internal/db/sqlc"
@@ -38,242 +40,1183 @@ func (_m *MockQuerier) EXPECT() *MockQuerier_Expecter {
 	return &MockQuerier_Expecter{mock: &_m.Mock}
 }
 
+// CreateAuditEntry provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) CreateAuditEntry(ctx context.Context, arg sqlc.CreateAuditEntryParams) error {
+	ret := _mock.Called(ctx, arg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateAuditEntry")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.CreateAuditEntryParams) error); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockQuerier_CreateAuditEntry_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateAuditEntry'
+type MockQuerier_CreateAuditEntry_Call struct {
+	*mock.Call
+}
+
+// CreateAuditEntry is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) CreateAuditEntry(ctx interface{}, arg interface{}) *MockQuerier_CreateAuditEntry_Call {
+	return &MockQuerier_CreateAuditEntry_Call{Call: _e.mock.On("CreateAuditEntry", ctx, arg)}
+}
+
+func (_c *MockQuerier_CreateAuditEntry_Call) Run(run func(ctx context.Context, arg sqlc.CreateAuditEntryParams)) *MockQuerier_CreateAuditEntry_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.CreateAuditEntryParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_CreateAuditEntry_Call) Return(err error) *MockQuerier_CreateAuditEntry_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockQuerier_CreateAuditEntry_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.CreateAuditEntryParams) error) *MockQuerier_CreateAuditEntry_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // CreateSnippet provides a mock function for the type MockQuerier
 func (_mock *MockQuerier) CreateSnippet(ctx context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
 	ret := _mock.Called(ctx, arg)
 
 	if len(ret) == 0 {
-		panic("no return value specified for CreateSnippet")
+		panic("no return value specified for CreateSnippet")
+	}
+
+	var r0 sqlc.CreateSnippetRow
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error)); ok {
+		return returnFunc(ctx, arg)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.CreateSnippetParams) sqlc.CreateSnippetRow); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(sqlc.CreateSnippetRow)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.CreateSnippetParams) error); ok {
+		r1 = returnFunc(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_CreateSnippet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateSnippet'
+type MockQuerier_CreateSnippet_Call struct {
+	*mock.Call
+}
+
+// CreateSnippet is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) CreateSnippet(ctx interface{}, arg interface{}) *MockQuerier_CreateSnippet_Call {
+	return &MockQuerier_CreateSnippet_Call{Call: _e.mock.On("CreateSnippet", ctx, arg)}
+}
+
+func (_c *MockQuerier_CreateSnippet_Call) Run(run func(ctx context.Context, arg sqlc.CreateSnippetParams)) *MockQuerier_CreateSnippet_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.CreateSnippetParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_CreateSnippet_Call) Return(createSnippetRow sqlc.CreateSnippetRow, err error) *MockQuerier_CreateSnippet_Call {
+	_c.Call.Return(createSnippetRow, err)
+	return _c
+}
+
+func (_c *MockQuerier_CreateSnippet_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error)) *MockQuerier_CreateSnippet_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CreateSnippetBody provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) CreateSnippetBody(ctx context.Context, arg sqlc.CreateSnippetBodyParams) (sqlc.CreateSnippetBodyRow, error) {
+	ret := _mock.Called(ctx, arg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateSnippetBody")
+	}
+
+	var r0 sqlc.CreateSnippetBodyRow
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.CreateSnippetBodyParams) (sqlc.CreateSnippetBodyRow, error)); ok {
+		return returnFunc(ctx, arg)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.CreateSnippetBodyParams) sqlc.CreateSnippetBodyRow); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(sqlc.CreateSnippetBodyRow)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.CreateSnippetBodyParams) error); ok {
+		r1 = returnFunc(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_CreateSnippetBody_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateSnippetBody'
+type MockQuerier_CreateSnippetBody_Call struct {
+	*mock.Call
+}
+
+// CreateSnippetBody is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) CreateSnippetBody(ctx interface{}, arg interface{}) *MockQuerier_CreateSnippetBody_Call {
+	return &MockQuerier_CreateSnippetBody_Call{Call: _e.mock.On("CreateSnippetBody", ctx, arg)}
+}
+
+func (_c *MockQuerier_CreateSnippetBody_Call) Run(run func(ctx context.Context, arg sqlc.CreateSnippetBodyParams)) *MockQuerier_CreateSnippetBody_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.CreateSnippetBodyParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_CreateSnippetBody_Call) Return(createSnippetBodyRow sqlc.CreateSnippetBodyRow, err error) *MockQuerier_CreateSnippetBody_Call {
+	_c.Call.Return(createSnippetBodyRow, err)
+	return _c
+}
+
+func (_c *MockQuerier_CreateSnippetBody_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.CreateSnippetBodyParams) (sqlc.CreateSnippetBodyRow, error)) *MockQuerier_CreateSnippetBody_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// DeleteExpiredSnippets provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) DeleteExpiredSnippets(ctx context.Context) ([]sql.NullString, error) {
+	ret := _mock.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteExpiredSnippets")
+	}
+
+	var r0 []sql.NullString
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context) ([]sql.NullString, error)); ok {
+		return returnFunc(ctx)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context) []sql.NullString); ok {
+		r0 = returnFunc(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]sql.NullString)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = returnFunc(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_DeleteExpiredSnippets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteExpiredSnippets'
+type MockQuerier_DeleteExpiredSnippets_Call struct {
+	*mock.Call
+}
+
+// DeleteExpiredSnippets is a helper method to define mock.On call
+//   - ctx
+func (_e *MockQuerier_Expecter) DeleteExpiredSnippets(ctx interface{}) *MockQuerier_DeleteExpiredSnippets_Call {
+	return &MockQuerier_DeleteExpiredSnippets_Call{Call: _e.mock.On("DeleteExpiredSnippets", ctx)}
+}
+
+func (_c *MockQuerier_DeleteExpiredSnippets_Call) Run(run func(ctx context.Context)) *MockQuerier_DeleteExpiredSnippets_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_DeleteExpiredSnippets_Call) Return(nullStrings []sql.NullString, err error) *MockQuerier_DeleteExpiredSnippets_Call {
+	_c.Call.Return(nullStrings, err)
+	return _c
+}
+
+func (_c *MockQuerier_DeleteExpiredSnippets_Call) RunAndReturn(run func(ctx context.Context) ([]sql.NullString, error)) *MockQuerier_DeleteExpiredSnippets_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// DeleteSnippetById provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) DeleteSnippetById(ctx context.Context, id int32) ([]sql.NullString, error) {
+	ret := _mock.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteSnippetById")
+	}
+
+	var r0 []sql.NullString
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) ([]sql.NullString, error)); ok {
+		return returnFunc(ctx, id)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) []sql.NullString); ok {
+		r0 = returnFunc(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]sql.NullString)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, int32) error); ok {
+		r1 = returnFunc(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_DeleteSnippetById_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteSnippetById'
+type MockQuerier_DeleteSnippetById_Call struct {
+	*mock.Call
+}
+
+// DeleteSnippetById is a helper method to define mock.On call
+//   - ctx
+//   - id
+func (_e *MockQuerier_Expecter) DeleteSnippetById(ctx interface{}, id interface{}) *MockQuerier_DeleteSnippetById_Call {
+	return &MockQuerier_DeleteSnippetById_Call{Call: _e.mock.On("DeleteSnippetById", ctx, id)}
+}
+
+func (_c *MockQuerier_DeleteSnippetById_Call) Run(run func(ctx context.Context, id int32)) *MockQuerier_DeleteSnippetById_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(int32))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_DeleteSnippetById_Call) Return(nullStrings []sql.NullString, err error) *MockQuerier_DeleteSnippetById_Call {
+	_c.Call.Return(nullStrings, err)
+	return _c
+}
+
+func (_c *MockQuerier_DeleteSnippetById_Call) RunAndReturn(run func(ctx context.Context, id int32) ([]sql.NullString, error)) *MockQuerier_DeleteSnippetById_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ExpireSnippet provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) ExpireSnippet(ctx context.Context, id int32) (int64, error) {
+	ret := _mock.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ExpireSnippet")
+	}
+
+	var r0 int64
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) (int64, error)); ok {
+		return returnFunc(ctx, id)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) int64); ok {
+		r0 = returnFunc(ctx, id)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, int32) error); ok {
+		r1 = returnFunc(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_ExpireSnippet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ExpireSnippet'
+type MockQuerier_ExpireSnippet_Call struct {
+	*mock.Call
+}
+
+// ExpireSnippet is a helper method to define mock.On call
+//   - ctx
+//   - id
+func (_e *MockQuerier_Expecter) ExpireSnippet(ctx interface{}, id interface{}) *MockQuerier_ExpireSnippet_Call {
+	return &MockQuerier_ExpireSnippet_Call{Call: _e.mock.On("ExpireSnippet", ctx, id)}
+}
+
+func (_c *MockQuerier_ExpireSnippet_Call) Run(run func(ctx context.Context, id int32)) *MockQuerier_ExpireSnippet_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(int32))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_ExpireSnippet_Call) Return(n int64, err error) *MockQuerier_ExpireSnippet_Call {
+	_c.Call.Return(n, err)
+	return _c
+}
+
+func (_c *MockQuerier_ExpireSnippet_Call) RunAndReturn(run func(ctx context.Context, id int32) (int64, error)) *MockQuerier_ExpireSnippet_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetAuditHead provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) GetAuditHead(ctx context.Context) (sqlc.GetAuditHeadRow, error) {
+	ret := _mock.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetAuditHead")
+	}
+
+	var r0 sqlc.GetAuditHeadRow
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context) (sqlc.GetAuditHeadRow, error)); ok {
+		return returnFunc(ctx)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context) sqlc.GetAuditHeadRow); ok {
+		r0 = returnFunc(ctx)
+	} else {
+		r0 = ret.Get(0).(sqlc.GetAuditHeadRow)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = returnFunc(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_GetAuditHead_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetAuditHead'
+type MockQuerier_GetAuditHead_Call struct {
+	*mock.Call
+}
+
+// GetAuditHead is a helper method to define mock.On call
+//   - ctx
+func (_e *MockQuerier_Expecter) GetAuditHead(ctx interface{}) *MockQuerier_GetAuditHead_Call {
+	return &MockQuerier_GetAuditHead_Call{Call: _e.mock.On("GetAuditHead", ctx)}
+}
+
+func (_c *MockQuerier_GetAuditHead_Call) Run(run func(ctx context.Context)) *MockQuerier_GetAuditHead_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_GetAuditHead_Call) Return(getAuditHeadRow sqlc.GetAuditHeadRow, err error) *MockQuerier_GetAuditHead_Call {
+	_c.Call.Return(getAuditHeadRow, err)
+	return _c
+}
+
+func (_c *MockQuerier_GetAuditHead_Call) RunAndReturn(run func(ctx context.Context) (sqlc.GetAuditHeadRow, error)) *MockQuerier_GetAuditHead_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetSnippetBlobKey provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) GetSnippetBlobKey(ctx context.Context, snippetID int32) (sql.NullString, error) {
+	ret := _mock.Called(ctx, snippetID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSnippetBlobKey")
+	}
+
+	var r0 sql.NullString
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) (sql.NullString, error)); ok {
+		return returnFunc(ctx, snippetID)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) sql.NullString); ok {
+		r0 = returnFunc(ctx, snippetID)
+	} else {
+		r0 = ret.Get(0).(sql.NullString)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, int32) error); ok {
+		r1 = returnFunc(ctx, snippetID)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_GetSnippetBlobKey_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetSnippetBlobKey'
+type MockQuerier_GetSnippetBlobKey_Call struct {
+	*mock.Call
+}
+
+// GetSnippetBlobKey is a helper method to define mock.On call
+//   - ctx
+//   - snippetID
+func (_e *MockQuerier_Expecter) GetSnippetBlobKey(ctx interface{}, snippetID interface{}) *MockQuerier_GetSnippetBlobKey_Call {
+	return &MockQuerier_GetSnippetBlobKey_Call{Call: _e.mock.On("GetSnippetBlobKey", ctx, snippetID)}
+}
+
+func (_c *MockQuerier_GetSnippetBlobKey_Call) Run(run func(ctx context.Context, snippetID int32)) *MockQuerier_GetSnippetBlobKey_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(int32))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_GetSnippetBlobKey_Call) Return(nullString sql.NullString, err error) *MockQuerier_GetSnippetBlobKey_Call {
+	_c.Call.Return(nullString, err)
+	return _c
+}
+
+func (_c *MockQuerier_GetSnippetBlobKey_Call) RunAndReturn(run func(ctx context.Context, snippetID int32) (sql.NullString, error)) *MockQuerier_GetSnippetBlobKey_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetSnippetByPublicID provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) GetSnippetByPublicID(ctx context.Context, publicID string) (sqlc.GetSnippetByPublicIDRow, error) {
+	ret := _mock.Called(ctx, publicID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSnippetByPublicID")
+	}
+
+	var r0 sqlc.GetSnippetByPublicIDRow
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string) (sqlc.GetSnippetByPublicIDRow, error)); ok {
+		return returnFunc(ctx, publicID)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string) sqlc.GetSnippetByPublicIDRow); ok {
+		r0 = returnFunc(ctx, publicID)
+	} else {
+		r0 = ret.Get(0).(sqlc.GetSnippetByPublicIDRow)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = returnFunc(ctx, publicID)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_GetSnippetByPublicID_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetSnippetByPublicID'
+type MockQuerier_GetSnippetByPublicID_Call struct {
+	*mock.Call
+}
+
+// GetSnippetByPublicID is a helper method to define mock.On call
+//   - ctx
+//   - publicID
+func (_e *MockQuerier_Expecter) GetSnippetByPublicID(ctx interface{}, publicID interface{}) *MockQuerier_GetSnippetByPublicID_Call {
+	return &MockQuerier_GetSnippetByPublicID_Call{Call: _e.mock.On("GetSnippetByPublicID", ctx, publicID)}
+}
+
+func (_c *MockQuerier_GetSnippetByPublicID_Call) Run(run func(ctx context.Context, publicID string)) *MockQuerier_GetSnippetByPublicID_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_GetSnippetByPublicID_Call) Return(getSnippetByPublicIDRow sqlc.GetSnippetByPublicIDRow, err error) *MockQuerier_GetSnippetByPublicID_Call {
+	_c.Call.Return(getSnippetByPublicIDRow, err)
+	return _c
+}
+
+func (_c *MockQuerier_GetSnippetByPublicID_Call) RunAndReturn(run func(ctx context.Context, publicID string) (sqlc.GetSnippetByPublicIDRow, error)) *MockQuerier_GetSnippetByPublicID_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetSnippetStats provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) GetSnippetStats(ctx context.Context) (sqlc.GetSnippetStatsRow, error) {
+	ret := _mock.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSnippetStats")
+	}
+
+	var r0 sqlc.GetSnippetStatsRow
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context) (sqlc.GetSnippetStatsRow, error)); ok {
+		return returnFunc(ctx)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context) sqlc.GetSnippetStatsRow); ok {
+		r0 = returnFunc(ctx)
+	} else {
+		r0 = ret.Get(0).(sqlc.GetSnippetStatsRow)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = returnFunc(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_GetSnippetStats_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetSnippetStats'
+type MockQuerier_GetSnippetStats_Call struct {
+	*mock.Call
+}
+
+// GetSnippetStats is a helper method to define mock.On call
+//   - ctx
+func (_e *MockQuerier_Expecter) GetSnippetStats(ctx interface{}) *MockQuerier_GetSnippetStats_Call {
+	return &MockQuerier_GetSnippetStats_Call{Call: _e.mock.On("GetSnippetStats", ctx)}
+}
+
+func (_c *MockQuerier_GetSnippetStats_Call) Run(run func(ctx context.Context)) *MockQuerier_GetSnippetStats_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_GetSnippetStats_Call) Return(getSnippetStatsRow sqlc.GetSnippetStatsRow, err error) *MockQuerier_GetSnippetStats_Call {
+	_c.Call.Return(getSnippetStatsRow, err)
+	return _c
+}
+
+func (_c *MockQuerier_GetSnippetStats_Call) RunAndReturn(run func(ctx context.Context) (sqlc.GetSnippetStatsRow, error)) *MockQuerier_GetSnippetStats_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ImportSnippet provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) ImportSnippet(ctx context.Context, arg sqlc.ImportSnippetParams) (int32, error) {
+	ret := _mock.Called(ctx, arg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ImportSnippet")
+	}
+
+	var r0 int32
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.ImportSnippetParams) (int32, error)); ok {
+		return returnFunc(ctx, arg)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.ImportSnippetParams) int32); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(int32)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.ImportSnippetParams) error); ok {
+		r1 = returnFunc(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_ImportSnippet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ImportSnippet'
+type MockQuerier_ImportSnippet_Call struct {
+	*mock.Call
+}
+
+// ImportSnippet is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) ImportSnippet(ctx interface{}, arg interface{}) *MockQuerier_ImportSnippet_Call {
+	return &MockQuerier_ImportSnippet_Call{Call: _e.mock.On("ImportSnippet", ctx, arg)}
+}
+
+func (_c *MockQuerier_ImportSnippet_Call) Run(run func(ctx context.Context, arg sqlc.ImportSnippetParams)) *MockQuerier_ImportSnippet_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.ImportSnippetParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_ImportSnippet_Call) Return(n int32, err error) *MockQuerier_ImportSnippet_Call {
+	_c.Call.Return(n, err)
+	return _c
+}
+
+func (_c *MockQuerier_ImportSnippet_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.ImportSnippetParams) (int32, error)) *MockQuerier_ImportSnippet_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// IncrementSnippetViewCount provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) IncrementSnippetViewCount(ctx context.Context, id int32) (int32, error) {
+	ret := _mock.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IncrementSnippetViewCount")
+	}
+
+	var r0 int32
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) (int32, error)); ok {
+		return returnFunc(ctx, id)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) int32); ok {
+		r0 = returnFunc(ctx, id)
+	} else {
+		r0 = ret.Get(0).(int32)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, int32) error); ok {
+		r1 = returnFunc(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_IncrementSnippetViewCount_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'IncrementSnippetViewCount'
+type MockQuerier_IncrementSnippetViewCount_Call struct {
+	*mock.Call
+}
+
+// IncrementSnippetViewCount is a helper method to define mock.On call
+//   - ctx
+//   - id
+func (_e *MockQuerier_Expecter) IncrementSnippetViewCount(ctx interface{}, id interface{}) *MockQuerier_IncrementSnippetViewCount_Call {
+	return &MockQuerier_IncrementSnippetViewCount_Call{Call: _e.mock.On("IncrementSnippetViewCount", ctx, id)}
+}
+
+func (_c *MockQuerier_IncrementSnippetViewCount_Call) Run(run func(ctx context.Context, id int32)) *MockQuerier_IncrementSnippetViewCount_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(int32))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_IncrementSnippetViewCount_Call) Return(n int32, err error) *MockQuerier_IncrementSnippetViewCount_Call {
+	_c.Call.Return(n, err)
+	return _c
+}
+
+func (_c *MockQuerier_IncrementSnippetViewCount_Call) RunAndReturn(run func(ctx context.Context, id int32) (int32, error)) *MockQuerier_IncrementSnippetViewCount_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListAuditEntries provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) ListAuditEntries(ctx context.Context, arg sqlc.ListAuditEntriesParams) ([]sqlc.AuditLog, error) {
+	ret := _mock.Called(ctx, arg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListAuditEntries")
+	}
+
+	var r0 []sqlc.AuditLog
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.ListAuditEntriesParams) ([]sqlc.AuditLog, error)); ok {
+		return returnFunc(ctx, arg)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.ListAuditEntriesParams) []sqlc.AuditLog); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]sqlc.AuditLog)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.ListAuditEntriesParams) error); ok {
+		r1 = returnFunc(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_ListAuditEntries_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListAuditEntries'
+type MockQuerier_ListAuditEntries_Call struct {
+	*mock.Call
+}
+
+// ListAuditEntries is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) ListAuditEntries(ctx interface{}, arg interface{}) *MockQuerier_ListAuditEntries_Call {
+	return &MockQuerier_ListAuditEntries_Call{Call: _e.mock.On("ListAuditEntries", ctx, arg)}
+}
+
+func (_c *MockQuerier_ListAuditEntries_Call) Run(run func(ctx context.Context, arg sqlc.ListAuditEntriesParams)) *MockQuerier_ListAuditEntries_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.ListAuditEntriesParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_ListAuditEntries_Call) Return(auditLogs []sqlc.AuditLog, err error) *MockQuerier_ListAuditEntries_Call {
+	_c.Call.Return(auditLogs, err)
+	return _c
+}
+
+func (_c *MockQuerier_ListAuditEntries_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.ListAuditEntriesParams) ([]sqlc.AuditLog, error)) *MockQuerier_ListAuditEntries_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListRecentSnippets provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) ListRecentSnippets(ctx context.Context, limit int32) ([]sqlc.ListRecentSnippetsRow, error) {
+	ret := _mock.Called(ctx, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListRecentSnippets")
+	}
+
+	var r0 []sqlc.ListRecentSnippetsRow
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) ([]sqlc.ListRecentSnippetsRow, error)); ok {
+		return returnFunc(ctx, limit)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) []sqlc.ListRecentSnippetsRow); ok {
+		r0 = returnFunc(ctx, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]sqlc.ListRecentSnippetsRow)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, int32) error); ok {
+		r1 = returnFunc(ctx, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_ListRecentSnippets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListRecentSnippets'
+type MockQuerier_ListRecentSnippets_Call struct {
+	*mock.Call
+}
+
+// ListRecentSnippets is a helper method to define mock.On call
+//   - ctx
+//   - limit
+func (_e *MockQuerier_Expecter) ListRecentSnippets(ctx interface{}, limit interface{}) *MockQuerier_ListRecentSnippets_Call {
+	return &MockQuerier_ListRecentSnippets_Call{Call: _e.mock.On("ListRecentSnippets", ctx, limit)}
+}
+
+func (_c *MockQuerier_ListRecentSnippets_Call) Run(run func(ctx context.Context, limit int32)) *MockQuerier_ListRecentSnippets_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(int32))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_ListRecentSnippets_Call) Return(listRecentSnippetsRows []sqlc.ListRecentSnippetsRow, err error) *MockQuerier_ListRecentSnippets_Call {
+	_c.Call.Return(listRecentSnippetsRows, err)
+	return _c
+}
+
+func (_c *MockQuerier_ListRecentSnippets_Call) RunAndReturn(run func(ctx context.Context, limit int32) ([]sqlc.ListRecentSnippetsRow, error)) *MockQuerier_ListRecentSnippets_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListSnippetBodies provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) ListSnippetBodies(ctx context.Context, arg sqlc.ListSnippetBodiesParams) ([]sqlc.ListSnippetBodiesRow, error) {
+	ret := _mock.Called(ctx, arg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListSnippetBodies")
+	}
+
+	var r0 []sqlc.ListSnippetBodiesRow
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.ListSnippetBodiesParams) ([]sqlc.ListSnippetBodiesRow, error)); ok {
+		return returnFunc(ctx, arg)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.ListSnippetBodiesParams) []sqlc.ListSnippetBodiesRow); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]sqlc.ListSnippetBodiesRow)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.ListSnippetBodiesParams) error); ok {
+		r1 = returnFunc(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_ListSnippetBodies_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListSnippetBodies'
+type MockQuerier_ListSnippetBodies_Call struct {
+	*mock.Call
+}
+
+// ListSnippetBodies is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) ListSnippetBodies(ctx interface{}, arg interface{}) *MockQuerier_ListSnippetBodies_Call {
+	return &MockQuerier_ListSnippetBodies_Call{Call: _e.mock.On("ListSnippetBodies", ctx, arg)}
+}
+
+func (_c *MockQuerier_ListSnippetBodies_Call) Run(run func(ctx context.Context, arg sqlc.ListSnippetBodiesParams)) *MockQuerier_ListSnippetBodies_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.ListSnippetBodiesParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_ListSnippetBodies_Call) Return(listSnippetBodiesRows []sqlc.ListSnippetBodiesRow, err error) *MockQuerier_ListSnippetBodies_Call {
+	_c.Call.Return(listSnippetBodiesRows, err)
+	return _c
+}
+
+func (_c *MockQuerier_ListSnippetBodies_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.ListSnippetBodiesParams) ([]sqlc.ListSnippetBodiesRow, error)) *MockQuerier_ListSnippetBodies_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListSnippets provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) ListSnippets(ctx context.Context, arg sqlc.ListSnippetsParams) ([]sqlc.ListSnippetsRow, error) {
+	ret := _mock.Called(ctx, arg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListSnippets")
+	}
+
+	var r0 []sqlc.ListSnippetsRow
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.ListSnippetsParams) ([]sqlc.ListSnippetsRow, error)); ok {
+		return returnFunc(ctx, arg)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.ListSnippetsParams) []sqlc.ListSnippetsRow); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]sqlc.ListSnippetsRow)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.ListSnippetsParams) error); ok {
+		r1 = returnFunc(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_ListSnippets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListSnippets'
+type MockQuerier_ListSnippets_Call struct {
+	*mock.Call
+}
+
+// ListSnippets is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) ListSnippets(ctx interface{}, arg interface{}) *MockQuerier_ListSnippets_Call {
+	return &MockQuerier_ListSnippets_Call{Call: _e.mock.On("ListSnippets", ctx, arg)}
+}
+
+func (_c *MockQuerier_ListSnippets_Call) Run(run func(ctx context.Context, arg sqlc.ListSnippetsParams)) *MockQuerier_ListSnippets_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.ListSnippetsParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_ListSnippets_Call) Return(listSnippetsRows []sqlc.ListSnippetsRow, err error) *MockQuerier_ListSnippets_Call {
+	_c.Call.Return(listSnippetsRows, err)
+	return _c
+}
+
+func (_c *MockQuerier_ListSnippets_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.ListSnippetsParams) ([]sqlc.ListSnippetsRow, error)) *MockQuerier_ListSnippets_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// LockAuditHead provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) LockAuditHead(ctx context.Context) (sqlc.LockAuditHeadRow, error) {
+	ret := _mock.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LockAuditHead")
+	}
+
+	var r0 sqlc.LockAuditHeadRow
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context) (sqlc.LockAuditHeadRow, error)); ok {
+		return returnFunc(ctx)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context) sqlc.LockAuditHeadRow); ok {
+		r0 = returnFunc(ctx)
+	} else {
+		r0 = ret.Get(0).(sqlc.LockAuditHeadRow)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = returnFunc(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_LockAuditHead_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'LockAuditHead'
+type MockQuerier_LockAuditHead_Call struct {
+	*mock.Call
+}
+
+// LockAuditHead is a helper method to define mock.On call
+//   - ctx
+func (_e *MockQuerier_Expecter) LockAuditHead(ctx interface{}) *MockQuerier_LockAuditHead_Call {
+	return &MockQuerier_LockAuditHead_Call{Call: _e.mock.On("LockAuditHead", ctx)}
+}
+
+func (_c *MockQuerier_LockAuditHead_Call) Run(run func(ctx context.Context)) *MockQuerier_LockAuditHead_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_LockAuditHead_Call) Return(lockAuditHeadRow sqlc.LockAuditHeadRow, err error) *MockQuerier_LockAuditHead_Call {
+	_c.Call.Return(lockAuditHeadRow, err)
+	return _c
+}
+
+func (_c *MockQuerier_LockAuditHead_Call) RunAndReturn(run func(ctx context.Context) (sqlc.LockAuditHeadRow, error)) *MockQuerier_LockAuditHead_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// PurgeDeletedSnippets provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) PurgeDeletedSnippets(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error) {
+	ret := _mock.Called(ctx, deletedBefore)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PurgeDeletedSnippets")
 	}
 
-	var r0 sqlc.CreateSnippetRow
+	var r0 []sql.NullString
 	var r1 error
-	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error)); ok {
-		return returnFunc(ctx, arg)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sql.NullTime) ([]sql.NullString, error)); ok {
+		return returnFunc(ctx, deletedBefore)
 	}
-	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.CreateSnippetParams) sqlc.CreateSnippetRow); ok {
-		r0 = returnFunc(ctx, arg)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sql.NullTime) []sql.NullString); ok {
+		r0 = returnFunc(ctx, deletedBefore)
 	} else {
-		r0 = ret.Get(0).(sqlc.CreateSnippetRow)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]sql.NullString)
+		}
 	}
-	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.CreateSnippetParams) error); ok {
-		r1 = returnFunc(ctx, arg)
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sql.NullTime) error); ok {
+		r1 = returnFunc(ctx, deletedBefore)
 	} else {
 		r1 = ret.Error(1)
 	}
 	return r0, r1
 }
 
-// MockQuerier_CreateSnippet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateSnippet'
-type MockQuerier_CreateSnippet_Call struct {
+// MockQuerier_PurgeDeletedSnippets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PurgeDeletedSnippets'
+type MockQuerier_PurgeDeletedSnippets_Call struct {
 	*mock.Call
 }
 
-// CreateSnippet is a helper method to define mock.On call
+// PurgeDeletedSnippets is a helper method to define mock.On call
 //   - ctx
-//   - arg
-func (_e *MockQuerier_Expecter) CreateSnippet(ctx interface{}, arg interface{}) *MockQuerier_CreateSnippet_Call {
-	return &MockQuerier_CreateSnippet_Call{Call: _e.mock.On("CreateSnippet", ctx, arg)}
+//   - deletedBefore
+func (_e *MockQuerier_Expecter) PurgeDeletedSnippets(ctx interface{}, deletedBefore interface{}) *MockQuerier_PurgeDeletedSnippets_Call {
+	return &MockQuerier_PurgeDeletedSnippets_Call{Call: _e.mock.On("PurgeDeletedSnippets", ctx, deletedBefore)}
 }
 
-func (_c *MockQuerier_CreateSnippet_Call) Run(run func(ctx context.Context, arg sqlc.CreateSnippetParams)) *MockQuerier_CreateSnippet_Call {
+func (_c *MockQuerier_PurgeDeletedSnippets_Call) Run(run func(ctx context.Context, deletedBefore sql.NullTime)) *MockQuerier_PurgeDeletedSnippets_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(sqlc.CreateSnippetParams))
+		run(args[0].(context.Context), args[1].(sql.NullTime))
 	})
 	return _c
 }
 
-func (_c *MockQuerier_CreateSnippet_Call) Return(createSnippetRow sqlc.CreateSnippetRow, err error) *MockQuerier_CreateSnippet_Call {
-	_c.Call.Return(createSnippetRow, err)
+func (_c *MockQuerier_PurgeDeletedSnippets_Call) Return(nullStrings []sql.NullString, err error) *MockQuerier_PurgeDeletedSnippets_Call {
+	_c.Call.Return(nullStrings, err)
 	return _c
 }
 
-func (_c *MockQuerier_CreateSnippet_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error)) *MockQuerier_CreateSnippet_Call {
+func (_c *MockQuerier_PurgeDeletedSnippets_Call) RunAndReturn(run func(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error)) *MockQuerier_PurgeDeletedSnippets_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// DeleteExpiredSnippets provides a mock function for the type MockQuerier
-func (_mock *MockQuerier) DeleteExpiredSnippets(ctx context.Context) (int64, error) {
-	ret := _mock.Called(ctx)
+// PurgeUnusedSnippetBodies provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) PurgeUnusedSnippetBodies(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error) {
+	ret := _mock.Called(ctx, usedBefore)
 
 	if len(ret) == 0 {
-		panic("no return value specified for DeleteExpiredSnippets")
+		panic("no return value specified for PurgeUnusedSnippetBodies")
 	}
 
-	var r0 int64
+	var r0 []sql.NullString
 	var r1 error
-	if returnFunc, ok := ret.Get(0).(func(context.Context) (int64, error)); ok {
-		return returnFunc(ctx)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, time.Time) ([]sql.NullString, error)); ok {
+		return returnFunc(ctx, usedBefore)
 	}
-	if returnFunc, ok := ret.Get(0).(func(context.Context) int64); ok {
-		r0 = returnFunc(ctx)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, time.Time) []sql.NullString); ok {
+		r0 = returnFunc(ctx, usedBefore)
 	} else {
-		r0 = ret.Get(0).(int64)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]sql.NullString)
+		}
 	}
-	if returnFunc, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = returnFunc(ctx)
+	if returnFunc, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = returnFunc(ctx, usedBefore)
 	} else {
 		r1 = ret.Error(1)
 	}
 	return r0, r1
 }
 
-// MockQuerier_DeleteExpiredSnippets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteExpiredSnippets'
-type MockQuerier_DeleteExpiredSnippets_Call struct {
+// MockQuerier_PurgeUnusedSnippetBodies_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PurgeUnusedSnippetBodies'
+type MockQuerier_PurgeUnusedSnippetBodies_Call struct {
 	*mock.Call
 }
 
-// DeleteExpiredSnippets is a helper method to define mock.On call
+// PurgeUnusedSnippetBodies is a helper method to define mock.On call
 //   - ctx
-func (_e *MockQuerier_Expecter) DeleteExpiredSnippets(ctx interface{}) *MockQuerier_DeleteExpiredSnippets_Call {
-	return &MockQuerier_DeleteExpiredSnippets_Call{Call: _e.mock.On("DeleteExpiredSnippets", ctx)}
+//   - usedBefore
+func (_e *MockQuerier_Expecter) PurgeUnusedSnippetBodies(ctx interface{}, usedBefore interface{}) *MockQuerier_PurgeUnusedSnippetBodies_Call {
+	return &MockQuerier_PurgeUnusedSnippetBodies_Call{Call: _e.mock.On("PurgeUnusedSnippetBodies", ctx, usedBefore)}
 }
 
-func (_c *MockQuerier_DeleteExpiredSnippets_Call) Run(run func(ctx context.Context)) *MockQuerier_DeleteExpiredSnippets_Call {
+func (_c *MockQuerier_PurgeUnusedSnippetBodies_Call) Run(run func(ctx context.Context, usedBefore time.Time)) *MockQuerier_PurgeUnusedSnippetBodies_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context))
+		run(args[0].(context.Context), args[1].(time.Time))
 	})
 	return _c
 }
 
-func (_c *MockQuerier_DeleteExpiredSnippets_Call) Return(n int64, err error) *MockQuerier_DeleteExpiredSnippets_Call {
-	_c.Call.Return(n, err)
+func (_c *MockQuerier_PurgeUnusedSnippetBodies_Call) Return(nullStrings []sql.NullString, err error) *MockQuerier_PurgeUnusedSnippetBodies_Call {
+	_c.Call.Return(nullStrings, err)
 	return _c
 }
 
-func (_c *MockQuerier_DeleteExpiredSnippets_Call) RunAndReturn(run func(ctx context.Context) (int64, error)) *MockQuerier_DeleteExpiredSnippets_Call {
+func (_c *MockQuerier_PurgeUnusedSnippetBodies_Call) RunAndReturn(run func(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error)) *MockQuerier_PurgeUnusedSnippetBodies_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// DeleteSnippetById provides a mock function for the type MockQuerier
-func (_mock *MockQuerier) DeleteSnippetById(ctx context.Context, id int32) (int64, error) {
-	ret := _mock.Called(ctx, id)
+// RestoreSnippet provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) RestoreSnippet(ctx context.Context, arg sqlc.RestoreSnippetParams) (int64, error) {
+	ret := _mock.Called(ctx, arg)
 
 	if len(ret) == 0 {
-		panic("no return value specified for DeleteSnippetById")
+		panic("no return value specified for RestoreSnippet")
 	}
 
 	var r0 int64
 	var r1 error
-	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) (int64, error)); ok {
-		return returnFunc(ctx, id)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.RestoreSnippetParams) (int64, error)); ok {
+		return returnFunc(ctx, arg)
 	}
-	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) int64); ok {
-		r0 = returnFunc(ctx, id)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.RestoreSnippetParams) int64); ok {
+		r0 = returnFunc(ctx, arg)
 	} else {
 		r0 = ret.Get(0).(int64)
 	}
-	if returnFunc, ok := ret.Get(1).(func(context.Context, int32) error); ok {
-		r1 = returnFunc(ctx, id)
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.RestoreSnippetParams) error); ok {
+		r1 = returnFunc(ctx, arg)
 	} else {
 		r1 = ret.Error(1)
 	}
 	return r0, r1
 }
 
-// MockQuerier_DeleteSnippetById_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteSnippetById'
-type MockQuerier_DeleteSnippetById_Call struct {
+// MockQuerier_RestoreSnippet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RestoreSnippet'
+type MockQuerier_RestoreSnippet_Call struct {
 	*mock.Call
 }
 
-// DeleteSnippetById is a helper method to define mock.On call
+// RestoreSnippet is a helper method to define mock.On call
 //   - ctx
-//   - id
-func (_e *MockQuerier_Expecter) DeleteSnippetById(ctx interface{}, id interface{}) *MockQuerier_DeleteSnippetById_Call {
-	return &MockQuerier_DeleteSnippetById_Call{Call: _e.mock.On("DeleteSnippetById", ctx, id)}
+//   - arg
+func (_e *MockQuerier_Expecter) RestoreSnippet(ctx interface{}, arg interface{}) *MockQuerier_RestoreSnippet_Call {
+	return &MockQuerier_RestoreSnippet_Call{Call: _e.mock.On("RestoreSnippet", ctx, arg)}
 }
 
-func (_c *MockQuerier_DeleteSnippetById_Call) Run(run func(ctx context.Context, id int32)) *MockQuerier_DeleteSnippetById_Call {
+func (_c *MockQuerier_RestoreSnippet_Call) Run(run func(ctx context.Context, arg sqlc.RestoreSnippetParams)) *MockQuerier_RestoreSnippet_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(int32))
+		run(args[0].(context.Context), args[1].(sqlc.RestoreSnippetParams))
 	})
 	return _c
 }
 
-func (_c *MockQuerier_DeleteSnippetById_Call) Return(n int64, err error) *MockQuerier_DeleteSnippetById_Call {
+func (_c *MockQuerier_RestoreSnippet_Call) Return(n int64, err error) *MockQuerier_RestoreSnippet_Call {
 	_c.Call.Return(n, err)
 	return _c
 }
 
-func (_c *MockQuerier_DeleteSnippetById_Call) RunAndReturn(run func(ctx context.Context, id int32) (int64, error)) *MockQuerier_DeleteSnippetById_Call {
+func (_c *MockQuerier_RestoreSnippet_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.RestoreSnippetParams) (int64, error)) *MockQuerier_RestoreSnippet_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// GetSnippetByPublicID provides a mock function for the type MockQuerier
-func (_mock *MockQuerier) GetSnippetByPublicID(ctx context.Context, publicID string) (sqlc.GetSnippetByPublicIDRow, error) {
-	ret := _mock.Called(ctx, publicID)
+// SearchSnippets provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) SearchSnippets(ctx context.Context, arg sqlc.SearchSnippetsParams) ([]sqlc.SearchSnippetsRow, error) {
+	ret := _mock.Called(ctx, arg)
 
 	if len(ret) == 0 {
-		panic("no return value specified for GetSnippetByPublicID")
+		panic("no return value specified for SearchSnippets")
 	}
 
-	var r0 sqlc.GetSnippetByPublicIDRow
+	var r0 []sqlc.SearchSnippetsRow
 	var r1 error
-	if returnFunc, ok := ret.Get(0).(func(context.Context, string) (sqlc.GetSnippetByPublicIDRow, error)); ok {
-		return returnFunc(ctx, publicID)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.SearchSnippetsParams) ([]sqlc.SearchSnippetsRow, error)); ok {
+		return returnFunc(ctx, arg)
 	}
-	if returnFunc, ok := ret.Get(0).(func(context.Context, string) sqlc.GetSnippetByPublicIDRow); ok {
-		r0 = returnFunc(ctx, publicID)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.SearchSnippetsParams) []sqlc.SearchSnippetsRow); ok {
+		r0 = returnFunc(ctx, arg)
 	} else {
-		r0 = ret.Get(0).(sqlc.GetSnippetByPublicIDRow)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]sqlc.SearchSnippetsRow)
+		}
 	}
-	if returnFunc, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = returnFunc(ctx, publicID)
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.SearchSnippetsParams) error); ok {
+		r1 = returnFunc(ctx, arg)
 	} else {
 		r1 = ret.Error(1)
 	}
 	return r0, r1
 }
 
-// MockQuerier_GetSnippetByPublicID_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetSnippetByPublicID'
-type MockQuerier_GetSnippetByPublicID_Call struct {
+// MockQuerier_SearchSnippets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SearchSnippets'
+type MockQuerier_SearchSnippets_Call struct {
 	*mock.Call
 }
 
-// GetSnippetByPublicID is a helper method to define mock.On call
+// SearchSnippets is a helper method to define mock.On call
 //   - ctx
-//   - publicID
-func (_e *MockQuerier_Expecter) GetSnippetByPublicID(ctx interface{}, publicID interface{}) *MockQuerier_GetSnippetByPublicID_Call {
-	return &MockQuerier_GetSnippetByPublicID_Call{Call: _e.mock.On("GetSnippetByPublicID", ctx, publicID)}
+//   - arg
+func (_e *MockQuerier_Expecter) SearchSnippets(ctx interface{}, arg interface{}) *MockQuerier_SearchSnippets_Call {
+	return &MockQuerier_SearchSnippets_Call{Call: _e.mock.On("SearchSnippets", ctx, arg)}
 }
 
-func (_c *MockQuerier_GetSnippetByPublicID_Call) Run(run func(ctx context.Context, publicID string)) *MockQuerier_GetSnippetByPublicID_Call {
+func (_c *MockQuerier_SearchSnippets_Call) Run(run func(ctx context.Context, arg sqlc.SearchSnippetsParams)) *MockQuerier_SearchSnippets_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string))
+		run(args[0].(context.Context), args[1].(sqlc.SearchSnippetsParams))
 	})
 	return _c
 }
 
-func (_c *MockQuerier_GetSnippetByPublicID_Call) Return(getSnippetByPublicIDRow sqlc.GetSnippetByPublicIDRow, err error) *MockQuerier_GetSnippetByPublicID_Call {
-	_c.Call.Return(getSnippetByPublicIDRow, err)
+func (_c *MockQuerier_SearchSnippets_Call) Return(searchSnippetsRows []sqlc.SearchSnippetsRow, err error) *MockQuerier_SearchSnippets_Call {
+	_c.Call.Return(searchSnippetsRows, err)
 	return _c
 }
 
-func (_c *MockQuerier_GetSnippetByPublicID_Call) RunAndReturn(run func(ctx context.Context, publicID string) (sqlc.GetSnippetByPublicIDRow, error)) *MockQuerier_GetSnippetByPublicID_Call {
+func (_c *MockQuerier_SearchSnippets_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.SearchSnippetsParams) ([]sqlc.SearchSnippetsRow, error)) *MockQuerier_SearchSnippets_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// IncrementSnippetViewCount provides a mock function for the type MockQuerier
-func (_mock *MockQuerier) IncrementSnippetViewCount(ctx context.Context, id int32) (int32, error) {
+// SoftDeleteSnippet provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) SoftDeleteSnippet(ctx context.Context, id int32) (int64, error) {
 	ret := _mock.Called(ctx, id)
 
 	if len(ret) == 0 {
-		panic("no return value specified for IncrementSnippetViewCount")
+		panic("no return value specified for SoftDeleteSnippet")
 	}
 
-	var r0 int32
+	var r0 int64
 	var r1 error
-	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) (int32, error)); ok {
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) (int64, error)); ok {
 		return returnFunc(ctx, id)
 	}
-	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) int32); ok {
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) int64); ok {
 		r0 = returnFunc(ctx, id)
 	} else {
-		r0 = ret.Get(0).(int32)
+		r0 = ret.Get(0).(int64)
 	}
 	if returnFunc, ok := ret.Get(1).(func(context.Context, int32) error); ok {
 		r1 = returnFunc(ctx, id)
@@ -283,88 +1226,132 @@ func (_mock *MockQuerier) IncrementSnippetViewCount(ctx context.Context, id int3
 	return r0, r1
 }
 
-// MockQuerier_IncrementSnippetViewCount_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'IncrementSnippetViewCount'
-type MockQuerier_IncrementSnippetViewCount_Call struct {
+// MockQuerier_SoftDeleteSnippet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SoftDeleteSnippet'
+type MockQuerier_SoftDeleteSnippet_Call struct {
 	*mock.Call
 }
 
-// IncrementSnippetViewCount is a helper method to define mock.On call
+// SoftDeleteSnippet is a helper method to define mock.On call
 //   - ctx
 //   - id
-func (_e *MockQuerier_Expecter) IncrementSnippetViewCount(ctx interface{}, id interface{}) *MockQuerier_IncrementSnippetViewCount_Call {
-	return &MockQuerier_IncrementSnippetViewCount_Call{Call: _e.mock.On("IncrementSnippetViewCount", ctx, id)}
+func (_e *MockQuerier_Expecter) SoftDeleteSnippet(ctx interface{}, id interface{}) *MockQuerier_SoftDeleteSnippet_Call {
+	return &MockQuerier_SoftDeleteSnippet_Call{Call: _e.mock.On("SoftDeleteSnippet", ctx, id)}
 }
 
-func (_c *MockQuerier_IncrementSnippetViewCount_Call) Run(run func(ctx context.Context, id int32)) *MockQuerier_IncrementSnippetViewCount_Call {
+func (_c *MockQuerier_SoftDeleteSnippet_Call) Run(run func(ctx context.Context, id int32)) *MockQuerier_SoftDeleteSnippet_Call {
 	_c.Call.Run(func(args mock.Arguments) {
 		run(args[0].(context.Context), args[1].(int32))
 	})
 	return _c
 }
 
-func (_c *MockQuerier_IncrementSnippetViewCount_Call) Return(n int32, err error) *MockQuerier_IncrementSnippetViewCount_Call {
+func (_c *MockQuerier_SoftDeleteSnippet_Call) Return(n int64, err error) *MockQuerier_SoftDeleteSnippet_Call {
 	_c.Call.Return(n, err)
 	return _c
 }
 
-func (_c *MockQuerier_IncrementSnippetViewCount_Call) RunAndReturn(run func(ctx context.Context, id int32) (int32, error)) *MockQuerier_IncrementSnippetViewCount_Call {
+func (_c *MockQuerier_SoftDeleteSnippet_Call) RunAndReturn(run func(ctx context.Context, id int32) (int64, error)) *MockQuerier_SoftDeleteSnippet_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// ListRecentSnippets provides a mock function for the type MockQuerier
-func (_mock *MockQuerier) ListRecentSnippets(ctx context.Context, limit int32) ([]sqlc.ListRecentSnippetsRow, error) {
-	ret := _mock.Called(ctx, limit)
+// TouchSnippetBody provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) TouchSnippetBody(ctx context.Context, contentHash []byte) (int32, error) {
+	ret := _mock.Called(ctx, contentHash)
 
 	if len(ret) == 0 {
-		panic("no return value specified for ListRecentSnippets")
+		panic("no return value specified for TouchSnippetBody")
 	}
 
-	var r0 []sqlc.ListRecentSnippetsRow
+	var r0 int32
 	var r1 error
-	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) ([]sqlc.ListRecentSnippetsRow, error)); ok {
-		return returnFunc(ctx, limit)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, []byte) (int32, error)); ok {
+		return returnFunc(ctx, contentHash)
 	}
-	if returnFunc, ok := ret.Get(0).(func(context.Context, int32) []sqlc.ListRecentSnippetsRow); ok {
-		r0 = returnFunc(ctx, limit)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, []byte) int32); ok {
+		r0 = returnFunc(ctx, contentHash)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]sqlc.ListRecentSnippetsRow)
-		}
+		r0 = ret.Get(0).(int32)
 	}
-	if returnFunc, ok := ret.Get(1).(func(context.Context, int32) error); ok {
-		r1 = returnFunc(ctx, limit)
+	if returnFunc, ok := ret.Get(1).(func(context.Context, []byte) error); ok {
+		r1 = returnFunc(ctx, contentHash)
 	} else {
 		r1 = ret.Error(1)
 	}
 	return r0, r1
 }
 
-// MockQuerier_ListRecentSnippets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListRecentSnippets'
-type MockQuerier_ListRecentSnippets_Call struct {
+// MockQuerier_TouchSnippetBody_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'TouchSnippetBody'
+type MockQuerier_TouchSnippetBody_Call struct {
 	*mock.Call
 }
 
-// ListRecentSnippets is a helper method to define mock.On call
+// TouchSnippetBody is a helper method to define mock.On call
 //   - ctx
-//   - limit
-func (_e *MockQuerier_Expecter) ListRecentSnippets(ctx interface{}, limit interface{}) *MockQuerier_ListRecentSnippets_Call {
-	return &MockQuerier_ListRecentSnippets_Call{Call: _e.mock.On("ListRecentSnippets", ctx, limit)}
+//   - contentHash
+func (_e *MockQuerier_Expecter) TouchSnippetBody(ctx interface{}, contentHash interface{}) *MockQuerier_TouchSnippetBody_Call {
+	return &MockQuerier_TouchSnippetBody_Call{Call: _e.mock.On("TouchSnippetBody", ctx, contentHash)}
 }
 
-func (_c *MockQuerier_ListRecentSnippets_Call) Run(run func(ctx context.Context, limit int32)) *MockQuerier_ListRecentSnippets_Call {
+func (_c *MockQuerier_TouchSnippetBody_Call) Run(run func(ctx context.Context, contentHash []byte)) *MockQuerier_TouchSnippetBody_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(int32))
+		run(args[0].(context.Context), args[1].([]byte))
 	})
 	return _c
 }
 
-func (_c *MockQuerier_ListRecentSnippets_Call) Return(listRecentSnippetsRows []sqlc.ListRecentSnippetsRow, err error) *MockQuerier_ListRecentSnippets_Call {
-	_c.Call.Return(listRecentSnippetsRows, err)
+func (_c *MockQuerier_TouchSnippetBody_Call) Return(n int32, err error) *MockQuerier_TouchSnippetBody_Call {
+	_c.Call.Return(n, err)
 	return _c
 }
 
-func (_c *MockQuerier_ListRecentSnippets_Call) RunAndReturn(run func(ctx context.Context, limit int32) ([]sqlc.ListRecentSnippetsRow, error)) *MockQuerier_ListRecentSnippets_Call {
+func (_c *MockQuerier_TouchSnippetBody_Call) RunAndReturn(run func(ctx context.Context, contentHash []byte) (int32, error)) *MockQuerier_TouchSnippetBody_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateAuditHead provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) UpdateAuditHead(ctx context.Context, arg sqlc.UpdateAuditHeadParams) error {
+	ret := _mock.Called(ctx, arg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateAuditHead")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.UpdateAuditHeadParams) error); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockQuerier_UpdateAuditHead_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateAuditHead'
+type MockQuerier_UpdateAuditHead_Call struct {
+	*mock.Call
+}
+
+// UpdateAuditHead is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) UpdateAuditHead(ctx interface{}, arg interface{}) *MockQuerier_UpdateAuditHead_Call {
+	return &MockQuerier_UpdateAuditHead_Call{Call: _e.mock.On("UpdateAuditHead", ctx, arg)}
+}
+
+func (_c *MockQuerier_UpdateAuditHead_Call) Run(run func(ctx context.Context, arg sqlc.UpdateAuditHeadParams)) *MockQuerier_UpdateAuditHead_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.UpdateAuditHeadParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_UpdateAuditHead_Call) Return(err error) *MockQuerier_UpdateAuditHead_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockQuerier_UpdateAuditHead_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.UpdateAuditHeadParams) error) *MockQuerier_UpdateAuditHead_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -424,6 +1411,61 @@ func (_c *MockQuerier_UpdateSnippet_Call) RunAndReturn(run func(ctx context.Cont
 	return _c
 }
 
+// UpdateSnippetBody provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) UpdateSnippetBody(ctx context.Context, arg sqlc.UpdateSnippetBodyParams) (int64, error) {
+	ret := _mock.Called(ctx, arg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateSnippetBody")
+	}
+
+	var r0 int64
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.UpdateSnippetBodyParams) (int64, error)); ok {
+		return returnFunc(ctx, arg)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.UpdateSnippetBodyParams) int64); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, sqlc.UpdateSnippetBodyParams) error); ok {
+		r1 = returnFunc(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuerier_UpdateSnippetBody_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateSnippetBody'
+type MockQuerier_UpdateSnippetBody_Call struct {
+	*mock.Call
+}
+
+// UpdateSnippetBody is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) UpdateSnippetBody(ctx interface{}, arg interface{}) *MockQuerier_UpdateSnippetBody_Call {
+	return &MockQuerier_UpdateSnippetBody_Call{Call: _e.mock.On("UpdateSnippetBody", ctx, arg)}
+}
+
+func (_c *MockQuerier_UpdateSnippetBody_Call) Run(run func(ctx context.Context, arg sqlc.UpdateSnippetBodyParams)) *MockQuerier_UpdateSnippetBody_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.UpdateSnippetBodyParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_UpdateSnippetBody_Call) Return(n int64, err error) *MockQuerier_UpdateSnippetBody_Call {
+	_c.Call.Return(n, err)
+	return _c
+}
+
+func (_c *MockQuerier_UpdateSnippetBody_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.UpdateSnippetBodyParams) (int64, error)) *MockQuerier_UpdateSnippetBody_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // UpdateSnippetContent provides a mock function for the type MockQuerier
 func (_mock *MockQuerier) UpdateSnippetContent(ctx context.Context, arg sqlc.UpdateSnippetContentParams) error {
 	ret := _mock.Called(ctx, arg)
@@ -469,3 +1511,49 @@ func (_c *MockQuerier_UpdateSnippetContent_Call) RunAndReturn(run func(ctx conte
 	_c.Call.Return(run)
 	return _c
 }
+
+// UpdateSnippetSlug provides a mock function for the type MockQuerier
+func (_mock *MockQuerier) UpdateSnippetSlug(ctx context.Context, arg sqlc.UpdateSnippetSlugParams) error {
+	ret := _mock.Called(ctx, arg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateSnippetSlug")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, sqlc.UpdateSnippetSlugParams) error); ok {
+		r0 = returnFunc(ctx, arg)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockQuerier_UpdateSnippetSlug_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateSnippetSlug'
+type MockQuerier_UpdateSnippetSlug_Call struct {
+	*mock.Call
+}
+
+// UpdateSnippetSlug is a helper method to define mock.On call
+//   - ctx
+//   - arg
+func (_e *MockQuerier_Expecter) UpdateSnippetSlug(ctx interface{}, arg interface{}) *MockQuerier_UpdateSnippetSlug_Call {
+	return &MockQuerier_UpdateSnippetSlug_Call{Call: _e.mock.On("UpdateSnippetSlug", ctx, arg)}
+}
+
+func (_c *MockQuerier_UpdateSnippetSlug_Call) Run(run func(ctx context.Context, arg sqlc.UpdateSnippetSlugParams)) *MockQuerier_UpdateSnippetSlug_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(sqlc.UpdateSnippetSlugParams))
+	})
+	return _c
+}
+
+func (_c *MockQuerier_UpdateSnippetSlug_Call) Return(err error) *MockQuerier_UpdateSnippetSlug_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockQuerier_UpdateSnippetSlug_Call) RunAndReturn(run func(ctx context.Context, arg sqlc.UpdateSnippetSlugParams) error) *MockQuerier_UpdateSnippetSlug_Call {
+	_c.Call.Return(run)
+	return _c
+}
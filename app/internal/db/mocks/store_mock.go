@@ -82,6 +82,105 @@ func (_c *MockStore_Close_Call) RunAndReturn(run func() error) *MockStore_Close_
 	return _c
 }
 
+// ConsistencyToken provides a mock function for the type MockStore
+func (_mock *MockStore) ConsistencyToken(ctx context.Context) (string, error) {
+	ret := _mock.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ConsistencyToken")
+	}
+
+	var r0 string
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context) (string, error)); ok {
+		return returnFunc(ctx)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context) string); ok {
+		r0 = returnFunc(ctx)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = returnFunc(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockStore_ConsistencyToken_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ConsistencyToken'
+type MockStore_ConsistencyToken_Call struct {
+	*mock.Call
+}
+
+// ConsistencyToken is a helper method to define mock.On call
+//   - ctx
+func (_e *MockStore_Expecter) ConsistencyToken(ctx interface{}) *MockStore_ConsistencyToken_Call {
+	return &MockStore_ConsistencyToken_Call{Call: _e.mock.On("ConsistencyToken", ctx)}
+}
+
+func (_c *MockStore_ConsistencyToken_Call) Run(run func(ctx context.Context)) *MockStore_ConsistencyToken_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockStore_ConsistencyToken_Call) Return(s string, err error) *MockStore_ConsistencyToken_Call {
+	_c.Call.Return(s, err)
+	return _c
+}
+
+func (_c *MockStore_ConsistencyToken_Call) RunAndReturn(run func(ctx context.Context) (string, error)) *MockStore_ConsistencyToken_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Ping provides a mock function for the type MockStore
+func (_mock *MockStore) Ping(ctx context.Context) error {
+	ret := _mock.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Ping")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = returnFunc(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockStore_Ping_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Ping'
+type MockStore_Ping_Call struct {
+	*mock.Call
+}
+
+// Ping is a helper method to define mock.On call
+//   - ctx
+func (_e *MockStore_Expecter) Ping(ctx interface{}) *MockStore_Ping_Call {
+	return &MockStore_Ping_Call{Call: _e.mock.On("Ping", ctx)}
+}
+
+func (_c *MockStore_Ping_Call) Run(run func(ctx context.Context)) *MockStore_Ping_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockStore_Ping_Call) Return(err error) *MockStore_Ping_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockStore_Ping_Call) RunAndReturn(run func(ctx context.Context) error) *MockStore_Ping_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Primary provides a mock function for the type MockStore
 func (_mock *MockStore) Primary() sqlc.Querier {
 	ret := _mock.Called()
@@ -174,6 +273,54 @@ func (_c *MockStore_Replica_Call) RunAndReturn(run func() sqlc.Querier) *MockSto
 	return _c
 }
 
+// ReplicaFor provides a mock function for the type MockStore
+func (_mock *MockStore) ReplicaFor(ctx context.Context, token string) sqlc.Querier {
+	ret := _mock.Called(ctx, token)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReplicaFor")
+	}
+
+	var r0 sqlc.Querier
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string) sqlc.Querier); ok {
+		r0 = returnFunc(ctx, token)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(sqlc.Querier)
+		}
+	}
+	return r0
+}
+
+// MockStore_ReplicaFor_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ReplicaFor'
+type MockStore_ReplicaFor_Call struct {
+	*mock.Call
+}
+
+// ReplicaFor is a helper method to define mock.On call
+//   - ctx
+//   - token
+func (_e *MockStore_Expecter) ReplicaFor(ctx interface{}, token interface{}) *MockStore_ReplicaFor_Call {
+	return &MockStore_ReplicaFor_Call{Call: _e.mock.On("ReplicaFor", ctx, token)}
+}
+
+func (_c *MockStore_ReplicaFor_Call) Run(run func(ctx context.Context, token string)) *MockStore_ReplicaFor_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockStore_ReplicaFor_Call) Return(querier sqlc.Querier) *MockStore_ReplicaFor_Call {
+	_c.Call.Return(querier)
+	return _c
+}
+
+func (_c *MockStore_ReplicaFor_Call) RunAndReturn(run func(ctx context.Context, token string) sqlc.Querier) *MockStore_ReplicaFor_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // WithTx provides a mock function for the type MockStore
 func (_mock *MockStore) WithTx(ctx context.Context, fn func(sqlc.Querier) error) error {
 	ret := _mock.Called(ctx, fn)
@@ -0,0 +1,425 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+	"snippets.adelh.dev/app/internal/db/sqlcpgx"
+)
+
+// PgxStore is a Store backed by native pgx connection pools, bypassing
+// database/sql and its driver shim.
+type PgxStore struct {
+	primary *pgxpool.Pool
+	rs      *replicaSet
+	q       *pgxQuerier
+	cfg     config.DBConfig
+}
+
+var _ Store = (*PgxStore)(nil)
+var _ ReplicaReporter = (*PgxStore)(nil)
+var _ ReplicaUpdater = (*PgxStore)(nil)
+var _ DBStatsReporter = (*PgxStore)(nil)
+var _ SchemaReporter = (*PgxStore)(nil)
+
+func NewPgxStore(cfg config.DBConfig) (*PgxStore, error) {
+	ctx := context.Background()
+
+	primary, err := newPgxPool(ctx, cfg.PrimaryDSN, cfg, cfg.PrimaryPool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to primary DB: %w", err)
+	}
+	if err := primary.Ping(ctx); err != nil {
+		primary.Close()
+		return nil, fmt.Errorf("failed to ping primary DB: %w", err)
+	}
+
+	store := &PgxStore{
+		primary: primary,
+		q:       &pgxQuerier{q: sqlcpgx.New(primary)},
+		cfg:     cfg,
+	}
+
+	var replicas []*replica
+	for i, dsn := range cfg.ReplicaDSNs {
+		r, err := store.openReplica(fmt.Sprintf("replica-%d", i), dsn)
+		if err != nil {
+			primary.Close()
+			closeReplicas(replicas)
+			return nil, fmt.Errorf("failed to connect to replica DB %d: %w", i, err)
+		}
+		replicas = append(replicas, r)
+	}
+	store.rs = newReplicaSet(replicas, cfg.ReplicaMaxLag, cfg.ReplicaProbeTimeout)
+	store.rs.primaryLSN = store.primaryLSN
+
+	store.rs.checkAll(ctx)
+	store.rs.start(cfg.ReplicaHealthInterval)
+
+	return store, nil
+}
+
+// newPgxPool creates a lazily connecting pool for dsn.
+func newPgxPool(ctx context.Context, dsn string, cfg config.DBConfig, poolCfg config.PoolConfig) (*pgxpool.Pool, error) {
+	pc, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	pc.MaxConns = int32(cfg.MaxOpenConns)
+	if poolCfg.MaxConns > 0 {
+		pc.MaxConns = poolCfg.MaxConns
+	}
+	if poolCfg.MinConns > 0 {
+		pc.MinConns = poolCfg.MinConns
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		pc.MaxConnLifetime = cfg.ConnMaxLifetime
+	}
+	if poolCfg.MaxConnIdleTime > 0 {
+		pc.MaxConnIdleTime = poolCfg.MaxConnIdleTime
+	}
+	if poolCfg.HealthCheckPeriod > 0 {
+		pc.HealthCheckPeriod = poolCfg.HealthCheckPeriod
+	}
+
+	if cfg.StatementCacheCapacity > 0 {
+		pc.ConnConfig.StatementCacheCapacity = cfg.StatementCacheCapacity
+	}
+	switch cfg.QueryExecMode {
+	case "", "cache_statement":
+		pc.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	case "cache_describe":
+		pc.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheDescribe
+	case "describe_exec":
+		pc.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeDescribeExec
+	case "exec":
+		pc.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	case "simple_protocol":
+		// required behind transaction pooling proxies such as PgBouncer
+		pc.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	default:
+		return nil, fmt.Errorf("unknown query exec mode %q", cfg.QueryExecMode)
+	}
+
+	return pgxpool.NewWithConfig(ctx, pc)
+}
+
+func (s *PgxStore) openReplica(name, dsn string) (*replica, error) {
+	pool, err := newPgxPool(context.Background(), dsn, s.cfg, s.cfg.ReplicaPool)
+	if err != nil {
+		return nil, err
+	}
+	return &replica{
+		name:  name,
+		dsn:   dsn,
+		q:     &pgxQuerier{q: sqlcpgx.New(pool)},
+		probe: pgxReplicaProbe(pool),
+		close: func() error {
+			pool.Close()
+			return nil
+		},
+		stats: func() sql.DBStats { return pgxPoolStats(pool) },
+	}, nil
+}
+
+func (s *PgxStore) Primary() sqlc.Querier {
+	return s.q
+}
+
+// Replica returns the next healthy replica, or the primary if none is healthy.
+func (s *PgxStore) Replica() sqlc.Querier {
+	if r := s.rs.pick(); r != nil {
+		return r.q
+	}
+	return s.q
+}
+
+// ReplicaFor returns a replica that has replayed the WAL up to token.
+func (s *PgxStore) ReplicaFor(ctx context.Context, token string) sqlc.Querier {
+	if token == "" {
+		return s.Replica()
+	}
+
+	target, err := ParseLSN(token)
+	if err != nil {
+		return s.q
+	}
+
+	if r := s.rs.pickFor(ctx, target); r != nil {
+		return r.q
+	}
+	return s.q
+}
+
+// ConsistencyToken returns the current WAL write position of the primary.
+func (s *PgxStore) ConsistencyToken(ctx context.Context) (string, error) {
+	lsn, err := s.primaryLSN(ctx)
+	if err != nil {
+		return "", err
+	}
+	return lsn.String(), nil
+}
+
+func (s *PgxStore) primaryLSN(ctx context.Context) (LSN, error) {
+	var lsn string
+	if err := s.primary.QueryRow(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&lsn); err != nil {
+		return 0, fmt.Errorf("failed to read primary WAL position: %w", err)
+	}
+	return ParseLSN(lsn)
+}
+
+// ReplicaStatus reports the health of every configured replica.
+func (s *PgxStore) ReplicaStatus() []ReplicaStatus {
+	return s.rs.statuses()
+}
+
+// SetReplicas replaces the replicas, keeping those that are still listed.
+func (s *PgxStore) SetReplicas(ctx context.Context, dsns []string) error {
+	return s.rs.replace(ctx, dsns, s.openReplica)
+}
+
+// WithTx executes a function within a database transaction
+func (s *PgxStore) WithTx(ctx context.Context, fn func(sqlc.Querier) error) error {
+	tx, err := s.primary.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(&pgxQuerier{q: sqlcpgx.New(tx)})
+	if err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DBStats reports the pools in the terms of database/sql.
+func (s *PgxStore) DBStats() map[string]sql.DBStats {
+	stats := map[string]sql.DBStats{"primary": pgxPoolStats(s.primary)}
+	for _, r := range s.rs.members() {
+		stats[r.name] = r.stats()
+	}
+	return stats
+}
+
+func pgxPoolStats(pool *pgxpool.Pool) sql.DBStats {
+	st := pool.Stat()
+	return sql.DBStats{
+		MaxOpenConnections: int(st.MaxConns()),
+		OpenConnections:    int(st.TotalConns()),
+		InUse:              int(st.AcquiredConns()),
+		Idle:               int(st.IdleConns()),
+		WaitCount:          st.EmptyAcquireCount(),
+		WaitDuration:       st.EmptyAcquireWaitTime(),
+		MaxIdleTimeClosed:  st.MaxIdleDestroyCount(),
+		MaxLifetimeClosed:  st.MaxLifetimeDestroyCount(),
+	}
+}
+
+func (s *PgxStore) Ping(ctx context.Context) error {
+	return s.primary.Ping(ctx)
+}
+
+func (s *PgxStore) SchemaStatus(ctx context.Context) (MigrationStatus, error) {
+	return schemaStatus(s.primary.QueryRow(ctx, schemaVersionQuery), postgresMigrations, "migrations")
+}
+
+func (s *PgxStore) Close() error {
+	err := s.rs.close()
+	s.primary.Close()
+	return err
+}
+
+func pgxReplicaProbe(pool *pgxpool.Pool) replicaProbe {
+	return func(ctx context.Context) (LSN, time.Duration, error) {
+		var lsn string
+		var lagSeconds float64
+		if err := pool.QueryRow(ctx, replicaProbeQuery).Scan(&lsn, &lagSeconds); err != nil {
+			return 0, 0, err
+		}
+		replayed, err := ParseLSN(lsn)
+		if err != nil {
+			return 0, 0, err
+		}
+		return replayed, time.Duration(lagSeconds * float64(time.Second)), nil
+	}
+}
+
+// pgxQuerier adapts the pgx flavoured sqlc queries to sqlc.Querier.
+// Both packages are generated from the same queries with matching Go types,
+// so rows and params convert directly. pgx.ErrNoRows wraps sql.ErrNoRows,
+// callers checking errors.Is(err, sql.ErrNoRows) keep working.
+type pgxQuerier struct {
+	q *sqlcpgx.Queries
+}
+
+var _ sqlc.Querier = (*pgxQuerier)(nil)
+
+func (p *pgxQuerier) CreateSnippet(ctx context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+	row, err := p.q.CreateSnippet(ctx, sqlcpgx.CreateSnippetParams(arg))
+	return sqlc.CreateSnippetRow(row), err
+}
+
+func (p *pgxQuerier) DeleteExpiredSnippets(ctx context.Context) ([]sql.NullString, error) {
+	return p.q.DeleteExpiredSnippets(ctx)
+}
+
+func (p *pgxQuerier) DeleteSnippetById(ctx context.Context, id int32) ([]sql.NullString, error) {
+	return p.q.DeleteSnippetById(ctx, id)
+}
+
+func (p *pgxQuerier) GetSnippetBlobKey(ctx context.Context, snippetID int32) (sql.NullString, error) {
+	return p.q.GetSnippetBlobKey(ctx, snippetID)
+}
+
+func (p *pgxQuerier) GetSnippetByPublicID(ctx context.Context, publicID string) (sqlc.GetSnippetByPublicIDRow, error) {
+	row, err := p.q.GetSnippetByPublicID(ctx, publicID)
+	return sqlc.GetSnippetByPublicIDRow(row), err
+}
+
+func (p *pgxQuerier) IncrementSnippetViewCount(ctx context.Context, id int32) (int32, error) {
+	return p.q.IncrementSnippetViewCount(ctx, id)
+}
+
+func (p *pgxQuerier) ListRecentSnippets(ctx context.Context, limit int32) ([]sqlc.ListRecentSnippetsRow, error) {
+	rows, err := p.q.ListRecentSnippets(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.ListRecentSnippetsRow, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.ListRecentSnippetsRow(row)
+	}
+	return out, nil
+}
+
+func (p *pgxQuerier) PurgeDeletedSnippets(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error) {
+	return p.q.PurgeDeletedSnippets(ctx, deletedBefore)
+}
+
+func (p *pgxQuerier) RestoreSnippet(ctx context.Context, arg sqlc.RestoreSnippetParams) (int64, error) {
+	return p.q.RestoreSnippet(ctx, sqlcpgx.RestoreSnippetParams(arg))
+}
+
+func (p *pgxQuerier) SoftDeleteSnippet(ctx context.Context, id int32) (int64, error) {
+	return p.q.SoftDeleteSnippet(ctx, id)
+}
+
+func (p *pgxQuerier) UpdateSnippet(ctx context.Context, arg sqlc.UpdateSnippetParams) (sqlc.UpdateSnippetRow, error) {
+	row, err := p.q.UpdateSnippet(ctx, sqlcpgx.UpdateSnippetParams(arg))
+	return sqlc.UpdateSnippetRow(row), err
+}
+
+func (p *pgxQuerier) UpdateSnippetSlug(ctx context.Context, arg sqlc.UpdateSnippetSlugParams) error {
+	return p.q.UpdateSnippetSlug(ctx, sqlcpgx.UpdateSnippetSlugParams(arg))
+}
+
+func (p *pgxQuerier) UpdateSnippetContent(ctx context.Context, arg sqlc.UpdateSnippetContentParams) error {
+	return p.q.UpdateSnippetContent(ctx, sqlcpgx.UpdateSnippetContentParams(arg))
+}
+
+func (p *pgxQuerier) TouchSnippetBody(ctx context.Context, contentHash []byte) (int32, error) {
+	return p.q.TouchSnippetBody(ctx, contentHash)
+}
+
+func (p *pgxQuerier) CreateSnippetBody(ctx context.Context, arg sqlc.CreateSnippetBodyParams) (sqlc.CreateSnippetBodyRow, error) {
+	row, err := p.q.CreateSnippetBody(ctx, sqlcpgx.CreateSnippetBodyParams(arg))
+	return sqlc.CreateSnippetBodyRow(row), err
+}
+
+func (p *pgxQuerier) PurgeUnusedSnippetBodies(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error) {
+	return p.q.PurgeUnusedSnippetBodies(ctx, usedBefore)
+}
+
+func (p *pgxQuerier) ImportSnippet(ctx context.Context, arg sqlc.ImportSnippetParams) (int32, error) {
+	return p.q.ImportSnippet(ctx, sqlcpgx.ImportSnippetParams(arg))
+}
+
+func (p *pgxQuerier) ListSnippets(ctx context.Context, arg sqlc.ListSnippetsParams) ([]sqlc.ListSnippetsRow, error) {
+	rows, err := p.q.ListSnippets(ctx, sqlcpgx.ListSnippetsParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.ListSnippetsRow, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.ListSnippetsRow(row)
+	}
+	return out, nil
+}
+
+func (p *pgxQuerier) GetSnippetStats(ctx context.Context) (sqlc.GetSnippetStatsRow, error) {
+	row, err := p.q.GetSnippetStats(ctx)
+	return sqlc.GetSnippetStatsRow(row), err
+}
+
+func (p *pgxQuerier) ListSnippetBodies(ctx context.Context, arg sqlc.ListSnippetBodiesParams) ([]sqlc.ListSnippetBodiesRow, error) {
+	rows, err := p.q.ListSnippetBodies(ctx, sqlcpgx.ListSnippetBodiesParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.ListSnippetBodiesRow, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.ListSnippetBodiesRow(row)
+	}
+	return out, nil
+}
+
+func (p *pgxQuerier) UpdateSnippetBody(ctx context.Context, arg sqlc.UpdateSnippetBodyParams) (int64, error) {
+	return p.q.UpdateSnippetBody(ctx, sqlcpgx.UpdateSnippetBodyParams(arg))
+}
+
+func (p *pgxQuerier) SearchSnippets(ctx context.Context, arg sqlc.SearchSnippetsParams) ([]sqlc.SearchSnippetsRow, error) {
+	rows, err := p.q.SearchSnippets(ctx, sqlcpgx.SearchSnippetsParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.SearchSnippetsRow, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.SearchSnippetsRow(row)
+	}
+	return out, nil
+}
+
+func (p *pgxQuerier) ExpireSnippet(ctx context.Context, id int32) (int64, error) {
+	return p.q.ExpireSnippet(ctx, id)
+}
+
+func (p *pgxQuerier) LockAuditHead(ctx context.Context) (sqlc.LockAuditHeadRow, error) {
+	row, err := p.q.LockAuditHead(ctx)
+	return sqlc.LockAuditHeadRow(row), err
+}
+
+func (p *pgxQuerier) GetAuditHead(ctx context.Context) (sqlc.GetAuditHeadRow, error) {
+	row, err := p.q.GetAuditHead(ctx)
+	return sqlc.GetAuditHeadRow(row), err
+}
+
+func (p *pgxQuerier) UpdateAuditHead(ctx context.Context, arg sqlc.UpdateAuditHeadParams) error {
+	return p.q.UpdateAuditHead(ctx, sqlcpgx.UpdateAuditHeadParams(arg))
+}
+
+func (p *pgxQuerier) CreateAuditEntry(ctx context.Context, arg sqlc.CreateAuditEntryParams) error {
+	return p.q.CreateAuditEntry(ctx, sqlcpgx.CreateAuditEntryParams(arg))
+}
+
+func (p *pgxQuerier) ListAuditEntries(ctx context.Context, arg sqlc.ListAuditEntriesParams) ([]sqlc.AuditLog, error) {
+	rows, err := p.q.ListAuditEntries(ctx, sqlcpgx.ListAuditEntriesParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.AuditLog, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.AuditLog(row)
+	}
+	return out, nil
+}
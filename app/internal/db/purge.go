@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/metrics"
+)
+
+// Purger permanently removes snippets that were deleted longer than the
+// restore window ago. Until then they are tombstones that can be restored.
+// It also sweeps expired snippets, which are no longer served either, and
+// shared bodies no snippet references anymore.
+type Purger struct {
+	store  Store
+	window time.Duration
+	// live overrides window if set, see Follow.
+	live     *config.Live
+	interval time.Duration
+	now      func() time.Time
+	logger   *slog.Logger
+}
+
+// bodyGracePeriod is how long an unreferenced body is kept after it was last
+// looked up, so a snippet that is being created with it can still claim it.
+const bodyGracePeriod = time.Hour
+
+func NewPurger(store Store, window, interval time.Duration) *Purger {
+	return &Purger{
+		store:    store,
+		window:   window,
+		interval: interval,
+		now:      time.Now,
+		logger:   slog.Default(),
+	}
+}
+
+// Follow makes the purger use the restore window of the configuration in
+// effect in live from the next purge on, rather than the one it was
+// created with. It must be called before the purger runs.
+func (p *Purger) Follow(live *config.Live) {
+	p.live = live
+}
+
+func (p *Purger) restoreWindow() time.Duration {
+	if p.live != nil {
+		return p.live.Load().Retention.RestoreWindow
+	}
+	return p.window
+}
+
+// PurgeOnce removes the tombstones that are past the restore window and the
+// expired snippets, and returns how many snippets were removed.
+func (p *Purger) PurgeOnce(ctx context.Context) (n int64, err error) {
+	ctx, span := otel.Tracer("snippets.adelh.dev/app/internal/db").Start(ctx, "purge")
+	defer func() { endSpan(span, err) }()
+
+	q := p.store.Primary()
+	cutoff := sql.NullTime{Time: p.now().Add(-p.restoreWindow()), Valid: true}
+	purged, err := q.PurgeDeletedSnippets(ctx, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted snippets: %w", err)
+	}
+	metrics.SnippetEvents(metrics.SnippetPurged, len(purged))
+	expired, err := q.DeleteExpiredSnippets(ctx)
+	if err != nil {
+		return int64(len(purged)), fmt.Errorf("failed to delete expired snippets: %w", err)
+	}
+	metrics.SnippetEvents(metrics.SnippetExpired, len(expired))
+	n = int64(len(purged) + len(expired))
+
+	bodies, err := q.PurgeUnusedSnippetBodies(ctx, p.now().Add(-bodyGracePeriod))
+	if err != nil {
+		return n, fmt.Errorf("failed to purge unused snippet bodies: %w", err)
+	}
+	if len(bodies) > 0 {
+		p.logger.Info("purged unused snippet bodies", "count", len(bodies))
+	}
+	return n, nil
+}
+
+// Run purges every interval until ctx is done. It returns immediately if
+// the interval is zero.
+func (p *Purger) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := p.PurgeOnce(ctx)
+			if err != nil {
+				p.logger.Error("purge job failed", "error", err)
+				continue
+			}
+			if n > 0 {
+				p.logger.Info("purged deleted and expired snippets", "count", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+func TestPurger_PurgeOnce(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	q := store.Primary()
+
+	var ids []int32
+	for _, publicID := range []string{"aaa-aaaa-aaa", "bbb-bbbb-bbb"} {
+		row, err := q.CreateSnippet(ctx, sqlc.CreateSnippetParams{PublicID: publicID, EditToken: "t", ContentType: "text/plain"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, row.SnippetID)
+	}
+	if _, err := q.SoftDeleteSnippet(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPurger(store, time.Hour, time.Minute)
+
+	// the tombstone is kept for the restore window
+	if n, err := p.PurgeOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("PurgeOnce = %d, %v, want 0, nil", n, err)
+	}
+
+	p.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if n, err := p.PurgeOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("PurgeOnce after the window = %d, %v, want 1, nil", n, err)
+	}
+	if _, err := q.GetSnippetByPublicID(ctx, "aaa-aaaa-aaa"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("purged snippet lookup error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := q.GetSnippetByPublicID(ctx, "bbb-bbbb-bbb"); err != nil {
+		t.Errorf("live snippet was purged: %v", err)
+	}
+}
+
+func TestPurger_Follow(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	q := store.Primary()
+
+	row, err := q.CreateSnippet(ctx, sqlc.CreateSnippetParams{PublicID: "aaa-aaaa-aaa", EditToken: "t", ContentType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.SoftDeleteSnippet(ctx, row.SnippetID); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPurger(store, 0, time.Minute)
+	live := config.NewLive(&config.Config{Retention: config.RetentionConfig{RestoreWindow: time.Hour}})
+	p.Follow(live)
+	p.now = func() time.Time { return time.Now().Add(time.Minute) }
+	if n, err := p.PurgeOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("PurgeOnce = %d, %v, want 0, nil", n, err)
+	}
+
+	live.Store(&config.Config{Retention: config.RetentionConfig{RestoreWindow: 30 * time.Second}})
+	if n, err := p.PurgeOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("PurgeOnce after shrinking the window = %d, %v, want 1, nil", n, err)
+	}
+}
+
+func TestPurger_PurgeOnceExpired(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	q := store.Primary()
+
+	_, err := q.CreateSnippet(ctx, sqlc.CreateSnippetParams{
+		PublicID:    "aaa-aaaa-aaa",
+		EditToken:   "t",
+		ContentType: "text/plain",
+		ExpiresAt:   sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := NewPurger(store, time.Hour, time.Minute).PurgeOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("PurgeOnce = %d, %v, want 1, nil", n, err)
+	}
+	if _, err := q.GetSnippetByPublicID(ctx, "aaa-aaaa-aaa"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expired snippet lookup error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPurger_PurgeOnceBodies(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	q := store.Primary()
+
+	body, err := q.CreateSnippetBody(ctx, sqlc.CreateSnippetBodyParams{ContentHash: []byte("hash"), EncryptedContent: []byte("body")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a fresh body may be about to be referenced
+	p := NewPurger(store, time.Hour, time.Minute)
+	if _, err := p.PurgeOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.TouchSnippetBody(ctx, []byte("hash")); err != nil {
+		t.Fatalf("body purged inside the grace period: %v", err)
+	}
+
+	p.now = func() time.Time { return time.Now().Add(2 * bodyGracePeriod) }
+	if _, err := p.PurgeOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.TouchSnippetBody(ctx, []byte("hash")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unused body %d lookup error = %v, want sql.ErrNoRows", body.ID, err)
+	}
+}
+
+func TestPurger_RunStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewPurger(NewMemoryStore(), time.Hour, time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was canceled")
+	}
+}
@@ -1,10 +1,17 @@
 -- name: GetSnippetByPublicID :one 
--- Retrieves a snippet by its public ID 
-SELECT s.id, s.public_id, s.title, s.created_at, s.expires_at, s.password_hash, s.edit_token, s.view_count, s.last_edited_at,
-       c.content_type, c.encrypted_content
+-- Retrieves a snippet by its public ID or its slug, deleted ones included.
+-- A public ID wins over the same slug of another snippet.
+-- The content of deduplicated snippets comes from their shared body.
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at, s.password_hash, s.edit_token, s.view_count, s.last_edited_at, s.deleted_at,
+       c.content_type,
+       COALESCE(b.encrypted_content, c.encrypted_content) AS encrypted_content,
+       COALESCE(b.blob_key, c.blob_key) AS blob_key,
+       b.content_hash
 FROM snippets s
 JOIN snippet_contents c ON s.id = c.snippet_id
-WHERE s.public_id = $1 
+LEFT JOIN snippet_bodies b ON b.id = c.body_id
+WHERE s.public_id = $1 OR s.slug = $1
+ORDER BY s.public_id = $1 DESC
 LIMIT 1;
 
 
@@ -12,37 +19,79 @@ LIMIT 1;
 -- Creates a new snippet 
 WITH new_snippet AS (
     INSERT INTO snippets (
+        public_id,
+        slug,
         title, 
         expires_at, 
         password_hash, 
         edit_token
     ) VALUES (
-        $1, $2, $3, $4
+        $1, $2, $3, $4, $5, $6
     )
-    RETURNING id, public_id, created_at, edit_token
+    RETURNING id, public_id, slug, created_at, edit_token
 )
 INSERT INTO snippet_contents (
     snippet_id,
     content_type,
-    encrypted_content
+    encrypted_content,
+    blob_key,
+    body_id
 ) 
 SELECT 
-    id, $5, $6
+    id, $7, $8, $9, $10
 FROM new_snippet
 RETURNING snippet_id,
           (SELECT public_id FROM new_snippet),
+          (SELECT slug FROM new_snippet),
           (SELECT created_at FROM new_snippet),
           (SELECT edit_token FROM new_snippet);
 
--- name: DeleteExpiredSnippets :execrows
--- Deletes all snippets that have expired
-DELETE FROM snippets
-WHERE expires_at IS NOT NULL AND expires_at < NOW();
+-- name: DeleteExpiredSnippets :many
+-- Deletes all snippets that have expired, returning one blob key per snippet.
+-- The SELECT sees the snapshot from before the DELETE, contents included.
+WITH deleted AS (
+    DELETE FROM snippets
+    WHERE expires_at IS NOT NULL AND expires_at < NOW()
+    RETURNING id
+)
+SELECT c.blob_key
+FROM snippet_contents c
+JOIN deleted d ON d.id = c.snippet_id;
 
--- name: DeleteSnippetById :execrows 
--- Deletes a snippet by id 
-DELETE FROM snippets 
-WHERE id = $1;
+-- name: DeleteSnippetById :many
+-- Permanently deletes a snippet by id, returning its blob key
+WITH deleted AS (
+    DELETE FROM snippets
+    WHERE id = $1
+    RETURNING id
+)
+SELECT c.blob_key
+FROM snippet_contents c
+JOIN deleted d ON d.id = c.snippet_id;
+
+-- name: SoftDeleteSnippet :execrows
+-- Marks a snippet as deleted, it can be restored until it is purged
+UPDATE snippets
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreSnippet :execrows
+-- Clears the tombstone of a snippet deleted after the given time
+UPDATE snippets
+SET deleted_at = NULL
+WHERE id = @id AND deleted_at >= @deleted_after;
+
+-- name: PurgeDeletedSnippets :many
+-- Permanently deletes snippets deleted before the given time, returning one
+-- blob key per snippet
+WITH purged AS (
+    DELETE FROM snippets
+    WHERE deleted_at IS NOT NULL AND deleted_at < @deleted_before
+    RETURNING id
+)
+SELECT c.blob_key
+FROM snippet_contents c
+JOIN purged p ON p.id = c.snippet_id;
 
 -- name: UpdateSnippet :one
 -- Updates an existing snippet by ID
@@ -55,14 +104,29 @@ SET
 WHERE id = $1
 RETURNING id, public_id, created_at, last_edited_at;
 
+-- name: UpdateSnippetSlug :exec
+-- Sets or, with NULL, removes the slug of a snippet
+UPDATE snippets
+SET slug = $2
+WHERE id = $1;
+
 -- name: UpdateSnippetContent :exec
--- Updates the content of a snippet
+-- Updates the content of a snippet, the blob key and body are always replaced
 UPDATE snippet_contents
 SET 
     content_type = COALESCE($2, content_type),
-    encrypted_content = COALESCE($3, encrypted_content)
+    encrypted_content = COALESCE($3, encrypted_content),
+    blob_key = $4,
+    body_id = $5
 WHERE snippet_id = $1;
 
+-- name: GetSnippetBlobKey :one
+-- Locks the content of a snippet and returns its blob key
+SELECT blob_key
+FROM snippet_contents
+WHERE snippet_id = $1
+FOR UPDATE;
+
 
 -- name: IncrementSnippetViewCount :one
 -- Increments the view count for a snippet
@@ -73,9 +137,169 @@ RETURNING view_count;
 
 -- name: ListRecentSnippets :many
 -- Lists recently created snippets (for admin purposes)
-SELECT s.id, s.public_id, s.title, s.created_at, s.expires_at 
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at 
 FROM snippets s
+WHERE s.deleted_at IS NULL
 ORDER BY s.created_at DESC
 LIMIT $1;
 
 
+-- name: TouchSnippetBody :one
+-- Looks up a shared body by content hash and marks it as used, so the purge
+-- job leaves it alone while a snippet is created with it
+UPDATE snippet_bodies
+SET last_used_at = NOW()
+WHERE content_hash = $1
+RETURNING id;
+
+-- name: CreateSnippetBody :one
+-- Stores a shared body. If one with the same hash was stored concurrently
+-- that one is kept and marked as used, the returned blob key tells which.
+INSERT INTO snippet_bodies (
+    content_hash,
+    encrypted_content,
+    blob_key
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT (content_hash) DO UPDATE SET last_used_at = NOW()
+RETURNING id, blob_key;
+
+-- name: PurgeUnusedSnippetBodies :many
+-- Deletes bodies no snippet has referenced since the given time, returning
+-- their blob keys
+DELETE FROM snippet_bodies
+WHERE ref_count = 0 AND last_used_at < @used_before
+RETURNING blob_key;
+
+-- name: ListSnippets :many
+-- Lists snippets in id order from after the given id, deleted ones included,
+-- for admin tasks that walk all of them. The content is resolved like
+-- GetSnippetByPublicID does, body_id tells whether it is shared.
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at, s.password_hash, s.edit_token, s.view_count, s.last_edited_at, s.deleted_at,
+       c.content_type,
+       COALESCE(b.encrypted_content, c.encrypted_content) AS encrypted_content,
+       COALESCE(b.blob_key, c.blob_key) AS blob_key,
+       b.content_hash,
+       c.body_id
+FROM snippets s
+JOIN snippet_contents c ON s.id = c.snippet_id
+LEFT JOIN snippet_bodies b ON b.id = c.body_id
+WHERE s.id > @after_id
+ORDER BY s.id
+LIMIT @max_rows;
+
+-- name: ImportSnippet :one
+-- Creates a snippet exported from another database, keeping its timestamps,
+-- view count and tombstone
+WITH new_snippet AS (
+    INSERT INTO snippets (
+        public_id,
+        slug,
+        title,
+        created_at,
+        expires_at,
+        password_hash,
+        edit_token,
+        view_count,
+        last_edited_at,
+        deleted_at
+    ) VALUES (
+        @public_id, @slug, @title, @created_at, @expires_at, @password_hash,
+        @edit_token, @view_count, @last_edited_at, @deleted_at
+    )
+    RETURNING id
+)
+INSERT INTO snippet_contents (
+    snippet_id,
+    content_type,
+    encrypted_content,
+    blob_key
+)
+SELECT
+    id, @content_type, @encrypted_content, @blob_key
+FROM new_snippet
+RETURNING snippet_id;
+
+-- name: GetSnippetStats :one
+-- Counts snippets by state, along with the content stored out of line
+SELECT COUNT(*) AS total,
+       COUNT(*) FILTER (WHERE s.deleted_at IS NOT NULL) AS deleted,
+       COUNT(*) FILTER (WHERE s.deleted_at IS NULL AND s.expires_at < NOW()) AS expired,
+       COUNT(*) FILTER (WHERE s.password_hash IS NOT NULL) AS protected,
+       COALESCE(SUM(s.view_count), 0)::bigint AS views,
+       (SELECT COUNT(*) FROM snippet_contents WHERE blob_key IS NOT NULL) AS blobs,
+       (SELECT COUNT(*) FROM snippet_bodies) AS bodies
+FROM snippets s;
+
+-- name: ListSnippetBodies :many
+-- Lists shared bodies in id order from after the given id
+SELECT id, content_hash, encrypted_content, blob_key
+FROM snippet_bodies
+WHERE id > @after_id
+ORDER BY id
+LIMIT @max_rows;
+
+-- name: UpdateSnippetBody :execrows
+-- Replaces the stored content of a shared body, its hash stays the same.
+-- Nothing is updated unless the body is still stored under old_blob_key.
+UPDATE snippet_bodies
+SET
+    encrypted_content = @encrypted_content,
+    blob_key = @blob_key
+WHERE id = @id AND blob_key IS NOT DISTINCT FROM sqlc.narg('old_blob_key');
+
+-- name: SearchSnippets :many
+-- Finds snippets by public ID or slug, or by a case-insensitive part of their
+-- title, deleted ones included (for admin purposes)
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at, s.deleted_at
+FROM snippets s
+WHERE s.public_id = @query OR s.slug = @query OR strpos(lower(s.title), lower(@query)) > 0
+ORDER BY s.created_at DESC, s.id DESC
+LIMIT @max_rows;
+
+-- name: ExpireSnippet :execrows
+-- Makes a live snippet expire now, unless it already expires earlier
+UPDATE snippets
+SET expires_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: LockAuditHead :one
+-- Returns the last entry of the audit log and serializes appends until the
+-- transaction ends, an entry needs the hash of the one before it
+SELECT seq, hash
+FROM audit_head
+FOR UPDATE;
+
+-- name: GetAuditHead :one
+SELECT seq, hash
+FROM audit_head;
+
+-- name: UpdateAuditHead :exec
+UPDATE audit_head
+SET seq = @seq, hash = @hash;
+
+-- name: CreateAuditEntry :exec
+INSERT INTO audit_log (
+    seq,
+    created_at,
+    event,
+    actor,
+    snippet,
+    client_ip,
+    user_agent,
+    request_id,
+    details,
+    prev_hash,
+    hash
+) VALUES (
+    @seq, @created_at, @event, @actor, @snippet, @client_ip, @user_agent, @request_id, @details, @prev_hash, @hash
+);
+
+-- name: ListAuditEntries :many
+-- Pages through the audit log in order, for verification
+SELECT seq, created_at, event, actor, snippet, client_ip, user_agent, request_id, details, prev_hash, hash
+FROM audit_log
+WHERE seq > @after_seq
+ORDER BY seq
+LIMIT @max_rows;
@@ -0,0 +1,425 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+// ReplicaStatus is a point-in-time view of a read replica's health.
+type ReplicaStatus struct {
+	Name        string        `json:"name"`
+	Healthy     bool          `json:"healthy"`
+	Lag         time.Duration `json:"lag"`
+	ReplayedLSN string        `json:"replayedLsn"`
+	LastChecked time.Time     `json:"lastChecked"`
+	LastError   string        `json:"lastError,omitempty"`
+}
+
+// ReplicaReporter is implemented by stores that route reads to replicas.
+type ReplicaReporter interface {
+	ReplicaStatus() []ReplicaStatus
+}
+
+// ReplicaUpdater is implemented by stores whose read replicas can be
+// replaced while they serve requests.
+type ReplicaUpdater interface {
+	// SetReplicas routes reads to the replicas at dsns from now on.
+	SetReplicas(ctx context.Context, dsns []string) error
+}
+
+// ErrReplicasUnsupported is returned when replicas are set on a store that
+// can't route reads to any, such as SQLite and the memory store.
+var ErrReplicasUnsupported = errors.New("the store does not support read replicas")
+
+// replicaProbe reports how far a replica has replayed the primary's WAL
+// and how far behind the primary it is.
+type replicaProbe func(ctx context.Context) (replayed LSN, lag time.Duration, err error)
+
+type replica struct {
+	name  string
+	dsn   string
+	q     sqlc.Querier
+	probe replicaProbe
+	// close and stats are nil for replicas without a connection pool.
+	close func() error
+	stats func() sql.DBStats
+
+	mu      sync.RWMutex
+	healthy bool
+	// replayed is the highest WAL position the replica is known to have replayed.
+	replayed    LSN
+	lag         time.Duration
+	lastChecked time.Time
+	lastErr     error
+}
+
+func (r *replica) status() ReplicaStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	st := ReplicaStatus{
+		Name:        r.name,
+		Healthy:     r.healthy,
+		Lag:         r.lag,
+		ReplayedLSN: r.replayed.String(),
+		LastChecked: r.lastChecked,
+	}
+	if r.lastErr != nil {
+		st.LastError = r.lastErr.Error()
+	}
+	return st
+}
+
+func (r *replica) isHealthy() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.healthy
+}
+
+func (r *replica) replayedLSN() LSN {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.replayed
+}
+
+// replicaSet load balances reads over replicas and keeps unhealthy ones out
+// of rotation based on periodic probes.
+type replicaSet struct {
+	// maxLag ejects replicas lagging further behind, zero disables the check.
+	maxLag       time.Duration
+	probeTimeout time.Duration
+	logger       *slog.Logger
+	// primaryLSN returns the current WAL position of the primary, nil if
+	// it is unknown.
+	primaryLSN func(ctx context.Context) (LSN, error)
+
+	mu sync.Mutex
+	// replicas is replaced as a whole, never modified in place.
+	replicas []*replica
+	next     int
+
+	// swapMu serializes replace and close.
+	swapMu sync.Mutex
+	// seq numbers the replicas, a new one never takes the name of one it
+	// replaces.
+	seq  int
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newReplicaSet(replicas []*replica, maxLag, probeTimeout time.Duration) *replicaSet {
+	if probeTimeout <= 0 {
+		probeTimeout = 2 * time.Second
+	}
+	return &replicaSet{
+		replicas:     replicas,
+		seq:          len(replicas),
+		maxLag:       maxLag,
+		probeTimeout: probeTimeout,
+		logger:       slog.Default(),
+	}
+}
+
+// members returns the replicas currently in the set.
+func (rs *replicaSet) members() []*replica {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.replicas
+}
+
+// check probes a single replica and updates its state.
+func (rs *replicaSet) check(ctx context.Context, r *replica) {
+	ctx, cancel := context.WithTimeout(ctx, rs.probeTimeout)
+	defer cancel()
+
+	replayed, lag, probeErr := r.probe(ctx)
+	err := probeErr
+	if err == nil && rs.maxLag > 0 && lag > rs.maxLag {
+		err = fmt.Errorf("replication lag %s exceeds %s", lag.Round(time.Millisecond), rs.maxLag)
+	}
+
+	r.mu.Lock()
+	wasHealthy := r.healthy
+	r.healthy = err == nil
+	r.lastErr = err
+	r.lastChecked = time.Now()
+	if probeErr == nil {
+		r.lag = lag
+		r.replayed = max(r.replayed, replayed)
+	}
+	r.mu.Unlock()
+
+	switch {
+	case wasHealthy && err != nil:
+		rs.logger.Warn("replica removed from rotation", "replica", r.name, "error", err)
+	case !wasHealthy && err == nil:
+		rs.logger.Info("replica back in rotation", "replica", r.name, "lag", lag)
+	}
+}
+
+// checkAll probes every replica concurrently.
+func (rs *replicaSet) checkAll(ctx context.Context) {
+	rs.probe(ctx, rs.members())
+}
+
+func (rs *replicaSet) probe(ctx context.Context, replicas []*replica) {
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rs.check(ctx, r)
+		}()
+	}
+	wg.Wait()
+}
+
+// start probes replicas every interval until close is called. It probes
+// even without replicas, replace may add some.
+func (rs *replicaSet) start(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	rs.stop = make(chan struct{})
+	rs.done = make(chan struct{})
+
+	go func() {
+		defer close(rs.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rs.stop:
+				return
+			case <-ticker.C:
+				rs.checkAll(context.Background())
+			}
+		}
+	}()
+}
+
+// close stops probing and closes the connections of every replica.
+func (rs *replicaSet) close() error {
+	rs.swapMu.Lock()
+	defer rs.swapMu.Unlock()
+
+	if rs.stop != nil {
+		close(rs.stop)
+		<-rs.done
+		rs.stop = nil
+	}
+	return closeReplicas(rs.members())
+}
+
+func closeReplicas(replicas []*replica) error {
+	var errs []error
+	for _, r := range replicas {
+		if r.close == nil {
+			continue
+		}
+		if err := r.close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", r.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// replace swaps the replicas for ones connected to dsns. Replicas whose DSN
+// is still listed are kept along with their health, new ones are opened
+// with open and probed before they join the rotation, and removed ones are
+// closed once they are out of it. Nothing changes if a replica can't be
+// opened.
+func (rs *replicaSet) replace(ctx context.Context, dsns []string, open func(name, dsn string) (*replica, error)) error {
+	rs.swapMu.Lock()
+	defer rs.swapMu.Unlock()
+
+	current := rs.members()
+	kept := make(map[*replica]bool, len(current))
+	var next, added []*replica
+	for i, dsn := range dsns {
+		if r := findReplica(current, kept, dsn); r != nil {
+			kept[r] = true
+			next = append(next, r)
+			continue
+		}
+		r, err := open(fmt.Sprintf("replica-%d", rs.seq), dsn)
+		if err != nil {
+			closeReplicas(added)
+			return fmt.Errorf("failed to connect to replica DB %d: %w", i, err)
+		}
+		rs.seq++
+		added = append(added, r)
+		next = append(next, r)
+	}
+	rs.probe(ctx, added)
+
+	rs.mu.Lock()
+	rs.replicas = next
+	rs.next = 0
+	rs.mu.Unlock()
+
+	var removed []*replica
+	for _, r := range current {
+		if !kept[r] {
+			removed = append(removed, r)
+		}
+	}
+	rs.logger.Info("replicas replaced", "added", len(added), "removed", len(removed), "replicas", len(next))
+	// queries already running on a removed replica finish before its
+	// connections are closed
+	return closeReplicas(removed)
+}
+
+// findReplica returns the first replica of replicas connected to dsn that
+// isn't taken yet.
+func findReplica(replicas []*replica, taken map[*replica]bool, dsn string) *replica {
+	for _, r := range replicas {
+		if r.dsn == dsn && !taken[r] {
+			return r
+		}
+	}
+	return nil
+}
+
+// rotation returns the replicas in the order they should be tried,
+// advancing the round-robin cursor.
+func (rs *replicaSet) rotation() []*replica {
+	rs.mu.Lock()
+	replicas := rs.replicas
+	if len(replicas) == 0 {
+		rs.mu.Unlock()
+		return nil
+	}
+	start := rs.next % len(replicas)
+	rs.next = (start + 1) % len(replicas)
+	rs.mu.Unlock()
+
+	order := make([]*replica, len(replicas))
+	for i := range replicas {
+		order[i] = replicas[(start+i)%len(replicas)]
+	}
+	return order
+}
+
+// pick returns the next healthy replica or nil if none is healthy.
+func (rs *replicaSet) pick() *replica {
+	for _, r := range rs.rotation() {
+		if r.isHealthy() {
+			return r
+		}
+	}
+	return nil
+}
+
+// catchUpTimeout bounds the probes pickFor makes while a request waits.
+const catchUpTimeout = 200 * time.Millisecond
+
+// pickFor returns a healthy replica that has replayed the WAL up to target.
+// Replicas whose last known position is behind are probed concurrently for
+// their position, under a deadline of their own rather than the request's.
+// A target past the primary's current position, from before a failover,
+// is lowered to it first, no replica would ever reach it.
+// These probes only move the position forward, health is left to the
+// periodic probes: a slow or cancelled request never takes a replica out of
+// rotation. It returns nil if no replica has caught up.
+func (rs *replicaSet) pickFor(ctx context.Context, target LSN) *replica {
+	var behind []*replica
+	for _, r := range rs.rotation() {
+		if !r.isHealthy() {
+			continue
+		}
+		if r.replayedLSN() >= target {
+			return r
+		}
+		behind = append(behind, r)
+	}
+	if len(behind) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), min(rs.probeTimeout, catchUpTimeout))
+	defer cancel()
+	if rs.primaryLSN != nil {
+		if current, err := rs.primaryLSN(ctx); err == nil && current < target {
+			target = current
+			for _, r := range behind {
+				if r.replayedLSN() >= target {
+					return r
+				}
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range behind {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rs.refreshReplayed(ctx, r)
+		}()
+	}
+	wg.Wait()
+
+	for _, r := range behind {
+		if r.isHealthy() && r.replayedLSN() >= target {
+			return r
+		}
+	}
+	return nil
+}
+
+// refreshReplayed probes how far r has replayed the WAL, leaving its health
+// and the outcome of its last check as they are.
+func (rs *replicaSet) refreshReplayed(ctx context.Context, r *replica) {
+	replayed, _, err := r.probe(ctx)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	r.replayed = max(r.replayed, replayed)
+	r.mu.Unlock()
+}
+
+func (rs *replicaSet) statuses() []ReplicaStatus {
+	replicas := rs.members()
+	out := make([]ReplicaStatus, len(replicas))
+	for i, r := range replicas {
+		out[i] = r.status()
+	}
+	return out
+}
+
+// sqlReplicaProbe measures replay position and lag of a database/sql replica.
+// A server that is not in recovery has by definition replayed everything it wrote.
+// An idle primary produces no new transactions to replay, so a replica that has
+// replayed everything it received is reported as not lagging.
+func sqlReplicaProbe(db *sql.DB) replicaProbe {
+	return func(ctx context.Context) (LSN, time.Duration, error) {
+		var lsn string
+		var lagSeconds float64
+		err := db.QueryRowContext(ctx, replicaProbeQuery).Scan(&lsn, &lagSeconds)
+		if err != nil {
+			return 0, 0, err
+		}
+		replayed, err := ParseLSN(lsn)
+		if err != nil {
+			return 0, 0, err
+		}
+		return replayed, time.Duration(lagSeconds * float64(time.Second)), nil
+	}
+}
+
+const replicaProbeQuery = `SELECT
+	(CASE WHEN pg_is_in_recovery()
+		THEN COALESCE(pg_last_wal_replay_lsn(), '0/0'::pg_lsn)
+		ELSE pg_current_wal_lsn() END)::text,
+	(CASE WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn()
+		THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END)::float8`
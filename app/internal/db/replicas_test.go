@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeProbe struct {
+	replayed LSN
+	lag      time.Duration
+	err      error
+	calls    int
+}
+
+func (f *fakeProbe) probe(context.Context) (LSN, time.Duration, error) {
+	f.calls++
+	return f.replayed, f.lag, f.err
+}
+
+func newTestReplicaSet(maxLag time.Duration, probes ...*fakeProbe) *replicaSet {
+	var replicas []*replica
+	for i, p := range probes {
+		replicas = append(replicas, &replica{name: string(rune('a' + i)), probe: p.probe})
+	}
+	return newReplicaSet(replicas, maxLag, time.Second)
+}
+
+func TestReplicaSet_Rotation(t *testing.T) {
+	a, b, c := &fakeProbe{}, &fakeProbe{err: errors.New("connection refused")}, &fakeProbe{}
+	rs := newTestReplicaSet(0, a, b, c)
+	rs.checkAll(context.Background())
+
+	seen := map[string]int{}
+	for range 6 {
+		r := rs.pick()
+		if r == nil {
+			t.Fatal("expected a healthy replica")
+		}
+		seen[r.name]++
+	}
+	if seen["b"] != 0 {
+		t.Errorf("unhealthy replica was picked %d times", seen["b"])
+	}
+	if seen["a"] == 0 || seen["c"] == 0 {
+		t.Errorf("healthy replicas not balanced: %v", seen)
+	}
+
+	b.err = nil
+	rs.checkAll(context.Background())
+	for range 3 {
+		if r := rs.pick(); r.name == "b" {
+			return
+		}
+	}
+	t.Error("recovered replica was not put back into rotation")
+}
+
+func TestReplicaSet_FallbackWhenNoneHealthy(t *testing.T) {
+	rs := newTestReplicaSet(0, &fakeProbe{err: errors.New("down")})
+	rs.checkAll(context.Background())
+
+	if r := rs.pick(); r != nil {
+		t.Errorf("pick() = %s, want nil", r.name)
+	}
+	if r := newTestReplicaSet(0).pick(); r != nil {
+		t.Errorf("pick() without replicas = %s, want nil", r.name)
+	}
+}
+
+func TestReplicaSet_MaxLag(t *testing.T) {
+	p := &fakeProbe{lag: 30 * time.Second}
+	rs := newTestReplicaSet(10*time.Second, p)
+	rs.checkAll(context.Background())
+
+	st := rs.statuses()[0]
+	if st.Healthy {
+		t.Error("lagging replica reported healthy")
+	}
+	if st.Lag != 30*time.Second || st.LastError == "" {
+		t.Errorf("status = %+v, want lag 30s and an error", st)
+	}
+
+	p.lag = time.Second
+	rs.checkAll(context.Background())
+	if st := rs.statuses()[0]; !st.Healthy || st.LastError != "" {
+		t.Errorf("status = %+v, want healthy", st)
+	}
+}
+
+func TestReplicaSet_PickFor(t *testing.T) {
+	behind, caughtUp := &fakeProbe{replayed: 100}, &fakeProbe{replayed: 200}
+	rs := newTestReplicaSet(0, behind, caughtUp)
+	rs.checkAll(context.Background())
+
+	for range 4 {
+		r := rs.pickFor(context.Background(), 150)
+		if r == nil || r.name != "b" {
+			t.Fatalf("pickFor(150) = %v, want replica b", r)
+		}
+	}
+
+	if r := rs.pickFor(context.Background(), 300); r != nil {
+		t.Errorf("pickFor(300) = %s, want nil", r.name)
+	}
+
+	// a replica that catches up is re-probed on demand
+	behind.replayed = 400
+	if r := rs.pickFor(context.Background(), 300); r == nil || r.name != "a" {
+		t.Errorf("pickFor(300) after catch up = %v, want replica a", r)
+	}
+}
+
+func TestReplicaSet_PickForKeepsHealth(t *testing.T) {
+	p := &fakeProbe{replayed: 100}
+	rs := newTestReplicaSet(10*time.Second, p)
+	rs.checkAll(context.Background())
+
+	// a request cancelled while the replica is probed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.replayed = 200
+	if r := rs.pickFor(ctx, 150); r == nil || r.name != "a" {
+		t.Errorf("pickFor(150) with a cancelled context = %v, want replica a", r)
+	}
+
+	// probes on the request path don't eject replicas, the periodic ones do
+	p.err = errors.New("connection refused")
+	p.lag = time.Minute
+	if r := rs.pickFor(context.Background(), 300); r != nil {
+		t.Errorf("pickFor(300) = %s, want nil", r.name)
+	}
+	if st := rs.statuses()[0]; !st.Healthy || st.LastError != "" || st.Lag != 0 {
+		t.Errorf("status after failed probe on the request path = %+v, want healthy", st)
+	}
+}
+
+func TestReplicaSet_PickForPastThePrimary(t *testing.T) {
+	p := &fakeProbe{replayed: 100}
+	rs := newTestReplicaSet(0, p)
+	rs.checkAll(context.Background())
+	rs.primaryLSN = func(context.Context) (LSN, error) { return 100, nil }
+
+	// a token from before a failover, the new primary is behind it
+	if r := rs.pickFor(context.Background(), 500); r == nil || r.name != "a" {
+		t.Errorf("pickFor(500) with the primary at 100 = %v, want replica a", r)
+	}
+	if p.calls != 1 {
+		t.Errorf("replica probed %d times, want only by checkAll", p.calls)
+	}
+
+	rs.primaryLSN = func(context.Context) (LSN, error) { return 600, nil }
+	if r := rs.pickFor(context.Background(), 500); r != nil {
+		t.Errorf("pickFor(500) with the primary at 600 = %s, want nil", r.name)
+	}
+}
+
+func TestReplicaSet_PickForTimeout(t *testing.T) {
+	rs := newReplicaSet([]*replica{{
+		name: "slow",
+		probe: func(ctx context.Context) (LSN, time.Duration, error) {
+			<-ctx.Done()
+			return 0, 0, ctx.Err()
+		},
+	}}, 0, time.Minute)
+	rs.replicas[0].healthy = true
+
+	start := time.Now()
+	if r := rs.pickFor(context.Background(), 100); r != nil {
+		t.Errorf("pickFor(100) = %s, want nil", r.name)
+	}
+	if d := time.Since(start); d > 5*catchUpTimeout {
+		t.Errorf("pickFor took %s, want it bounded by %s", d, catchUpTimeout)
+	}
+}
+
+func TestReplicaSet_Replace(t *testing.T) {
+	closed := map[string]bool{}
+	open := func(name, dsn string) (*replica, error) {
+		if dsn == "unreachable" {
+			return nil, errors.New("invalid DSN")
+		}
+		p := &fakeProbe{}
+		return &replica{name: name, dsn: dsn, probe: p.probe, close: func() error {
+			closed[dsn] = true
+			return nil
+		}}, nil
+	}
+	rs := newReplicaSet(nil, 0, time.Second)
+	ctx := context.Background()
+
+	if err := rs.replace(ctx, []string{"a", "b"}, open); err != nil {
+		t.Fatal(err)
+	}
+	before := rs.members()
+	if len(before) != 2 || rs.pick() == nil {
+		t.Fatalf("replicas = %v, want two in rotation", before)
+	}
+
+	if err := rs.replace(ctx, []string{"b", "c"}, open); err != nil {
+		t.Fatal(err)
+	}
+	after := rs.members()
+	if len(after) != 2 || after[0] != before[1] {
+		t.Errorf("replica b was not kept: %v", after)
+	}
+	if after[1].name != "replica-2" || !after[1].isHealthy() {
+		t.Errorf("added replica = %+v, want replica-2 probed healthy", after[1].status())
+	}
+	if !closed["a"] || closed["b"] {
+		t.Errorf("closed = %v, want only the removed replica closed", closed)
+	}
+
+	if err := rs.replace(ctx, []string{"d", "unreachable"}, open); err == nil {
+		t.Fatal("replace with an unreachable replica succeeded")
+	}
+	if got := rs.members(); len(got) != 2 || got[0] != after[0] || got[1] != after[1] {
+		t.Errorf("replicas changed by a failed replace: %v", got)
+	}
+	if !closed["d"] {
+		t.Error("replica opened by a failed replace was not closed")
+	}
+}
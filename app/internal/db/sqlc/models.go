@@ -9,6 +9,26 @@ import (
 	"time"
 )
 
+type AuditHead struct {
+	ID   bool   `db:"id"`
+	Seq  int64  `db:"seq"`
+	Hash []byte `db:"hash"`
+}
+
+type AuditLog struct {
+	Seq       int64          `db:"seq"`
+	CreatedAt time.Time      `db:"created_at"`
+	Event     string         `db:"event"`
+	Actor     string         `db:"actor"`
+	Snippet   sql.NullString `db:"snippet"`
+	ClientIP  sql.NullString `db:"client_ip"`
+	UserAgent sql.NullString `db:"user_agent"`
+	RequestID sql.NullString `db:"request_id"`
+	Details   sql.NullString `db:"details"`
+	PrevHash  []byte         `db:"prev_hash"`
+	Hash      []byte         `db:"hash"`
+}
+
 type Snippet struct {
 	ID           int32          `db:"id"`
 	PublicID     string         `db:"public_id"`
@@ -19,10 +39,23 @@ type Snippet struct {
 	EditToken    string         `db:"edit_token"`
 	ViewCount    int32          `db:"view_count"`
 	LastEditedAt sql.NullTime   `db:"last_edited_at"`
+	Slug         sql.NullString `db:"slug"`
+	DeletedAt    sql.NullTime   `db:"deleted_at"`
+}
+
+type SnippetBody struct {
+	ID               int32          `db:"id"`
+	ContentHash      []byte         `db:"content_hash"`
+	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+	RefCount         int32          `db:"ref_count"`
+	LastUsedAt       time.Time      `db:"last_used_at"`
 }
 
 type SnippetContent struct {
-	SnippetID        int32  `db:"snippet_id"`
-	ContentType      string `db:"content_type"`
-	EncryptedContent []byte `db:"encrypted_content"`
+	SnippetID        int32          `db:"snippet_id"`
+	ContentType      string         `db:"content_type"`
+	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+	BodyID           sql.NullInt32  `db:"body_id"`
 }
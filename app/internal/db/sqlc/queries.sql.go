@@ -11,108 +11,300 @@ import (
 	"time"
 )
 
+const createAuditEntry = `-- name: CreateAuditEntry :exec
+INSERT INTO audit_log (
+    seq,
+    created_at,
+    event,
+    actor,
+    snippet,
+    client_ip,
+    user_agent,
+    request_id,
+    details,
+    prev_hash,
+    hash
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+)
+`
+
+type CreateAuditEntryParams struct {
+	Seq       int64          `db:"seq"`
+	CreatedAt time.Time      `db:"created_at"`
+	Event     string         `db:"event"`
+	Actor     string         `db:"actor"`
+	Snippet   sql.NullString `db:"snippet"`
+	ClientIP  sql.NullString `db:"client_ip"`
+	UserAgent sql.NullString `db:"user_agent"`
+	RequestID sql.NullString `db:"request_id"`
+	Details   sql.NullString `db:"details"`
+	PrevHash  []byte         `db:"prev_hash"`
+	Hash      []byte         `db:"hash"`
+}
+
+func (q *Queries) CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) error {
+	_, err := q.db.ExecContext(ctx, createAuditEntry,
+		arg.Seq,
+		arg.CreatedAt,
+		arg.Event,
+		arg.Actor,
+		arg.Snippet,
+		arg.ClientIP,
+		arg.UserAgent,
+		arg.RequestID,
+		arg.Details,
+		arg.PrevHash,
+		arg.Hash,
+	)
+	return err
+}
+
 const createSnippet = `-- name: CreateSnippet :one
 WITH new_snippet AS (
     INSERT INTO snippets (
+        public_id,
+        slug,
         title, 
         expires_at, 
         password_hash, 
         edit_token
     ) VALUES (
-        $1, $2, $3, $4
+        $1, $2, $3, $4, $5, $6
     )
-    RETURNING id, public_id, created_at, edit_token
+    RETURNING id, public_id, slug, created_at, edit_token
 )
 INSERT INTO snippet_contents (
     snippet_id,
     content_type,
-    encrypted_content
+    encrypted_content,
+    blob_key,
+    body_id
 ) 
 SELECT 
-    id, $5, $6
+    id, $7, $8, $9, $10
 FROM new_snippet
 RETURNING snippet_id,
           (SELECT public_id FROM new_snippet),
+          (SELECT slug FROM new_snippet),
           (SELECT created_at FROM new_snippet),
           (SELECT edit_token FROM new_snippet)
 `
 
 type CreateSnippetParams struct {
+	PublicID         string         `db:"public_id"`
+	Slug             sql.NullString `db:"slug"`
 	Title            sql.NullString `db:"title"`
 	ExpiresAt        sql.NullTime   `db:"expires_at"`
 	PasswordHash     sql.NullString `db:"password_hash"`
 	EditToken        string         `db:"edit_token"`
 	ContentType      string         `db:"content_type"`
 	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+	BodyID           sql.NullInt32  `db:"body_id"`
 }
 
 type CreateSnippetRow struct {
-	SnippetID int32     `db:"snippet_id"`
-	PublicID  string    `db:"public_id"`
-	CreatedAt time.Time `db:"created_at"`
-	EditToken string    `db:"edit_token"`
+	SnippetID int32          `db:"snippet_id"`
+	PublicID  string         `db:"public_id"`
+	Slug      sql.NullString `db:"slug"`
+	CreatedAt time.Time      `db:"created_at"`
+	EditToken string         `db:"edit_token"`
 }
 
 // Creates a new snippet
 func (q *Queries) CreateSnippet(ctx context.Context, arg CreateSnippetParams) (CreateSnippetRow, error) {
 	row := q.db.QueryRowContext(ctx, createSnippet,
+		arg.PublicID,
+		arg.Slug,
 		arg.Title,
 		arg.ExpiresAt,
 		arg.PasswordHash,
 		arg.EditToken,
 		arg.ContentType,
 		arg.EncryptedContent,
+		arg.BlobKey,
+		arg.BodyID,
 	)
 	var i CreateSnippetRow
 	err := row.Scan(
 		&i.SnippetID,
 		&i.PublicID,
+		&i.Slug,
 		&i.CreatedAt,
 		&i.EditToken,
 	)
 	return i, err
 }
 
-const deleteExpiredSnippets = `-- name: DeleteExpiredSnippets :execrows
-DELETE FROM snippets
-WHERE expires_at IS NOT NULL AND expires_at < NOW()
+const createSnippetBody = `-- name: CreateSnippetBody :one
+INSERT INTO snippet_bodies (
+    content_hash,
+    encrypted_content,
+    blob_key
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT (content_hash) DO UPDATE SET last_used_at = NOW()
+RETURNING id, blob_key
 `
 
-// Deletes all snippets that have expired
-func (q *Queries) DeleteExpiredSnippets(ctx context.Context) (int64, error) {
-	result, err := q.db.ExecContext(ctx, deleteExpiredSnippets)
+type CreateSnippetBodyParams struct {
+	ContentHash      []byte         `db:"content_hash"`
+	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+}
+
+type CreateSnippetBodyRow struct {
+	ID      int32          `db:"id"`
+	BlobKey sql.NullString `db:"blob_key"`
+}
+
+// Stores a shared body. If one with the same hash was stored concurrently
+// that one is kept and marked as used, the returned blob key tells which.
+func (q *Queries) CreateSnippetBody(ctx context.Context, arg CreateSnippetBodyParams) (CreateSnippetBodyRow, error) {
+	row := q.db.QueryRowContext(ctx, createSnippetBody, arg.ContentHash, arg.EncryptedContent, arg.BlobKey)
+	var i CreateSnippetBodyRow
+	err := row.Scan(&i.ID, &i.BlobKey)
+	return i, err
+}
+
+const deleteExpiredSnippets = `-- name: DeleteExpiredSnippets :many
+WITH deleted AS (
+    DELETE FROM snippets
+    WHERE expires_at IS NOT NULL AND expires_at < NOW()
+    RETURNING id
+)
+SELECT c.blob_key
+FROM snippet_contents c
+JOIN deleted d ON d.id = c.snippet_id
+`
+
+// Deletes all snippets that have expired, returning one blob key per snippet.
+// The SELECT sees the snapshot from before the DELETE, contents included.
+func (q *Queries) DeleteExpiredSnippets(ctx context.Context) ([]sql.NullString, error) {
+	rows, err := q.db.QueryContext(ctx, deleteExpiredSnippets)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return result.RowsAffected()
+	defer rows.Close()
+	items := []sql.NullString{}
+	for rows.Next() {
+		var blob_key sql.NullString
+		if err := rows.Scan(&blob_key); err != nil {
+			return nil, err
+		}
+		items = append(items, blob_key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const deleteSnippetById = `-- name: DeleteSnippetById :execrows
-DELETE FROM snippets 
-WHERE id = $1
+const deleteSnippetById = `-- name: DeleteSnippetById :many
+WITH deleted AS (
+    DELETE FROM snippets
+    WHERE id = $1
+    RETURNING id
+)
+SELECT c.blob_key
+FROM snippet_contents c
+JOIN deleted d ON d.id = c.snippet_id
+`
+
+// Permanently deletes a snippet by id, returning its blob key
+func (q *Queries) DeleteSnippetById(ctx context.Context, id int32) ([]sql.NullString, error) {
+	rows, err := q.db.QueryContext(ctx, deleteSnippetById, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []sql.NullString{}
+	for rows.Next() {
+		var blob_key sql.NullString
+		if err := rows.Scan(&blob_key); err != nil {
+			return nil, err
+		}
+		items = append(items, blob_key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const expireSnippet = `-- name: ExpireSnippet :execrows
+UPDATE snippets
+SET expires_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
 `
 
-// Deletes a snippet by id
-func (q *Queries) DeleteSnippetById(ctx context.Context, id int32) (int64, error) {
-	result, err := q.db.ExecContext(ctx, deleteSnippetById, id)
+// Makes a live snippet expire now, unless it already expires earlier
+func (q *Queries) ExpireSnippet(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, expireSnippet, id)
 	if err != nil {
 		return 0, err
 	}
 	return result.RowsAffected()
 }
 
+const getAuditHead = `-- name: GetAuditHead :one
+SELECT seq, hash
+FROM audit_head
+`
+
+type GetAuditHeadRow struct {
+	Seq  int64  `db:"seq"`
+	Hash []byte `db:"hash"`
+}
+
+func (q *Queries) GetAuditHead(ctx context.Context) (GetAuditHeadRow, error) {
+	row := q.db.QueryRowContext(ctx, getAuditHead)
+	var i GetAuditHeadRow
+	err := row.Scan(&i.Seq, &i.Hash)
+	return i, err
+}
+
+const getSnippetBlobKey = `-- name: GetSnippetBlobKey :one
+SELECT blob_key
+FROM snippet_contents
+WHERE snippet_id = $1
+FOR UPDATE
+`
+
+// Locks the content of a snippet and returns its blob key
+func (q *Queries) GetSnippetBlobKey(ctx context.Context, snippetID int32) (sql.NullString, error) {
+	row := q.db.QueryRowContext(ctx, getSnippetBlobKey, snippetID)
+	var blob_key sql.NullString
+	err := row.Scan(&blob_key)
+	return blob_key, err
+}
+
 const getSnippetByPublicID = `-- name: GetSnippetByPublicID :one
-SELECT s.id, s.public_id, s.title, s.created_at, s.expires_at, s.password_hash, s.edit_token, s.view_count, s.last_edited_at,
-       c.content_type, c.encrypted_content
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at, s.password_hash, s.edit_token, s.view_count, s.last_edited_at, s.deleted_at,
+       c.content_type,
+       COALESCE(b.encrypted_content, c.encrypted_content) AS encrypted_content,
+       COALESCE(b.blob_key, c.blob_key) AS blob_key,
+       b.content_hash
 FROM snippets s
 JOIN snippet_contents c ON s.id = c.snippet_id
-WHERE s.public_id = $1 
+LEFT JOIN snippet_bodies b ON b.id = c.body_id
+WHERE s.public_id = $1 OR s.slug = $1
+ORDER BY s.public_id = $1 DESC
 LIMIT 1
 `
 
 type GetSnippetByPublicIDRow struct {
 	ID               int32          `db:"id"`
 	PublicID         string         `db:"public_id"`
+	Slug             sql.NullString `db:"slug"`
 	Title            sql.NullString `db:"title"`
 	CreatedAt        time.Time      `db:"created_at"`
 	ExpiresAt        sql.NullTime   `db:"expires_at"`
@@ -120,17 +312,23 @@ type GetSnippetByPublicIDRow struct {
 	EditToken        string         `db:"edit_token"`
 	ViewCount        int32          `db:"view_count"`
 	LastEditedAt     sql.NullTime   `db:"last_edited_at"`
+	DeletedAt        sql.NullTime   `db:"deleted_at"`
 	ContentType      string         `db:"content_type"`
 	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+	ContentHash      []byte         `db:"content_hash"`
 }
 
-// Retrieves a snippet by its public ID
+// Retrieves a snippet by its public ID or its slug, deleted ones included.
+// A public ID wins over the same slug of another snippet.
+// The content of deduplicated snippets comes from their shared body.
 func (q *Queries) GetSnippetByPublicID(ctx context.Context, publicID string) (GetSnippetByPublicIDRow, error) {
 	row := q.db.QueryRowContext(ctx, getSnippetByPublicID, publicID)
 	var i GetSnippetByPublicIDRow
 	err := row.Scan(
 		&i.ID,
 		&i.PublicID,
+		&i.Slug,
 		&i.Title,
 		&i.CreatedAt,
 		&i.ExpiresAt,
@@ -138,12 +336,122 @@ func (q *Queries) GetSnippetByPublicID(ctx context.Context, publicID string) (Ge
 		&i.EditToken,
 		&i.ViewCount,
 		&i.LastEditedAt,
+		&i.DeletedAt,
 		&i.ContentType,
 		&i.EncryptedContent,
+		&i.BlobKey,
+		&i.ContentHash,
+	)
+	return i, err
+}
+
+const getSnippetStats = `-- name: GetSnippetStats :one
+SELECT COUNT(*) AS total,
+       COUNT(*) FILTER (WHERE s.deleted_at IS NOT NULL) AS deleted,
+       COUNT(*) FILTER (WHERE s.deleted_at IS NULL AND s.expires_at < NOW()) AS expired,
+       COUNT(*) FILTER (WHERE s.password_hash IS NOT NULL) AS protected,
+       COALESCE(SUM(s.view_count), 0)::bigint AS views,
+       (SELECT COUNT(*) FROM snippet_contents WHERE blob_key IS NOT NULL) AS blobs,
+       (SELECT COUNT(*) FROM snippet_bodies) AS bodies
+FROM snippets s
+`
+
+type GetSnippetStatsRow struct {
+	Total     int64 `db:"total"`
+	Deleted   int64 `db:"deleted"`
+	Expired   int64 `db:"expired"`
+	Protected int64 `db:"protected"`
+	Views     int64 `db:"views"`
+	Blobs     int64 `db:"blobs"`
+	Bodies    int64 `db:"bodies"`
+}
+
+// Counts snippets by state, along with the content stored out of line
+func (q *Queries) GetSnippetStats(ctx context.Context) (GetSnippetStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getSnippetStats)
+	var i GetSnippetStatsRow
+	err := row.Scan(
+		&i.Total,
+		&i.Deleted,
+		&i.Expired,
+		&i.Protected,
+		&i.Views,
+		&i.Blobs,
+		&i.Bodies,
 	)
 	return i, err
 }
 
+const importSnippet = `-- name: ImportSnippet :one
+WITH new_snippet AS (
+    INSERT INTO snippets (
+        public_id,
+        slug,
+        title,
+        created_at,
+        expires_at,
+        password_hash,
+        edit_token,
+        view_count,
+        last_edited_at,
+        deleted_at
+    ) VALUES (
+        $4, $5, $6, $7, $8, $9,
+        $10, $11, $12, $13
+    )
+    RETURNING id
+)
+INSERT INTO snippet_contents (
+    snippet_id,
+    content_type,
+    encrypted_content,
+    blob_key
+)
+SELECT
+    id, $1, $2, $3
+FROM new_snippet
+RETURNING snippet_id
+`
+
+type ImportSnippetParams struct {
+	ContentType      string         `db:"content_type"`
+	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+	PublicID         string         `db:"public_id"`
+	Slug             sql.NullString `db:"slug"`
+	Title            sql.NullString `db:"title"`
+	CreatedAt        time.Time      `db:"created_at"`
+	ExpiresAt        sql.NullTime   `db:"expires_at"`
+	PasswordHash     sql.NullString `db:"password_hash"`
+	EditToken        string         `db:"edit_token"`
+	ViewCount        int32          `db:"view_count"`
+	LastEditedAt     sql.NullTime   `db:"last_edited_at"`
+	DeletedAt        sql.NullTime   `db:"deleted_at"`
+}
+
+// Creates a snippet exported from another database, keeping its timestamps,
+// view count and tombstone
+func (q *Queries) ImportSnippet(ctx context.Context, arg ImportSnippetParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, importSnippet,
+		arg.ContentType,
+		arg.EncryptedContent,
+		arg.BlobKey,
+		arg.PublicID,
+		arg.Slug,
+		arg.Title,
+		arg.CreatedAt,
+		arg.ExpiresAt,
+		arg.PasswordHash,
+		arg.EditToken,
+		arg.ViewCount,
+		arg.LastEditedAt,
+		arg.DeletedAt,
+	)
+	var snippet_id int32
+	err := row.Scan(&snippet_id)
+	return snippet_id, err
+}
+
 const incrementSnippetViewCount = `-- name: IncrementSnippetViewCount :one
 UPDATE snippets
 SET view_count = view_count + 1
@@ -159,9 +467,59 @@ func (q *Queries) IncrementSnippetViewCount(ctx context.Context, id int32) (int3
 	return view_count, err
 }
 
+const listAuditEntries = `-- name: ListAuditEntries :many
+SELECT seq, created_at, event, actor, snippet, client_ip, user_agent, request_id, details, prev_hash, hash
+FROM audit_log
+WHERE seq > $1
+ORDER BY seq
+LIMIT $2
+`
+
+type ListAuditEntriesParams struct {
+	AfterSeq int64 `db:"after_seq"`
+	MaxRows  int32 `db:"max_rows"`
+}
+
+// Pages through the audit log in order, for verification
+func (q *Queries) ListAuditEntries(ctx context.Context, arg ListAuditEntriesParams) ([]AuditLog, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEntries, arg.AfterSeq, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditLog{}
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.Seq,
+			&i.CreatedAt,
+			&i.Event,
+			&i.Actor,
+			&i.Snippet,
+			&i.ClientIP,
+			&i.UserAgent,
+			&i.RequestID,
+			&i.Details,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listRecentSnippets = `-- name: ListRecentSnippets :many
-SELECT s.id, s.public_id, s.title, s.created_at, s.expires_at 
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at 
 FROM snippets s
+WHERE s.deleted_at IS NULL
 ORDER BY s.created_at DESC
 LIMIT $1
 `
@@ -169,6 +527,7 @@ LIMIT $1
 type ListRecentSnippetsRow struct {
 	ID        int32          `db:"id"`
 	PublicID  string         `db:"public_id"`
+	Slug      sql.NullString `db:"slug"`
 	Title     sql.NullString `db:"title"`
 	CreatedAt time.Time      `db:"created_at"`
 	ExpiresAt sql.NullTime   `db:"expires_at"`
@@ -187,6 +546,7 @@ func (q *Queries) ListRecentSnippets(ctx context.Context, limit int32) ([]ListRe
 		if err := rows.Scan(
 			&i.ID,
 			&i.PublicID,
+			&i.Slug,
 			&i.Title,
 			&i.CreatedAt,
 			&i.ExpiresAt,
@@ -204,6 +564,346 @@ func (q *Queries) ListRecentSnippets(ctx context.Context, limit int32) ([]ListRe
 	return items, nil
 }
 
+const listSnippetBodies = `-- name: ListSnippetBodies :many
+SELECT id, content_hash, encrypted_content, blob_key
+FROM snippet_bodies
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListSnippetBodiesParams struct {
+	AfterID int32 `db:"after_id"`
+	MaxRows int32 `db:"max_rows"`
+}
+
+type ListSnippetBodiesRow struct {
+	ID               int32          `db:"id"`
+	ContentHash      []byte         `db:"content_hash"`
+	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+}
+
+// Lists shared bodies in id order from after the given id
+func (q *Queries) ListSnippetBodies(ctx context.Context, arg ListSnippetBodiesParams) ([]ListSnippetBodiesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSnippetBodies, arg.AfterID, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListSnippetBodiesRow{}
+	for rows.Next() {
+		var i ListSnippetBodiesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.ContentHash,
+			&i.EncryptedContent,
+			&i.BlobKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSnippets = `-- name: ListSnippets :many
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at, s.password_hash, s.edit_token, s.view_count, s.last_edited_at, s.deleted_at,
+       c.content_type,
+       COALESCE(b.encrypted_content, c.encrypted_content) AS encrypted_content,
+       COALESCE(b.blob_key, c.blob_key) AS blob_key,
+       b.content_hash,
+       c.body_id
+FROM snippets s
+JOIN snippet_contents c ON s.id = c.snippet_id
+LEFT JOIN snippet_bodies b ON b.id = c.body_id
+WHERE s.id > $1
+ORDER BY s.id
+LIMIT $2
+`
+
+type ListSnippetsParams struct {
+	AfterID int32 `db:"after_id"`
+	MaxRows int32 `db:"max_rows"`
+}
+
+type ListSnippetsRow struct {
+	ID               int32          `db:"id"`
+	PublicID         string         `db:"public_id"`
+	Slug             sql.NullString `db:"slug"`
+	Title            sql.NullString `db:"title"`
+	CreatedAt        time.Time      `db:"created_at"`
+	ExpiresAt        sql.NullTime   `db:"expires_at"`
+	PasswordHash     sql.NullString `db:"password_hash"`
+	EditToken        string         `db:"edit_token"`
+	ViewCount        int32          `db:"view_count"`
+	LastEditedAt     sql.NullTime   `db:"last_edited_at"`
+	DeletedAt        sql.NullTime   `db:"deleted_at"`
+	ContentType      string         `db:"content_type"`
+	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+	ContentHash      []byte         `db:"content_hash"`
+	BodyID           sql.NullInt32  `db:"body_id"`
+}
+
+// Lists snippets in id order from after the given id, deleted ones included,
+// for admin tasks that walk all of them. The content is resolved like
+// GetSnippetByPublicID does, body_id tells whether it is shared.
+func (q *Queries) ListSnippets(ctx context.Context, arg ListSnippetsParams) ([]ListSnippetsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSnippets, arg.AfterID, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListSnippetsRow{}
+	for rows.Next() {
+		var i ListSnippetsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.PublicID,
+			&i.Slug,
+			&i.Title,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.PasswordHash,
+			&i.EditToken,
+			&i.ViewCount,
+			&i.LastEditedAt,
+			&i.DeletedAt,
+			&i.ContentType,
+			&i.EncryptedContent,
+			&i.BlobKey,
+			&i.ContentHash,
+			&i.BodyID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockAuditHead = `-- name: LockAuditHead :one
+SELECT seq, hash
+FROM audit_head
+FOR UPDATE
+`
+
+type LockAuditHeadRow struct {
+	Seq  int64  `db:"seq"`
+	Hash []byte `db:"hash"`
+}
+
+// Returns the last entry of the audit log and serializes appends until the
+// transaction ends, an entry needs the hash of the one before it
+func (q *Queries) LockAuditHead(ctx context.Context) (LockAuditHeadRow, error) {
+	row := q.db.QueryRowContext(ctx, lockAuditHead)
+	var i LockAuditHeadRow
+	err := row.Scan(&i.Seq, &i.Hash)
+	return i, err
+}
+
+const purgeDeletedSnippets = `-- name: PurgeDeletedSnippets :many
+WITH purged AS (
+    DELETE FROM snippets
+    WHERE deleted_at IS NOT NULL AND deleted_at < $1
+    RETURNING id
+)
+SELECT c.blob_key
+FROM snippet_contents c
+JOIN purged p ON p.id = c.snippet_id
+`
+
+// Permanently deletes snippets deleted before the given time, returning one
+// blob key per snippet
+func (q *Queries) PurgeDeletedSnippets(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error) {
+	rows, err := q.db.QueryContext(ctx, purgeDeletedSnippets, deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []sql.NullString{}
+	for rows.Next() {
+		var blob_key sql.NullString
+		if err := rows.Scan(&blob_key); err != nil {
+			return nil, err
+		}
+		items = append(items, blob_key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeUnusedSnippetBodies = `-- name: PurgeUnusedSnippetBodies :many
+DELETE FROM snippet_bodies
+WHERE ref_count = 0 AND last_used_at < $1
+RETURNING blob_key
+`
+
+// Deletes bodies no snippet has referenced since the given time, returning
+// their blob keys
+func (q *Queries) PurgeUnusedSnippetBodies(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error) {
+	rows, err := q.db.QueryContext(ctx, purgeUnusedSnippetBodies, usedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []sql.NullString{}
+	for rows.Next() {
+		var blob_key sql.NullString
+		if err := rows.Scan(&blob_key); err != nil {
+			return nil, err
+		}
+		items = append(items, blob_key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const restoreSnippet = `-- name: RestoreSnippet :execrows
+UPDATE snippets
+SET deleted_at = NULL
+WHERE id = $1 AND deleted_at >= $2
+`
+
+type RestoreSnippetParams struct {
+	ID           int32        `db:"id"`
+	DeletedAfter sql.NullTime `db:"deleted_after"`
+}
+
+// Clears the tombstone of a snippet deleted after the given time
+func (q *Queries) RestoreSnippet(ctx context.Context, arg RestoreSnippetParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, restoreSnippet, arg.ID, arg.DeletedAfter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const searchSnippets = `-- name: SearchSnippets :many
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at, s.deleted_at
+FROM snippets s
+WHERE s.public_id = $1 OR s.slug = $1 OR strpos(lower(s.title), lower($1)) > 0
+ORDER BY s.created_at DESC, s.id DESC
+LIMIT $2
+`
+
+type SearchSnippetsParams struct {
+	Query   string `db:"query"`
+	MaxRows int32  `db:"max_rows"`
+}
+
+type SearchSnippetsRow struct {
+	ID        int32          `db:"id"`
+	PublicID  string         `db:"public_id"`
+	Slug      sql.NullString `db:"slug"`
+	Title     sql.NullString `db:"title"`
+	CreatedAt time.Time      `db:"created_at"`
+	ExpiresAt sql.NullTime   `db:"expires_at"`
+	DeletedAt sql.NullTime   `db:"deleted_at"`
+}
+
+// Finds snippets by public ID or slug, or by a case-insensitive part of their
+// title, deleted ones included (for admin purposes)
+func (q *Queries) SearchSnippets(ctx context.Context, arg SearchSnippetsParams) ([]SearchSnippetsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchSnippets, arg.Query, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchSnippetsRow{}
+	for rows.Next() {
+		var i SearchSnippetsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.PublicID,
+			&i.Slug,
+			&i.Title,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteSnippet = `-- name: SoftDeleteSnippet :execrows
+UPDATE snippets
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+// Marks a snippet as deleted, it can be restored until it is purged
+func (q *Queries) SoftDeleteSnippet(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteSnippet, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const touchSnippetBody = `-- name: TouchSnippetBody :one
+UPDATE snippet_bodies
+SET last_used_at = NOW()
+WHERE content_hash = $1
+RETURNING id
+`
+
+// Looks up a shared body by content hash and marks it as used, so the purge
+// job leaves it alone while a snippet is created with it
+func (q *Queries) TouchSnippetBody(ctx context.Context, contentHash []byte) (int32, error) {
+	row := q.db.QueryRowContext(ctx, touchSnippetBody, contentHash)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const updateAuditHead = `-- name: UpdateAuditHead :exec
+UPDATE audit_head
+SET seq = $1, hash = $2
+`
+
+type UpdateAuditHeadParams struct {
+	Seq  int64  `db:"seq"`
+	Hash []byte `db:"hash"`
+}
+
+func (q *Queries) UpdateAuditHead(ctx context.Context, arg UpdateAuditHeadParams) error {
+	_, err := q.db.ExecContext(ctx, updateAuditHead, arg.Seq, arg.Hash)
+	return err
+}
+
 const updateSnippet = `-- name: UpdateSnippet :one
 UPDATE snippets
 SET 
@@ -247,22 +947,79 @@ func (q *Queries) UpdateSnippet(ctx context.Context, arg UpdateSnippetParams) (U
 	return i, err
 }
 
+const updateSnippetBody = `-- name: UpdateSnippetBody :execrows
+UPDATE snippet_bodies
+SET
+    encrypted_content = $1,
+    blob_key = $2
+WHERE id = $3 AND blob_key IS NOT DISTINCT FROM $4
+`
+
+type UpdateSnippetBodyParams struct {
+	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+	ID               int32          `db:"id"`
+	OldBlobKey       sql.NullString `db:"old_blob_key"`
+}
+
+// Replaces the stored content of a shared body, its hash stays the same.
+// Nothing is updated unless the body is still stored under old_blob_key.
+func (q *Queries) UpdateSnippetBody(ctx context.Context, arg UpdateSnippetBodyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateSnippetBody,
+		arg.EncryptedContent,
+		arg.BlobKey,
+		arg.ID,
+		arg.OldBlobKey,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateSnippetContent = `-- name: UpdateSnippetContent :exec
 UPDATE snippet_contents
 SET 
     content_type = COALESCE($2, content_type),
-    encrypted_content = COALESCE($3, encrypted_content)
+    encrypted_content = COALESCE($3, encrypted_content),
+    blob_key = $4,
+    body_id = $5
 WHERE snippet_id = $1
 `
 
 type UpdateSnippetContentParams struct {
-	SnippetID        int32  `db:"snippet_id"`
-	ContentType      string `db:"content_type"`
-	EncryptedContent []byte `db:"encrypted_content"`
+	SnippetID        int32          `db:"snippet_id"`
+	ContentType      string         `db:"content_type"`
+	EncryptedContent []byte         `db:"encrypted_content"`
+	BlobKey          sql.NullString `db:"blob_key"`
+	BodyID           sql.NullInt32  `db:"body_id"`
 }
 
-// Updates the content of a snippet
+// Updates the content of a snippet, the blob key and body are always replaced
 func (q *Queries) UpdateSnippetContent(ctx context.Context, arg UpdateSnippetContentParams) error {
-	_, err := q.db.ExecContext(ctx, updateSnippetContent, arg.SnippetID, arg.ContentType, arg.EncryptedContent)
+	_, err := q.db.ExecContext(ctx, updateSnippetContent,
+		arg.SnippetID,
+		arg.ContentType,
+		arg.EncryptedContent,
+		arg.BlobKey,
+		arg.BodyID,
+	)
+	return err
+}
+
+const updateSnippetSlug = `-- name: UpdateSnippetSlug :exec
+UPDATE snippets
+SET slug = $2
+WHERE id = $1
+`
+
+type UpdateSnippetSlugParams struct {
+	ID   int32          `db:"id"`
+	Slug sql.NullString `db:"slug"`
+}
+
+// Sets or, with NULL, removes the slug of a snippet
+func (q *Queries) UpdateSnippetSlug(ctx context.Context, arg UpdateSnippetSlugParams) error {
+	_, err := q.db.ExecContext(ctx, updateSnippetSlug, arg.ID, arg.Slug)
 	return err
 }
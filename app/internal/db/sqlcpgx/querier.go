@@ -0,0 +1,82 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+
+package sqlcpgx
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Querier interface {
+	CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) error
+	// Creates a new snippet
+	CreateSnippet(ctx context.Context, arg CreateSnippetParams) (CreateSnippetRow, error)
+	// Stores a shared body. If one with the same hash was stored concurrently
+	// that one is kept and marked as used, the returned blob key tells which.
+	CreateSnippetBody(ctx context.Context, arg CreateSnippetBodyParams) (CreateSnippetBodyRow, error)
+	// Deletes all snippets that have expired, returning one blob key per snippet.
+	// The SELECT sees the snapshot from before the DELETE, contents included.
+	DeleteExpiredSnippets(ctx context.Context) ([]sql.NullString, error)
+	// Permanently deletes a snippet by id, returning its blob key
+	DeleteSnippetById(ctx context.Context, id int32) ([]sql.NullString, error)
+	// Makes a live snippet expire now, unless it already expires earlier
+	ExpireSnippet(ctx context.Context, id int32) (int64, error)
+	GetAuditHead(ctx context.Context) (GetAuditHeadRow, error)
+	// Locks the content of a snippet and returns its blob key
+	GetSnippetBlobKey(ctx context.Context, snippetID int32) (sql.NullString, error)
+	// Retrieves a snippet by its public ID or its slug, deleted ones included.
+	// A public ID wins over the same slug of another snippet.
+	// The content of deduplicated snippets comes from their shared body.
+	GetSnippetByPublicID(ctx context.Context, publicID string) (GetSnippetByPublicIDRow, error)
+	// Counts snippets by state, along with the content stored out of line
+	GetSnippetStats(ctx context.Context) (GetSnippetStatsRow, error)
+	// Creates a snippet exported from another database, keeping its timestamps,
+	// view count and tombstone
+	ImportSnippet(ctx context.Context, arg ImportSnippetParams) (int32, error)
+	// Increments the view count for a snippet
+	IncrementSnippetViewCount(ctx context.Context, id int32) (int32, error)
+	// Pages through the audit log in order, for verification
+	ListAuditEntries(ctx context.Context, arg ListAuditEntriesParams) ([]AuditLog, error)
+	// Lists recently created snippets (for admin purposes)
+	ListRecentSnippets(ctx context.Context, limit int32) ([]ListRecentSnippetsRow, error)
+	// Lists shared bodies in id order from after the given id
+	ListSnippetBodies(ctx context.Context, arg ListSnippetBodiesParams) ([]ListSnippetBodiesRow, error)
+	// Lists snippets in id order from after the given id, deleted ones included,
+	// for admin tasks that walk all of them. The content is resolved like
+	// GetSnippetByPublicID does, body_id tells whether it is shared.
+	ListSnippets(ctx context.Context, arg ListSnippetsParams) ([]ListSnippetsRow, error)
+	// Returns the last entry of the audit log and serializes appends until the
+	// transaction ends, an entry needs the hash of the one before it
+	LockAuditHead(ctx context.Context) (LockAuditHeadRow, error)
+	// Permanently deletes snippets deleted before the given time, returning one
+	// blob key per snippet
+	PurgeDeletedSnippets(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error)
+	// Deletes bodies no snippet has referenced since the given time, returning
+	// their blob keys
+	PurgeUnusedSnippetBodies(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error)
+	// Clears the tombstone of a snippet deleted after the given time
+	RestoreSnippet(ctx context.Context, arg RestoreSnippetParams) (int64, error)
+	// Finds snippets by public ID or slug, or by a case-insensitive part of their
+	// title, deleted ones included (for admin purposes)
+	SearchSnippets(ctx context.Context, arg SearchSnippetsParams) ([]SearchSnippetsRow, error)
+	// Marks a snippet as deleted, it can be restored until it is purged
+	SoftDeleteSnippet(ctx context.Context, id int32) (int64, error)
+	// Looks up a shared body by content hash and marks it as used, so the purge
+	// job leaves it alone while a snippet is created with it
+	TouchSnippetBody(ctx context.Context, contentHash []byte) (int32, error)
+	UpdateAuditHead(ctx context.Context, arg UpdateAuditHeadParams) error
+	// Updates an existing snippet by ID
+	UpdateSnippet(ctx context.Context, arg UpdateSnippetParams) (UpdateSnippetRow, error)
+	// Replaces the stored content of a shared body, its hash stays the same.
+	// Nothing is updated unless the body is still stored under old_blob_key.
+	UpdateSnippetBody(ctx context.Context, arg UpdateSnippetBodyParams) (int64, error)
+	// Updates the content of a snippet, the blob key and body are always replaced
+	UpdateSnippetContent(ctx context.Context, arg UpdateSnippetContentParams) error
+	// Sets or, with NULL, removes the slug of a snippet
+	UpdateSnippetSlug(ctx context.Context, arg UpdateSnippetSlugParams) error
+}
+
+var _ Querier = (*Queries)(nil)
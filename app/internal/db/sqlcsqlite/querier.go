@@ -0,0 +1,92 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+
+package sqlcsqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Querier interface {
+	CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) error
+	// Creates a new snippet, the content is inserted by CreateSnippetContent
+	CreateSnippet(ctx context.Context, arg CreateSnippetParams) (int64, error)
+	// Stores a shared body. If one with the same hash was stored concurrently
+	// that one is kept and marked as used, the returned blob key tells which.
+	CreateSnippetBody(ctx context.Context, arg CreateSnippetBodyParams) (CreateSnippetBodyRow, error)
+	// Stores the content of a new snippet
+	CreateSnippetContent(ctx context.Context, arg CreateSnippetContentParams) error
+	// Deletes the contents of all snippets that expired before now, returning
+	// their blob keys. Run in a transaction with DeleteExpiredSnippets.
+	DeleteExpiredSnippetContents(ctx context.Context, now sql.NullTime) ([]sql.NullString, error)
+	// Deletes all snippets that expired before now
+	DeleteExpiredSnippets(ctx context.Context, now sql.NullTime) (int64, error)
+	// Permanently deletes a snippet by id
+	DeleteSnippetById(ctx context.Context, id int64) (int64, error)
+	// Deletes the content of a snippet, returning its blob key. Run in a
+	// transaction with DeleteSnippetById.
+	DeleteSnippetContentById(ctx context.Context, snippetID int64) ([]sql.NullString, error)
+	// Makes a live snippet expire now, unless it already expires earlier
+	ExpireSnippet(ctx context.Context, arg ExpireSnippetParams) (int64, error)
+	GetAuditHead(ctx context.Context) (GetAuditHeadRow, error)
+	// Returns the blob key of a snippet's content
+	GetSnippetBlobKey(ctx context.Context, snippetID int64) (sql.NullString, error)
+	// Retrieves a snippet by its public ID or its slug, deleted ones included.
+	// A public ID wins over the same slug of another snippet.
+	// The content of deduplicated snippets comes from their shared body.
+	// sqlc leaves @id as is past WHERE, ?1 is the parameter it becomes
+	GetSnippetByPublicID(ctx context.Context, id string) (GetSnippetByPublicIDRow, error)
+	// Counts snippets by state, along with the content stored out of line
+	GetSnippetStats(ctx context.Context, now sql.NullTime) (GetSnippetStatsRow, error)
+	// Creates a snippet exported from another database, keeping its timestamps,
+	// view count and tombstone. The content is inserted by CreateSnippetContent.
+	ImportSnippet(ctx context.Context, arg ImportSnippetParams) (int64, error)
+	// Increments the view count for a snippet
+	IncrementSnippetViewCount(ctx context.Context, id int64) (int64, error)
+	// Pages through the audit log in order, for verification
+	ListAuditEntries(ctx context.Context, arg ListAuditEntriesParams) ([]AuditLog, error)
+	// Lists recently created snippets (for admin purposes)
+	ListRecentSnippets(ctx context.Context, limit int64) ([]ListRecentSnippetsRow, error)
+	// Lists shared bodies in id order from after the given id
+	ListSnippetBodies(ctx context.Context, arg ListSnippetBodiesParams) ([]ListSnippetBodiesRow, error)
+	// Lists snippets in id order from after the given id, deleted ones included,
+	// for admin tasks that walk all of them. The content is resolved like
+	// GetSnippetByPublicID does, body_id tells whether it is shared.
+	ListSnippets(ctx context.Context, arg ListSnippetsParams) ([]ListSnippetsRow, error)
+	// Transactions take the write lock when they begin, appends are serialized
+	// without FOR UPDATE
+	LockAuditHead(ctx context.Context) (LockAuditHeadRow, error)
+	// Deletes the contents of snippets deleted before the given time, returning
+	// their blob keys. Run in a transaction with PurgeDeletedSnippets.
+	PurgeDeletedSnippetContents(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error)
+	// Permanently deletes snippets deleted before the given time
+	PurgeDeletedSnippets(ctx context.Context, deletedBefore sql.NullTime) (int64, error)
+	// Deletes bodies no snippet has referenced since the given time, returning
+	// their blob keys
+	PurgeUnusedSnippetBodies(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error)
+	// Clears the tombstone of a snippet deleted after the given time
+	RestoreSnippet(ctx context.Context, arg RestoreSnippetParams) (int64, error)
+	// Finds snippets by public ID or slug, or by a case-insensitive part of their
+	// title, deleted ones included (for admin purposes)
+	SearchSnippets(ctx context.Context, arg SearchSnippetsParams) ([]SearchSnippetsRow, error)
+	// Marks a snippet as deleted, it can be restored until it is purged
+	SoftDeleteSnippet(ctx context.Context, arg SoftDeleteSnippetParams) (int64, error)
+	// Looks up a shared body by content hash and marks it as used, so the purge
+	// job leaves it alone while a snippet is created with it
+	TouchSnippetBody(ctx context.Context, arg TouchSnippetBodyParams) (int64, error)
+	UpdateAuditHead(ctx context.Context, arg UpdateAuditHeadParams) error
+	// Updates an existing snippet by ID
+	UpdateSnippet(ctx context.Context, arg UpdateSnippetParams) (UpdateSnippetRow, error)
+	// Replaces the stored content of a shared body, its hash stays the same.
+	// Nothing is updated unless the body is still stored under old_blob_key.
+	UpdateSnippetBody(ctx context.Context, arg UpdateSnippetBodyParams) (int64, error)
+	// Updates the content of a snippet
+	UpdateSnippetContent(ctx context.Context, arg UpdateSnippetContentParams) error
+	// Sets or, with NULL, removes the slug of a snippet
+	UpdateSnippetSlug(ctx context.Context, arg UpdateSnippetSlugParams) error
+}
+
+var _ Querier = (*Queries)(nil)
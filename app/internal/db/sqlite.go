@@ -0,0 +1,576 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"snippets.adelh.dev/app/internal/config"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+	"snippets.adelh.dev/app/internal/db/sqlcsqlite"
+)
+
+// SQLiteStore is a Store backed by a single SQLite database, for single-node
+// deployments that don't want to run Postgres. It needs the modernc.org/sqlite
+// driver registered as "sqlite".
+type SQLiteStore struct {
+	db *sql.DB
+	q  *sqliteQuerier
+}
+
+var _ Store = (*SQLiteStore)(nil)
+var _ DBStatsReporter = (*SQLiteStore)(nil)
+var _ SchemaReporter = (*SQLiteStore)(nil)
+
+// NewSQLiteStore opens the database named by a sqlite:// or file: DSN,
+// creating it if needed. The schema is managed by Migrator.
+func NewSQLiteStore(cfg config.DBConfig) (*SQLiteStore, error) {
+	dsn, err := sqliteDSN(cfg.PrimaryDSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SQLite DSN: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite DB: %w", err)
+	}
+
+	// every connection to an in-memory database gets its own empty database
+	if strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory") {
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite DB: %w", err)
+	}
+
+	return &SQLiteStore{
+		db: db,
+		q:  &sqliteQuerier{db: db, q: sqlcsqlite.New(db)},
+	}, nil
+}
+
+// sqliteDSN converts a sqlite:// or file: DSN into a modernc.org/sqlite DSN
+// with the settings the store relies on:
+//   - foreign keys, for ON DELETE CASCADE
+//   - WAL journaling and a busy timeout, so readers don't block the writer
+//   - immediate transactions, so concurrent writers wait instead of failing
+//   - timestamps written in SQLite's format, so they compare as text
+func sqliteDSN(dsn string) (string, error) {
+	name, rawQuery, _ := strings.Cut(dsn, "?")
+	switch lower := strings.ToLower(name); {
+	case strings.HasPrefix(lower, "sqlite://"):
+		name = name[len("sqlite://"):]
+	case strings.HasPrefix(lower, "sqlite:"):
+		name = name[len("sqlite:"):]
+	}
+	if name == "" {
+		return "", fmt.Errorf("missing database path in %q", dsn)
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", err
+	}
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	if !slices.ContainsFunc(query["_pragma"], func(p string) bool {
+		return strings.HasPrefix(p, "busy_timeout")
+	}) {
+		query.Add("_pragma", "busy_timeout(5000)")
+	}
+	query.Set("_txlock", "immediate")
+	query.Set("_time_format", "sqlite")
+
+	return name + "?" + query.Encode(), nil
+}
+
+func (s *SQLiteStore) Primary() sqlc.Querier {
+	return s.q
+}
+
+// Replica returns the primary, SQLite has no replicas.
+func (s *SQLiteStore) Replica() sqlc.Querier {
+	return s.q
+}
+
+// ReplicaFor returns the primary, which is always consistent.
+func (s *SQLiteStore) ReplicaFor(ctx context.Context, token string) sqlc.Querier {
+	return s.q
+}
+
+// ConsistencyToken returns an empty token, there are no replicas to catch up.
+func (s *SQLiteStore) ConsistencyToken(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+// WithTx executes a function within a database transaction
+func (s *SQLiteStore) WithTx(ctx context.Context, fn func(sqlc.Querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(&sqliteQuerier{q: sqlcsqlite.New(tx)})
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) DBStats() map[string]sql.DBStats {
+	return map[string]sql.DBStats{"primary": s.db.Stats()}
+}
+
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLiteStore) SchemaStatus(ctx context.Context) (MigrationStatus, error) {
+	return schemaStatus(s.db.QueryRowContext(ctx, schemaVersionQuery), sqliteMigrations, "sqlite/migrations")
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// sqliteQuerier implements sqlc.Querier with the SQLite queries. It fills in
+// what Postgres does on its own: timestamps and the 32 bit ids.
+type sqliteQuerier struct {
+	// db starts transactions for multi-statement queries, it is nil when q
+	// already runs inside one.
+	db *sql.DB
+	q  *sqlcsqlite.Queries
+}
+
+var _ sqlc.Querier = (*sqliteQuerier)(nil)
+
+// sqliteNow returns the current time with the precision SQLite stores.
+func sqliteNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func nullTimeUTC(t sql.NullTime) sql.NullTime {
+	if t.Valid {
+		t.Time = t.Time.UTC()
+	}
+	return t
+}
+
+func nullInt64(n sql.NullInt32) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n.Int32), Valid: n.Valid}
+}
+
+func (s *sqliteQuerier) CreateSnippet(ctx context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+	if s.db == nil {
+		return s.createSnippet(ctx, arg)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlc.CreateSnippetRow{}, err
+	}
+	row, err := (&sqliteQuerier{q: s.q.WithTx(tx)}).createSnippet(ctx, arg)
+	if err != nil {
+		tx.Rollback()
+		return sqlc.CreateSnippetRow{}, err
+	}
+	return row, tx.Commit()
+}
+
+// createSnippet inserts the snippet and its content, it must run in a transaction.
+func (s *sqliteQuerier) createSnippet(ctx context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+	createdAt := sqliteNow()
+	id, err := s.q.CreateSnippet(ctx, sqlcsqlite.CreateSnippetParams{
+		PublicID:     arg.PublicID,
+		Slug:         arg.Slug,
+		Title:        arg.Title,
+		CreatedAt:    createdAt,
+		ExpiresAt:    nullTimeUTC(arg.ExpiresAt),
+		PasswordHash: arg.PasswordHash,
+		EditToken:    arg.EditToken,
+	})
+	if err != nil {
+		return sqlc.CreateSnippetRow{}, err
+	}
+
+	err = s.q.CreateSnippetContent(ctx, sqlcsqlite.CreateSnippetContentParams{
+		SnippetID:        id,
+		ContentType:      arg.ContentType,
+		EncryptedContent: arg.EncryptedContent,
+		BlobKey:          arg.BlobKey,
+		BodyID:           nullInt64(arg.BodyID),
+	})
+	if err != nil {
+		return sqlc.CreateSnippetRow{}, err
+	}
+
+	return sqlc.CreateSnippetRow{
+		SnippetID: int32(id),
+		PublicID:  arg.PublicID,
+		Slug:      arg.Slug,
+		CreatedAt: createdAt,
+		EditToken: arg.EditToken,
+	}, nil
+}
+
+// inTx runs fn in a transaction unless s already runs inside one.
+func (s *sqliteQuerier) inTx(ctx context.Context, fn func(q *sqlcsqlite.Queries) error) error {
+	if s.db == nil {
+		return fn(s.q)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(s.q.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteExpiredSnippets deletes the contents first to collect their blob
+// keys, SQLite can't return them from the cascading delete.
+func (s *sqliteQuerier) DeleteExpiredSnippets(ctx context.Context) ([]sql.NullString, error) {
+	now := sql.NullTime{Time: sqliteNow(), Valid: true}
+	var keys []sql.NullString
+	err := s.inTx(ctx, func(q *sqlcsqlite.Queries) error {
+		var err error
+		if keys, err = q.DeleteExpiredSnippetContents(ctx, now); err != nil {
+			return err
+		}
+		_, err = q.DeleteExpiredSnippets(ctx, now)
+		return err
+	})
+	return keys, err
+}
+
+func (s *sqliteQuerier) DeleteSnippetById(ctx context.Context, id int32) ([]sql.NullString, error) {
+	var keys []sql.NullString
+	err := s.inTx(ctx, func(q *sqlcsqlite.Queries) error {
+		var err error
+		if keys, err = q.DeleteSnippetContentById(ctx, int64(id)); err != nil {
+			return err
+		}
+		_, err = q.DeleteSnippetById(ctx, int64(id))
+		return err
+	})
+	return keys, err
+}
+
+func (s *sqliteQuerier) GetSnippetBlobKey(ctx context.Context, snippetID int32) (sql.NullString, error) {
+	return s.q.GetSnippetBlobKey(ctx, int64(snippetID))
+}
+
+func (s *sqliteQuerier) GetSnippetByPublicID(ctx context.Context, publicID string) (sqlc.GetSnippetByPublicIDRow, error) {
+	row, err := s.q.GetSnippetByPublicID(ctx, publicID)
+	if err != nil {
+		return sqlc.GetSnippetByPublicIDRow{}, err
+	}
+	return sqlc.GetSnippetByPublicIDRow{
+		ID:               int32(row.ID),
+		PublicID:         row.PublicID,
+		Slug:             row.Slug,
+		Title:            row.Title,
+		CreatedAt:        row.CreatedAt,
+		ExpiresAt:        row.ExpiresAt,
+		PasswordHash:     row.PasswordHash,
+		EditToken:        row.EditToken,
+		ViewCount:        int32(row.ViewCount),
+		LastEditedAt:     row.LastEditedAt,
+		DeletedAt:        row.DeletedAt,
+		ContentType:      row.ContentType,
+		EncryptedContent: row.EncryptedContent,
+		BlobKey:          row.BlobKey,
+		ContentHash:      row.ContentHash,
+	}, nil
+}
+
+func (s *sqliteQuerier) IncrementSnippetViewCount(ctx context.Context, id int32) (int32, error) {
+	n, err := s.q.IncrementSnippetViewCount(ctx, int64(id))
+	return int32(n), err
+}
+
+func (s *sqliteQuerier) ListRecentSnippets(ctx context.Context, limit int32) ([]sqlc.ListRecentSnippetsRow, error) {
+	rows, err := s.q.ListRecentSnippets(ctx, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.ListRecentSnippetsRow, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.ListRecentSnippetsRow{
+			ID:        int32(row.ID),
+			PublicID:  row.PublicID,
+			Slug:      row.Slug,
+			Title:     row.Title,
+			CreatedAt: row.CreatedAt,
+			ExpiresAt: row.ExpiresAt,
+		}
+	}
+	return out, nil
+}
+
+func (s *sqliteQuerier) PurgeDeletedSnippets(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error) {
+	deletedBefore = nullTimeUTC(deletedBefore)
+	var keys []sql.NullString
+	err := s.inTx(ctx, func(q *sqlcsqlite.Queries) error {
+		var err error
+		if keys, err = q.PurgeDeletedSnippetContents(ctx, deletedBefore); err != nil {
+			return err
+		}
+		_, err = q.PurgeDeletedSnippets(ctx, deletedBefore)
+		return err
+	})
+	return keys, err
+}
+
+func (s *sqliteQuerier) RestoreSnippet(ctx context.Context, arg sqlc.RestoreSnippetParams) (int64, error) {
+	return s.q.RestoreSnippet(ctx, sqlcsqlite.RestoreSnippetParams{
+		ID:           int64(arg.ID),
+		DeletedAfter: nullTimeUTC(arg.DeletedAfter),
+	})
+}
+
+func (s *sqliteQuerier) SoftDeleteSnippet(ctx context.Context, id int32) (int64, error) {
+	return s.q.SoftDeleteSnippet(ctx, sqlcsqlite.SoftDeleteSnippetParams{
+		ID:  int64(id),
+		Now: sql.NullTime{Time: sqliteNow(), Valid: true},
+	})
+}
+
+func (s *sqliteQuerier) UpdateSnippet(ctx context.Context, arg sqlc.UpdateSnippetParams) (sqlc.UpdateSnippetRow, error) {
+	row, err := s.q.UpdateSnippet(ctx, sqlcsqlite.UpdateSnippetParams{
+		ID:           int64(arg.ID),
+		Title:        arg.Title,
+		ExpiresAt:    nullTimeUTC(arg.ExpiresAt),
+		PasswordHash: arg.PasswordHash,
+		LastEditedAt: sql.NullTime{Time: sqliteNow(), Valid: true},
+	})
+	if err != nil {
+		return sqlc.UpdateSnippetRow{}, err
+	}
+	return sqlc.UpdateSnippetRow{
+		ID:           int32(row.ID),
+		PublicID:     row.PublicID,
+		CreatedAt:    row.CreatedAt,
+		LastEditedAt: row.LastEditedAt,
+	}, nil
+}
+
+func (s *sqliteQuerier) UpdateSnippetSlug(ctx context.Context, arg sqlc.UpdateSnippetSlugParams) error {
+	return s.q.UpdateSnippetSlug(ctx, sqlcsqlite.UpdateSnippetSlugParams{
+		ID:   int64(arg.ID),
+		Slug: arg.Slug,
+	})
+}
+
+func (s *sqliteQuerier) UpdateSnippetContent(ctx context.Context, arg sqlc.UpdateSnippetContentParams) error {
+	return s.q.UpdateSnippetContent(ctx, sqlcsqlite.UpdateSnippetContentParams{
+		SnippetID:        int64(arg.SnippetID),
+		ContentType:      arg.ContentType,
+		EncryptedContent: arg.EncryptedContent,
+		BlobKey:          arg.BlobKey,
+		BodyID:           nullInt64(arg.BodyID),
+	})
+}
+
+func (s *sqliteQuerier) TouchSnippetBody(ctx context.Context, contentHash []byte) (int32, error) {
+	id, err := s.q.TouchSnippetBody(ctx, sqlcsqlite.TouchSnippetBodyParams{
+		Now:         sqliteNow(),
+		ContentHash: contentHash,
+	})
+	return int32(id), err
+}
+
+func (s *sqliteQuerier) CreateSnippetBody(ctx context.Context, arg sqlc.CreateSnippetBodyParams) (sqlc.CreateSnippetBodyRow, error) {
+	row, err := s.q.CreateSnippetBody(ctx, sqlcsqlite.CreateSnippetBodyParams{
+		ContentHash:      arg.ContentHash,
+		EncryptedContent: arg.EncryptedContent,
+		BlobKey:          arg.BlobKey,
+		Now:              sqliteNow(),
+	})
+	if err != nil {
+		return sqlc.CreateSnippetBodyRow{}, err
+	}
+	return sqlc.CreateSnippetBodyRow{ID: int32(row.ID), BlobKey: row.BlobKey}, nil
+}
+
+func (s *sqliteQuerier) PurgeUnusedSnippetBodies(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error) {
+	return s.q.PurgeUnusedSnippetBodies(ctx, usedBefore.UTC())
+}
+
+func (s *sqliteQuerier) ImportSnippet(ctx context.Context, arg sqlc.ImportSnippetParams) (int32, error) {
+	var id int64
+	err := s.inTx(ctx, func(q *sqlcsqlite.Queries) error {
+		var err error
+		id, err = q.ImportSnippet(ctx, sqlcsqlite.ImportSnippetParams{
+			PublicID:     arg.PublicID,
+			Slug:         arg.Slug,
+			Title:        arg.Title,
+			CreatedAt:    arg.CreatedAt.UTC(),
+			ExpiresAt:    nullTimeUTC(arg.ExpiresAt),
+			PasswordHash: arg.PasswordHash,
+			EditToken:    arg.EditToken,
+			ViewCount:    int64(arg.ViewCount),
+			LastEditedAt: nullTimeUTC(arg.LastEditedAt),
+			DeletedAt:    nullTimeUTC(arg.DeletedAt),
+		})
+		if err != nil {
+			return err
+		}
+		return q.CreateSnippetContent(ctx, sqlcsqlite.CreateSnippetContentParams{
+			SnippetID:        id,
+			ContentType:      arg.ContentType,
+			EncryptedContent: arg.EncryptedContent,
+			BlobKey:          arg.BlobKey,
+		})
+	})
+	return int32(id), err
+}
+
+func (s *sqliteQuerier) ListSnippets(ctx context.Context, arg sqlc.ListSnippetsParams) ([]sqlc.ListSnippetsRow, error) {
+	rows, err := s.q.ListSnippets(ctx, sqlcsqlite.ListSnippetsParams{
+		AfterID: int64(arg.AfterID),
+		MaxRows: int64(arg.MaxRows),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.ListSnippetsRow, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.ListSnippetsRow{
+			ID:               int32(row.ID),
+			PublicID:         row.PublicID,
+			Slug:             row.Slug,
+			Title:            row.Title,
+			CreatedAt:        row.CreatedAt,
+			ExpiresAt:        row.ExpiresAt,
+			PasswordHash:     row.PasswordHash,
+			EditToken:        row.EditToken,
+			ViewCount:        int32(row.ViewCount),
+			LastEditedAt:     row.LastEditedAt,
+			DeletedAt:        row.DeletedAt,
+			ContentType:      row.ContentType,
+			EncryptedContent: row.EncryptedContent,
+			BlobKey:          row.BlobKey,
+			ContentHash:      row.ContentHash,
+			BodyID:           sql.NullInt32{Int32: int32(row.BodyID.Int64), Valid: row.BodyID.Valid},
+		}
+	}
+	return out, nil
+}
+
+func (s *sqliteQuerier) GetSnippetStats(ctx context.Context) (sqlc.GetSnippetStatsRow, error) {
+	row, err := s.q.GetSnippetStats(ctx, sql.NullTime{Time: sqliteNow(), Valid: true})
+	return sqlc.GetSnippetStatsRow(row), err
+}
+
+func (s *sqliteQuerier) ListSnippetBodies(ctx context.Context, arg sqlc.ListSnippetBodiesParams) ([]sqlc.ListSnippetBodiesRow, error) {
+	rows, err := s.q.ListSnippetBodies(ctx, sqlcsqlite.ListSnippetBodiesParams{
+		AfterID: int64(arg.AfterID),
+		MaxRows: int64(arg.MaxRows),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.ListSnippetBodiesRow, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.ListSnippetBodiesRow{
+			ID:               int32(row.ID),
+			ContentHash:      row.ContentHash,
+			EncryptedContent: row.EncryptedContent,
+			BlobKey:          row.BlobKey,
+		}
+	}
+	return out, nil
+}
+
+func (s *sqliteQuerier) UpdateSnippetBody(ctx context.Context, arg sqlc.UpdateSnippetBodyParams) (int64, error) {
+	return s.q.UpdateSnippetBody(ctx, sqlcsqlite.UpdateSnippetBodyParams{
+		EncryptedContent: arg.EncryptedContent,
+		BlobKey:          arg.BlobKey,
+		ID:               int64(arg.ID),
+		OldBlobKey:       arg.OldBlobKey,
+	})
+}
+
+func (s *sqliteQuerier) SearchSnippets(ctx context.Context, arg sqlc.SearchSnippetsParams) ([]sqlc.SearchSnippetsRow, error) {
+	rows, err := s.q.SearchSnippets(ctx, sqlcsqlite.SearchSnippetsParams{
+		Query:   arg.Query,
+		MaxRows: int64(arg.MaxRows),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.SearchSnippetsRow, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.SearchSnippetsRow{
+			ID:        int32(row.ID),
+			PublicID:  row.PublicID,
+			Slug:      row.Slug,
+			Title:     row.Title,
+			CreatedAt: row.CreatedAt,
+			ExpiresAt: row.ExpiresAt,
+			DeletedAt: row.DeletedAt,
+		}
+	}
+	return out, nil
+}
+
+func (s *sqliteQuerier) ExpireSnippet(ctx context.Context, id int32) (int64, error) {
+	return s.q.ExpireSnippet(ctx, sqlcsqlite.ExpireSnippetParams{
+		Now: sql.NullTime{Time: sqliteNow(), Valid: true},
+		ID:  int64(id),
+	})
+}
+
+// LockAuditHead only reads the head, transactions take the write lock when
+// they begin.
+func (s *sqliteQuerier) LockAuditHead(ctx context.Context) (sqlc.LockAuditHeadRow, error) {
+	row, err := s.q.LockAuditHead(ctx)
+	return sqlc.LockAuditHeadRow(row), err
+}
+
+func (s *sqliteQuerier) GetAuditHead(ctx context.Context) (sqlc.GetAuditHeadRow, error) {
+	row, err := s.q.GetAuditHead(ctx)
+	return sqlc.GetAuditHeadRow(row), err
+}
+
+func (s *sqliteQuerier) UpdateAuditHead(ctx context.Context, arg sqlc.UpdateAuditHeadParams) error {
+	return s.q.UpdateAuditHead(ctx, sqlcsqlite.UpdateAuditHeadParams(arg))
+}
+
+func (s *sqliteQuerier) CreateAuditEntry(ctx context.Context, arg sqlc.CreateAuditEntryParams) error {
+	arg.CreatedAt = arg.CreatedAt.UTC()
+	return s.q.CreateAuditEntry(ctx, sqlcsqlite.CreateAuditEntryParams(arg))
+}
+
+func (s *sqliteQuerier) ListAuditEntries(ctx context.Context, arg sqlc.ListAuditEntriesParams) ([]sqlc.AuditLog, error) {
+	rows, err := s.q.ListAuditEntries(ctx, sqlcsqlite.ListAuditEntriesParams{
+		AfterSeq: arg.AfterSeq,
+		MaxRows:  int64(arg.MaxRows),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sqlc.AuditLog, len(rows))
+	for i, row := range rows {
+		out[i] = sqlc.AuditLog(row)
+	}
+	return out, nil
+}
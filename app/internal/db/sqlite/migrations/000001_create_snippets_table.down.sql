@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS snippet_contents;
+DROP TABLE IF EXISTS snippets;
@@ -0,0 +1,47 @@
+-- SQLite port of migrations/000001_create_snippets_table.up.sql.
+-- Public IDs are generated by the application, there is no trigger.
+-- Timestamps are stored as UTC text in SQLite's own format so they sort
+-- and compare correctly as strings.
+
+-- SNIPPETS TABLE: stores snippet metadata
+CREATE TABLE snippets (
+    -- Internal ID (primary key)
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+    -- Public facing ID with Google Meet-style format (abc-defg-hij)
+    public_id TEXT NOT NULL UNIQUE,
+
+    -- Snippet title (optional)
+    title TEXT,
+
+    -- Creation timestamp
+    created_at DATETIME NOT NULL,
+
+    -- Expiration date (NULL means never expires)
+    expires_at DATETIME,
+
+    -- Password hash stored using bcrypt/argon2
+    password_hash TEXT,
+
+    edit_token TEXT NOT NULL,
+
+    view_count INTEGER NOT NULL DEFAULT 0,
+
+    last_edited_at DATETIME
+);
+
+-- SNIPPET_CONTENTS TABLE: stores the encrypted content and related encryption data
+CREATE TABLE snippet_contents (
+    -- Reference to the snippet this content belongs to
+    snippet_id INTEGER NOT NULL PRIMARY KEY REFERENCES snippets(id) ON DELETE CASCADE,
+
+    -- The content type/language
+    content_type TEXT NOT NULL DEFAULT 'text/plain',
+
+    -- The encrypted content of the snippet
+    encrypted_content BLOB NOT NULL
+);
+
+-- Index to efficiently query for expired snippets
+CREATE INDEX idx_snippets_expires_at ON snippets(expires_at)
+WHERE expires_at IS NOT NULL;
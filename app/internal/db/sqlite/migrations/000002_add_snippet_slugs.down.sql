@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_snippets_slug;
+
+ALTER TABLE snippets DROP COLUMN slug;
@@ -0,0 +1,5 @@
+-- SQLite port of migrations/000003_add_snippet_slugs.up.sql.
+-- ADD COLUMN can't add a UNIQUE constraint, a unique index does the same.
+ALTER TABLE snippets ADD COLUMN slug TEXT;
+
+CREATE UNIQUE INDEX idx_snippets_slug ON snippets(slug);
@@ -0,0 +1,5 @@
+-- SQLite port of migrations/000004_soft_delete_snippets.up.sql.
+ALTER TABLE snippets ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX idx_snippets_deleted_at ON snippets(deleted_at)
+WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+DELETE FROM snippets
+WHERE id IN (SELECT snippet_id FROM snippet_contents WHERE blob_key IS NOT NULL);
+
+ALTER TABLE snippet_contents DROP COLUMN blob_key;
@@ -0,0 +1,2 @@
+-- SQLite port of migrations/000005_add_snippet_blob_keys.up.sql.
+ALTER TABLE snippet_contents ADD COLUMN blob_key TEXT;
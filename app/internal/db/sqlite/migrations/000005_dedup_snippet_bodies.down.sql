@@ -0,0 +1,12 @@
+DELETE FROM snippets
+WHERE id IN (SELECT snippet_id FROM snippet_contents WHERE body_id IS NOT NULL);
+
+DROP TRIGGER IF EXISTS snippet_contents_body_refs_insert;
+DROP TRIGGER IF EXISTS snippet_contents_body_refs_delete;
+DROP TRIGGER IF EXISTS snippet_contents_body_refs_update;
+
+DROP INDEX IF EXISTS idx_snippet_contents_body_id;
+
+ALTER TABLE snippet_contents DROP COLUMN body_id;
+
+DROP TABLE IF EXISTS snippet_bodies;
@@ -0,0 +1,38 @@
+-- SQLite port of migrations/000006_dedup_snippet_bodies.up.sql.
+CREATE TABLE snippet_bodies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    content_hash BLOB NOT NULL UNIQUE,
+    encrypted_content BLOB NOT NULL,
+    blob_key TEXT,
+    ref_count INTEGER NOT NULL DEFAULT 0 CHECK (ref_count >= 0),
+    last_used_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_snippet_bodies_unused ON snippet_bodies(last_used_at)
+WHERE ref_count = 0;
+
+ALTER TABLE snippet_contents ADD COLUMN body_id INTEGER REFERENCES snippet_bodies(id);
+
+CREATE INDEX idx_snippet_contents_body_id ON snippet_contents(body_id);
+
+CREATE TRIGGER snippet_contents_body_refs_insert
+AFTER INSERT ON snippet_contents
+WHEN NEW.body_id IS NOT NULL
+BEGIN
+    UPDATE snippet_bodies SET ref_count = ref_count + 1 WHERE id = NEW.body_id;
+END;
+
+CREATE TRIGGER snippet_contents_body_refs_delete
+AFTER DELETE ON snippet_contents
+WHEN OLD.body_id IS NOT NULL
+BEGIN
+    UPDATE snippet_bodies SET ref_count = ref_count - 1 WHERE id = OLD.body_id;
+END;
+
+CREATE TRIGGER snippet_contents_body_refs_update
+AFTER UPDATE OF body_id ON snippet_contents
+WHEN OLD.body_id IS NOT NEW.body_id
+BEGIN
+    UPDATE snippet_bodies SET ref_count = ref_count - 1 WHERE id = OLD.body_id;
+    UPDATE snippet_bodies SET ref_count = ref_count + 1 WHERE id = NEW.body_id;
+END;
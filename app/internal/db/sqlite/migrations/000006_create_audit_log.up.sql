@@ -0,0 +1,36 @@
+-- SQLite port of migrations/000007_create_audit_log.up.sql.
+CREATE TABLE audit_log (
+    seq INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL,
+    event TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    snippet TEXT,
+    client_ip TEXT,
+    user_agent TEXT,
+    request_id TEXT,
+    details TEXT,
+    prev_hash BLOB NOT NULL,
+    hash BLOB NOT NULL
+);
+
+CREATE INDEX idx_audit_log_snippet ON audit_log(snippet) WHERE snippet IS NOT NULL;
+
+CREATE TABLE audit_head (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    seq INTEGER NOT NULL,
+    hash BLOB NOT NULL
+);
+
+INSERT INTO audit_head (id, seq, hash) VALUES (1, 0, X'');
+
+CREATE TRIGGER audit_log_no_update
+BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete
+BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
@@ -0,0 +1,290 @@
+-- name: GetSnippetByPublicID :one
+-- Retrieves a snippet by its public ID or its slug, deleted ones included.
+-- A public ID wins over the same slug of another snippet.
+-- The content of deduplicated snippets comes from their shared body.
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at, s.password_hash, s.edit_token, s.view_count, s.last_edited_at, s.deleted_at,
+       c.content_type,
+       COALESCE(b.encrypted_content, c.encrypted_content) AS encrypted_content,
+       COALESCE(b.blob_key, c.blob_key) AS blob_key,
+       b.content_hash
+FROM snippets s
+JOIN snippet_contents c ON s.id = c.snippet_id
+LEFT JOIN snippet_bodies b ON b.id = c.body_id
+WHERE s.public_id = @id OR s.slug = @id
+-- sqlc leaves @id as is past WHERE, ?1 is the parameter it becomes
+ORDER BY s.public_id = ?1 DESC
+LIMIT 1;
+
+-- name: CreateSnippet :one
+-- Creates a new snippet, the content is inserted by CreateSnippetContent
+INSERT INTO snippets (
+    public_id,
+    slug,
+    title,
+    created_at,
+    expires_at,
+    password_hash,
+    edit_token
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING id;
+
+-- name: CreateSnippetContent :exec
+-- Stores the content of a new snippet
+INSERT INTO snippet_contents (
+    snippet_id,
+    content_type,
+    encrypted_content,
+    blob_key,
+    body_id
+) VALUES (
+    ?, ?, ?, ?, ?
+);
+
+-- name: DeleteExpiredSnippetContents :many
+-- Deletes the contents of all snippets that expired before now, returning
+-- their blob keys. Run in a transaction with DeleteExpiredSnippets.
+DELETE FROM snippet_contents
+WHERE snippet_id IN (
+    SELECT id FROM snippets WHERE expires_at IS NOT NULL AND expires_at < @now
+)
+RETURNING blob_key;
+
+-- name: DeleteExpiredSnippets :execrows
+-- Deletes all snippets that expired before now
+DELETE FROM snippets
+WHERE expires_at IS NOT NULL AND expires_at < @now;
+
+-- name: DeleteSnippetContentById :many
+-- Deletes the content of a snippet, returning its blob key. Run in a
+-- transaction with DeleteSnippetById.
+DELETE FROM snippet_contents
+WHERE snippet_id = ?
+RETURNING blob_key;
+
+-- name: DeleteSnippetById :execrows
+-- Permanently deletes a snippet by id
+DELETE FROM snippets
+WHERE id = ?;
+
+-- name: SoftDeleteSnippet :execrows
+-- Marks a snippet as deleted, it can be restored until it is purged
+UPDATE snippets
+SET deleted_at = @now
+WHERE id = @id AND deleted_at IS NULL;
+
+-- name: RestoreSnippet :execrows
+-- Clears the tombstone of a snippet deleted after the given time
+UPDATE snippets
+SET deleted_at = NULL
+WHERE id = @id AND deleted_at >= @deleted_after;
+
+-- name: PurgeDeletedSnippetContents :many
+-- Deletes the contents of snippets deleted before the given time, returning
+-- their blob keys. Run in a transaction with PurgeDeletedSnippets.
+DELETE FROM snippet_contents
+WHERE snippet_id IN (
+    SELECT id FROM snippets WHERE deleted_at IS NOT NULL AND deleted_at < @deleted_before
+)
+RETURNING blob_key;
+
+-- name: PurgeDeletedSnippets :execrows
+-- Permanently deletes snippets deleted before the given time
+DELETE FROM snippets
+WHERE deleted_at IS NOT NULL AND deleted_at < @deleted_before;
+
+-- name: UpdateSnippet :one
+-- Updates an existing snippet by ID
+UPDATE snippets
+SET
+    title = COALESCE(sqlc.narg('title'), title),
+    expires_at = COALESCE(sqlc.narg('expires_at'), expires_at),
+    password_hash = COALESCE(sqlc.narg('password_hash'), password_hash),
+    last_edited_at = @last_edited_at
+WHERE id = @id
+RETURNING id, public_id, created_at, last_edited_at;
+
+-- name: UpdateSnippetSlug :exec
+-- Sets or, with NULL, removes the slug of a snippet
+UPDATE snippets
+SET slug = @slug
+WHERE id = @id;
+
+-- name: UpdateSnippetContent :exec
+-- Updates the content of a snippet
+UPDATE snippet_contents
+SET
+    content_type = @content_type,
+    encrypted_content = COALESCE(sqlc.narg('encrypted_content'), encrypted_content),
+    blob_key = @blob_key,
+    body_id = @body_id
+WHERE snippet_id = @snippet_id;
+
+-- name: GetSnippetBlobKey :one
+-- Returns the blob key of a snippet's content
+SELECT blob_key
+FROM snippet_contents
+WHERE snippet_id = ?;
+
+-- name: IncrementSnippetViewCount :one
+-- Increments the view count for a snippet
+UPDATE snippets
+SET view_count = view_count + 1
+WHERE id = ?
+RETURNING view_count;
+
+-- name: ListRecentSnippets :many
+-- Lists recently created snippets (for admin purposes)
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at
+FROM snippets s
+WHERE s.deleted_at IS NULL
+ORDER BY s.created_at DESC, s.id DESC
+LIMIT ?;
+
+-- name: TouchSnippetBody :one
+-- Looks up a shared body by content hash and marks it as used, so the purge
+-- job leaves it alone while a snippet is created with it
+UPDATE snippet_bodies
+SET last_used_at = @now
+WHERE content_hash = @content_hash
+RETURNING id;
+
+-- name: CreateSnippetBody :one
+-- Stores a shared body. If one with the same hash was stored concurrently
+-- that one is kept and marked as used, the returned blob key tells which.
+INSERT INTO snippet_bodies (
+    content_hash,
+    encrypted_content,
+    blob_key,
+    last_used_at
+) VALUES (
+    @content_hash, @encrypted_content, @blob_key, @now
+)
+ON CONFLICT (content_hash) DO UPDATE SET last_used_at = excluded.last_used_at
+RETURNING id, blob_key;
+
+-- name: PurgeUnusedSnippetBodies :many
+-- Deletes bodies no snippet has referenced since the given time, returning
+-- their blob keys
+DELETE FROM snippet_bodies
+WHERE ref_count = 0 AND last_used_at < @used_before
+RETURNING blob_key;
+
+-- name: ListSnippets :many
+-- Lists snippets in id order from after the given id, deleted ones included,
+-- for admin tasks that walk all of them. The content is resolved like
+-- GetSnippetByPublicID does, body_id tells whether it is shared.
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at, s.password_hash, s.edit_token, s.view_count, s.last_edited_at, s.deleted_at,
+       c.content_type,
+       COALESCE(b.encrypted_content, c.encrypted_content) AS encrypted_content,
+       COALESCE(b.blob_key, c.blob_key) AS blob_key,
+       b.content_hash,
+       c.body_id
+FROM snippets s
+JOIN snippet_contents c ON s.id = c.snippet_id
+LEFT JOIN snippet_bodies b ON b.id = c.body_id
+WHERE s.id > @after_id
+ORDER BY s.id
+LIMIT @max_rows;
+
+-- name: ImportSnippet :one
+-- Creates a snippet exported from another database, keeping its timestamps,
+-- view count and tombstone. The content is inserted by CreateSnippetContent.
+INSERT INTO snippets (
+    public_id,
+    slug,
+    title,
+    created_at,
+    expires_at,
+    password_hash,
+    edit_token,
+    view_count,
+    last_edited_at,
+    deleted_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING id;
+
+-- name: GetSnippetStats :one
+-- Counts snippets by state, along with the content stored out of line
+SELECT COUNT(*) AS total,
+       CAST(COALESCE(SUM(s.deleted_at IS NOT NULL), 0) AS INTEGER) AS deleted,
+       CAST(COALESCE(SUM(s.deleted_at IS NULL AND s.expires_at < @now), 0) AS INTEGER) AS expired,
+       CAST(COALESCE(SUM(s.password_hash IS NOT NULL), 0) AS INTEGER) AS protected,
+       CAST(COALESCE(SUM(s.view_count), 0) AS INTEGER) AS views,
+       (SELECT COUNT(*) FROM snippet_contents WHERE blob_key IS NOT NULL) AS blobs,
+       (SELECT COUNT(*) FROM snippet_bodies) AS bodies
+FROM snippets s;
+
+-- name: ListSnippetBodies :many
+-- Lists shared bodies in id order from after the given id
+SELECT id, content_hash, encrypted_content, blob_key
+FROM snippet_bodies
+WHERE id > @after_id
+ORDER BY id
+LIMIT @max_rows;
+
+-- name: UpdateSnippetBody :execrows
+-- Replaces the stored content of a shared body, its hash stays the same.
+-- Nothing is updated unless the body is still stored under old_blob_key.
+UPDATE snippet_bodies
+SET
+    encrypted_content = @encrypted_content,
+    blob_key = @blob_key
+WHERE id = @id AND blob_key IS sqlc.narg('old_blob_key');
+
+-- name: SearchSnippets :many
+-- Finds snippets by public ID or slug, or by a case-insensitive part of their
+-- title, deleted ones included (for admin purposes)
+SELECT s.id, s.public_id, s.slug, s.title, s.created_at, s.expires_at, s.deleted_at
+FROM snippets s
+WHERE s.public_id = @query OR s.slug = @query OR instr(lower(s.title), lower(@query)) > 0
+ORDER BY s.created_at DESC, s.id DESC
+LIMIT @max_rows;
+
+-- name: ExpireSnippet :execrows
+-- Makes a live snippet expire now, unless it already expires earlier
+UPDATE snippets
+SET expires_at = @now
+WHERE id = @id AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > @now);
+
+-- name: LockAuditHead :one
+-- Transactions take the write lock when they begin, appends are serialized
+-- without FOR UPDATE
+SELECT seq, hash
+FROM audit_head;
+
+-- name: GetAuditHead :one
+SELECT seq, hash
+FROM audit_head;
+
+-- name: UpdateAuditHead :exec
+UPDATE audit_head
+SET seq = @seq, hash = @hash;
+
+-- name: CreateAuditEntry :exec
+INSERT INTO audit_log (
+    seq,
+    created_at,
+    event,
+    actor,
+    snippet,
+    client_ip,
+    user_agent,
+    request_id,
+    details,
+    prev_hash,
+    hash
+) VALUES (
+    @seq, @created_at, @event, @actor, @snippet, @client_ip, @user_agent, @request_id, @details, @prev_hash, @hash
+);
+
+-- name: ListAuditEntries :many
+-- Pages through the audit log in order, for verification
+SELECT seq, created_at, event, actor, snippet, client_ip, user_agent, request_id, details, prev_hash, hash
+FROM audit_log
+WHERE seq > @after_seq
+ORDER BY seq
+LIMIT @max_rows;
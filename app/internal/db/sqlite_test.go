@@ -0,0 +1,54 @@
+package db
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		wantName string
+		wantErr  bool
+	}{
+		{dsn: "sqlite:///var/lib/snippets.db", wantName: "/var/lib/snippets.db"},
+		{dsn: "sqlite://snippets.db", wantName: "snippets.db"},
+		{dsn: "SQLite:snippets.db", wantName: "snippets.db"},
+		{dsn: "file:snippets.db?cache=shared", wantName: "file:snippets.db"},
+		{dsn: "sqlite://:memory:", wantName: ":memory:"},
+		{dsn: "sqlite://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			got, err := sqliteDSN(tt.dsn)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("sqliteDSN(%q) = %q, want error", tt.dsn, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sqliteDSN(%q): %v", tt.dsn, err)
+			}
+
+			name, rawQuery, _ := strings.Cut(got, "?")
+			if name != tt.wantName {
+				t.Errorf("name = %q, want %q", name, tt.wantName)
+			}
+			query, err := url.ParseQuery(rawQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query.Get("_txlock") != "immediate" || query.Get("_time_format") != "sqlite" {
+				t.Errorf("query = %v, want immediate transactions and sqlite time format", query)
+			}
+			if !strings.Contains(strings.Join(query["_pragma"], ","), "foreign_keys(1)") {
+				t.Errorf("pragmas = %v, want foreign_keys(1)", query["_pragma"])
+			}
+		})
+	}
+}
@@ -0,0 +1,1076 @@
+// Package storetest is a conformance suite for db.Store implementations.
+// Every backend runs it so they can be swapped without behavioural changes.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"snippets.adelh.dev/app/internal/db"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+	"snippets.adelh.dev/app/internal/publicid"
+)
+
+// Run runs the suite against stores returned by newStore. Stores may be
+// shared between subtests and contain unrelated data, the suite only
+// inspects snippets it created itself.
+func Run(t *testing.T, newStore func(t *testing.T) db.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s db.Store)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"GetMissing", testGetMissing},
+		{"DuplicatePublicID", testDuplicatePublicID},
+		{"UpdateSnippet", testUpdateSnippet},
+		{"UpdateMissingSnippet", testUpdateMissingSnippet},
+		{"UpdateSnippetContent", testUpdateSnippetContent},
+		{"BlobKeys", testBlobKeys},
+		{"SnippetBodies", testSnippetBodies},
+		{"Slugs", testSlugs},
+		{"UpdateSnippetSlug", testUpdateSnippetSlug},
+		{"IncrementViewCount", testIncrementViewCount},
+		{"DeleteSnippet", testDeleteSnippet},
+		{"DeleteExpiredSnippets", testDeleteExpiredSnippets},
+		{"SoftDeleteSnippet", testSoftDeleteSnippet},
+		{"RestoreSnippet", testRestoreSnippet},
+		{"PurgeDeletedSnippets", testPurgeDeletedSnippets},
+		{"ListRecentSnippets", testListRecentSnippets},
+		{"ListSnippets", testListSnippets},
+		{"ImportSnippet", testImportSnippet},
+		{"SnippetStats", testSnippetStats},
+		{"UpdateSnippetBody", testUpdateSnippetBody},
+		{"SearchSnippets", testSearchSnippets},
+		{"ExpireSnippet", testExpireSnippet},
+		{"AuditLog", testAuditLog},
+		{"TxCommit", testTxCommit},
+		{"TxRollback", testTxRollback},
+		{"ReadYourWrites", testReadYourWrites},
+		{"Ping", testPing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore(t)
+			tt.fn(t, s)
+		})
+	}
+}
+
+func create(t *testing.T, q sqlc.Querier, arg sqlc.CreateSnippetParams) sqlc.CreateSnippetRow {
+	t.Helper()
+	if arg.PublicID == "" {
+		arg.PublicID = newPublicID(t)
+	}
+	if arg.EditToken == "" {
+		arg.EditToken = "edit-token"
+	}
+	if arg.ContentType == "" {
+		arg.ContentType = "text/plain"
+	}
+	if arg.EncryptedContent == nil {
+		arg.EncryptedContent = []byte("ciphertext")
+	}
+	row, err := q.CreateSnippet(context.Background(), arg)
+	if err != nil {
+		t.Fatalf("CreateSnippet: %v", err)
+	}
+	return row
+}
+
+func newPublicID(t *testing.T) string {
+	t.Helper()
+	id, err := publicid.Default.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// newSlug returns a slug no other test run uses, Postgres tests share a database.
+func newSlug(t *testing.T) sql.NullString {
+	t.Helper()
+	return sql.NullString{String: "slug-" + newPublicID(t), Valid: true}
+}
+
+func get(t *testing.T, q sqlc.Querier, publicID string) sqlc.GetSnippetByPublicIDRow {
+	t.Helper()
+	row, err := q.GetSnippetByPublicID(context.Background(), publicID)
+	if err != nil {
+		t.Fatalf("GetSnippetByPublicID(%q): %v", publicID, err)
+	}
+	return row
+}
+
+func assertMissing(t *testing.T, q sqlc.Querier, publicID string) {
+	t.Helper()
+	_, err := q.GetSnippetByPublicID(context.Background(), publicID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetSnippetByPublicID(%q) error = %v, want sql.ErrNoRows", publicID, err)
+	}
+}
+
+func assertTime(t *testing.T, field string, got, want time.Time) {
+	t.Helper()
+	// Postgres stores microseconds
+	if d := got.Sub(want).Abs(); d > time.Millisecond {
+		t.Errorf("%s = %v, want %v", field, got, want)
+	}
+}
+
+func testCreateAndGet(t *testing.T, s db.Store) {
+	q := s.Primary()
+	expires := time.Now().Add(time.Hour).UTC()
+	arg := sqlc.CreateSnippetParams{
+		PublicID:         newPublicID(t),
+		Title:            sql.NullString{String: "hello", Valid: true},
+		ExpiresAt:        sql.NullTime{Time: expires, Valid: true},
+		PasswordHash:     sql.NullString{String: "hash", Valid: true},
+		EditToken:        "token-1",
+		ContentType:      "text/markdown",
+		EncryptedContent: []byte{0x00, 0x01, 0xff},
+	}
+
+	before := time.Now()
+	created := create(t, q, arg)
+	if created.PublicID != arg.PublicID {
+		t.Errorf("PublicID = %q, want %q", created.PublicID, arg.PublicID)
+	}
+	if created.EditToken != arg.EditToken {
+		t.Errorf("EditToken = %q, want %q", created.EditToken, arg.EditToken)
+	}
+	if created.CreatedAt.Before(before.Add(-time.Second)) || created.CreatedAt.After(time.Now().Add(time.Second)) {
+		t.Errorf("CreatedAt = %v, want around %v", created.CreatedAt, before)
+	}
+
+	got := get(t, q, created.PublicID)
+	if got.ID != created.SnippetID {
+		t.Errorf("ID = %d, want %d", got.ID, created.SnippetID)
+	}
+	if got.Title != arg.Title {
+		t.Errorf("Title = %v, want %v", got.Title, arg.Title)
+	}
+	if !got.ExpiresAt.Valid {
+		t.Error("ExpiresAt is NULL")
+	}
+	assertTime(t, "ExpiresAt", got.ExpiresAt.Time, expires)
+	assertTime(t, "CreatedAt", got.CreatedAt, created.CreatedAt)
+	if got.PasswordHash != arg.PasswordHash {
+		t.Errorf("PasswordHash = %v, want %v", got.PasswordHash, arg.PasswordHash)
+	}
+	if got.EditToken != arg.EditToken {
+		t.Errorf("EditToken = %q, want %q", got.EditToken, arg.EditToken)
+	}
+	if got.ViewCount != 0 {
+		t.Errorf("ViewCount = %d, want 0", got.ViewCount)
+	}
+	if got.LastEditedAt.Valid {
+		t.Errorf("LastEditedAt = %v, want NULL", got.LastEditedAt.Time)
+	}
+	if got.ContentType != arg.ContentType {
+		t.Errorf("ContentType = %q, want %q", got.ContentType, arg.ContentType)
+	}
+	if !bytes.Equal(got.EncryptedContent, arg.EncryptedContent) {
+		t.Errorf("EncryptedContent = %x, want %x", got.EncryptedContent, arg.EncryptedContent)
+	}
+
+	// optional columns stay NULL
+	bare := create(t, q, sqlc.CreateSnippetParams{})
+	row := get(t, q, bare.PublicID)
+	if row.Title.Valid || row.ExpiresAt.Valid || row.PasswordHash.Valid {
+		t.Errorf("optional columns = %v %v %v, want NULL", row.Title, row.ExpiresAt, row.PasswordHash)
+	}
+}
+
+func testGetMissing(t *testing.T, s db.Store) {
+	assertMissing(t, s.Primary(), "zzz-zzzz-zzz")
+}
+
+func testDuplicatePublicID(t *testing.T, s db.Store) {
+	first := create(t, s.Primary(), sqlc.CreateSnippetParams{})
+
+	_, err := s.Primary().CreateSnippet(context.Background(), sqlc.CreateSnippetParams{
+		PublicID:         first.PublicID,
+		EditToken:        "other",
+		ContentType:      "text/plain",
+		EncryptedContent: []byte("other"),
+	})
+	if !db.IsUniqueViolation(err) {
+		t.Fatalf("CreateSnippet with a taken public ID error = %v, want a unique violation", err)
+	}
+	if got := get(t, s.Primary(), first.PublicID); got.ID != first.SnippetID {
+		t.Errorf("public ID now resolves to snippet %d, want %d", got.ID, first.SnippetID)
+	}
+
+	// a failed insert inside a transaction is reported the same way
+	err = s.WithTx(context.Background(), func(q sqlc.Querier) error {
+		_, err := q.CreateSnippet(context.Background(), sqlc.CreateSnippetParams{
+			PublicID:         first.PublicID,
+			EditToken:        "other",
+			ContentType:      "text/plain",
+			EncryptedContent: []byte("other"),
+		})
+		return err
+	})
+	if !db.IsUniqueViolation(err) {
+		t.Fatalf("WithTx error = %v, want a unique violation", err)
+	}
+}
+
+func testUpdateSnippet(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	created := create(t, q, sqlc.CreateSnippetParams{
+		Title:        sql.NullString{String: "before", Valid: true},
+		PasswordHash: sql.NullString{String: "hash", Valid: true},
+	})
+
+	// NULL params leave columns untouched
+	updated, err := q.UpdateSnippet(ctx, sqlc.UpdateSnippetParams{ID: created.SnippetID})
+	if err != nil {
+		t.Fatalf("UpdateSnippet: %v", err)
+	}
+	if updated.PublicID != created.PublicID || updated.ID != created.SnippetID {
+		t.Errorf("UpdateSnippet returned %+v, want snippet %d", updated, created.SnippetID)
+	}
+	if !updated.LastEditedAt.Valid {
+		t.Error("LastEditedAt is NULL after update")
+	}
+	got := get(t, q, created.PublicID)
+	if got.Title.String != "before" || got.PasswordHash.String != "hash" || got.ExpiresAt.Valid {
+		t.Errorf("columns changed by NULL update: %+v", got)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	_, err = q.UpdateSnippet(ctx, sqlc.UpdateSnippetParams{
+		ID:           created.SnippetID,
+		Title:        sql.NullString{String: "after", Valid: true},
+		ExpiresAt:    sql.NullTime{Time: expires, Valid: true},
+		PasswordHash: sql.NullString{String: "new-hash", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("UpdateSnippet: %v", err)
+	}
+	got = get(t, q, created.PublicID)
+	if got.Title.String != "after" || got.PasswordHash.String != "new-hash" {
+		t.Errorf("Title, PasswordHash = %v, %v, want after, new-hash", got.Title, got.PasswordHash)
+	}
+	assertTime(t, "ExpiresAt", got.ExpiresAt.Time, expires)
+	if !got.LastEditedAt.Valid {
+		t.Error("LastEditedAt is NULL after update")
+	}
+}
+
+func testUpdateMissingSnippet(t *testing.T, s db.Store) {
+	_, err := s.Primary().UpdateSnippet(context.Background(), sqlc.UpdateSnippetParams{ID: -1})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("UpdateSnippet error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testUpdateSnippetContent(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	created := create(t, q, sqlc.CreateSnippetParams{EncryptedContent: []byte("v1")})
+
+	err := q.UpdateSnippetContent(ctx, sqlc.UpdateSnippetContentParams{
+		SnippetID:        created.SnippetID,
+		ContentType:      "application/json",
+		EncryptedContent: []byte("v2"),
+	})
+	if err != nil {
+		t.Fatalf("UpdateSnippetContent: %v", err)
+	}
+	got := get(t, q, created.PublicID)
+	if got.ContentType != "application/json" || string(got.EncryptedContent) != "v2" {
+		t.Errorf("content = %q %q, want application/json v2", got.ContentType, got.EncryptedContent)
+	}
+
+	// NULL content keeps the stored ciphertext
+	err = q.UpdateSnippetContent(ctx, sqlc.UpdateSnippetContentParams{
+		SnippetID:   created.SnippetID,
+		ContentType: "text/plain",
+	})
+	if err != nil {
+		t.Fatalf("UpdateSnippetContent: %v", err)
+	}
+	got = get(t, q, created.PublicID)
+	if got.ContentType != "text/plain" || string(got.EncryptedContent) != "v2" {
+		t.Errorf("content = %q %q, want text/plain v2", got.ContentType, got.EncryptedContent)
+	}
+}
+
+func blobKey(key string) sql.NullString {
+	return sql.NullString{String: key, Valid: true}
+}
+
+// testBlobKeys checks that blob keys are stored as given and handed back by
+// every query that removes the row referencing them.
+func testBlobKeys(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	created := create(t, q, sqlc.CreateSnippetParams{EncryptedContent: []byte{}, BlobKey: blobKey("k1")})
+
+	if got := get(t, q, created.PublicID); got.BlobKey != blobKey("k1") {
+		t.Errorf("BlobKey = %v, want k1", got.BlobKey)
+	}
+	if key, err := q.GetSnippetBlobKey(ctx, created.SnippetID); err != nil || key != blobKey("k1") {
+		t.Errorf("GetSnippetBlobKey = %v, %v, want k1, nil", key, err)
+	}
+
+	// the key is replaced along with the content, NULL moves it back inline
+	err := q.UpdateSnippetContent(ctx, sqlc.UpdateSnippetContentParams{
+		SnippetID:        created.SnippetID,
+		EncryptedContent: []byte("inline"),
+	})
+	if err != nil {
+		t.Fatalf("UpdateSnippetContent: %v", err)
+	}
+	if got := get(t, q, created.PublicID); got.BlobKey.Valid || string(got.EncryptedContent) != "inline" {
+		t.Errorf("after update BlobKey = %v, content = %q, want NULL, inline", got.BlobKey, got.EncryptedContent)
+	}
+	err = q.UpdateSnippetContent(ctx, sqlc.UpdateSnippetContentParams{
+		SnippetID:        created.SnippetID,
+		EncryptedContent: []byte{},
+		BlobKey:          blobKey("k2"),
+	})
+	if err != nil {
+		t.Fatalf("UpdateSnippetContent: %v", err)
+	}
+
+	keys, err := q.DeleteSnippetById(ctx, created.SnippetID)
+	if err != nil || len(keys) != 1 || keys[0] != blobKey("k2") {
+		t.Errorf("DeleteSnippetById = %v, %v, want [k2], nil", keys, err)
+	}
+
+	if _, err := q.GetSnippetBlobKey(ctx, created.SnippetID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetSnippetBlobKey of a deleted snippet error = %v, want sql.ErrNoRows", err)
+	}
+
+	deleted := create(t, q, sqlc.CreateSnippetParams{BlobKey: blobKey("k3")})
+	softDelete(t, q, deleted.SnippetID)
+	keys, err = q.PurgeDeletedSnippets(ctx, sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true})
+	if err != nil {
+		t.Fatalf("PurgeDeletedSnippets: %v", err)
+	}
+	if !slices.Contains(keys, blobKey("k3")) {
+		t.Errorf("PurgeDeletedSnippets = %v, want k3 among them", keys)
+	}
+
+	create(t, q, sqlc.CreateSnippetParams{
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+		BlobKey:   blobKey("k4"),
+	})
+	keys, err = q.DeleteExpiredSnippets(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpiredSnippets: %v", err)
+	}
+	if !slices.Contains(keys, blobKey("k4")) {
+		t.Errorf("DeleteExpiredSnippets = %v, want k4 among them", keys)
+	}
+}
+
+func newContentHash(t *testing.T) []byte {
+	t.Helper()
+	hash := make([]byte, 32)
+	if _, err := rand.Read(hash); err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// testSnippetBodies checks that shared bodies are counted by the snippets
+// referencing them and only purged once unused.
+func testSnippetBodies(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	hash := newContentHash(t)
+
+	if _, err := q.TouchSnippetBody(ctx, hash); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("TouchSnippetBody of a missing body error = %v, want sql.ErrNoRows", err)
+	}
+	body, err := q.CreateSnippetBody(ctx, sqlc.CreateSnippetBodyParams{ContentHash: hash, EncryptedContent: []byte("shared")})
+	if err != nil {
+		t.Fatalf("CreateSnippetBody: %v", err)
+	}
+	// an identical body stored again keeps the first
+	again, err := q.CreateSnippetBody(ctx, sqlc.CreateSnippetBodyParams{
+		ContentHash:      hash,
+		EncryptedContent: []byte("other"),
+		BlobKey:          blobKey("k1"),
+	})
+	if err != nil || again.ID != body.ID || again.BlobKey.Valid {
+		t.Fatalf("second CreateSnippetBody = %+v, %v, want id %d without a blob key", again, err, body.ID)
+	}
+	if id, err := q.TouchSnippetBody(ctx, hash); err != nil || id != body.ID {
+		t.Fatalf("TouchSnippetBody = %d, %v, want %d, nil", id, err, body.ID)
+	}
+
+	bodyID := sql.NullInt32{Int32: body.ID, Valid: true}
+	first := create(t, q, sqlc.CreateSnippetParams{EncryptedContent: []byte{}, BodyID: bodyID})
+	second := create(t, q, sqlc.CreateSnippetParams{EncryptedContent: []byte{}, BodyID: bodyID})
+	for _, publicID := range []string{first.PublicID, second.PublicID} {
+		got := get(t, q, publicID)
+		if string(got.EncryptedContent) != "shared" || !bytes.Equal(got.ContentHash, hash) {
+			t.Errorf("content = %q, hash = %x, want the shared body", got.EncryptedContent, got.ContentHash)
+		}
+	}
+	if got := get(t, q, create(t, q, sqlc.CreateSnippetParams{}).PublicID); got.ContentHash != nil {
+		t.Errorf("ContentHash of an inline snippet = %x, want nil", got.ContentHash)
+	}
+
+	purgeUnused := func() {
+		t.Helper()
+		if _, err := q.PurgeUnusedSnippetBodies(ctx, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("PurgeUnusedSnippetBodies: %v", err)
+		}
+	}
+
+	// referenced bodies survive the purge until the last snippet lets go
+	purgeUnused()
+	if _, err := q.DeleteSnippetById(ctx, first.SnippetID); err != nil {
+		t.Fatalf("DeleteSnippetById: %v", err)
+	}
+	purgeUnused()
+	if got := get(t, q, second.PublicID); string(got.EncryptedContent) != "shared" {
+		t.Fatalf("content = %q after deleting the other snippet, want shared", got.EncryptedContent)
+	}
+
+	err = q.UpdateSnippetContent(ctx, sqlc.UpdateSnippetContentParams{
+		SnippetID:        second.SnippetID,
+		ContentType:      "text/plain",
+		EncryptedContent: []byte("own"),
+	})
+	if err != nil {
+		t.Fatalf("UpdateSnippetContent: %v", err)
+	}
+	if got := get(t, q, second.PublicID); string(got.EncryptedContent) != "own" || got.ContentHash != nil {
+		t.Errorf("content = %q, hash = %x, want own content without a hash", got.EncryptedContent, got.ContentHash)
+	}
+
+	// unused bodies are kept for a grace period after their last use
+	if _, err := q.PurgeUnusedSnippetBodies(ctx, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("PurgeUnusedSnippetBodies: %v", err)
+	}
+	if _, err := q.TouchSnippetBody(ctx, hash); err != nil {
+		t.Fatalf("TouchSnippetBody inside the grace period: %v", err)
+	}
+	purgeUnused()
+	if _, err := q.TouchSnippetBody(ctx, hash); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("TouchSnippetBody after the purge error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testSlugs(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	slug := newSlug(t)
+	created := create(t, q, sqlc.CreateSnippetParams{Slug: slug})
+	if created.Slug != slug {
+		t.Errorf("Slug = %v, want %v", created.Slug, slug)
+	}
+
+	// the slug and the public ID resolve to the same snippet
+	for _, id := range []string{slug.String, created.PublicID} {
+		got := get(t, q, id)
+		if got.ID != created.SnippetID || got.Slug != slug {
+			t.Errorf("GetSnippetByPublicID(%q) = snippet %d with slug %v, want %d with %v", id, got.ID, got.Slug, created.SnippetID, slug)
+		}
+	}
+
+	_, err := q.CreateSnippet(ctx, sqlc.CreateSnippetParams{
+		PublicID:         newPublicID(t),
+		Slug:             slug,
+		EditToken:        "other",
+		ContentType:      "text/plain",
+		EncryptedContent: []byte("other"),
+	})
+	if !db.IsUniqueViolation(err) {
+		t.Fatalf("CreateSnippet with a taken slug error = %v, want a unique violation", err)
+	}
+
+	// any number of snippets can go without a slug
+	for range 2 {
+		bare := create(t, q, sqlc.CreateSnippetParams{})
+		if got := get(t, q, bare.PublicID); got.Slug.Valid {
+			t.Errorf("Slug = %q, want NULL", got.Slug.String)
+		}
+	}
+
+	// a public ID wins over the same slug, which a snippet can have been
+	// given before the public ID format changed
+	id := newPublicID(t)
+	shadowed := create(t, q, sqlc.CreateSnippetParams{Slug: sql.NullString{String: id, Valid: true}})
+	owner := create(t, q, sqlc.CreateSnippetParams{PublicID: id})
+	if got := get(t, q, id); got.ID != owner.SnippetID {
+		t.Errorf("GetSnippetByPublicID(%q) = snippet %d, want %d and not %d, which has it as its slug", id, got.ID, owner.SnippetID, shadowed.SnippetID)
+	}
+
+	// deleting the snippet frees its slug
+	if _, err := q.DeleteSnippetById(ctx, created.SnippetID); err != nil {
+		t.Fatalf("DeleteSnippetById: %v", err)
+	}
+	assertMissing(t, q, slug.String)
+	create(t, q, sqlc.CreateSnippetParams{Slug: slug})
+}
+
+func testUpdateSnippetSlug(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	oldSlug, slug := newSlug(t), newSlug(t)
+	created := create(t, q, sqlc.CreateSnippetParams{Slug: oldSlug})
+
+	err := q.UpdateSnippetSlug(ctx, sqlc.UpdateSnippetSlugParams{ID: created.SnippetID, Slug: slug})
+	if err != nil {
+		t.Fatalf("UpdateSnippetSlug: %v", err)
+	}
+	if got := get(t, q, slug.String); got.ID != created.SnippetID {
+		t.Errorf("new slug resolves to snippet %d, want %d", got.ID, created.SnippetID)
+	}
+	assertMissing(t, q, oldSlug.String)
+	get(t, q, created.PublicID)
+
+	// setting the current slug again is not a conflict
+	err = q.UpdateSnippetSlug(ctx, sqlc.UpdateSnippetSlugParams{ID: created.SnippetID, Slug: slug})
+	if err != nil {
+		t.Fatalf("UpdateSnippetSlug with the current slug: %v", err)
+	}
+
+	other := create(t, q, sqlc.CreateSnippetParams{})
+	err = q.UpdateSnippetSlug(ctx, sqlc.UpdateSnippetSlugParams{ID: other.SnippetID, Slug: slug})
+	if !db.IsUniqueViolation(err) {
+		t.Fatalf("UpdateSnippetSlug with a taken slug error = %v, want a unique violation", err)
+	}
+
+	// NULL removes the slug
+	if err := q.UpdateSnippetSlug(ctx, sqlc.UpdateSnippetSlugParams{ID: created.SnippetID}); err != nil {
+		t.Fatalf("UpdateSnippetSlug(NULL): %v", err)
+	}
+	assertMissing(t, q, slug.String)
+	if got := get(t, q, created.PublicID); got.Slug.Valid {
+		t.Errorf("Slug = %q, want NULL", got.Slug.String)
+	}
+}
+
+func testIncrementViewCount(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	created := create(t, q, sqlc.CreateSnippetParams{})
+
+	for want := int32(1); want <= 3; want++ {
+		n, err := q.IncrementSnippetViewCount(ctx, created.SnippetID)
+		if err != nil {
+			t.Fatalf("IncrementSnippetViewCount: %v", err)
+		}
+		if n != want {
+			t.Errorf("view count = %d, want %d", n, want)
+		}
+	}
+	if got := get(t, q, created.PublicID); got.ViewCount != 3 {
+		t.Errorf("ViewCount = %d, want 3", got.ViewCount)
+	}
+
+	_, err := q.IncrementSnippetViewCount(ctx, -1)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("IncrementSnippetViewCount(missing) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testDeleteSnippet(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	created := create(t, q, sqlc.CreateSnippetParams{})
+
+	keys, err := q.DeleteSnippetById(ctx, created.SnippetID)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("DeleteSnippetById = %v, %v, want one key, nil", keys, err)
+	}
+	assertMissing(t, q, created.PublicID)
+
+	keys, err = q.DeleteSnippetById(ctx, created.SnippetID)
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("second DeleteSnippetById = %v, %v, want no keys, nil", keys, err)
+	}
+}
+
+func testDeleteExpiredSnippets(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	expired := create(t, q, sqlc.CreateSnippetParams{
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	})
+	live := create(t, q, sqlc.CreateSnippetParams{
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	forever := create(t, q, sqlc.CreateSnippetParams{})
+
+	// expired snippets are still readable until purged, callers check expiry
+	if got := get(t, q, expired.PublicID); !got.ExpiresAt.Time.Before(time.Now()) {
+		t.Errorf("ExpiresAt = %v, want in the past", got.ExpiresAt.Time)
+	}
+
+	keys, err := q.DeleteExpiredSnippets(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpiredSnippets: %v", err)
+	}
+	if len(keys) < 1 {
+		t.Errorf("DeleteExpiredSnippets = %v, want at least one key", keys)
+	}
+	assertMissing(t, q, expired.PublicID)
+	get(t, q, live.PublicID)
+	get(t, q, forever.PublicID)
+}
+
+func softDelete(t *testing.T, q sqlc.Querier, id int32) {
+	t.Helper()
+	n, err := q.SoftDeleteSnippet(context.Background(), id)
+	if err != nil || n != 1 {
+		t.Fatalf("SoftDeleteSnippet = %d, %v, want 1, nil", n, err)
+	}
+}
+
+func testSoftDeleteSnippet(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	created := create(t, q, sqlc.CreateSnippetParams{})
+
+	before := time.Now()
+	softDelete(t, q, created.SnippetID)
+
+	// tombstones stay readable, callers check DeletedAt
+	got := get(t, q, created.PublicID)
+	if !got.DeletedAt.Valid {
+		t.Fatal("DeletedAt is NULL after SoftDeleteSnippet")
+	}
+	if got.DeletedAt.Time.Before(before.Add(-time.Second)) || got.DeletedAt.Time.After(time.Now().Add(time.Second)) {
+		t.Errorf("DeletedAt = %v, want around %v", got.DeletedAt.Time, before)
+	}
+
+	n, err := q.SoftDeleteSnippet(ctx, created.SnippetID)
+	if err != nil || n != 0 {
+		t.Fatalf("second SoftDeleteSnippet = %d, %v, want 0, nil", n, err)
+	}
+
+	rows, err := q.ListRecentSnippets(ctx, 100)
+	if err != nil {
+		t.Fatalf("ListRecentSnippets: %v", err)
+	}
+	for _, row := range rows {
+		if row.ID == created.SnippetID {
+			t.Error("ListRecentSnippets returned a deleted snippet")
+		}
+	}
+}
+
+func testRestoreSnippet(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	created := create(t, q, sqlc.CreateSnippetParams{})
+
+	// not deleted, nothing to restore
+	n, err := q.RestoreSnippet(ctx, sqlc.RestoreSnippetParams{
+		ID:           created.SnippetID,
+		DeletedAfter: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil || n != 0 {
+		t.Fatalf("RestoreSnippet of a live snippet = %d, %v, want 0, nil", n, err)
+	}
+
+	softDelete(t, q, created.SnippetID)
+	n, err = q.RestoreSnippet(ctx, sqlc.RestoreSnippetParams{
+		ID:           created.SnippetID,
+		DeletedAfter: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("RestoreSnippet = %d, %v, want 1, nil", n, err)
+	}
+	if got := get(t, q, created.PublicID); got.DeletedAt.Valid {
+		t.Errorf("DeletedAt = %v after restore, want NULL", got.DeletedAt.Time)
+	}
+
+	// deleted before the window started
+	softDelete(t, q, created.SnippetID)
+	n, err = q.RestoreSnippet(ctx, sqlc.RestoreSnippetParams{
+		ID:           created.SnippetID,
+		DeletedAfter: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	if err != nil || n != 0 {
+		t.Fatalf("RestoreSnippet outside the window = %d, %v, want 0, nil", n, err)
+	}
+	if got := get(t, q, created.PublicID); !got.DeletedAt.Valid {
+		t.Error("DeletedAt is NULL, want the snippet to stay deleted")
+	}
+}
+
+func testPurgeDeletedSnippets(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	deleted := create(t, q, sqlc.CreateSnippetParams{})
+	live := create(t, q, sqlc.CreateSnippetParams{})
+	softDelete(t, q, deleted.SnippetID)
+
+	// still inside the window
+	if _, err := q.PurgeDeletedSnippets(ctx, sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}); err != nil {
+		t.Fatalf("PurgeDeletedSnippets: %v", err)
+	}
+	get(t, q, deleted.PublicID)
+
+	keys, err := q.PurgeDeletedSnippets(ctx, sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true})
+	if err != nil {
+		t.Fatalf("PurgeDeletedSnippets: %v", err)
+	}
+	if len(keys) < 1 {
+		t.Errorf("PurgeDeletedSnippets = %v, want at least one key", keys)
+	}
+	assertMissing(t, q, deleted.PublicID)
+	get(t, q, live.PublicID)
+}
+
+func testListRecentSnippets(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+
+	var ids []int32
+	for range 3 {
+		ids = append(ids, create(t, q, sqlc.CreateSnippetParams{}).SnippetID)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	rows, err := q.ListRecentSnippets(ctx, 2)
+	if err != nil {
+		t.Fatalf("ListRecentSnippets: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("ListRecentSnippets returned %d rows, want 2", len(rows))
+	}
+	if rows[0].ID != ids[2] || rows[1].ID != ids[1] {
+		t.Errorf("ListRecentSnippets ids = %d, %d, want %d, %d", rows[0].ID, rows[1].ID, ids[2], ids[1])
+	}
+}
+
+func testListSnippets(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	hash := newContentHash(t)
+	body, err := q.CreateSnippetBody(ctx, sqlc.CreateSnippetBodyParams{ContentHash: hash, EncryptedContent: []byte("shared")})
+	if err != nil {
+		t.Fatalf("CreateSnippetBody: %v", err)
+	}
+
+	first := create(t, q, sqlc.CreateSnippetParams{})
+	shared := create(t, q, sqlc.CreateSnippetParams{EncryptedContent: []byte{}, BodyID: sql.NullInt32{Int32: body.ID, Valid: true}})
+	deleted := create(t, q, sqlc.CreateSnippetParams{})
+	softDelete(t, q, deleted.SnippetID)
+
+	rows, err := q.ListSnippets(ctx, sqlc.ListSnippetsParams{AfterID: first.SnippetID - 1, MaxRows: 2})
+	if err != nil {
+		t.Fatalf("ListSnippets: %v", err)
+	}
+	if len(rows) != 2 || rows[0].ID != first.SnippetID || rows[1].ID != shared.SnippetID {
+		t.Fatalf("ListSnippets = %+v, want snippets %d and %d", rows, first.SnippetID, shared.SnippetID)
+	}
+	if string(rows[0].EncryptedContent) != "ciphertext" || rows[0].BodyID.Valid {
+		t.Errorf("inline snippet listed with content %q, body %v", rows[0].EncryptedContent, rows[0].BodyID)
+	}
+	if string(rows[1].EncryptedContent) != "shared" || !bytes.Equal(rows[1].ContentHash, hash) || rows[1].BodyID.Int32 != body.ID {
+		t.Errorf("shared snippet listed with content %q, hash %x, body %v", rows[1].EncryptedContent, rows[1].ContentHash, rows[1].BodyID)
+	}
+
+	// tombstones are listed too
+	rows, err = q.ListSnippets(ctx, sqlc.ListSnippetsParams{AfterID: shared.SnippetID, MaxRows: 1})
+	if err != nil {
+		t.Fatalf("ListSnippets: %v", err)
+	}
+	if len(rows) != 1 || rows[0].ID != deleted.SnippetID || !rows[0].DeletedAt.Valid {
+		t.Errorf("ListSnippets after %d = %+v, want the deleted snippet", shared.SnippetID, rows)
+	}
+}
+
+func testImportSnippet(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	createdAt := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Microsecond)
+	deletedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Microsecond)
+
+	arg := sqlc.ImportSnippetParams{
+		PublicID:         newPublicID(t),
+		Slug:             newSlug(t),
+		Title:            sql.NullString{String: "imported", Valid: true},
+		CreatedAt:        createdAt,
+		PasswordHash:     sql.NullString{String: "hash", Valid: true},
+		EditToken:        "edit-token",
+		ViewCount:        7,
+		DeletedAt:        sql.NullTime{Time: deletedAt, Valid: true},
+		ContentType:      "text/markdown",
+		EncryptedContent: []byte("imported ciphertext"),
+	}
+	id, err := q.ImportSnippet(ctx, arg)
+	if err != nil {
+		t.Fatalf("ImportSnippet: %v", err)
+	}
+
+	got := get(t, q, arg.Slug.String)
+	if got.ID != id || got.PublicID != arg.PublicID || got.Title != arg.Title || got.ViewCount != 7 || got.PasswordHash != arg.PasswordHash {
+		t.Errorf("imported snippet = %+v", got)
+	}
+	if got.ContentType != "text/markdown" || string(got.EncryptedContent) != "imported ciphertext" {
+		t.Errorf("imported content = %s %q", got.ContentType, got.EncryptedContent)
+	}
+	assertTime(t, "CreatedAt", got.CreatedAt, createdAt)
+	if !got.DeletedAt.Valid {
+		t.Fatal("the tombstone was not imported")
+	}
+	assertTime(t, "DeletedAt", got.DeletedAt.Time, deletedAt)
+
+	arg.Slug = sql.NullString{}
+	if _, err := q.ImportSnippet(ctx, arg); !db.IsUniqueViolation(err) {
+		t.Errorf("importing a public ID twice: error = %v, want a unique violation", err)
+	}
+}
+
+// testSnippetStats only checks lower bounds, stores may hold data written
+// concurrently by other tests.
+func testSnippetStats(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	create(t, q, sqlc.CreateSnippetParams{PasswordHash: sql.NullString{String: "hash", Valid: true}})
+	create(t, q, sqlc.CreateSnippetParams{ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}})
+	create(t, q, sqlc.CreateSnippetParams{EncryptedContent: []byte{}, BlobKey: blobKey("stats")})
+	deleted := create(t, q, sqlc.CreateSnippetParams{})
+	softDelete(t, q, deleted.SnippetID)
+	if _, err := q.IncrementSnippetViewCount(ctx, deleted.SnippetID); err != nil {
+		t.Fatalf("IncrementSnippetViewCount: %v", err)
+	}
+
+	stats, err := q.GetSnippetStats(ctx)
+	if err != nil {
+		t.Fatalf("GetSnippetStats: %v", err)
+	}
+	if stats.Total < 4 || stats.Deleted < 1 || stats.Expired < 1 || stats.Protected < 1 || stats.Views < 1 || stats.Blobs < 1 {
+		t.Errorf("GetSnippetStats = %+v", stats)
+	}
+	if stats.Deleted+stats.Expired > stats.Total {
+		t.Errorf("GetSnippetStats = %+v, deleted and expired snippets are counted twice", stats)
+	}
+}
+
+func testUpdateSnippetBody(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+	hash := newContentHash(t)
+	body, err := q.CreateSnippetBody(ctx, sqlc.CreateSnippetBodyParams{ContentHash: hash, EncryptedContent: []byte("old")})
+	if err != nil {
+		t.Fatalf("CreateSnippetBody: %v", err)
+	}
+	snippet := create(t, q, sqlc.CreateSnippetParams{EncryptedContent: []byte{}, BodyID: sql.NullInt32{Int32: body.ID, Valid: true}})
+
+	// the body isn't stored under that key, nothing changes
+	n, err := q.UpdateSnippetBody(ctx, sqlc.UpdateSnippetBodyParams{ID: body.ID, EncryptedContent: []byte("new"), OldBlobKey: blobKey("other")})
+	if err != nil || n != 0 {
+		t.Fatalf("UpdateSnippetBody with a stale key = %d, %v, want 0, nil", n, err)
+	}
+	n, err = q.UpdateSnippetBody(ctx, sqlc.UpdateSnippetBodyParams{ID: body.ID, EncryptedContent: []byte("new")})
+	if err != nil || n != 1 {
+		t.Fatalf("UpdateSnippetBody = %d, %v, want 1, nil", n, err)
+	}
+	if got := get(t, q, snippet.PublicID); string(got.EncryptedContent) != "new" || !bytes.Equal(got.ContentHash, hash) {
+		t.Errorf("content = %q, hash = %x after the update", got.EncryptedContent, got.ContentHash)
+	}
+
+	rows, err := q.ListSnippetBodies(ctx, sqlc.ListSnippetBodiesParams{AfterID: body.ID - 1, MaxRows: 1})
+	if err != nil {
+		t.Fatalf("ListSnippetBodies: %v", err)
+	}
+	if len(rows) != 1 || rows[0].ID != body.ID || string(rows[0].EncryptedContent) != "new" || !bytes.Equal(rows[0].ContentHash, hash) {
+		t.Errorf("ListSnippetBodies = %+v", rows)
+	}
+}
+
+func testTxCommit(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	var created sqlc.CreateSnippetRow
+	err := s.WithTx(ctx, func(q sqlc.Querier) error {
+		created = create(t, q, sqlc.CreateSnippetParams{})
+		// writes are visible inside the transaction
+		get(t, q, created.PublicID)
+		_, err := q.IncrementSnippetViewCount(ctx, created.SnippetID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if got := get(t, s.Primary(), created.PublicID); got.ViewCount != 1 {
+		t.Errorf("ViewCount = %d, want 1", got.ViewCount)
+	}
+}
+
+func testTxRollback(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	existing := create(t, s.Primary(), sqlc.CreateSnippetParams{
+		Title: sql.NullString{String: "original", Valid: true},
+	})
+
+	errAbort := errors.New("abort")
+	var created sqlc.CreateSnippetRow
+	err := s.WithTx(ctx, func(q sqlc.Querier) error {
+		created = create(t, q, sqlc.CreateSnippetParams{})
+		if _, err := q.UpdateSnippet(ctx, sqlc.UpdateSnippetParams{
+			ID:    existing.SnippetID,
+			Title: sql.NullString{String: "changed", Valid: true},
+		}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx error = %v, want %v", err, errAbort)
+	}
+
+	assertMissing(t, s.Primary(), created.PublicID)
+	if got := get(t, s.Primary(), existing.PublicID); got.Title.String != "original" {
+		t.Errorf("Title = %q, want original", got.Title.String)
+	}
+}
+
+func testReadYourWrites(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	created := create(t, s.Primary(), sqlc.CreateSnippetParams{})
+
+	token, err := s.ConsistencyToken(ctx)
+	if err != nil {
+		t.Fatalf("ConsistencyToken: %v", err)
+	}
+	get(t, s.ReplicaFor(ctx, token), created.PublicID)
+}
+
+func testPing(t *testing.T, s db.Store) {
+	if err := s.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+}
+
+func testSearchSnippets(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+
+	// the stores may be shared, the tag keeps other snippets out of the results
+	tag := newPublicID(t)
+	titled := create(t, q, sqlc.CreateSnippetParams{Title: sql.NullString{String: "Notes " + strings.ToUpper(tag), Valid: true}})
+	time.Sleep(2 * time.Millisecond)
+	deleted := create(t, q, sqlc.CreateSnippetParams{Title: sql.NullString{String: tag + " draft", Valid: true}})
+	softDelete(t, q, deleted.SnippetID)
+	slugged := create(t, q, sqlc.CreateSnippetParams{Slug: sql.NullString{String: "search-" + tag, Valid: true}})
+
+	rows, err := q.SearchSnippets(ctx, sqlc.SearchSnippetsParams{Query: tag, MaxRows: 10})
+	if err != nil {
+		t.Fatalf("SearchSnippets: %v", err)
+	}
+	if len(rows) != 2 || rows[0].ID != deleted.SnippetID || rows[1].ID != titled.SnippetID {
+		t.Fatalf("SearchSnippets by title = %+v, want the deleted then the titled snippet", rows)
+	}
+	if !rows[0].DeletedAt.Valid {
+		t.Error("SearchSnippets did not report the tombstone")
+	}
+
+	rows, err = q.SearchSnippets(ctx, sqlc.SearchSnippetsParams{Query: "search-" + tag, MaxRows: 10})
+	if err != nil {
+		t.Fatalf("SearchSnippets: %v", err)
+	}
+	if len(rows) != 1 || rows[0].ID != slugged.SnippetID || rows[0].Slug.String != "search-"+tag {
+		t.Errorf("SearchSnippets by slug = %+v", rows)
+	}
+
+	rows, err = q.SearchSnippets(ctx, sqlc.SearchSnippetsParams{Query: tag, MaxRows: 1})
+	if err != nil {
+		t.Fatalf("SearchSnippets: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("SearchSnippets returned %d rows, want at most 1", len(rows))
+	}
+}
+
+func testExpireSnippet(t *testing.T, s db.Store) {
+	ctx := context.Background()
+	q := s.Primary()
+
+	live := create(t, q, sqlc.CreateSnippetParams{})
+	if n, err := q.ExpireSnippet(ctx, live.SnippetID); err != nil || n != 1 {
+		t.Fatalf("ExpireSnippet = %d, %v, want 1, nil", n, err)
+	}
+	row := get(t, q, live.PublicID)
+	if !row.ExpiresAt.Valid || row.ExpiresAt.Time.After(time.Now()) {
+		t.Errorf("expires_at = %v, want now", row.ExpiresAt)
+	}
+	if n, err := q.ExpireSnippet(ctx, live.SnippetID); err != nil || n != 0 {
+		t.Errorf("ExpireSnippet on an expired snippet = %d, %v, want 0, nil", n, err)
+	}
+
+	deleted := create(t, q, sqlc.CreateSnippetParams{})
+	softDelete(t, q, deleted.SnippetID)
+	if n, err := q.ExpireSnippet(ctx, deleted.SnippetID); err != nil || n != 0 {
+		t.Errorf("ExpireSnippet on a deleted snippet = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func testAuditLog(t *testing.T, s db.Store) {
+	ctx := context.Background()
+
+	// the log may already hold entries of other tests, append after them
+	var first int64
+	err := s.WithTx(ctx, func(q sqlc.Querier) error {
+		head, err := q.LockAuditHead(ctx)
+		if err != nil {
+			return err
+		}
+		first = head.Seq + 1
+		for i := range int64(3) {
+			if err := q.CreateAuditEntry(ctx, sqlc.CreateAuditEntryParams{
+				Seq:       first + i,
+				CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+				Event:     "test.event",
+				Actor:     "storetest",
+				ClientIP:  sql.NullString{String: "192.0.2.1", Valid: true},
+				PrevHash:  []byte{byte(i)},
+				Hash:      []byte{byte(i + 1)},
+			}); err != nil {
+				return err
+			}
+		}
+		return q.UpdateAuditHead(ctx, sqlc.UpdateAuditHeadParams{Seq: first + 2, Hash: []byte{3}})
+	})
+	if err != nil {
+		t.Fatalf("appending to the audit log: %v", err)
+	}
+
+	q := s.Primary()
+	head, err := q.GetAuditHead(ctx)
+	if err != nil {
+		t.Fatalf("GetAuditHead: %v", err)
+	}
+	if head.Seq < first+2 {
+		t.Errorf("head seq = %d, want at least %d", head.Seq, first+2)
+	}
+
+	err = q.CreateAuditEntry(ctx, sqlc.CreateAuditEntryParams{
+		Seq: first, CreatedAt: time.Now().UTC(), Event: "test.event", Actor: "storetest", PrevHash: []byte{}, Hash: []byte{},
+	})
+	if !db.IsUniqueViolation(err) {
+		t.Errorf("CreateAuditEntry with a used seq = %v, want a unique violation", err)
+	}
+
+	rows, err := q.ListAuditEntries(ctx, sqlc.ListAuditEntriesParams{AfterSeq: first, MaxRows: 1})
+	if err != nil {
+		t.Fatalf("ListAuditEntries: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Seq != first+1 || rows[0].Event != "test.event" ||
+		rows[0].ClientIP.String != "192.0.2.1" || !bytes.Equal(rows[0].Hash, []byte{2}) {
+		t.Errorf("ListAuditEntries = %+v, want entry %d", rows, first+1)
+	}
+}
@@ -0,0 +1,317 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+// TracedStore records a span for every query made through the wrapped
+// store, named after the query and the database it was sent to.
+type TracedStore struct {
+	Store
+	tracer trace.Tracer
+}
+
+var _ Store = (*TracedStore)(nil)
+var _ ReplicaReporter = (*TracedStore)(nil)
+var _ ReplicaUpdater = (*TracedStore)(nil)
+var _ DBStatsReporter = (*TracedStore)(nil)
+var _ SchemaReporter = (*TracedStore)(nil)
+
+// WithTracing wraps store so that its queries are traced. It must wrap the
+// store before WithBlobStorage does, the content store isn't forwarded.
+func WithTracing(store Store) *TracedStore {
+	return &TracedStore{Store: store, tracer: otel.Tracer("snippets.adelh.dev/app/internal/db")}
+}
+
+func (s *TracedStore) Primary() sqlc.Querier {
+	return &tracedQuerier{q: s.Store.Primary(), tracer: s.tracer, role: "primary"}
+}
+
+func (s *TracedStore) Replica() sqlc.Querier {
+	return &tracedQuerier{q: s.Store.Replica(), tracer: s.tracer, role: "replica"}
+}
+
+func (s *TracedStore) ReplicaFor(ctx context.Context, token string) sqlc.Querier {
+	return &tracedQuerier{q: s.Store.ReplicaFor(ctx, token), tracer: s.tracer, role: "replica"}
+}
+
+func (s *TracedStore) WithTx(ctx context.Context, fn func(sqlc.Querier) error) (err error) {
+	ctx, span := s.tracer.Start(ctx, "db.tx", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+	return s.Store.WithTx(ctx, func(q sqlc.Querier) error {
+		return fn(&tracedQuerier{q: q, tracer: s.tracer, role: "primary", tx: span})
+	})
+}
+
+// ReplicaStatus reports the replicas of the wrapped store, if it has any.
+func (s *TracedStore) ReplicaStatus() []ReplicaStatus {
+	if r, ok := s.Store.(ReplicaReporter); ok {
+		return r.ReplicaStatus()
+	}
+	return nil
+}
+
+// SetReplicas replaces the replicas of the wrapped store, if it has any.
+func (s *TracedStore) SetReplicas(ctx context.Context, dsns []string) error {
+	if u, ok := s.Store.(ReplicaUpdater); ok {
+		return u.SetReplicas(ctx, dsns)
+	}
+	return ErrReplicasUnsupported
+}
+
+// SchemaStatus reports the schema of the wrapped store, if it has one.
+func (s *TracedStore) SchemaStatus(ctx context.Context) (MigrationStatus, error) {
+	if r, ok := s.Store.(SchemaReporter); ok {
+		return r.SchemaStatus(ctx)
+	}
+	return MigrationStatus{}, ErrNoSchema
+}
+
+// DBStats reports the pools of the wrapped store, if it has any.
+func (s *TracedStore) DBStats() map[string]sql.DBStats {
+	if r, ok := s.Store.(DBStatsReporter); ok {
+		return r.DBStats()
+	}
+	return nil
+}
+
+// tracedQuerier starts a span around every query. Replica reads are
+// attributed to "replica" even when they fell back to the primary.
+type tracedQuerier struct {
+	q      sqlc.Querier
+	tracer trace.Tracer
+	role   string
+	// tx is the span of the transaction the queries run in, their parent
+	// whatever context they are made with.
+	tx trace.Span
+}
+
+var _ sqlc.Querier = (*tracedQuerier)(nil)
+
+func (q *tracedQuerier) start(ctx context.Context, name string) (context.Context, trace.Span) {
+	if q.tx != nil {
+		ctx = trace.ContextWithSpan(ctx, q.tx)
+	}
+	return q.tracer.Start(ctx, "db."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.operation.name", name),
+			attribute.String("db.role", q.role),
+		),
+	)
+}
+
+// endSpan ends span, marking it failed unless err is nil or only reports
+// that no row matched.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (q *tracedQuerier) CreateAuditEntry(ctx context.Context, arg sqlc.CreateAuditEntryParams) error {
+	ctx, span := q.start(ctx, "CreateAuditEntry")
+	err := q.q.CreateAuditEntry(ctx, arg)
+	endSpan(span, err)
+	return err
+}
+
+func (q *tracedQuerier) CreateSnippet(ctx context.Context, arg sqlc.CreateSnippetParams) (sqlc.CreateSnippetRow, error) {
+	ctx, span := q.start(ctx, "CreateSnippet")
+	row, err := q.q.CreateSnippet(ctx, arg)
+	endSpan(span, err)
+	return row, err
+}
+
+func (q *tracedQuerier) CreateSnippetBody(ctx context.Context, arg sqlc.CreateSnippetBodyParams) (sqlc.CreateSnippetBodyRow, error) {
+	ctx, span := q.start(ctx, "CreateSnippetBody")
+	row, err := q.q.CreateSnippetBody(ctx, arg)
+	endSpan(span, err)
+	return row, err
+}
+
+func (q *tracedQuerier) DeleteExpiredSnippets(ctx context.Context) ([]sql.NullString, error) {
+	ctx, span := q.start(ctx, "DeleteExpiredSnippets")
+	keys, err := q.q.DeleteExpiredSnippets(ctx)
+	endSpan(span, err)
+	return keys, err
+}
+
+func (q *tracedQuerier) DeleteSnippetById(ctx context.Context, id int32) ([]sql.NullString, error) {
+	ctx, span := q.start(ctx, "DeleteSnippetById")
+	keys, err := q.q.DeleteSnippetById(ctx, id)
+	endSpan(span, err)
+	return keys, err
+}
+
+func (q *tracedQuerier) ExpireSnippet(ctx context.Context, id int32) (int64, error) {
+	ctx, span := q.start(ctx, "ExpireSnippet")
+	n, err := q.q.ExpireSnippet(ctx, id)
+	endSpan(span, err)
+	return n, err
+}
+
+func (q *tracedQuerier) GetAuditHead(ctx context.Context) (sqlc.GetAuditHeadRow, error) {
+	ctx, span := q.start(ctx, "GetAuditHead")
+	row, err := q.q.GetAuditHead(ctx)
+	endSpan(span, err)
+	return row, err
+}
+
+func (q *tracedQuerier) GetSnippetBlobKey(ctx context.Context, snippetID int32) (sql.NullString, error) {
+	ctx, span := q.start(ctx, "GetSnippetBlobKey")
+	key, err := q.q.GetSnippetBlobKey(ctx, snippetID)
+	endSpan(span, err)
+	return key, err
+}
+
+func (q *tracedQuerier) GetSnippetByPublicID(ctx context.Context, publicID string) (sqlc.GetSnippetByPublicIDRow, error) {
+	ctx, span := q.start(ctx, "GetSnippetByPublicID")
+	row, err := q.q.GetSnippetByPublicID(ctx, publicID)
+	endSpan(span, err)
+	return row, err
+}
+
+func (q *tracedQuerier) GetSnippetStats(ctx context.Context) (sqlc.GetSnippetStatsRow, error) {
+	ctx, span := q.start(ctx, "GetSnippetStats")
+	row, err := q.q.GetSnippetStats(ctx)
+	endSpan(span, err)
+	return row, err
+}
+
+func (q *tracedQuerier) ImportSnippet(ctx context.Context, arg sqlc.ImportSnippetParams) (int32, error) {
+	ctx, span := q.start(ctx, "ImportSnippet")
+	id, err := q.q.ImportSnippet(ctx, arg)
+	endSpan(span, err)
+	return id, err
+}
+
+func (q *tracedQuerier) IncrementSnippetViewCount(ctx context.Context, id int32) (int32, error) {
+	ctx, span := q.start(ctx, "IncrementSnippetViewCount")
+	n, err := q.q.IncrementSnippetViewCount(ctx, id)
+	endSpan(span, err)
+	return n, err
+}
+
+func (q *tracedQuerier) ListAuditEntries(ctx context.Context, arg sqlc.ListAuditEntriesParams) ([]sqlc.AuditLog, error) {
+	ctx, span := q.start(ctx, "ListAuditEntries")
+	rows, err := q.q.ListAuditEntries(ctx, arg)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (q *tracedQuerier) ListRecentSnippets(ctx context.Context, limit int32) ([]sqlc.ListRecentSnippetsRow, error) {
+	ctx, span := q.start(ctx, "ListRecentSnippets")
+	rows, err := q.q.ListRecentSnippets(ctx, limit)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (q *tracedQuerier) ListSnippetBodies(ctx context.Context, arg sqlc.ListSnippetBodiesParams) ([]sqlc.ListSnippetBodiesRow, error) {
+	ctx, span := q.start(ctx, "ListSnippetBodies")
+	rows, err := q.q.ListSnippetBodies(ctx, arg)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (q *tracedQuerier) ListSnippets(ctx context.Context, arg sqlc.ListSnippetsParams) ([]sqlc.ListSnippetsRow, error) {
+	ctx, span := q.start(ctx, "ListSnippets")
+	rows, err := q.q.ListSnippets(ctx, arg)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (q *tracedQuerier) LockAuditHead(ctx context.Context) (sqlc.LockAuditHeadRow, error) {
+	ctx, span := q.start(ctx, "LockAuditHead")
+	row, err := q.q.LockAuditHead(ctx)
+	endSpan(span, err)
+	return row, err
+}
+
+func (q *tracedQuerier) PurgeDeletedSnippets(ctx context.Context, deletedBefore sql.NullTime) ([]sql.NullString, error) {
+	ctx, span := q.start(ctx, "PurgeDeletedSnippets")
+	keys, err := q.q.PurgeDeletedSnippets(ctx, deletedBefore)
+	endSpan(span, err)
+	return keys, err
+}
+
+func (q *tracedQuerier) PurgeUnusedSnippetBodies(ctx context.Context, usedBefore time.Time) ([]sql.NullString, error) {
+	ctx, span := q.start(ctx, "PurgeUnusedSnippetBodies")
+	keys, err := q.q.PurgeUnusedSnippetBodies(ctx, usedBefore)
+	endSpan(span, err)
+	return keys, err
+}
+
+func (q *tracedQuerier) RestoreSnippet(ctx context.Context, arg sqlc.RestoreSnippetParams) (int64, error) {
+	ctx, span := q.start(ctx, "RestoreSnippet")
+	n, err := q.q.RestoreSnippet(ctx, arg)
+	endSpan(span, err)
+	return n, err
+}
+
+func (q *tracedQuerier) SearchSnippets(ctx context.Context, arg sqlc.SearchSnippetsParams) ([]sqlc.SearchSnippetsRow, error) {
+	ctx, span := q.start(ctx, "SearchSnippets")
+	rows, err := q.q.SearchSnippets(ctx, arg)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (q *tracedQuerier) SoftDeleteSnippet(ctx context.Context, id int32) (int64, error) {
+	ctx, span := q.start(ctx, "SoftDeleteSnippet")
+	n, err := q.q.SoftDeleteSnippet(ctx, id)
+	endSpan(span, err)
+	return n, err
+}
+
+func (q *tracedQuerier) TouchSnippetBody(ctx context.Context, contentHash []byte) (int32, error) {
+	ctx, span := q.start(ctx, "TouchSnippetBody")
+	id, err := q.q.TouchSnippetBody(ctx, contentHash)
+	endSpan(span, err)
+	return id, err
+}
+
+func (q *tracedQuerier) UpdateAuditHead(ctx context.Context, arg sqlc.UpdateAuditHeadParams) error {
+	ctx, span := q.start(ctx, "UpdateAuditHead")
+	err := q.q.UpdateAuditHead(ctx, arg)
+	endSpan(span, err)
+	return err
+}
+
+func (q *tracedQuerier) UpdateSnippet(ctx context.Context, arg sqlc.UpdateSnippetParams) (sqlc.UpdateSnippetRow, error) {
+	ctx, span := q.start(ctx, "UpdateSnippet")
+	row, err := q.q.UpdateSnippet(ctx, arg)
+	endSpan(span, err)
+	return row, err
+}
+
+func (q *tracedQuerier) UpdateSnippetBody(ctx context.Context, arg sqlc.UpdateSnippetBodyParams) (int64, error) {
+	ctx, span := q.start(ctx, "UpdateSnippetBody")
+	n, err := q.q.UpdateSnippetBody(ctx, arg)
+	endSpan(span, err)
+	return n, err
+}
+
+func (q *tracedQuerier) UpdateSnippetContent(ctx context.Context, arg sqlc.UpdateSnippetContentParams) error {
+	ctx, span := q.start(ctx, "UpdateSnippetContent")
+	err := q.q.UpdateSnippetContent(ctx, arg)
+	endSpan(span, err)
+	return err
+}
+
+func (q *tracedQuerier) UpdateSnippetSlug(ctx context.Context, arg sqlc.UpdateSnippetSlugParams) error {
+	ctx, span := q.start(ctx, "UpdateSnippetSlug")
+	err := q.q.UpdateSnippetSlug(ctx, arg)
+	endSpan(span, err)
+	return err
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"snippets.adelh.dev/app/internal/db/sqlc"
+)
+
+func TestTracedStore(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	s := WithTracing(NewMemoryStore())
+	s.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	ctx := context.Background()
+
+	_, err := s.Replica().GetSnippetByPublicID(ctx, "missing")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetSnippetByPublicID = %v, want sql.ErrNoRows", err)
+	}
+	err = s.WithTx(ctx, func(q sqlc.Querier) error {
+		if _, err := q.SoftDeleteSnippet(ctx, 1); err != nil {
+			return err
+		}
+		return errors.New("rolled back")
+	})
+	if err == nil {
+		t.Fatal("WithTx succeeded, want the error of fn")
+	}
+
+	spans := recorder.Ended()
+	want := []struct {
+		name string
+		code codes.Code
+	}{
+		// no matching row isn't a failure
+		{"db.GetSnippetByPublicID", codes.Unset},
+		{"db.SoftDeleteSnippet", codes.Unset},
+		{"db.tx", codes.Error},
+	}
+	if len(spans) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(spans), len(want))
+	}
+	for i, w := range want {
+		if spans[i].Name() != w.name || spans[i].Status().Code != w.code {
+			t.Errorf("span %d = %s %v, want %s %v", i, spans[i].Name(), spans[i].Status().Code, w.name, w.code)
+		}
+	}
+	if spans[1].Parent().SpanID() != spans[2].SpanContext().SpanID() {
+		t.Error("query in a transaction is not a child of the transaction span")
+	}
+}
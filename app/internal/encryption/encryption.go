@@ -4,35 +4,79 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"time"
+
+	"snippets.adelh.dev/app/internal/metrics"
 )
 
 type Service struct {
 	systemKey []byte
+	// previousKeys are keys the system key replaced. Content encrypted
+	// under them still decrypts until it is encrypted again, everything
+	// new is encrypted under the system key.
+	previousKeys [][]byte
 }
 
-func NewService(systemKey string) (*Service, error) {
-	key, err := base64.StdEncoding.DecodeString(systemKey)
+// NewService returns a Service encrypting under systemKey, the previous keys
+// are only used to decrypt. Keys are base64 encoded.
+func NewService(systemKey string, previousKeys ...string) (*Service, error) {
+	key, err := parseKey(systemKey)
 	if err != nil {
 		return nil, fmt.Errorf("invalid system key: %w", err)
 	}
+	s := &Service{systemKey: key}
+	for i, k := range previousKeys {
+		key, err := parseKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous key %d: %w", i, err)
+		}
+		s.previousKeys = append(s.previousKeys, key)
+	}
+	return s, nil
+}
+
+func parseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
 
 	switch len(key) {
 	case 16, 24, 32:
 	default:
-		return nil, errors.New("system key must be 16, 24, or 32 bytes when decoded")
+		return nil, errors.New("key must be 16, 24, or 32 bytes when decoded")
 	}
+	return key, nil
+}
+
+// KeyID identifies the system key without revealing it, for the audit log
+// of key rotations: the first 8 bytes of its SHA-256, hex encoded.
+func (s *Service) KeyID() string {
+	sum := sha256.Sum256(s.systemKey)
+	return hex.EncodeToString(sum[:8])
+}
 
-	return &Service{
-		systemKey: key,
-	}, nil
+// keys returns the keys to try when decrypting, the system key first.
+func (s *Service) keys() [][]byte {
+	return append([][]byte{s.systemKey}, s.previousKeys...)
 }
 
 // Encrypt encrypts data using AES-GCM
 func (s *Service) Encrypt(data []byte) ([]byte, error) {
+	return s.EncryptWithAAD(data, nil)
+}
+
+// EncryptWithAAD encrypts data using AES-GCM and authenticates aad along
+// with it. aad is not part of the output, the same bytes must be passed to
+// DecryptWithAAD.
+func (s *Service) EncryptWithAAD(data, aad []byte) ([]byte, error) {
+	defer metrics.CryptoDuration(metrics.Encrypt, time.Now())
 	block, err := aes.NewCipher(s.systemKey)
 	if err != nil {
 		return nil, err
@@ -48,14 +92,33 @@ func (s *Service) Encrypt(data []byte) ([]byte, error) {
 		return nil, err
 	}
 	// prepend nonce to the encrypted text
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
+	ciphertext := gcm.Seal(nonce, nonce, data, aad)
 
 	return ciphertext, nil
 }
 
 // Decrypt decrypts data using AES-GCM
 func (s *Service) Decrypt(ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(s.systemKey)
+	return s.DecryptWithAAD(ciphertext, nil)
+}
+
+// DecryptWithAAD decrypts data encrypted by EncryptWithAAD, under the system
+// key or a previous one. It fails if aad differs from the one used for
+// encryption.
+func (s *Service) DecryptWithAAD(ciphertext, aad []byte) ([]byte, error) {
+	defer metrics.CryptoDuration(metrics.Decrypt, time.Now())
+	var err error
+	for _, key := range s.keys() {
+		var data []byte
+		if data, err = decrypt(key, ciphertext, aad); err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+func decrypt(key, ciphertext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -71,5 +134,5 @@ func (s *Service) Decrypt(ciphertext []byte) ([]byte, error) {
 	}
 	nonce, encryptedData := ciphertext[:nonceSize], ciphertext[nonceSize:]
 
-	return gcm.Open(nil, nonce, encryptedData, nil)
+	return gcm.Open(nil, nonce, encryptedData, aad)
 }
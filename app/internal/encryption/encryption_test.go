@@ -2,6 +2,7 @@ package encryption
 
 import (
 	"bytes"
+	"io"
 	"testing"
 )
 
@@ -83,3 +84,74 @@ func TestService_EncryptDecrypt(t *testing.T) {
 		})
 	}
 }
+
+func TestService_EncryptDecryptWithAAD(t *testing.T) {
+	s := &Service{systemKey: []byte("1234567890123456")}
+	data := []byte("hello world!")
+
+	encrypted, err := s.EncryptWithAAD(data, []byte("header"))
+	if err != nil {
+		t.Fatalf("EncryptWithAAD() error: %v", err)
+	}
+
+	decrypted, err := s.DecryptWithAAD(encrypted, []byte("header"))
+	if err != nil {
+		t.Fatalf("DecryptWithAAD() error: %v", err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("EncryptWithAAD/DecryptWithAAD roundtrip failed: got %v, want %v", decrypted, data)
+	}
+
+	if _, err := s.DecryptWithAAD(encrypted, []byte("other")); err == nil {
+		t.Error("DecryptWithAAD() with a different aad succeeded")
+	}
+	if _, err := s.Decrypt(encrypted); err == nil {
+		t.Error("Decrypt() without the aad succeeded")
+	}
+}
+
+func TestService_PreviousKeys(t *testing.T) {
+	const oldKey, newKey = "MTIzNDU2Nzg5MDEyMzQ1Ng==", "MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI="
+	old, err := NewService(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewService(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("encrypted before the rotation")
+
+	encrypted, err := old.EncryptWithAAD(data, []byte("header"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rotated.DecryptWithAAD(encrypted, []byte("header")); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("DecryptWithAAD() under the previous key = %q, %v", got, err)
+	}
+	if _, err := rotated.DecryptWithAAD(encrypted, []byte("other")); err == nil {
+		t.Error("DecryptWithAAD() with a different aad succeeded")
+	}
+
+	stream := encryptStream(t, old, bytes.Repeat(data, StreamChunkSize/10), nil)
+	if got, err := io.ReadAll(rotated.DecryptStream(bytes.NewReader(stream), nil)); err != nil || len(got) != len(data)*(StreamChunkSize/10) {
+		t.Errorf("DecryptStream() under the previous key read %d bytes, %v", len(got), err)
+	}
+
+	// new content is encrypted under the new key only
+	encrypted, err = rotated.Encrypt(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Decrypt(encrypted); err == nil {
+		t.Error("content encrypted after the rotation decrypts under the previous key")
+	}
+
+	if rotated.KeyID() == old.KeyID() || len(rotated.KeyID()) != 16 {
+		t.Errorf("KeyID() = %q, %q, want distinct IDs of 16 characters", rotated.KeyID(), old.KeyID())
+	}
+
+	if _, err := NewService(newKey, "invalid-base64!"); err == nil {
+		t.Error("NewService() accepted an invalid previous key")
+	}
+}
@@ -0,0 +1,33 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// ContentHasher computes keyed hashes of snippet content to find identical
+// snippets. Without the key a hash can't be matched against guessed content.
+type ContentHasher struct {
+	key []byte
+}
+
+func NewContentHasher(key string) (*ContentHasher, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash key: %w", err)
+	}
+	if len(raw) < 16 {
+		return nil, errors.New("hash key must be at least 16 bytes when decoded")
+	}
+	return &ContentHasher{key: raw}, nil
+}
+
+// Sum returns the HMAC-SHA256 of content.
+func (h *ContentHasher) Sum(content []byte) []byte {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(content)
+	return mac.Sum(nil)
+}
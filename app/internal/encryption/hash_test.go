@@ -0,0 +1,35 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestContentHasher(t *testing.T) {
+	if _, err := NewContentHasher("MTIzNDU2Nzg5MA=="); err == nil {
+		t.Error("NewContentHasher accepted a 10 byte key")
+	}
+
+	h, err := NewContentHasher("MTIzNDU2Nzg5MDEyMzQ1Ng==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewContentHasher("NjU0MzIxMDk4NzY1NDMyMQ==")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := h.Sum([]byte("panic: runtime error"))
+	if len(sum) != 32 {
+		t.Fatalf("Sum is %d bytes, want 32", len(sum))
+	}
+	if !bytes.Equal(sum, h.Sum([]byte("panic: runtime error"))) {
+		t.Error("Sum is not deterministic")
+	}
+	if bytes.Equal(sum, h.Sum([]byte("panic: runtime error!"))) {
+		t.Error("different content has the same hash")
+	}
+	if bytes.Equal(sum, other.Sum([]byte("panic: runtime error"))) {
+		t.Error("different keys produce the same hash")
+	}
+}
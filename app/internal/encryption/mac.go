@@ -0,0 +1,34 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// Sign returns the HMAC-SHA256 of data under a key derived from the system
+// key for purpose, for values handed to clients that must come back
+// unchanged. Each purpose has its own key, a value signed for one doesn't
+// verify for another.
+func (s *Service) Sign(purpose string, data []byte) []byte {
+	return sign(s.systemKey, purpose, data)
+}
+
+// Verify reports whether mac is the signature of data for purpose under
+// the system key or a previous one, values signed before a key rotation
+// verify until the previous key is removed.
+func (s *Service) Verify(purpose string, data, mac []byte) bool {
+	for _, key := range s.keys() {
+		if hmac.Equal(mac, sign(key, purpose, data)) {
+			return true
+		}
+	}
+	return false
+}
+
+func sign(key []byte, purpose string, data []byte) []byte {
+	derive := hmac.New(sha256.New, key)
+	derive.Write([]byte("snippets/sign/" + purpose))
+	mac := hmac.New(sha256.New, derive.Sum(nil))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,36 @@
+package encryption
+
+import "testing"
+
+func TestService_SignVerify(t *testing.T) {
+	const oldKey, newKey = "MTIzNDU2Nzg5MDEyMzQ1Ng==", "MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI="
+	old, err := NewService(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewService(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("0/16B3748")
+
+	mac := old.Sign("token", data)
+	if !old.Verify("token", data, mac) {
+		t.Error("Verify() rejected its own signature")
+	}
+	if old.Verify("token", []byte("0/16B3749"), mac) {
+		t.Error("Verify() accepted the signature of other data")
+	}
+	if old.Verify("other", data, mac) {
+		t.Error("Verify() accepted a signature made for another purpose")
+	}
+	if old.Verify("token", data, mac[:16]) {
+		t.Error("Verify() accepted a truncated signature")
+	}
+	if !rotated.Verify("token", data, mac) {
+		t.Error("Verify() rejected a signature made under the previous key")
+	}
+	if old.Verify("token", data, rotated.Sign("token", data)) {
+		t.Error("Verify() accepted a signature made under an unknown key")
+	}
+}
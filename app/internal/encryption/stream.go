@@ -0,0 +1,271 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+	"snippets.adelh.dev/app/internal/metrics"
+)
+
+// Streams are encrypted in chunks so that neither side has to hold more
+// than one chunk in memory:
+//
+//	salt | chunk 0 | chunk 1 | ... | chunk n
+//
+// Each stream is encrypted under its own key, derived from the system key
+// and the random salt with HKDF-SHA256, so nonces only need to be unique
+// within a stream. A chunk is AES-GCM over StreamChunkSize bytes of
+// plaintext, the last one over what is left, possibly nothing. Its nonce is
+// the chunk index followed by a flag set only on the last chunk: reordered,
+// dropped or appended chunks fail authentication, and so does a stream cut
+// off at a chunk boundary, since its new last chunk wasn't sealed as one.
+const (
+	// StreamChunkSize is the plaintext size of every chunk but the last.
+	StreamChunkSize = 64 * 1024
+
+	streamSaltSize = 32
+	streamTagSize  = 16
+)
+
+var (
+	// ErrStreamTruncated is returned when an encrypted stream ends before
+	// its last chunk.
+	ErrStreamTruncated = errors.New("encrypted stream is truncated")
+	// ErrStreamCorrupt is returned when a chunk fails authentication.
+	ErrStreamCorrupt = errors.New("encrypted stream is corrupt")
+)
+
+var streamInfo = []byte("snippets stream v1")
+
+func streamCipher(systemKey, salt []byte) (cipher.AEAD, error) {
+	key := make([]byte, len(systemKey))
+	if _, err := io.ReadFull(hkdf.New(sha256.New, systemKey, salt, streamInfo), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// streamNonce returns the nonce of chunk i.
+func streamNonce(dst []byte, i uint64, last bool) []byte {
+	clear(dst)
+	binary.BigEndian.PutUint64(dst[3:11], i)
+	if last {
+		dst[11] = 1
+	}
+	return dst
+}
+
+// EncryptStream returns a writer that encrypts what is written to it to w.
+// aad is authenticated with every chunk, the same bytes must be passed to
+// DecryptStream. Close writes the last chunk, without it the stream reads
+// as truncated.
+func (s *Service) EncryptStream(w io.Writer, aad []byte) (io.WriteCloser, error) {
+	salt := make([]byte, streamSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := streamCipher(s.systemKey, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		w:     w,
+		aead:  aead,
+		aad:   aad,
+		nonce: make([]byte, aead.NonceSize()),
+		buf:   make([]byte, 0, StreamChunkSize),
+		out:   make([]byte, 0, StreamChunkSize+streamTagSize),
+	}, nil
+}
+
+type streamWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	aad   []byte
+	nonce []byte
+	// buf holds the plaintext of the next chunk. A full chunk is only
+	// sealed once more data arrives, it may turn out to be the last one.
+	buf   []byte
+	out   []byte
+	index uint64
+	err   error
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		if sw.err != nil {
+			return n, sw.err
+		}
+		if len(sw.buf) == StreamChunkSize {
+			sw.err = sw.flush(false)
+			continue
+		}
+		m := copy(sw.buf[len(sw.buf):StreamChunkSize], p)
+		sw.buf = sw.buf[:len(sw.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (sw *streamWriter) flush(last bool) error {
+	start := time.Now()
+	sw.out = sw.aead.Seal(sw.out[:0], streamNonce(sw.nonce, sw.index, last), sw.buf, sw.aad)
+	metrics.CryptoDuration(metrics.Encrypt, start)
+	sw.buf = sw.buf[:0]
+	sw.index++
+	_, err := sw.w.Write(sw.out)
+	return err
+}
+
+// Close seals the last chunk. It does not close the underlying writer.
+func (sw *streamWriter) Close() error {
+	if sw.err != nil {
+		return sw.err
+	}
+	sw.err = sw.flush(true)
+	if sw.err != nil {
+		return sw.err
+	}
+	sw.err = errors.New("write to closed stream")
+	return nil
+}
+
+// DecryptStream returns a reader of the plaintext of a stream written by
+// EncryptStream with the same aad, under the system key or a previous one.
+// Chunks are authenticated before any of their plaintext is returned. A
+// stream that ends early fails with ErrStreamTruncated instead of io.EOF, a
+// tampered one with ErrStreamCorrupt.
+func (s *Service) DecryptStream(r io.Reader, aad []byte) io.Reader {
+	return &streamReader{
+		s:   s,
+		r:   bufio.NewReader(r),
+		aad: aad,
+		buf: make([]byte, StreamChunkSize+streamTagSize),
+		out: make([]byte, 0, StreamChunkSize),
+	}
+}
+
+type streamReader struct {
+	s   *Service
+	r   *bufio.Reader
+	aad []byte
+	// aeads are the ciphers of every key until the first chunk tells which
+	// one the stream was encrypted with.
+	aeads []cipher.AEAD
+	// nonce is nil until the salt has been read
+	nonce []byte
+	buf   []byte
+	out   []byte
+	// plain is the unread part of out
+	plain []byte
+	index uint64
+	err   error
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	for len(sr.plain) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		sr.err = sr.next()
+	}
+	n := copy(p, sr.plain)
+	sr.plain = sr.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk into plain. It returns io.EOF once the last
+// chunk has been read.
+func (sr *streamReader) next() error {
+	if sr.nonce == nil {
+		salt := make([]byte, streamSaltSize)
+		if _, err := io.ReadFull(sr.r, salt); err != nil {
+			return sr.readError(err)
+		}
+		for _, key := range sr.s.keys() {
+			aead, err := streamCipher(key, salt)
+			if err != nil {
+				return err
+			}
+			sr.aeads = append(sr.aeads, aead)
+		}
+		sr.nonce = make([]byte, sr.aeads[0].NonceSize())
+	}
+
+	n, err := io.ReadFull(sr.r, sr.buf)
+	var last bool
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return err
+	default:
+		// a full chunk is the last one if nothing follows it
+		_, err := sr.r.Peek(1)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		last = errors.Is(err, io.EOF)
+	}
+	if n < streamTagSize {
+		return ErrStreamTruncated
+	}
+
+	start := time.Now()
+	plain, err := sr.open(sr.out[:0], sr.buf[:n], last)
+	metrics.CryptoDuration(metrics.Decrypt, start)
+	if err != nil {
+		// a chunk that opens as an intermediate one was cut off after it
+		if last {
+			if _, err := sr.open(nil, sr.buf[:n], false); err == nil {
+				return ErrStreamTruncated
+			}
+		}
+		return ErrStreamCorrupt
+	}
+	sr.plain = plain
+	sr.index++
+	if last {
+		return io.EOF
+	}
+	return nil
+}
+
+// open authenticates and decrypts the current chunk. Once a chunk opens
+// only the cipher that opened it is kept.
+func (sr *streamReader) open(dst, chunk []byte, last bool) ([]byte, error) {
+	nonce := streamNonce(sr.nonce, sr.index, last)
+	var err error
+	for i, aead := range sr.aeads {
+		var plain []byte
+		if plain, err = aead.Open(dst, nonce, chunk, sr.aad); err == nil {
+			sr.aeads = sr.aeads[i : i+1]
+			return plain, nil
+		}
+	}
+	return nil, err
+}
+
+func (sr *streamReader) readError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrStreamTruncated
+	}
+	return err
+}
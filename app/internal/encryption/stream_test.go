@@ -0,0 +1,126 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func encryptStream(t *testing.T, s *Service, plaintext, aad []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := s.EncryptStream(&buf, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// odd write sizes exercise chunks filled across writes
+	for p := plaintext; len(p) > 0; {
+		n := min(len(p), 1000)
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStream_RoundTrip(t *testing.T) {
+	s, _ := NewService("MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI=")
+	aad := []byte("header")
+
+	for _, size := range []int{0, 1, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3*StreamChunkSize + 17} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		stored := encryptStream(t, s, plaintext, aad)
+		chunks := max(1, (size+StreamChunkSize-1)/StreamChunkSize)
+		if size > 0 && size%StreamChunkSize == 0 {
+			// a full last chunk is followed by nothing, not an empty chunk
+			chunks = size / StreamChunkSize
+		}
+		if want := streamSaltSize + size + chunks*streamTagSize; len(stored) != want {
+			t.Errorf("size %d: stream is %d bytes, want %d", size, len(stored), want)
+		}
+
+		got, err := io.ReadAll(s.DecryptStream(iotest.OneByteReader(bytes.NewReader(stored)), aad))
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: plaintext differs after round trip", size)
+		}
+	}
+}
+
+func TestStream_Tampering(t *testing.T) {
+	s, _ := NewService("MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI=")
+	aad := []byte("header")
+	plaintext := bytes.Repeat([]byte("chunked "), StreamChunkSize/2)
+	stored := encryptStream(t, s, plaintext, aad)
+	chunkLen := StreamChunkSize + streamTagSize
+
+	// stored holds the salt and 4 full chunks
+	if len(stored) != streamSaltSize+4*chunkLen {
+		t.Fatalf("unexpected stream length %d", len(stored))
+	}
+	chunk := func(i int) []byte {
+		start := streamSaltSize + i*chunkLen
+		return stored[start:min(start+chunkLen, len(stored))]
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	flipped := bytes.Clone(stored)
+	flipped[streamSaltSize+chunkLen+5] ^= 1
+
+	tests := []struct {
+		name   string
+		stored []byte
+		aad    []byte
+		want   error
+	}{
+		{"empty", nil, aad, ErrStreamTruncated},
+		{"salt only", stored[:streamSaltSize], aad, ErrStreamTruncated},
+		{"cut at chunk boundary", stored[:streamSaltSize+chunkLen], aad, ErrStreamTruncated},
+		{"last chunk dropped", stored[:len(stored)-chunkLen], aad, ErrStreamTruncated},
+		{"cut inside a chunk", stored[:streamSaltSize+chunkLen+100], aad, ErrStreamCorrupt},
+		{"flipped bit", flipped, aad, ErrStreamCorrupt},
+		{"reordered", join(stored[:streamSaltSize], chunk(1), chunk(0), chunk(2), chunk(3)), aad, ErrStreamCorrupt},
+		{"appended", join(stored, chunk(1)), aad, ErrStreamCorrupt},
+		{"wrong aad", stored, []byte("other"), ErrStreamCorrupt},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := io.ReadAll(s.DecryptStream(bytes.NewReader(tc.stored), tc.aad))
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("error = %v, want %v", err, tc.want)
+			}
+			// only whole authenticated chunks are returned
+			if len(got)%StreamChunkSize != 0 || !bytes.Equal(got, plaintext[:len(got)]) {
+				t.Errorf("returned %d bytes of unauthenticated plaintext", len(got))
+			}
+		})
+	}
+}
+
+func TestStream_FreshKeys(t *testing.T) {
+	s, _ := NewService("MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI=")
+	plaintext := []byte("same content")
+
+	a := encryptStream(t, s, plaintext, nil)
+	b := encryptStream(t, s, plaintext, nil)
+	if bytes.Equal(a[streamSaltSize:], b[streamSaltSize:]) {
+		t.Error("two streams of the same plaintext encrypted identically")
+	}
+
+	other, _ := NewService("MTIzNDU2Nzg5MDEyMzQ1Ng==")
+	if _, err := io.ReadAll(other.DecryptStream(bytes.NewReader(a), nil)); !errors.Is(err, ErrStreamCorrupt) {
+		t.Errorf("decrypting with another key: error = %v, want ErrStreamCorrupt", err)
+	}
+}
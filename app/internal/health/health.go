@@ -0,0 +1,273 @@
+// Package health serves the liveness and readiness endpoints of the API.
+//
+// Liveness only tells that the process serves requests. Readiness runs the
+// registered checks of the dependencies: a required check that fails makes
+// the instance not ready, an optional one only degrades it, so an outage of
+// a cache doesn't take every instance out of the load balancer.
+//
+// The public readiness endpoint only reports the status of each check, the
+// errors and details, which name hosts and replicas, are logged and served
+// to operators by ReadyDetail.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Status is the outcome of a check or of all of them.
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded"
+	StatusFailing  Status = "failing"
+)
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status   Status `json:"status"`
+	Required bool   `json:"required"`
+	Error    string `json:"error,omitempty"`
+	Detail   any    `json:"detail,omitempty"`
+}
+
+// OK returns a passing result with optional detail.
+func OK(detail any) Result {
+	return Result{Status: StatusOK, Detail: detail}
+}
+
+// Degraded returns a result for a dependency that works only partially.
+func Degraded(err error, detail any) Result {
+	return Result{Status: StatusDegraded, Error: errorString(err), Detail: detail}
+}
+
+// Failing returns a result for a dependency that doesn't work.
+func Failing(err error) Result {
+	return Result{Status: StatusFailing, Error: errorString(err)}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Ping turns a function that reports whether a dependency is reachable into
+// a check function.
+func Ping(ping func(ctx context.Context) error) func(ctx context.Context) Result {
+	return func(ctx context.Context) Result {
+		if err := ping(ctx); err != nil {
+			return Failing(err)
+		}
+		return OK(nil)
+	}
+}
+
+// Check is a named readiness check of a dependency.
+type Check struct {
+	Name string
+	// Required checks that fail make the instance not ready, others only
+	// degrade it.
+	Required bool
+	// Every reuses a result for that long, for checks too costly to run on
+	// every probe. Concurrent probes that find it expired share a single
+	// run. Zero runs the check every time.
+	Every time.Duration
+	Run   func(ctx context.Context) Result
+}
+
+// Report is the readiness of the instance with the results of every check.
+type Report struct {
+	Status       Status            `json:"status"`
+	ShuttingDown bool              `json:"shuttingDown,omitempty"`
+	Checks       map[string]Result `json:"checks,omitempty"`
+}
+
+// Checker runs the readiness checks.
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+	now     func() time.Time
+
+	shuttingDown atomic.Bool
+
+	// refreshing runs the checks with an expired cached result once for
+	// all the probes waiting on it.
+	refreshing singleflight.Group
+
+	mu     sync.Mutex
+	cached map[string]cachedResult
+	// last is the status of each check on the previous run, changes are
+	// logged.
+	last map[string]Status
+}
+
+type cachedResult struct {
+	result  Result
+	expires time.Time
+}
+
+// NewChecker returns a Checker that gives each check up to timeout.
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		timeout: timeout,
+		now:     time.Now,
+		cached:  map[string]cachedResult{},
+		last:    map[string]Status{},
+	}
+}
+
+// SetShuttingDown makes the instance not ready for good, load balancers
+// stop sending it requests while the in-flight ones are drained.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Check runs every check concurrently and combines their results.
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusFailing, ShuttingDown: true}
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	for i, check := range c.checks {
+		res := results[i]
+		report.Checks[check.Name] = res
+		switch {
+		case res.Status == StatusFailing && check.Required:
+			report.Status = StatusFailing
+		case res.Status != StatusOK && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	c.logChanges(report)
+	return report
+}
+
+// logChanges logs the checks whose status changed since the previous run,
+// with their error. Probes run every few seconds, a check that stays
+// failing is logged once.
+func (c *Checker) logChanges(report Report) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, res := range report.Checks {
+		last, seen := c.last[name]
+		c.last[name] = res.Status
+		switch {
+		case res.Status != StatusOK && res.Status != last:
+			slog.Warn("readiness check not ok", "check", name, "status", res.Status, "required", res.Required, "error", res.Error)
+		case res.Status == StatusOK && seen && last != StatusOK:
+			slog.Info("readiness check ok again", "check", name)
+		}
+	}
+}
+
+// Summary returns the report with only the status of each check, without
+// their errors and details.
+func (r Report) Summary() Report {
+	if r.Checks == nil {
+		return r
+	}
+	checks := make(map[string]Result, len(r.Checks))
+	for name, res := range r.Checks {
+		checks[name] = Result{Status: res.Status, Required: res.Required}
+	}
+	r.Checks = checks
+	return r
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	if check.Every == 0 {
+		return c.runCheck(ctx, check)
+	}
+
+	c.mu.Lock()
+	cached, ok := c.cached[check.Name]
+	c.mu.Unlock()
+	if ok && c.now().Before(cached.expires) {
+		return cached.result
+	}
+
+	// the result is shared, the probe that happens to start the run
+	// going away must not fail it for the others
+	shared := context.WithoutCancel(ctx)
+	ch := c.refreshing.DoChan(check.Name, func() (any, error) {
+		res := c.runCheck(shared, check)
+		c.mu.Lock()
+		c.cached[check.Name] = cachedResult{result: res, expires: c.now().Add(check.Every)}
+		c.mu.Unlock()
+		return res, nil
+	})
+	select {
+	case r := <-ch:
+		return r.Val.(Result)
+	case <-ctx.Done():
+		return Result{Status: StatusFailing, Required: check.Required, Error: ctx.Err().Error()}
+	}
+}
+
+// runCheck runs check within the timeout of the checker.
+func (c *Checker) runCheck(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	res := check.Run(ctx)
+	res.Required = check.Required
+	return res
+}
+
+// Live answers liveness probes, it doesn't check any dependency.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Ready answers readiness probes with the summary of the checks, see
+// Report.Summary. It fails with 503 if a required check fails or the
+// instance is shutting down.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+	writeReport(w, readyStatus(report), report.Summary())
+}
+
+// ReadyDetail answers like Ready with the full report, errors and details
+// of the checks included, for operators rather than the public listener.
+func (c *Checker) ReadyDetail(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+	writeReport(w, readyStatus(report), report)
+}
+
+func readyStatus(report Report) int {
+	if report.Status == StatusFailing {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.Error("failed to write health report", "error", err)
+	}
+}
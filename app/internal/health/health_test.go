@@ -0,0 +1,190 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func result(res Result) func(context.Context) Result {
+	return func(context.Context) Result { return res }
+}
+
+func TestChecker_Check(t *testing.T) {
+	down := errors.New("connection refused")
+
+	tests := []struct {
+		name   string
+		checks []Check
+		want   Status
+	}{
+		{"no checks", nil, StatusOK},
+		{"all passing", []Check{
+			{Name: "primary", Required: true, Run: result(OK(nil))},
+			{Name: "redis", Run: result(OK(nil))},
+		}, StatusOK},
+		{"optional failing", []Check{
+			{Name: "primary", Required: true, Run: result(OK(nil))},
+			{Name: "redis", Run: result(Failing(down))},
+		}, StatusDegraded},
+		{"required degraded", []Check{
+			{Name: "replicas", Required: true, Run: result(Degraded(down, nil))},
+		}, StatusDegraded},
+		{"required failing", []Check{
+			{Name: "primary", Required: true, Run: result(Failing(down))},
+			{Name: "redis", Run: result(Failing(down))},
+		}, StatusFailing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewChecker(time.Second, tt.checks...).Check(context.Background())
+			if report.Status != tt.want {
+				t.Errorf("status = %q, want %q", report.Status, tt.want)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("got %d results, want %d", len(report.Checks), len(tt.checks))
+			}
+			for _, check := range tt.checks {
+				if report.Checks[check.Name].Required != check.Required {
+					t.Errorf("%s: required not reported", check.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	c := NewChecker(10*time.Millisecond, Check{
+		Name:     "primary",
+		Required: true,
+		Run: Ping(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	})
+	report := c.Check(context.Background())
+	if report.Status != StatusFailing {
+		t.Errorf("status = %q, want %q", report.Status, StatusFailing)
+	}
+	if report.Checks["primary"].Error == "" {
+		t.Error("timed out check reported no error")
+	}
+}
+
+func TestChecker_Every(t *testing.T) {
+	runs := 0
+	c := NewChecker(time.Second, Check{
+		Name:  "schema",
+		Every: time.Minute,
+		Run: func(context.Context) Result {
+			runs++
+			return OK(nil)
+		},
+	})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Check(context.Background())
+	c.Check(context.Background())
+	if runs != 1 {
+		t.Errorf("check ran %d times within its interval, want 1", runs)
+	}
+
+	now = now.Add(time.Minute)
+	c.Check(context.Background())
+	if runs != 2 {
+		t.Errorf("check ran %d times after its interval, want 2", runs)
+	}
+}
+
+func TestChecker_EveryRunsOnce(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	c := NewChecker(time.Second, Check{
+		Name:  "schema",
+		Every: time.Minute,
+		Run: func(context.Context) Result {
+			runs.Add(1)
+			<-release
+			return OK(nil)
+		},
+	})
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if report := c.Check(context.Background()); report.Status != StatusOK {
+				t.Errorf("status = %q, want %q", report.Status, StatusOK)
+			}
+		}()
+	}
+	// let the probes pile up behind the first run
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := runs.Load(); n != 1 {
+		t.Errorf("check ran %d times for concurrent probes, want 1", n)
+	}
+}
+
+func TestChecker_Handlers(t *testing.T) {
+	failing := true
+	c := NewChecker(time.Second, Check{
+		Name:     "primary",
+		Required: true,
+		Run: Ping(func(context.Context) error {
+			if failing {
+				return errors.New("connection refused")
+			}
+			return nil
+		}),
+	})
+
+	probe := func(h http.HandlerFunc) (int, Report) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		var report Report
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, report
+	}
+
+	if code, _ := probe(c.Live); code != http.StatusOK {
+		t.Errorf("live with failing dependency = %d, want 200", code)
+	}
+	code, report := probe(c.Ready)
+	if code != http.StatusServiceUnavailable || report.Checks["primary"].Status != StatusFailing {
+		t.Errorf("ready with failing primary = %d %+v", code, report)
+	}
+	if report.Checks["primary"].Error != "" {
+		t.Errorf("ready reports the error %q, only the detailed report should", report.Checks["primary"].Error)
+	}
+	code, report = probe(c.ReadyDetail)
+	if code != http.StatusServiceUnavailable || report.Checks["primary"].Error != "connection refused" {
+		t.Errorf("detailed ready with failing primary = %d %+v", code, report)
+	}
+
+	failing = false
+	if code, _ := probe(c.Ready); code != http.StatusOK {
+		t.Errorf("ready = %d, want 200", code)
+	}
+
+	c.SetShuttingDown()
+	code, report = probe(c.Ready)
+	if code != http.StatusServiceUnavailable || !report.ShuttingDown {
+		t.Errorf("ready while shutting down = %d %+v", code, report)
+	}
+	if code, _ := probe(c.Live); code != http.StatusOK {
+		t.Errorf("live while shutting down = %d, want 200", code)
+	}
+}
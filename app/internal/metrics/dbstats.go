@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dbMaxOpen = prometheus.NewDesc(namespace+"_db_max_open_connections",
+		"Maximum number of open connections to the database.", []string{"db"}, nil)
+	dbOpen = prometheus.NewDesc(namespace+"_db_open_connections",
+		"Established connections to the database, in use and idle.", []string{"db"}, nil)
+	dbInUse = prometheus.NewDesc(namespace+"_db_in_use_connections",
+		"Connections to the database currently in use.", []string{"db"}, nil)
+	dbIdle = prometheus.NewDesc(namespace+"_db_idle_connections",
+		"Idle connections to the database.", []string{"db"}, nil)
+	dbWaitCount = prometheus.NewDesc(namespace+"_db_wait_count_total",
+		"Connections waited for.", []string{"db"}, nil)
+	dbWaitDuration = prometheus.NewDesc(namespace+"_db_wait_duration_seconds_total",
+		"Time blocked waiting for a connection.", []string{"db"}, nil)
+	dbMaxIdleClosed = prometheus.NewDesc(namespace+"_db_max_idle_closed_total",
+		"Connections closed due to the maximum of idle connections.", []string{"db"}, nil)
+	dbMaxIdleTimeClosed = prometheus.NewDesc(namespace+"_db_max_idle_time_closed_total",
+		"Connections closed due to the maximum idle time.", []string{"db"}, nil)
+	dbMaxLifetimeClosed = prometheus.NewDesc(namespace+"_db_max_lifetime_closed_total",
+		"Connections closed due to the maximum connection lifetime.", []string{"db"}, nil)
+)
+
+// dbStatsCollector reads the pool statistics when scraped, they are kept by
+// the pools themselves.
+type dbStatsCollector struct {
+	stats func() map[string]sql.DBStats
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxOpen
+	ch <- dbOpen
+	ch <- dbInUse
+	ch <- dbIdle
+	ch <- dbWaitCount
+	ch <- dbWaitDuration
+	ch <- dbMaxIdleClosed
+	ch <- dbMaxIdleTimeClosed
+	ch <- dbMaxLifetimeClosed
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, st := range c.stats() {
+		ch <- prometheus.MustNewConstMetric(dbMaxOpen, prometheus.GaugeValue, float64(st.MaxOpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(dbOpen, prometheus.GaugeValue, float64(st.OpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(dbInUse, prometheus.GaugeValue, float64(st.InUse), name)
+		ch <- prometheus.MustNewConstMetric(dbIdle, prometheus.GaugeValue, float64(st.Idle), name)
+		ch <- prometheus.MustNewConstMetric(dbWaitCount, prometheus.CounterValue, float64(st.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(dbWaitDuration, prometheus.CounterValue, st.WaitDuration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(dbMaxIdleClosed, prometheus.CounterValue, float64(st.MaxIdleClosed), name)
+		ch <- prometheus.MustNewConstMetric(dbMaxIdleTimeClosed, prometheus.CounterValue, float64(st.MaxIdleTimeClosed), name)
+		ch <- prometheus.MustNewConstMetric(dbMaxLifetimeClosed, prometheus.CounterValue, float64(st.MaxLifetimeClosed), name)
+	}
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unmatchedRoute labels requests no route matched, their paths are not used
+// as labels so they can't grow the number of series without bound.
+const unmatchedRoute = "unmatched"
+
+// otherMethod labels requests with a method not defined by HTTP, any token
+// is a valid method and clients choose them freely.
+const otherMethod = "OTHER"
+
+// methodLabel returns the method label of a request.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
+
+// InstrumentHandler counts and times the requests served by mux, labelled
+// with the pattern of the route that served them. It must wrap the
+// http.ServeMux directly: the mux records the pattern on the request it is
+// given, not on a copy made by another middleware.
+func InstrumentHandler(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpInFlight.Inc()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			httpInFlight.Dec()
+			route := unmatchedRoute
+			if r.Pattern != "" {
+				// patterns are registered with their method
+				_, path, found := strings.Cut(r.Pattern, " ")
+				if !found {
+					path = r.Pattern
+				}
+				route = path
+			}
+			method := methodLabel(r.Method)
+			httpRequests.WithLabelValues(method, route, strconv.Itoa(rec.status)).Inc()
+			httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		}()
+		mux.ServeHTTP(rec, r)
+	})
+}
+
+// statusRecorder records the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.status, rec.wroteHeader = code, true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
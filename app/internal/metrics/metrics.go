@@ -0,0 +1,127 @@
+// Package metrics collects the Prometheus metrics of the API and serves them
+// in the text exposition format.
+//
+// The collectors are registered on Registry when the package is loaded, the
+// packages that produce a metric report it through the functions here so
+// they don't depend on the Prometheus client.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "snippets"
+
+// Registry holds every metric of the API, along with the Go runtime and
+// process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route pattern and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by route pattern.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "route"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being served.",
+	})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache operations, by operation and result.",
+	}, []string{"op", "result"})
+
+	cryptoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "crypto_duration_seconds",
+		Help:      "Time taken to encrypt and decrypt content, streams are timed per chunk.",
+		Buckets:   prometheus.ExponentialBuckets(1e-6, 4, 10),
+	}, []string{"op"})
+
+	snippetEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "snippet_events_total",
+		Help:      "Snippet lifecycle events.",
+	}, []string{"event"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		httpInFlight,
+		cacheRequests,
+		cryptoDuration,
+		snippetEvents,
+	)
+}
+
+// Handler serves the metrics of Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Cache operation results, reads hit or miss and writes are ok.
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheOK    = "ok"
+	CacheError = "error"
+)
+
+// CacheRequest counts a cache operation op with one of the Cache results.
+func CacheRequest(op, result string) {
+	cacheRequests.WithLabelValues(op, result).Inc()
+}
+
+// Crypto operations.
+const (
+	Encrypt = "encrypt"
+	Decrypt = "decrypt"
+)
+
+// CryptoDuration records the time taken by a crypto operation started at
+// start.
+func CryptoDuration(op string, start time.Time) {
+	cryptoDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// Snippet lifecycle events.
+const (
+	SnippetCreated  = "created"
+	SnippetViewed   = "viewed"
+	SnippetDeleted  = "deleted"
+	SnippetRestored = "restored"
+	SnippetExpired  = "expired"
+	SnippetPurged   = "purged"
+)
+
+// SnippetEvents counts n snippet lifecycle events.
+func SnippetEvents(event string, n int) {
+	snippetEvents.WithLabelValues(event).Add(float64(n))
+}
+
+// RegisterDBStats exports the connection pool statistics returned by stats,
+// keyed by the name of the database, on every scrape.
+func RegisterDBStats(stats func() map[string]sql.DBStats) error {
+	return Registry.Register(&dbStatsCollector{stats: stats})
+}
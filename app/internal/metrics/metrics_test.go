@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /snippets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("content"))
+	})
+	handler := InstrumentHandler(mux)
+
+	for _, path := range []string{"/snippets/a", "/snippets/b", "/snippets/missing", "/unknown/path"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	tests := []struct {
+		route, code string
+		want        float64
+	}{
+		{"/snippets/{id}", "200", 2},
+		{"/snippets/{id}", "404", 1},
+		{unmatchedRoute, "404", 1},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET", tt.route, tt.code)); got != tt.want {
+			t.Errorf("requests to %s with %s = %v, want %v", tt.route, tt.code, got, tt.want)
+		}
+	}
+	for _, method := range []string{"FOO", "BAR"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/unknown/path", nil))
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues(otherMethod, unmatchedRoute, "404")); got != 2 {
+		t.Errorf("requests with unknown methods = %v, want 2 labelled %s", got, otherMethod)
+	}
+	if got := testutil.CollectAndCount(httpRequests); got != 4 {
+		t.Errorf("%d request series, want 4", got)
+	}
+	if got := testutil.ToFloat64(httpInFlight); got != 0 {
+		t.Errorf("in flight after all requests completed = %v", got)
+	}
+}
+
+func TestDBStatsCollector(t *testing.T) {
+	c := &dbStatsCollector{stats: func() map[string]sql.DBStats {
+		return map[string]sql.DBStats{
+			"primary":   {MaxOpenConnections: 10, OpenConnections: 3, InUse: 2, Idle: 1, WaitDuration: 1500 * time.Millisecond},
+			"replica-0": {OpenConnections: 1},
+		}
+	}}
+
+	want := `
+# HELP snippets_db_in_use_connections Connections to the database currently in use.
+# TYPE snippets_db_in_use_connections gauge
+snippets_db_in_use_connections{db="primary"} 2
+snippets_db_in_use_connections{db="replica-0"} 0
+# HELP snippets_db_wait_duration_seconds_total Time blocked waiting for a connection.
+# TYPE snippets_db_wait_duration_seconds_total counter
+snippets_db_wait_duration_seconds_total{db="primary"} 1.5
+snippets_db_wait_duration_seconds_total{db="replica-0"} 0
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"snippets_db_in_use_connections", "snippets_db_wait_duration_seconds_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	SnippetEvents(SnippetCreated, 1)
+	CacheRequest("get", CacheHit)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{"snippets_snippet_events_total", "snippets_cache_requests_total", "go_goroutines"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("%s missing from the exposition", name)
+		}
+	}
+}
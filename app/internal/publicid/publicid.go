@@ -0,0 +1,122 @@
+// Package publicid generates the random public IDs snippets are addressed by.
+package publicid
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Separator joins the segments of an ID.
+const Separator = '-'
+
+// MaxLen is the longest ID, separators included, the database column holds.
+const MaxLen = 64
+
+// Default produces Google Meet-style IDs like abc-defg-hij. The alphabet
+// leaves out characters that are easily confused, such as l, 0 and 1.
+var Default = Format{
+	Alphabet: "abcdefghijkmnopqrstuvwxyz23456789",
+	Segments: []int{3, 4, 3},
+}
+
+// Format describes the layout of generated IDs.
+type Format struct {
+	// Alphabet holds the characters IDs are made of.
+	Alphabet string
+	// Segments are the lengths of the separated groups of characters.
+	Segments []int
+}
+
+// NewFormat returns a validated Format.
+func NewFormat(alphabet string, segments []int) (Format, error) {
+	f := Format{Alphabet: alphabet, Segments: segments}
+	return f, f.Validate()
+}
+
+// Validate reports whether f can produce IDs.
+func (f Format) Validate() error {
+	if len(f.Alphabet) < 2 {
+		return errors.New("public ID alphabet needs at least two characters")
+	}
+	seen := make(map[rune]bool, len(f.Alphabet))
+	for _, c := range f.Alphabet {
+		if c > 127 {
+			return fmt.Errorf("public ID alphabet must be ASCII, got %q", c)
+		}
+		if c == Separator || c == '/' || c <= ' ' {
+			return fmt.Errorf("public ID alphabet must not contain %q", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("public ID alphabet contains %q twice", c)
+		}
+		seen[c] = true
+	}
+
+	if len(f.Segments) == 0 {
+		return errors.New("public ID needs at least one segment")
+	}
+	for _, n := range f.Segments {
+		if n <= 0 {
+			return fmt.Errorf("public ID segment length must be positive, got %d", n)
+		}
+	}
+	if n := f.Len(); n > MaxLen {
+		return fmt.Errorf("public ID length %d exceeds %d", n, MaxLen)
+	}
+	return nil
+}
+
+// Len returns the length of IDs including separators.
+func (f Format) Len() int {
+	n := len(f.Segments) - 1
+	for _, s := range f.Segments {
+		n += s
+	}
+	return n
+}
+
+// New returns a random ID read from crypto/rand. f must be valid.
+func (f Format) New() (string, error) {
+	alphabetLen := big.NewInt(int64(len(f.Alphabet)))
+
+	var sb strings.Builder
+	sb.Grow(f.Len())
+	for i, n := range f.Segments {
+		if i > 0 {
+			sb.WriteByte(Separator)
+		}
+		for range n {
+			idx, err := rand.Int(rand.Reader, alphabetLen)
+			if err != nil {
+				return "", fmt.Errorf("failed to generate public ID: %w", err)
+			}
+			sb.WriteByte(f.Alphabet[idx.Int64()])
+		}
+	}
+	return sb.String(), nil
+}
+
+// Match reports whether id has the layout of f.
+func (f Format) Match(id string) bool {
+	if len(id) != f.Len() {
+		return false
+	}
+	segments := strings.Split(id, string(Separator))
+	if len(segments) != len(f.Segments) {
+		return false
+	}
+	for i, s := range segments {
+		if len(s) != f.Segments[i] {
+			return false
+		}
+		for _, c := range s {
+			if !strings.ContainsRune(f.Alphabet, c) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package publicid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultFormat(t *testing.T) {
+	if err := Default.Validate(); err != nil {
+		t.Fatalf("Default.Validate() = %v", err)
+	}
+
+	seen := map[string]bool{}
+	for range 1000 {
+		id, err := Default.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(id) != 12 || id[3] != '-' || id[8] != '-' {
+			t.Fatalf("New() = %q, want abc-defg-hij layout", id)
+		}
+		if !Default.Match(id) {
+			t.Fatalf("Match(%q) = false for a generated ID", id)
+		}
+		if seen[id] {
+			t.Fatalf("New() returned %q twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestCustomFormat(t *testing.T) {
+	f, err := NewFormat("0123456789ABCDEF", []int{8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := f.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != 8 || strings.Trim(id, "0123456789ABCDEF") != "" {
+		t.Errorf("New() = %q, want 8 hex digits", id)
+	}
+}
+
+func TestFormatValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		segments []int
+		wantErr  bool
+	}{
+		{"default", Default.Alphabet, Default.Segments, false},
+		{"single segment", "ab", []int{20}, false},
+		{"short alphabet", "a", []int{3}, true},
+		{"separator in alphabet", "ab-", []int{3}, true},
+		{"slash in alphabet", "ab/", []int{3}, true},
+		{"duplicate character", "abca", []int{3}, true},
+		{"non ASCII", "abé", []int{3}, true},
+		{"no segments", "abc", nil, true},
+		{"empty segment", "abc", []int{3, 0}, true},
+		{"too long", "abc", []int{40, 40}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFormat(tt.alphabet, tt.segments)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatMatch(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"abc-defg-hij", true},
+		{"abc-defg-hi", false},
+		{"abcd-efg-hij", false},
+		{"abc-defg-hil", false}, // l is not in the alphabet
+		{"abc-defghijk", false},
+		{"deploy-runbook", false},
+	}
+	for _, tt := range tests {
+		if got := Default.Match(tt.id); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package requestlog identifies the requests served by the API and logs
+// them, one structured record per request.
+//
+// Every request gets an ID, taken from its X-Request-ID header if the
+// caller set a usable one, and a logger carrying it, and the trace ID if
+// the request is traced. Handlers log through FromContext so their records
+// can be correlated with the request that caused them.
+package requestlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header carries the request ID, in requests and responses.
+const Header = "X-Request-ID"
+
+// maxIDLength bounds request IDs taken from callers, they end up in every
+// log record of the request.
+const maxIDLength = 128
+
+type contextKey struct{}
+
+type requestContext struct {
+	id     string
+	logger *slog.Logger
+}
+
+// FromContext returns the logger of the request ctx belongs to, or the
+// default logger outside of a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if rc, ok := ctx.Value(contextKey{}).(*requestContext); ok {
+		return rc.logger
+	}
+	return slog.Default()
+}
+
+// RequestID returns the ID of the request ctx belongs to, or an empty
+// string outside of a request.
+func RequestID(ctx context.Context) string {
+	if rc, ok := ctx.Value(contextKey{}).(*requestContext); ok {
+		return rc.id
+	}
+	return ""
+}
+
+// Options configures Middleware.
+type Options struct {
+	// Logger logs the requests, the default logger is used if it is nil.
+	Logger *slog.Logger
+	// Route returns the route pattern matching a request, an empty string
+	// if none does.
+	Route func(*http.Request) string
+	// Quiet lists the route patterns logged at debug level, such as probes
+	// and metrics scrapes.
+	Quiet []string
+}
+
+// Middleware identifies every request and logs it once it has been served.
+func Middleware(next http.Handler, opts Options) http.Handler {
+	quiet := make(map[string]bool, len(opts.Quiet))
+	for _, pattern := range opts.Quiet {
+		quiet[pattern] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(Header)
+		if !validID(id) {
+			id = newID()
+		}
+		w.Header().Set(Header, id)
+
+		base := opts.Logger
+		if base == nil {
+			base = slog.Default()
+		}
+		reqLogger := base.With("request_id", id)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			reqLogger = reqLogger.With("trace_id", sc.TraceID().String())
+		}
+		ctx := context.WithValue(r.Context(), contextKey{}, &requestContext{id: id, logger: reqLogger})
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		route := opts.Route(r)
+		defer func() {
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("route", route),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Duration("duration", time.Since(start)),
+				slog.Int64("bytes", rec.bytes),
+			}
+			if !completed {
+				// the handler panicked, the client got an incomplete response
+				reqLogger.LogAttrs(ctx, slog.LevelWarn, "request aborted", attrs...)
+				return
+			}
+			level := slog.LevelInfo
+			if quiet[route] {
+				level = slog.LevelDebug
+			}
+			reqLogger.LogAttrs(ctx, level, "request served", attrs...)
+		}()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		completed = true
+	})
+}
+
+// validID accepts IDs of printable ASCII without spaces, so a caller can't
+// forge log records with them.
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand is unavailable: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// responseRecorder records the status code and the size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.status, rec.wroteHeader = code, true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,148 @@
+package requestlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newHandler(t *testing.T, h http.HandlerFunc) (http.Handler, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /snippets/{id}", h)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {})
+	return Middleware(mux, Options{
+		Logger: logger,
+		Route: func(r *http.Request) string {
+			_, pattern := mux.Handler(r)
+			return pattern
+		},
+		Quiet: []string{"GET /healthz"},
+	}), &buf
+}
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid log record %q: %v", line, err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestMiddleware(t *testing.T) {
+	var seenID string
+	handler, buf := newHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		seenID = RequestID(r.Context())
+		FromContext(r.Context()).Error("lookup failed")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/snippets/abc", nil))
+
+	id := w.Header().Get(Header)
+	if len(id) != 32 || seenID != id {
+		t.Fatalf("request ID = %q, handler saw %q", id, seenID)
+	}
+
+	recs := records(t, buf)
+	if len(recs) != 2 {
+		t.Fatalf("got %d log records, want 2", len(recs))
+	}
+	if recs[0]["msg"] != "lookup failed" || recs[0]["request_id"] != id {
+		t.Errorf("handler record = %v, want it correlated with %s", recs[0], id)
+	}
+	want := map[string]any{
+		"msg":        "request served",
+		"request_id": id,
+		"method":     "GET",
+		"route":      "GET /snippets/{id}",
+		"path":       "/snippets/abc",
+		"status":     float64(404),
+		"bytes":      float64(len("not found")),
+	}
+	for k, v := range want {
+		if recs[1][k] != v {
+			t.Errorf("request record %s = %v, want %v", k, recs[1][k], v)
+		}
+	}
+}
+
+func TestMiddleware_RequestIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		kept   bool
+	}{
+		{"propagated", "upstream-3f2a.1", true},
+		{"too long", strings.Repeat("a", maxIDLength+1), false},
+		{"with spaces", "a b", false},
+		{"with newline", "a\nmsg=forged", false},
+		{"non ASCII", "idé", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _ := newHandler(t, func(w http.ResponseWriter, r *http.Request) {})
+			r := httptest.NewRequest(http.MethodGet, "/snippets/abc", nil)
+			r.Header.Set(Header, tt.header)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			got := w.Header().Get(Header)
+			if (got == tt.header) != tt.kept || got == "" {
+				t.Errorf("request ID = %q for header %q, kept = %v", got, tt.header, tt.kept)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Quiet(t *testing.T) {
+	handler, buf := newHandler(t, func(w http.ResponseWriter, r *http.Request) {})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	recs := records(t, buf)
+	if len(recs) != 1 || recs[0]["level"] != "DEBUG" {
+		t.Errorf("probe logged as %v, want a single debug record", recs)
+	}
+}
+
+func TestMiddleware_Aborted(t *testing.T) {
+	handler, buf := newHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic(http.ErrAbortHandler)
+	})
+
+	func() {
+		defer func() {
+			if recover() != http.ErrAbortHandler {
+				t.Error("panic was not passed on")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/snippets/abc", nil))
+	}()
+
+	recs := records(t, buf)
+	if len(recs) != 1 || recs[0]["msg"] != "request aborted" || recs[0]["level"] != "WARN" {
+		t.Errorf("aborted request logged as %v", recs)
+	}
+}
+
+func TestFromContext_OutsideRequest(t *testing.T) {
+	ctx := httptest.NewRequest(http.MethodGet, "/", nil).Context()
+	if FromContext(ctx) != slog.Default() || RequestID(ctx) != "" {
+		t.Error("outside a request want the default logger and no request ID")
+	}
+}
@@ -0,0 +1,119 @@
+// Package sealer converts snippet content to the bytes stored in
+// snippet_contents.encrypted_content and back.
+//
+// Content is compressed, then encrypted, behind a small header:
+//
+//	magic "SN" | version | compress.Algorithm | nonce | AES-GCM ciphertext
+//
+// The header is authenticated as additional data, so it can't be altered
+// without failing decryption. Content stored before the header existed is
+// plain AES-GCM output; Open tells the two apart by whether decryption with
+// the header succeeds, never by the header bytes alone, since a legacy
+// nonce may start with the magic by chance.
+//
+// Content shared by several snippets is sealed with its content hash
+// appended to the additional data, so a shared body only opens under the
+// hash it was stored for.
+//
+// Content too large to hold in memory is sealed in chunks by SealStream,
+// under a header of its own version. Open reads both formats.
+package sealer
+
+import (
+	"errors"
+	"fmt"
+
+	"snippets.adelh.dev/app/internal/compress"
+	"snippets.adelh.dev/app/internal/encryption"
+)
+
+const (
+	magic0, magic1 = 'S', 'N'
+	version        = 1
+	headerLen      = 4
+)
+
+// ErrTooLarge is returned by Open when the content exceeds the size limit
+// once decompressed.
+var ErrTooLarge = compress.ErrTooLarge
+
+type Sealer struct {
+	enc *encryption.Service
+	// maxSize bounds the decompressed content.
+	maxSize int64
+}
+
+// New returns a Sealer that refuses to open content larger than maxSize
+// bytes.
+func New(enc *encryption.Service, maxSize int64) *Sealer {
+	return &Sealer{enc: enc, maxSize: maxSize}
+}
+
+// Seal compresses content with the algorithm compress.Choose picks, falling
+// back to none if that doesn't make it smaller, and encrypts it.
+func (s *Sealer) Seal(content []byte) ([]byte, error) {
+	return s.seal(content, nil)
+}
+
+// SealShared seals content shared between snippets, bound to its hash.
+func (s *Sealer) SealShared(content, hash []byte) ([]byte, error) {
+	return s.seal(content, hash)
+}
+
+func (s *Sealer) seal(content, hash []byte) ([]byte, error) {
+	algo := compress.Choose(content)
+	data, err := compress.Compress(algo, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress content: %w", err)
+	}
+	if len(data) >= len(content) {
+		algo, data = compress.None, content
+	}
+
+	header := []byte{magic0, magic1, version, byte(algo)}
+	ciphertext, err := s.enc.EncryptWithAAD(data, append(header[:headerLen:headerLen], hash...))
+	if err != nil {
+		return nil, err
+	}
+	return append(header, ciphertext...), nil
+}
+
+// Open decrypts and decompresses stored content, legacy content included.
+func (s *Sealer) Open(stored []byte) ([]byte, error) {
+	content, err := s.open(stored, nil)
+	if errors.Is(err, errNotSealed) {
+		return s.enc.Decrypt(stored)
+	}
+	return content, err
+}
+
+// OpenShared opens content sealed by SealShared with the same hash.
+func (s *Sealer) OpenShared(stored, hash []byte) ([]byte, error) {
+	content, err := s.open(stored, hash)
+	if errors.Is(err, errNotSealed) {
+		return nil, errors.New("shared content does not match its hash")
+	}
+	return content, err
+}
+
+// errNotSealed is returned by open for content without a valid header.
+var errNotSealed = errors.New("content is not sealed")
+
+func (s *Sealer) open(stored, hash []byte) ([]byte, error) {
+	if len(stored) > headerLen && isStream(stored) {
+		return s.openStreamed(stored, hash)
+	}
+	if len(stored) <= headerLen || stored[0] != magic0 || stored[1] != magic1 || stored[2] != version {
+		return nil, errNotSealed
+	}
+	header := stored[:headerLen]
+	data, err := s.enc.DecryptWithAAD(stored[headerLen:], append(header[:headerLen:headerLen], hash...))
+	if err != nil {
+		return nil, errNotSealed
+	}
+	content, err := compress.Decompress(compress.Algorithm(header[3]), data, s.maxSize)
+	if err != nil && !errors.Is(err, compress.ErrTooLarge) {
+		err = fmt.Errorf("failed to decompress content: %w", err)
+	}
+	return content, err
+}
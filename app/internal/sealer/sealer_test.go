@@ -0,0 +1,295 @@
+package sealer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"snippets.adelh.dev/app/internal/compress"
+	"snippets.adelh.dev/app/internal/encryption"
+)
+
+func newSealer(t *testing.T, maxSize int64) (*Sealer, *encryption.Service) {
+	t.Helper()
+	enc, err := encryption.NewService("MTIzNDU2Nzg5MDEyMzQ1Ng==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(enc, maxSize), enc
+}
+
+func TestSealOpen(t *testing.T) {
+	e, _ := newSealer(t, 1<<20)
+
+	tests := []struct {
+		name string
+		data []byte
+		algo compress.Algorithm
+	}{
+		{"empty", []byte{}, compress.None},
+		{"short", []byte("hello world"), compress.None},
+		{"log", []byte(strings.Repeat("GET /health 200 3ms\n", 100)), compress.Gzip},
+		{"large log", []byte(strings.Repeat("level=info msg=\"request served\" status=200\n", 2000)), compress.Zstd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := e.Seal(tt.data)
+			if err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+			if got := compress.Algorithm(stored[3]); got != tt.algo {
+				t.Errorf("stored with %s, want %s", got, tt.algo)
+			}
+			if tt.algo != compress.None && len(stored) >= len(tt.data)/5 {
+				t.Errorf("stored %d bytes as %d, want it compressed", len(tt.data), len(stored))
+			}
+
+			got, err := e.Open(stored)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("Open = %q, want %q", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestOpen_Legacy(t *testing.T) {
+	e, enc := newSealer(t, 1<<20)
+	data := []byte("stored before compression")
+
+	stored, err := enc.Encrypt(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a legacy nonce can start like a header by chance
+	block, err := aes.NewCipher([]byte("1234567890123456"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := []byte("SN\x01\x02-nonce--")
+	lookalike := gcm.Seal(nonce, nonce, data, nil)
+
+	for _, blob := range [][]byte{stored, lookalike} {
+		got, err := e.Open(blob)
+		if err != nil {
+			t.Fatalf("Open(legacy): %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Open(legacy) = %q, want %q", got, data)
+		}
+	}
+}
+
+func TestOpen_TamperedHeader(t *testing.T) {
+	e, _ := newSealer(t, 1<<20)
+	stored, err := e.Seal([]byte(strings.Repeat("GET /health 200 3ms\n", 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored[3] = byte(compress.None)
+	if _, err := e.Open(stored); err == nil {
+		t.Error("Open with a modified header succeeded")
+	}
+}
+
+func TestOpen_SizeLimit(t *testing.T) {
+	big, _ := newSealer(t, 32<<20)
+	small, _ := newSealer(t, 1<<20)
+
+	// 8 MiB of zeros seal to a few KiB
+	stored, err := big.Seal(make([]byte, 8<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) > 64<<10 {
+		t.Fatalf("stored size = %d, want it compressed", len(stored))
+	}
+
+	if _, err := small.Open(stored); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Open error = %v, want ErrTooLarge", err)
+	}
+	if _, err := big.Open(stored); err != nil {
+		t.Errorf("Open within the limit: %v", err)
+	}
+}
+
+func TestSealShared(t *testing.T) {
+	e, _ := newSealer(t, 1<<20)
+	content := []byte(strings.Repeat("panic: runtime error: index out of range\n", 50))
+	hash := []byte("hash of the content")
+
+	stored, err := e.SealShared(content, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := e.OpenShared(stored, hash)
+	if err != nil {
+		t.Fatalf("OpenShared: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("OpenShared = %q, want %q", got, content)
+	}
+
+	// the body is bound to its hash
+	if _, err := e.OpenShared(stored, []byte("another hash")); err == nil {
+		t.Error("OpenShared with another hash succeeded")
+	}
+	if _, err := e.Open(stored); err == nil {
+		t.Error("Open of shared content succeeded")
+	}
+	unshared, err := e.Seal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.OpenShared(unshared, hash); err == nil {
+		t.Error("OpenShared of unshared content succeeded")
+	}
+}
+
+func sealStream(t *testing.T, e *Sealer, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := e.SealStream(&buf)
+	if _, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(content))); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openStream(e *Sealer, stored, hash []byte) ([]byte, error) {
+	r, err := e.OpenStream(bytes.NewReader(stored), hash)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestSealStream(t *testing.T) {
+	e, _ := newSealer(t, 1<<20)
+	random := make([]byte, 300<<10)
+	rand.Read(random)
+
+	tests := []struct {
+		name string
+		data []byte
+		algo compress.Algorithm
+	}{
+		{"empty", []byte{}, compress.None},
+		{"short", []byte("hello world"), compress.None},
+		{"log", []byte(strings.Repeat("GET /health 200 3ms\n", 100)), compress.Gzip},
+		{"large log", []byte(strings.Repeat("level=info msg=\"request served\" status=200\n", 20000)), compress.Zstd},
+		{"random", random, compress.None},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := sealStream(t, e, tt.data)
+			if stored[2] != streamVersion {
+				t.Fatalf("stored with version %d, want %d", stored[2], streamVersion)
+			}
+			if got := compress.Algorithm(stored[3]); got != tt.algo {
+				t.Errorf("stored with %s, want %s", got, tt.algo)
+			}
+
+			got, err := openStream(e, stored, nil)
+			if err != nil {
+				t.Fatalf("OpenStream: %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("OpenStream = %d bytes, want %d", len(got), len(tt.data))
+			}
+			got, err = e.Open(stored)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("Open = %d bytes, want %d", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestOpenStream_Formats(t *testing.T) {
+	e, enc := newSealer(t, 1<<20)
+	data := []byte(strings.Repeat("GET /health 200 3ms\n", 100))
+	hash := []byte("hash of the content")
+
+	sealed, err := e.Seal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := e.SealShared(data, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := enc.Encrypt(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a legacy nonce can start like a stream header by chance
+	block, _ := aes.NewCipher([]byte("1234567890123456"))
+	gcm, _ := cipher.NewGCM(block)
+	nonce := []byte("SN\x02\x00-nonce--")
+	lookalike := gcm.Seal(nonce, nonce, data, nil)
+
+	for name, tc := range map[string]struct {
+		stored, hash []byte
+	}{
+		"sealed":    {sealed, nil},
+		"shared":    {shared, hash},
+		"legacy":    {legacy, nil},
+		"lookalike": {lookalike, nil},
+	} {
+		got, err := openStream(e, tc.stored, tc.hash)
+		if err != nil {
+			t.Errorf("%s: OpenStream: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: OpenStream = %q, want %q", name, got, data)
+		}
+	}
+}
+
+func TestOpenStream_Large(t *testing.T) {
+	e, _ := newSealer(t, 1<<20)
+	data := make([]byte, 3<<20)
+	rand.Read(data)
+	stored := sealStream(t, e, data)
+
+	// streamed reads aren't bound by the size limit, whole ones are
+	got, err := openStream(e, stored, nil)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("OpenStream = %d bytes, %v, want %d bytes", len(got), err, len(data))
+	}
+	if _, err := e.Open(stored); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Open error = %v, want ErrTooLarge", err)
+	}
+
+	// a cut off stream fails once the reader reaches the cut
+	cut := stored[:len(stored)/2]
+	got, err = openStream(e, cut, nil)
+	if !errors.Is(err, encryption.ErrStreamCorrupt) && !errors.Is(err, encryption.ErrStreamTruncated) {
+		t.Errorf("OpenStream of a cut off stream: error = %v, want a stream error", err)
+	}
+	if !bytes.Equal(got, data[:len(got)]) {
+		t.Error("OpenStream of a cut off stream returned wrong content")
+	}
+}
@@ -0,0 +1,187 @@
+package sealer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"snippets.adelh.dev/app/internal/compress"
+	"snippets.adelh.dev/app/internal/encryption"
+)
+
+// Streamed content has its own version, the compressed content follows the
+// header as an encryption stream that authenticates the header with every
+// chunk:
+//
+//	magic "SN" | 2 | compress.Algorithm | encryption.EncryptStream output
+const streamVersion = 2
+
+// sealedOverhead is the most sealing adds to content that doesn't
+// compress: the header, the nonce and the tag.
+const sealedOverhead = headerLen + 12 + 16
+
+// SealStream returns a writer that seals the content written to it to w,
+// holding no more than a chunk of it at a time. The compression is chosen
+// from the beginning of the content. Close completes the stream, it does
+// not close w.
+func (s *Sealer) SealStream(w io.Writer) io.WriteCloser {
+	return &streamSealer{s: s, w: w, head: make([]byte, 0, encryption.StreamChunkSize)}
+}
+
+type streamSealer struct {
+	s *Sealer
+	w io.Writer
+	// head holds the beginning of the content until the compression is
+	// chosen, zw and enc are nil until then.
+	head []byte
+	zw   io.WriteCloser
+	enc  io.WriteCloser
+}
+
+func (ss *streamSealer) Write(p []byte) (int, error) {
+	if ss.zw != nil {
+		return ss.zw.Write(p)
+	}
+	n := copy(ss.head[len(ss.head):cap(ss.head)], p)
+	ss.head = ss.head[:len(ss.head)+n]
+	if len(ss.head) < cap(ss.head) {
+		return n, nil
+	}
+	if err := ss.start(); err != nil {
+		return n, err
+	}
+	m, err := ss.zw.Write(p[n:])
+	return n + m, err
+}
+
+func (ss *streamSealer) start() error {
+	algo := compress.Choose(ss.head)
+	header := []byte{magic0, magic1, streamVersion, byte(algo)}
+	if _, err := ss.w.Write(header); err != nil {
+		return err
+	}
+	enc, err := ss.s.enc.EncryptStream(ss.w, header)
+	if err != nil {
+		return err
+	}
+	zw, err := compress.NewWriter(algo, enc)
+	if err != nil {
+		return fmt.Errorf("failed to compress content: %w", err)
+	}
+	ss.enc, ss.zw = enc, zw
+	_, err = zw.Write(ss.head)
+	ss.head = nil
+	return err
+}
+
+func (ss *streamSealer) Close() error {
+	if ss.zw == nil {
+		if err := ss.start(); err != nil {
+			return err
+		}
+	}
+	if err := ss.zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress content: %w", err)
+	}
+	return ss.enc.Close()
+}
+
+// OpenStream returns a reader of the content stored in r, hash is the
+// content hash of a shared body and nil otherwise. Content sealed by
+// SealStream is decrypted as it is read, any other content is read whole
+// and opened like Open and OpenShared do, it was sealed within maxSize.
+//
+// A stream that fails authentication later on fails the read: the content
+// read until then must not be taken as complete.
+func (s *Sealer) OpenStream(r io.Reader, hash []byte) (io.ReadCloser, error) {
+	header := make([]byte, headerLen)
+	n, err := io.ReadFull(r, header)
+	if err == nil && isStream(header) {
+		rec := &recorder{r: r}
+		content, err := s.openStream(header, rec, hash)
+		if !errors.Is(err, errNotSealed) {
+			rec.buf, rec.done = nil, true
+			return content, err
+		}
+		// legacy content starting like a header, read it again
+		r = io.MultiReader(bytes.NewReader(rec.buf), r)
+	} else if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	limit := s.maxSize + sealedOverhead
+	stored, err := io.ReadAll(io.LimitReader(io.MultiReader(bytes.NewReader(header[:n]), r), limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(stored)) > limit {
+		return nil, ErrTooLarge
+	}
+
+	var content []byte
+	if hash != nil {
+		content, err = s.OpenShared(stored, hash)
+	} else {
+		content, err = s.Open(stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func isStream(header []byte) bool {
+	return header[0] == magic0 && header[1] == magic1 && header[2] == streamVersion
+}
+
+// openStream returns errNotSealed if the first chunk doesn't authenticate,
+// the content is then most likely legacy content.
+func (s *Sealer) openStream(header []byte, r io.Reader, hash []byte) (io.ReadCloser, error) {
+	plain := bufio.NewReader(s.enc.DecryptStream(r, append(header[:headerLen:headerLen], hash...)))
+	if _, err := plain.Peek(1); err != nil && !errors.Is(err, io.EOF) {
+		if errors.Is(err, encryption.ErrStreamCorrupt) || errors.Is(err, encryption.ErrStreamTruncated) {
+			return nil, errNotSealed
+		}
+		return nil, err
+	}
+	content, err := compress.NewReader(compress.Algorithm(header[3]), plain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress content: %w", err)
+	}
+	return content, nil
+}
+
+// openStreamed opens streamed content held in memory, within maxSize.
+func (s *Sealer) openStreamed(stored, hash []byte) ([]byte, error) {
+	r, err := s.openStream(stored[:headerLen], bytes.NewReader(stored[headerLen:]), hash)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(io.LimitReader(r, s.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open content: %w", err)
+	}
+	if int64(len(content)) > s.maxSize {
+		return nil, ErrTooLarge
+	}
+	return content, nil
+}
+
+// recorder keeps a copy of what is read through it until done.
+type recorder struct {
+	r    io.Reader
+	buf  []byte
+	done bool
+}
+
+func (rec *recorder) Read(p []byte) (int, error) {
+	n, err := rec.r.Read(p)
+	if !rec.done {
+		rec.buf = append(rec.buf, p[:n]...)
+	}
+	return n, err
+}
@@ -0,0 +1,80 @@
+// Package slug validates the vanity names snippets can be addressed by in
+// addition to their public ID.
+package slug
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MinLen is the shortest slug, shorter names are too easy to squat.
+	MinLen = 3
+	// MaxLen is the longest slug the database column holds.
+	MaxLen = 64
+)
+
+// reserved holds names that are, or may become, routes or otherwise
+// misleading as a link to a user's snippet.
+var reserved = map[string]bool{
+	"about":     true,
+	"admin":     true,
+	"api":       true,
+	"assets":    true,
+	"auth":      true,
+	"config":    true,
+	"delete":    true,
+	"docs":      true,
+	"edit":      true,
+	"health":    true,
+	"healthz":   true,
+	"help":      true,
+	"login":     true,
+	"logout":    true,
+	"metrics":   true,
+	"new":       true,
+	"null":      true,
+	"raw":       true,
+	"readyz":    true,
+	"root":      true,
+	"settings":  true,
+	"signup":    true,
+	"snippet":   true,
+	"snippets":  true,
+	"static":    true,
+	"status":    true,
+	"support":   true,
+	"system":    true,
+	"undefined": true,
+	"www":       true,
+}
+
+// IsReserved reports whether s is a reserved name.
+func IsReserved(s string) bool {
+	return reserved[s]
+}
+
+// Validate checks s against the slug character policy: MinLen to MaxLen
+// lowercase ASCII letters, digits and single hyphens, starting and ending
+// with a letter or digit, and not a reserved name.
+func Validate(s string) error {
+	if len(s) < MinLen || len(s) > MaxLen {
+		return fmt.Errorf("slug must be %d to %d characters long", MinLen, MaxLen)
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return fmt.Errorf("slug may only contain lowercase letters, digits and hyphens, got %q", c)
+		}
+	}
+	if s[0] == '-' || s[len(s)-1] == '-' {
+		return errors.New("slug must start and end with a letter or digit")
+	}
+	if strings.Contains(s, "--") {
+		return errors.New("slug must not contain consecutive hyphens")
+	}
+	if IsReserved(s) {
+		return fmt.Errorf("slug %q is reserved", s)
+	}
+	return nil
+}
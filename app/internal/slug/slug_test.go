@@ -0,0 +1,36 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		slug    string
+		wantErr bool
+	}{
+		{"deploy-runbook", false},
+		{"abc", false},
+		{"2024-release-notes", false},
+		{strings.Repeat("a", MaxLen), false},
+		{"ab", true},
+		{strings.Repeat("a", MaxLen+1), true},
+		{"Deploy-Runbook", true},
+		{"deploy_runbook", true},
+		{"deploy runbook", true},
+		{"deploy/runbook", true},
+		{"café-notes", true},
+		{"-deploy", true},
+		{"deploy-", true},
+		{"deploy--runbook", true},
+		{"admin", true},
+		{"snippets", true},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.slug)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) error = %v, wantErr %v", tt.slug, err, tt.wantErr)
+		}
+	}
+}